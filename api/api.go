@@ -0,0 +1,130 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package api allows Go programs to deploy and manage sandboxes.
+// Unlike the command line client, the functions in this package never
+// terminate the program: every failure is returned as an error.
+package api
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/ops"
+	"github.com/datacharmer/dbdeployer/sandbox"
+)
+
+// DeployOptions define a single sandbox, or the nodes of a replication sandbox.
+// Only Version is required. Empty fields get the same defaults of "dbdeployer deploy".
+type DeployOptions = ops.DeployOptions
+
+// ReplicationOptions define a replication sandbox
+type ReplicationOptions = ops.ReplicationOptions
+
+// Sandbox describes a deployed sandbox
+type Sandbox struct {
+	Name    string   `json:"name"`
+	Dir     string   `json:"dir"`
+	Type    string   `json:"type"`
+	Version string   `json:"version"`
+	Flavor  string   `json:"flavor"`
+	Port    []int    `json:"port"`
+	Nodes   []string `json:"nodes,omitempty"`
+}
+
+// NewSandboxDef builds the definition of a sandbox from the deployment options.
+// It returns the definition and the name of the binaries directory
+func NewSandboxDef(options DeployOptions) (sandbox.SandboxDef, string, error) {
+	return ops.NewSandboxDef(options)
+}
+
+// describeSandbox returns the description of a deployed sandbox
+func describeSandbox(sandboxDir string) (Sandbox, error) {
+	sbDesc, err := common.ReadSandboxDescription(sandboxDir)
+	if err != nil {
+		return Sandbox{}, err
+	}
+	result := Sandbox{
+		Name:    path.Base(sandboxDir),
+		Dir:     sandboxDir,
+		Type:    sbDesc.SBType,
+		Version: sbDesc.Version,
+		Flavor:  sbDesc.Flavor,
+		Port:    sbDesc.Port,
+	}
+	catalog, err := defaults.ReadCatalog()
+	if err == nil {
+		item, found := catalog[sandboxDir]
+		if found {
+			result.Port = item.Port
+			result.Nodes = item.Nodes
+		}
+	}
+	return result, nil
+}
+
+// DeploySingle deploys a single sandbox
+func DeploySingle(options DeployOptions) (Sandbox, error) {
+	sandboxDir, err := ops.DeploySingle(options)
+	if err != nil {
+		return Sandbox{}, err
+	}
+	return describeSandbox(sandboxDir)
+}
+
+// DeployReplication deploys a replication sandbox
+func DeployReplication(options ReplicationOptions) (Sandbox, error) {
+	sandboxDir, err := ops.DeployReplication(options)
+	if err != nil {
+		return Sandbox{}, err
+	}
+	return describeSandbox(sandboxDir)
+}
+
+// Delete stops a sandbox and removes it, together with its catalog entry and the proxies attached to it
+func Delete(sandboxDir string) error {
+	return ops.DeleteSandbox(sandboxDir, false)
+}
+
+// Start starts all the nodes of a sandbox
+func Start(sandboxDir string) error {
+	return ops.StartSandbox(sandboxDir)
+}
+
+// Stop stops all the nodes of a sandbox
+func Stop(sandboxDir string) error {
+	return ops.StopSandbox(sandboxDir)
+}
+
+// Status returns the live state of all the nodes of a sandbox
+func Status(sandboxDir string) (ops.SandboxHealth, error) {
+	if !common.DirExists(sandboxDir) {
+		return ops.SandboxHealth{}, fmt.Errorf(globals.ErrDirectoryNotFound, sandboxDir)
+	}
+	sb, err := describeSandbox(sandboxDir)
+	if err != nil {
+		return ops.SandboxHealth{}, err
+	}
+	return ops.SandboxHealthCheck(sandboxDir, defaults.SandboxItem{
+		SBType:  sb.Type,
+		Version: sb.Version,
+		Flavor:  sb.Flavor,
+		Port:    sb.Port,
+		Nodes:   sb.Nodes,
+	}), nil
+}
@@ -0,0 +1,87 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"path"
+	"testing"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/sandbox"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeployWithMockBinaries(t *testing.T) {
+	require.NoError(t, sandbox.SetMockEnvironment(sandbox.DefaultMockDir))
+	defer func() { _ = sandbox.RemoveMockEnvironment(sandbox.DefaultMockDir) }()
+	require.NoError(t, sandbox.CreateMockVersion("8.0.35"))
+	require.NoError(t, sandbox.CreateMockVersion("8.0.36"))
+	sandboxHome := defaults.Defaults().SandboxHome
+
+	// Failures are returned as errors
+	_, err := DeploySingle(DeployOptions{})
+	require.Error(t, err)
+	_, err = DeploySingle(DeployOptions{Version: "9.9.9"})
+	require.Error(t, err)
+	_, err = DeploySingle(DeployOptions{Version: "9.9"})
+	require.Error(t, err)
+	_, err = DeploySingle(DeployOptions{Version: "8.0.36", DbUser: "root"})
+	require.Error(t, err)
+	_, err = DeployReplication(ReplicationOptions{DeployOptions: DeployOptions{Version: "8.0.36"}, Topology: "no-such-topology"})
+	require.Error(t, err)
+	_, err = DeployReplication(ReplicationOptions{DeployOptions: DeployOptions{Version: "8.0.36"}, SinglePrimary: true})
+	require.Error(t, err)
+
+	single, err := DeploySingle(DeployOptions{Version: "8.0", Gtid: true})
+	require.NoError(t, err)
+	require.Equal(t, "msb_8_0_36", single.Name)
+	require.Equal(t, path.Join(sandboxHome, "msb_8_0_36"), single.Dir)
+	require.Equal(t, "8.0.36", single.Version)
+	require.Equal(t, globals.SbTypeSingle, single.Type)
+	require.Equal(t, common.MySQLFlavor, single.Flavor)
+	require.NotEmpty(t, single.Port)
+	require.True(t, common.DirExists(path.Join(single.Dir, globals.DataDirName)))
+
+	require.NoError(t, Stop(single.Dir))
+	require.NoError(t, Start(single.Dir))
+	status, err := Status(single.Dir)
+	require.NoError(t, err)
+	require.Equal(t, single.Name, status.Name)
+	require.Len(t, status.Nodes, 1)
+
+	_, err = Status(path.Join(sandboxHome, "no_such_sandbox"))
+	require.Error(t, err)
+
+	replication, err := DeployReplication(ReplicationOptions{
+		DeployOptions: DeployOptions{Version: "8.0.35", DirName: "repl_test"},
+		Nodes:         2,
+	})
+	require.NoError(t, err)
+	require.Equal(t, path.Join(sandboxHome, "repl_test"), replication.Dir)
+	require.Equal(t, []string{"master", "node1"}, replication.Nodes)
+
+	for _, sb := range []Sandbox{single, replication} {
+		require.NoError(t, Delete(sb.Dir))
+		require.False(t, common.DirExists(sb.Dir))
+		catalog, err := defaults.ReadCatalog()
+		require.NoError(t, err)
+		_, found := catalog[sb.Dir]
+		require.False(t, found)
+	}
+	require.Error(t, Delete(single.Dir))
+}
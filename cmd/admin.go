@@ -204,15 +204,34 @@ func DryRunCmd(cmd string, dryRun bool) (string, error) {
 	return common.RunCmd(cmd)
 }
 
-func upgradeSandbox(sandboxDir, oldSandbox, newSandbox string, verbose, dryRun bool) error {
-	var possibleUpgrades = map[string]string{
-		"5.0": "5.1",
-		"5.1": "5.5",
-		"5.5": "5.6",
-		"5.6": "5.7",
-		"5.7": "8.0",
-		"8.0": "8.0",
+// checkUpgradePath makes sure that the old series can be upgraded to the new one,
+// following the paths listed in the release series table.
+// Flavors without a release series table can be upgraded to any higher version
+func checkUpgradePath(flavor, oldSeries, newSeries string, oldRev, newRev int) error {
+	if oldSeries == newSeries {
+		if oldRev < newRev {
+			return nil
+		}
+		return fmt.Errorf("version '%s' can only be upgraded to a higher revision within the same series", oldSeries)
+	}
+	if _, hasSeries := common.AllReleaseSeries[flavor]; !hasSeries {
+		return nil
+	}
+	series, err := common.FindReleaseSeries(flavor, oldSeries)
+	if err != nil {
+		return err
+	}
+	if len(series.UpgradeTo) == 0 {
+		return fmt.Errorf("no upgrade path is known for version '%s', other than a higher revision", oldSeries)
 	}
+	if !series.CanUpgradeTo(newSeries) {
+		return fmt.Errorf("version '%s' can only be upgraded to %v or to the same version with a higher revision",
+			oldSeries, series.UpgradeTo)
+	}
+	return nil
+}
+
+func upgradeSandbox(sandboxDir, oldSandbox, newSandbox string, verbose, dryRun bool) error {
 	if dryRun {
 		verbose = true
 	}
@@ -241,24 +260,15 @@ func upgradeSandbox(sandboxDir, oldSandbox, newSandbox string, verbose, dryRun b
 	if err != nil {
 		return errors.Wrapf(err, "error reading old sandbox description")
 	}
-	mysqlUpgrade := path.Join(newSbdesc.Basedir, "bin", "mysql_upgrade")
-	if !common.ExecExists(mysqlUpgrade) {
-		_ = common.WriteString("", path.Join(newSandbox, "no_upgrade"))
-		return errors.Errorf("mysql_upgrade not found in %s. Upgrade is not possible", newSbdesc.Basedir)
-	}
 	newVersionList, err := common.VersionToList(newSbdesc.Version)
 	if err != nil {
 		return errors.Wrapf(err, "error converting new sandbox version to major/minor/rev")
 	}
-	newMajor := newVersionList[0]
-	newMinor := newVersionList[1]
 	newRev := newVersionList[2]
 	oldVersionList, err := common.VersionToList(oldSbdesc.Version)
 	if err != nil {
 		return errors.Wrapf(err, "error converting old sandbox version to major/minor/rev")
 	}
-	oldMajor := oldVersionList[0]
-	oldMinor := oldVersionList[1]
 	oldRev := oldVersionList[2]
 	newUpgradeVersion := fmt.Sprintf("%d.%d", newVersionList[0], newVersionList[1])
 	oldUpgradeVersion := fmt.Sprintf("%d.%d", oldVersionList[0], oldVersionList[1])
@@ -276,20 +286,17 @@ func upgradeSandbox(sandboxDir, oldSandbox, newSandbox string, verbose, dryRun b
 	if err != nil {
 		return errors.Wrapf(err, "error detecting upgrade capability")
 	}
-	canBeUpgraded := false
-	if oldMajor < newMajor {
-		canBeUpgraded = true
-	} else {
-		if oldMajor == newMajor && oldMinor < newMinor {
-			canBeUpgraded = true
-		} else {
-			if oldMajor == newMajor && oldMinor == newMinor && oldRev < newRev {
-				canBeUpgraded = true
-			}
+	// Since 8.0.16 the server upgrades itself, and mysql_upgrade is no longer shipped in recent tarballs
+	if !upgradeWithServer {
+		mysqlUpgrade := path.Join(newSbdesc.Basedir, "bin", "mysql_upgrade")
+		if !common.ExecExists(mysqlUpgrade) {
+			_ = common.WriteString("", path.Join(newSandbox, "no_upgrade"))
+			return errors.Errorf("mysql_upgrade not found in %s. Upgrade is not possible", newSbdesc.Basedir)
 		}
 	}
-	if !canBeUpgraded {
-		return fmt.Errorf("version '%s' can only be upgraded to '%s' or to the same version with a higher revision", oldUpgradeVersion, possibleUpgrades[oldUpgradeVersion])
+	err = checkUpgradePath(oldSbdesc.Flavor, oldUpgradeVersion, newUpgradeVersion, oldRev, newRev)
+	if err != nil {
+		return err
 	}
 	newSandboxOldData := path.Join(newSandbox, globals.DataDirName+"-"+newSandbox)
 	if common.DirExists(newSandboxOldData) {
@@ -383,6 +390,15 @@ func runUpgradeSandbox(cmd *cobra.Command, args []string) {
 	}
 }
 
+// capabilityRecord is the CSV output of a flavor feature
+type capabilityRecord struct {
+	Flavor      string `json:"flavor"`
+	Feature     string `json:"feature"`
+	Description string `json:"description"`
+	Since       string `json:"since"`
+	Until       string `json:"until"`
+}
+
 func showCapabilities(cmd *cobra.Command, args []string) {
 	flavor := ""
 	version := ""
@@ -392,7 +408,16 @@ func showCapabilities(cmd *cobra.Command, args []string) {
 	if len(args) > 1 {
 		version = args[1]
 	}
-	for fl, capability := range common.AllCapabilities {
+	outputFormat, isStructured := structuredOutputFormat(cmd)
+	var flavors []string
+	for fl := range common.AllCapabilities {
+		flavors = append(flavors, fl)
+	}
+	sort.Strings(flavors)
+	var capabilitiesList []common.Capabilities
+	var records []capabilityRecord
+	for _, fl := range flavors {
+		capability := common.AllCapabilities[fl]
 		if flavor == "" || (flavor != "" && flavor == fl) {
 			var features = make(common.FeatureList)
 			var featureNames []string
@@ -407,12 +432,30 @@ func showCapabilities(cmd *cobra.Command, args []string) {
 				featureNames = append(featureNames, featureName)
 				features[featureName] = capability
 			}
+			sort.Strings(featureNames)
+			if isStructured {
+				capabilitiesList = append(capabilitiesList,
+					common.Capabilities{Flavor: fl, Description: capability.Description, Features: features})
+				for _, fn := range featureNames {
+					untilVers := ""
+					if features[fn].Until != nil {
+						untilVers = common.IntSliceToDottedString(features[fn].Until)
+					}
+					records = append(records, capabilityRecord{
+						Flavor:      fl,
+						Feature:     fn,
+						Description: features[fn].Description,
+						Since:       common.IntSliceToDottedString(features[fn].Since),
+						Until:       untilVers,
+					})
+				}
+				continue
+			}
 			if capability.Description != fl && capability.Description != "" {
 				fmt.Printf("## %s (%s)\n", fl, capability.Description)
 			} else {
 				fmt.Printf("## %s\n", fl)
 			}
-			sort.Strings(featureNames)
 			for _, fn := range featureNames {
 				capability := features[fn]
 				minVers := common.IntSliceToDottedString(capability.Since)
@@ -425,6 +468,12 @@ func showCapabilities(cmd *cobra.Command, args []string) {
 			fmt.Println()
 		}
 	}
+	switch outputFormat {
+	case globals.OutputCsv:
+		printStructured(outputFormat, records)
+	case globals.OutputJson, globals.OutputYaml:
+		printStructured(outputFormat, capabilitiesList)
+	}
 }
 
 var (
@@ -460,7 +509,9 @@ Users can still delete locked sandboxes manually.`,
 		Short: "Upgrades a sandbox to a newer version",
 		Long: `Upgrades a sandbox to a newer version.
 The sandbox with the new version must exist already.
-The data directory of the old sandbox will be moved to the new one.`,
+The data directory of the old sandbox will be moved to the new one.
+The new version must be in the same release series with a higher revision,
+or in a series that the old one can be upgraded to (e.g. 8.0 to 8.4 LTS).`,
 		Example:     "dbdeployer admin upgrade msb_8_0_11 msb_8_0_12",
 		Run:         runUpgradeSandbox,
 		Args:        SandboxNames(2),
@@ -0,0 +1,114 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/sandbox"
+)
+
+func cacheEntryStatus(entry sandbox.DatadirCacheEntry) string {
+	if entry.Stale {
+		return "stale"
+	}
+	return "valid"
+}
+
+func runCacheList(cmd *cobra.Command, args []string) error {
+	outputFormat, isStructured := structuredOutputFormat(cmd)
+	entries, err := sandbox.ListDatadirCache()
+	if err != nil {
+		return err
+	}
+	if isStructured {
+		if entries == nil {
+			entries = []sandbox.DatadirCacheEntry{}
+		}
+		printStructured(outputFormat, entries)
+		return nil
+	}
+	if len(entries) == 0 {
+		fmt.Printf("No cached data directories in %s\n", common.ReplaceLiteralHome(sandbox.DatadirCacheDir()))
+		return nil
+	}
+	for _, entry := range entries {
+		fmt.Printf("%-16s %-8s %-12s %-6s %10d %s\n", entry.Key, entry.Flavor, entry.Version,
+			cacheEntryStatus(entry), entry.Size, entry.Created)
+	}
+	return nil
+}
+
+func runCachePurge(cmd *cobra.Command, args []string) error {
+	staleOnly, _ := cmd.Flags().GetBool(globals.StaleOnlyLabel)
+	removed, err := sandbox.PurgeDatadirCache(args, staleOnly)
+	if err != nil {
+		return err
+	}
+	for _, entry := range removed {
+		fmt.Printf("Removed cached data directory %s (%s %s)\n", entry.Key, entry.Flavor, entry.Version)
+	}
+	if len(removed) == 0 {
+		fmt.Println("No cached data directories removed")
+	}
+	return nil
+}
+
+var (
+	adminCacheCmd = &cobra.Command{
+		Use:   "cache",
+		Short: "Manages the cache of initialized data directories",
+		Long: `Deployments that use the option --datadir-cache copy the data directory from a cache
+instead of initializing the server. The cache has one entry for each combination of
+binaries and initialization options. An entry becomes stale when the server executables
+or the init_db template change, and it is rebuilt at the next deployment that needs it.
+Only the result of the server initialization is cached: users and grants are loaded
+into every sandbox at its first start, as usual.`,
+	}
+
+	adminCacheListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Lists the cached data directories",
+		Long: `Shows key, flavor, version, status (valid or stale), size in bytes,
+and creation time of every cached data directory.`,
+		Args: cobra.NoArgs,
+		RunE: runCacheList,
+	}
+
+	adminCachePurgeCmd = &cobra.Command{
+		Use:   "purge [key-prefix|version ...]",
+		Short: "Removes cached data directories",
+		Long: `Removes the cached data directories that match the given versions or key prefixes.
+Without arguments, removes all of them.`,
+		Example: `
+	$ dbdeployer admin cache purge
+	$ dbdeployer admin cache purge 8.0.36 8.4.0
+	$ dbdeployer admin cache purge --stale-only
+`,
+		RunE: runCachePurge,
+	}
+)
+
+func init() {
+	adminCmd.AddCommand(adminCacheCmd)
+	adminCacheCmd.AddCommand(adminCacheListCmd)
+	adminCacheCmd.AddCommand(adminCachePurgeCmd)
+	adminCachePurgeCmd.Flags().Bool(globals.StaleOnlyLabel, false, "Removes only the entries invalidated by a change of binaries or templates")
+}
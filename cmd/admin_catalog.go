@@ -0,0 +1,210 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/ops"
+)
+
+// catalogSandboxHomes returns the sandbox homes given as arguments, or the current one
+func catalogSandboxHomes(cmd *cobra.Command, args []string) ([]string, error) {
+	if len(args) == 0 {
+		sandboxHome, err := getAbsolutePathFromFlag(cmd, "sandbox-home")
+		if err != nil {
+			return nil, err
+		}
+		return []string{sandboxHome}, nil
+	}
+	var sandboxHomes []string
+	for _, arg := range args {
+		sandboxHome, err := common.AbsolutePath(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !common.DirExists(sandboxHome) {
+			return nil, fmt.Errorf("sandbox home %s not found", sandboxHome)
+		}
+		sandboxHomes = append(sandboxHomes, sandboxHome)
+	}
+	return sandboxHomes, nil
+}
+
+func printCatalogIssues(cmd *cobra.Command, issues []ops.CatalogIssue) {
+	outputFormat, isStructured := structuredOutputFormat(cmd)
+	if isStructured {
+		if issues == nil {
+			issues = []ops.CatalogIssue{}
+		}
+		printStructured(outputFormat, issues)
+		return
+	}
+	for _, issue := range issues {
+		status := ""
+		if issue.Repaired {
+			status = "(repaired)"
+		}
+		detail := ""
+		switch {
+		case issue.Catalog != "" && issue.Disk != "":
+			detail = fmt.Sprintf("catalog: %s - disk: %s", issue.Catalog, issue.Disk)
+		case issue.Catalog != "":
+			detail = fmt.Sprintf("catalog: %s", issue.Catalog)
+		case issue.Disk != "":
+			detail = fmt.Sprintf("disk: %s", issue.Disk)
+		}
+		fmt.Printf("%-16s %s %s %s\n", issue.Issue, common.ReplaceLiteralHome(issue.Sandbox), detail, status)
+	}
+}
+
+func runCatalogVerify(cmd *cobra.Command, args []string) error {
+	sandboxHomes, err := catalogSandboxHomes(cmd, args)
+	if err != nil {
+		return err
+	}
+	issues, err := ops.VerifyCatalog(sandboxHomes)
+	if err != nil {
+		return err
+	}
+	printCatalogIssues(cmd, issues)
+	if len(issues) > 0 {
+		common.Exitf(1, "%d catalog issues found", len(issues))
+	}
+	if _, isStructured := structuredOutputFormat(cmd); !isStructured {
+		fmt.Println("The catalog is consistent with the sandboxes on disk")
+	}
+	return nil
+}
+
+func runCatalogRepair(cmd *cobra.Command, args []string) error {
+	sandboxHomes, err := catalogSandboxHomes(cmd, args)
+	if err != nil {
+		return err
+	}
+	issues, err := ops.RepairCatalog(sandboxHomes)
+	if err != nil {
+		return err
+	}
+	printCatalogIssues(cmd, issues)
+	unrepaired := 0
+	for _, issue := range issues {
+		if !issue.Repaired {
+			unrepaired++
+		}
+	}
+	if unrepaired > 0 {
+		common.Exitf(1, "%d catalog issues could not be repaired", unrepaired)
+	}
+	if _, isStructured := structuredOutputFormat(cmd); !isStructured && len(issues) == 0 {
+		fmt.Println("The catalog is consistent with the sandboxes on disk")
+	}
+	return nil
+}
+
+func runCatalogRebuild(cmd *cobra.Command, args []string) error {
+	sandboxHomes, err := catalogSandboxHomes(cmd, args)
+	if err != nil {
+		return err
+	}
+	catalog, skipped, err := ops.RebuildCatalog(sandboxHomes)
+	if err != nil {
+		return err
+	}
+	outputFormat, isStructured := structuredOutputFormat(cmd)
+	if isStructured {
+		if catalog == nil {
+			catalog = defaults.SandboxCatalog{}
+		}
+		printStructured(outputFormat, catalog)
+		return nil
+	}
+	var names []string
+	for name := range catalog {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%-40s %-20s %s\n", common.ReplaceLiteralHome(name), catalog[name].SBType, catalog[name].Version)
+	}
+	fmt.Printf("Catalog rebuilt with %d sandboxes\n", len(catalog))
+	for _, issue := range skipped {
+		fmt.Printf("Skipped %s: %s\n", common.ReplaceLiteralHome(issue.Sandbox), issue.Disk)
+	}
+	return nil
+}
+
+var (
+	adminCatalogCmd = &cobra.Command{
+		Use:   "catalog",
+		Short: "Checks and fixes the sandbox catalog",
+		Long: `The catalog (sandboxes.json) records every deployed sandbox. It drifts from
+the sandboxes on disk when directories are removed by hand or when the sandbox home
+changes. These commands compare the catalog with the sandboxes found in one or more
+sandbox homes (by default, the current one) and with their sbdescription.json.`,
+	}
+
+	adminCatalogVerifyCmd = &cobra.Command{
+		Use:   "verify [sandbox-home ...]",
+		Short: "Reports the differences between the catalog and the sandboxes on disk",
+		Long: `Reports catalog entries whose sandbox directory does not exist (missing-sandbox),
+sandboxes that are not in the catalog (missing-entry), sandboxes without a readable
+description (no-description), and sandboxes whose ports or version in the catalog
+differ from their description (port-mismatch, version-mismatch).
+Catalog entries are checked regardless of their sandbox home.
+Exits with an error when any issue is found.`,
+		Example: `
+	$ dbdeployer admin catalog verify
+	$ dbdeployer admin catalog verify $HOME/sandboxes /opt/old-sandboxes
+`,
+		RunE: runCatalogVerify,
+	}
+
+	adminCatalogRepairCmd = &cobra.Command{
+		Use:   "repair [sandbox-home ...]",
+		Short: "Fixes the differences between the catalog and the sandboxes on disk",
+		Long: `Removes the catalog entries whose sandbox directory does not exist, adds the
+sandboxes that are not in the catalog, and updates ports and version from the
+sandbox description. Sandboxes without a readable description can't be repaired.
+Catalog entries that are consistent are not modified.`,
+		RunE: runCatalogRepair,
+	}
+
+	adminCatalogRebuildCmd = &cobra.Command{
+		Use:   "rebuild [sandbox-home ...]",
+		Short: "Rebuilds the catalog from the sandboxes on disk",
+		Long: `Replaces the catalog with the sandboxes found in the given sandbox homes, using
+their sbdescription.json. Snapshots, expiration, and log directory are kept from the
+current catalog for the sandboxes that were already there.
+All the sandbox homes in use must be listed, as the entries for other homes are removed.`,
+		Example: `
+	$ dbdeployer admin catalog rebuild $HOME/sandboxes $HOME/sandboxes-8.4
+`,
+		RunE: runCatalogRebuild,
+	}
+)
+
+func init() {
+	adminCmd.AddCommand(adminCatalogCmd)
+	adminCatalogCmd.AddCommand(adminCatalogVerifyCmd)
+	adminCatalogCmd.AddCommand(adminCatalogRepairCmd)
+	adminCatalogCmd.AddCommand(adminCatalogRebuildCmd)
+}
@@ -0,0 +1,62 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/ops"
+)
+
+func runCloneSandbox(cmd *cobra.Command, args []string) error {
+	sourceDir, err := adminSandboxDir(cmd, args[0])
+	if err != nil {
+		return err
+	}
+	cloneDir, err := ops.CloneSandbox(sourceDir, args[1])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Sandbox %s cloned into %s\n", args[0], cloneDir)
+	return nil
+}
+
+var adminCloneCmd = &cobra.Command{
+	Use:   "clone source_sandbox new_name",
+	Short: "Clones a sandbox into a new one",
+	Long: `Creates a new sandbox with the same deployment options and the same data of an existing one.
+The sandbox directory is copied, and its scripts and configuration files are rewritten
+with the new directory and with fresh ports. Every node gets a new server UUID,
+and the clone is registered in the catalog. An incomplete clone is removed if any step fails.
+In replication sandboxes, the replication channels of the clone are moved to the clone ports.
+The source sandbox is stopped during the data copy, and restarted afterwards.
+The clone is left running only if the source was running.
+NDB, PXC, and TiDB sandboxes can't be cloned.`,
+	Example: `
+	$ dbdeployer admin clone msb_8_0_36 msb_8_0_36_copy
+	$ dbdeployer admin clone rsandbox_5_7_44 rsandbox_test
+`,
+	Args:        cobra.ExactArgs(2),
+	RunE:        runCloneSandbox,
+	Annotations: map[string]string{"export": makeExportArgs(globals.ExportSandboxDir, 1)},
+}
+
+func init() {
+	adminCmd.AddCommand(adminCloneCmd)
+}
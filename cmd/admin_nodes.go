@@ -0,0 +1,93 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/ops"
+)
+
+func runAddNode(cmd *cobra.Command, args []string) error {
+	sandboxDir, err := adminSandboxDir(cmd, args[0])
+	if err != nil {
+		return err
+	}
+	nodeName, err := ops.AddNode(sandboxDir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Node %s added to %s\n", nodeName, args[0])
+	return nil
+}
+
+func runRemoveNode(cmd *cobra.Command, args []string) error {
+	sandboxDir, err := adminSandboxDir(cmd, args[0])
+	if err != nil {
+		return err
+	}
+	nodeName, err := ops.RemoveNode(sandboxDir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Node %s removed from %s\n", nodeName, args[0])
+	return nil
+}
+
+var adminAddNodeCmd = &cobra.Command{
+	Use:   "add-node sandbox_name",
+	Short: "Adds a node to a multi-node sandbox",
+	Long: `Adds a node to a master-slave, group replication, or multiple sandbox.
+The new node gets the next number and free ports, and the same options and version of
+the existing nodes. In replication sandboxes, the node receives the data of the master
+(or of the first group member) through the clone plugin, when available, or through a dump,
+and then it replicates from the master or joins the group.
+The *_all scripts, the node scripts, the sandbox description, and the catalog are updated.
+All the nodes of a replication sandbox must be running.`,
+	Example: `
+	$ dbdeployer admin add-node rsandbox_8_0_36
+	Node node3 added to rsandbox_8_0_36
+`,
+	Args:        cobra.ExactArgs(1),
+	RunE:        runAddNode,
+	Annotations: map[string]string{"export": makeExportArgs(globals.ExportSandboxDir, 1)},
+}
+
+var adminRemoveNodeCmd = &cobra.Command{
+	Use:   "remove-node sandbox_name",
+	Short: "Removes the last node from a multi-node sandbox",
+	Long: `Removes the node with the highest number from a master-slave, group replication, or
+multiple sandbox. The node is detached from replication or from the group, stopped, and
+its directory is deleted. The *_all scripts, the node scripts, the sandbox description,
+and the catalog are updated.
+The master of a master-slave sandbox can't be removed, and group replication sandboxes
+keep at least three nodes.`,
+	Example: `
+	$ dbdeployer admin remove-node rsandbox_8_0_36
+	Node node3 removed from rsandbox_8_0_36
+`,
+	Args:        cobra.ExactArgs(1),
+	RunE:        runRemoveNode,
+	Annotations: map[string]string{"export": makeExportArgs(globals.ExportSandboxDir, 1)},
+}
+
+func init() {
+	adminCmd.AddCommand(adminAddNodeCmd)
+	adminCmd.AddCommand(adminRemoveNodeCmd)
+}
@@ -0,0 +1,137 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+)
+
+const (
+	portOwnerSandbox  = "sandbox"
+	portOwnerLease    = "lease"
+	portOwnerReserved = "reserved"
+	portOwnerNone     = "none"
+)
+
+type portRecord struct {
+	Port      int    `json:"port"`
+	OwnerType string `json:"owner-type"`
+	Owner     string `json:"owner"`
+	Bound     bool   `json:"bound"`
+}
+
+// collectPortRecords returns the ports known to dbdeployer, with their owners.
+// When ports are given, only those ports are returned, including the ones without an owner.
+func collectPortRecords(catalog defaults.SandboxCatalog, leases []defaults.PortLease, reserved []int, ports []int) []portRecord {
+	records := make(map[int]portRecord)
+	for _, port := range reserved {
+		records[port] = portRecord{Port: port, OwnerType: portOwnerReserved}
+	}
+	for _, lease := range leases {
+		for _, port := range lease.Ports {
+			records[port] = portRecord{Port: port, OwnerType: portOwnerLease,
+				Owner: fmt.Sprintf("pid %d: %s", lease.Pid, lease.Owner)}
+		}
+	}
+	for name, item := range catalog {
+		for _, port := range item.Port {
+			records[port] = portRecord{Port: port, OwnerType: portOwnerSandbox, Owner: path.Base(name)}
+		}
+	}
+	var result []portRecord
+	if len(ports) > 0 {
+		for _, port := range ports {
+			record, found := records[port]
+			if !found {
+				record = portRecord{Port: port, OwnerType: portOwnerNone}
+			}
+			result = append(result, record)
+		}
+		return result
+	}
+	for _, record := range records {
+		result = append(result, record)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Port < result[j].Port })
+	return result
+}
+
+func runAdminPorts(cmd *cobra.Command, args []string) error {
+	var ports []int
+	for _, arg := range args {
+		port, err := strconv.Atoi(arg)
+		if err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("invalid port '%s'", arg)
+		}
+		ports = append(ports, port)
+	}
+	catalog, err := defaults.ReadCatalog()
+	if err != nil {
+		return err
+	}
+	leases, err := defaults.ActivePortLeases()
+	if err != nil {
+		return err
+	}
+	records := collectPortRecords(catalog, leases, defaults.Defaults().ReservedPorts, ports)
+	for i := range records {
+		records[i].Bound = common.IsPortBusy(records[i].Port)
+	}
+	outputFormat, isStructured := structuredOutputFormat(cmd)
+	if isStructured {
+		if records == nil {
+			records = []portRecord{}
+		}
+		printStructured(outputFormat, records)
+		return nil
+	}
+	for _, record := range records {
+		bound := "free"
+		if record.Bound {
+			bound = "bound"
+		}
+		fmt.Printf("%5d %-8s %-5s %s\n", record.Port, record.OwnerType, bound, record.Owner)
+	}
+	return nil
+}
+
+var adminPortsCmd = &cobra.Command{
+	Use:   "ports [port ...]",
+	Short: "Shows the ports used by dbdeployer",
+	Long: `Shows the ports assigned to sandboxes in the catalog, the ports leased by
+deployments in progress, and the reserved ports, with their owner and whether
+the port is currently bound by any process.
+When ports are given, shows only those ports, including the ones that dbdeployer
+does not know about.`,
+	Example: `
+	$ dbdeployer admin ports
+	$ dbdeployer admin ports 8036 3306
+	$ dbdeployer admin ports --output=json
+`,
+	RunE: runAdminPorts,
+}
+
+func init() {
+	adminCmd.AddCommand(adminPortsCmd)
+}
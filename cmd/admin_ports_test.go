@@ -0,0 +1,47 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/datacharmer/dbdeployer/compare"
+	"github.com/datacharmer/dbdeployer/defaults"
+)
+
+func TestCollectPortRecords(t *testing.T) {
+	catalog := defaults.SandboxCatalog{
+		"/sandboxes/msb_8_0_36": {Port: []int{8036, 18036}},
+	}
+	leases := []defaults.PortLease{
+		{Pid: 1234, Owner: "dbdeployer deploy single 8.4.0", Ports: []int{8400}},
+	}
+	records := collectPortRecords(catalog, leases, []int{1186, 8036}, nil)
+	var ports []int
+	for _, record := range records {
+		ports = append(ports, record.Port)
+	}
+	compare.OkEqualIntSlices(t, ports, []int{1186, 8036, 8400, 18036})
+	compare.OkEqualString("reserved", records[0].OwnerType, portOwnerReserved, t)
+	// A sandbox port takes precedence over the reserved list
+	compare.OkEqualString("sandbox owner", records[1].Owner, "msb_8_0_36", t)
+	compare.OkEqualString("lease owner", records[2].Owner, "pid 1234: dbdeployer deploy single 8.4.0", t)
+
+	records = collectPortRecords(catalog, leases, nil, []int{5000, 18036})
+	compare.OkEqualInt("requested ports", len(records), 2, t)
+	compare.OkEqualString("unknown port", records[0].OwnerType, portOwnerNone, t)
+	compare.OkEqualString("requested sandbox port", records[1].OwnerType, portOwnerSandbox, t)
+}
@@ -0,0 +1,168 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/ops"
+)
+
+func adminSandboxDir(cmd *cobra.Command, sandboxName string) (string, error) {
+	sandboxHome, err := getAbsolutePathFromFlag(cmd, "sandbox-home")
+	if err != nil {
+		return "", err
+	}
+	sandboxDir := path.Join(sandboxHome, sandboxName)
+	if !common.DirExists(sandboxDir) {
+		return "", fmt.Errorf(globals.ErrDirectoryNotFound, sandboxDir)
+	}
+	return sandboxDir, nil
+}
+
+func runSnapshotCreate(cmd *cobra.Command, args []string) error {
+	sandboxDir, err := adminSandboxDir(cmd, args[0])
+	if err != nil {
+		return err
+	}
+	var options ops.SnapshotOptions
+	if len(args) > 1 {
+		options.Label = args[1]
+	}
+	options.NoClone, _ = cmd.Flags().GetBool(globals.NoCloneLabel)
+	snapshot, err := ops.CreateSnapshot(sandboxDir, options)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Snapshot '%s' of %s created using method '%s'\n", snapshot.Label, args[0], snapshot.Method)
+	return nil
+}
+
+func runSnapshotList(cmd *cobra.Command, args []string) error {
+	sandboxDir, err := adminSandboxDir(cmd, args[0])
+	if err != nil {
+		return err
+	}
+	snapshots, err := ops.ListSnapshots(sandboxDir)
+	if err != nil {
+		return err
+	}
+	for _, snapshot := range snapshots {
+		nodes := strings.Join(snapshot.Nodes, " ")
+		if nodes == "" {
+			nodes = "-"
+		}
+		fmt.Printf("%-20s %-30s %-6s %s\n", snapshot.Label, snapshot.Timestamp, snapshot.Method, nodes)
+	}
+	return nil
+}
+
+func runSnapshotRestore(cmd *cobra.Command, args []string) error {
+	sandboxDir, err := adminSandboxDir(cmd, args[0])
+	if err != nil {
+		return err
+	}
+	err = ops.RestoreSnapshot(sandboxDir, args[1])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Snapshot '%s' restored into %s\n", args[1], args[0])
+	return nil
+}
+
+func runSnapshotDelete(cmd *cobra.Command, args []string) error {
+	sandboxDir, err := adminSandboxDir(cmd, args[0])
+	if err != nil {
+		return err
+	}
+	err = ops.DeleteSnapshot(sandboxDir, args[1])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Snapshot '%s' of %s deleted\n", args[1], args[0])
+	return nil
+}
+
+var (
+	adminSnapshotCmd = &cobra.Command{
+		Use:   "snapshot",
+		Short: "Manages snapshots of sandbox data",
+		Long: `Saves and restores the data directories of a sandbox.
+Snapshots are stored inside the sandbox directory, and are recorded in the catalog.
+They are removed together with the sandbox.`,
+	}
+
+	adminSnapshotCreateCmd = &cobra.Command{
+		Use:   "create sandbox_name [label]",
+		Short: "Creates a snapshot of a sandbox",
+		Long: `Archives the data directory of every node in the sandbox.
+If all nodes are running a version that supports the clone plugin (8.0.17+),
+the data is cloned while the servers are running. Otherwise, the sandbox is stopped
+during the copy, and restarted afterwards.
+When no label is given, the current date and time are used.`,
+		Example: `
+	$ dbdeployer admin snapshot create msb_8_0_36 before-upgrade
+	$ dbdeployer admin snapshot create rsandbox_5_7_44
+`,
+		Args:        cobra.RangeArgs(1, 2),
+		RunE:        runSnapshotCreate,
+		Annotations: map[string]string{"export": makeExportArgs(globals.ExportSandboxDir, 1)},
+	}
+
+	adminSnapshotListCmd = &cobra.Command{
+		Use:         "list sandbox_name",
+		Short:       "Lists the snapshots of a sandbox",
+		Args:        cobra.ExactArgs(1),
+		RunE:        runSnapshotList,
+		Annotations: map[string]string{"export": makeExportArgs(globals.ExportSandboxDir, 1)},
+	}
+
+	adminSnapshotRestoreCmd = &cobra.Command{
+		Use:   "restore sandbox_name label",
+		Short: "Restores a snapshot into a sandbox",
+		Long: `Replaces the data directories of the sandbox with the ones saved in a snapshot.
+The sandbox is stopped during the operation, and restarted if it was running.
+All archives are extracted before replacing any data directory. If the replacement fails
+for one node, the nodes already replaced get their previous data back.`,
+		Example:     `	$ dbdeployer admin snapshot restore msb_8_0_36 before-upgrade`,
+		Args:        cobra.ExactArgs(2),
+		RunE:        runSnapshotRestore,
+		Annotations: map[string]string{"export": makeExportArgs(globals.ExportSandboxDir, 1)},
+	}
+
+	adminSnapshotDeleteCmd = &cobra.Command{
+		Use:         "delete sandbox_name label",
+		Short:       "Deletes a snapshot",
+		Args:        cobra.ExactArgs(2),
+		RunE:        runSnapshotDelete,
+		Annotations: map[string]string{"export": makeExportArgs(globals.ExportSandboxDir, 1)},
+	}
+)
+
+func init() {
+	adminCmd.AddCommand(adminSnapshotCmd)
+	adminSnapshotCmd.AddCommand(adminSnapshotCreateCmd)
+	adminSnapshotCmd.AddCommand(adminSnapshotListCmd)
+	adminSnapshotCmd.AddCommand(adminSnapshotRestoreCmd)
+	adminSnapshotCmd.AddCommand(adminSnapshotDeleteCmd)
+	adminSnapshotCreateCmd.Flags().Bool(globals.NoCloneLabel, false, "Stops the sandbox to copy the data, even if the clone plugin is available")
+}
@@ -0,0 +1,103 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/ops"
+)
+
+func runSwitchover(cmd *cobra.Command, args []string) error {
+	sandboxDir, err := adminSandboxDir(cmd, args[0])
+	if err != nil {
+		return err
+	}
+	newMaster, _ := cmd.Flags().GetString(globals.NewMasterLabel)
+	err = ops.Switchover(sandboxDir, newMaster)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Node %s is the new master of %s\n", newMaster, args[0])
+	return nil
+}
+
+func runFailover(cmd *cobra.Command, args []string) error {
+	sandboxDir, err := adminSandboxDir(cmd, args[0])
+	if err != nil {
+		return err
+	}
+	newMaster, _ := cmd.Flags().GetString(globals.NewMasterLabel)
+	newMaster, err = ops.Failover(sandboxDir, newMaster)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Node %s is the new master of %s\n", newMaster, args[0])
+	return nil
+}
+
+var adminSwitchoverCmd = &cobra.Command{
+	Use:   "switchover sandbox_name --new-master=node_name",
+	Short: "Makes a slave the new master of a master-slave sandbox",
+	Long: `Promotes a slave of a running master-slave sandbox to master.
+The current master is set read-only, and the new master waits until it has executed
+all the transactions of the old one. Then the new master is made writable, and all the
+other nodes, including the old master, replicate from it using GTID auto-position.
+The read-only flags of the slaves are moved to the old master.
+If the new master can't catch up, the old master is made writable again.
+If a later step fails, the new master gets back its read-only flags, and the old
+master stays read-only until the replication is fixed by hand.
+Nodes keep their directories: the scripts that depend on the roles (m, s1, use_all_masters,
+use_all_slaves, check_slaves, initialize_slaves, and similar) are written again,
+and the new roles are recorded in the sandbox description, under "replication-tree".
+The sandbox must have been deployed with --gtid.`,
+	Example: `
+	$ dbdeployer admin switchover rsandbox_8_0_36 --new-master=node2
+`,
+	Args:        cobra.ExactArgs(1),
+	RunE:        runSwitchover,
+	Annotations: map[string]string{"export": makeExportArgs(globals.ExportSandboxDir, 1)},
+}
+
+var adminFailoverCmd = &cobra.Command{
+	Use:   "failover sandbox_name [--new-master=node_name]",
+	Short: "Replaces the failed master of a master-slave sandbox",
+	Long: `Simulates the failure of the master of a master-slave sandbox, and promotes a slave.
+The master is killed, if it is still running. The running slaves apply the transactions they
+have received, and then one of them becomes the new master: either the one given with
+--new-master, or the one that has executed all the transactions of the others.
+The other slaves replicate from the new master using GTID auto-position.
+The old master is left out of replication: scripts such as m, s1, and use_all don't include it.
+The sandbox must have been deployed with --gtid.`,
+	Example: `
+	$ dbdeployer admin failover rsandbox_8_0_36
+	$ dbdeployer admin failover rsandbox_8_0_36 --new-master=node1
+`,
+	Args:        cobra.ExactArgs(1),
+	RunE:        runFailover,
+	Annotations: map[string]string{"export": makeExportArgs(globals.ExportSandboxDir, 1)},
+}
+
+func init() {
+	adminCmd.AddCommand(adminSwitchoverCmd)
+	adminCmd.AddCommand(adminFailoverCmd)
+	adminSwitchoverCmd.Flags().String(globals.NewMasterLabel, "", "Node that becomes the new master (such as 'node2')")
+	_ = adminSwitchoverCmd.MarkFlagRequired(globals.NewMasterLabel)
+	adminFailoverCmd.Flags().String(globals.NewMasterLabel, "", "Node that becomes the new master (default: the most up-to-date slave)")
+}
@@ -0,0 +1,91 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/ops"
+	"github.com/spf13/cobra"
+)
+
+func runApply(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	fileName, _ := flags.GetString(globals.ManifestFileLabel)
+	if fileName == "" {
+		return fmt.Errorf("option --%s is required", globals.ManifestFileLabel)
+	}
+	var options ops.ApplyOptions
+	options.DryRun, _ = flags.GetBool(globals.DryRunLabel)
+	options.Force, _ = flags.GetBool(globals.ForceLabel)
+
+	manifest, err := ops.ReadManifest(fileName)
+	if err != nil {
+		return err
+	}
+	return ops.ApplyManifest(manifest, options)
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Deploys the sandboxes described in a manifest",
+	Long: `Reads a YAML or JSON manifest describing one or more sandboxes,
+compares it with the sandboxes already deployed, and creates the missing ones.
+Sandboxes that differ from the manifest (version, flavor, type, number of nodes)
+are reported. With --force, they are removed and deployed again.
+Existing sandboxes are never modified in place, and the other options of an entry
+(my-cnf-options, users, SQL, etc.) are only used when the sandbox is deployed.
+
+A manifest looks like this:
+
+    sandbox-home: $HOME/sandboxes      # optional
+    sandboxes:
+      - name: app_db                   # sandbox directory (required)
+        version: 8.0.36                # required
+        type: single                   # single (default), multiple, replication
+        my-cnf-options:
+          - max_connections=200
+        post-grants-sql:
+          - create schema app
+      - name: app_repl
+        version: 8.0.36
+        type: replication
+        topology: chain                # any topology allowed by "deploy replication"
+        chain-spec: 1>2>3,2>4
+        gtid: true
+        data-load:
+          - sakila                     # archives from "dbdeployer data-load list"
+
+Every sandbox entry accepts the same options of "dbdeployer deploy", using
+the option name as key (db-user, rpl-password, init-options, pre-grants-sql, etc.).
+Environment variables and "~" are expanded in sandbox-home, sandbox-binary,
+my-cnf-file, and post-grants-sql-file.
+`,
+	Example: `
+	$ dbdeployer apply -f topology.yaml --dry-run
+	$ dbdeployer apply -f topology.yaml
+	$ dbdeployer apply -f topology.json --force
+`,
+	RunE: runApply,
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+	applyCmd.Flags().StringP(globals.ManifestFileLabel, "f", "", "Manifest file (YAML or JSON)")
+	applyCmd.Flags().Bool(globals.DryRunLabel, false, "Shows what would be done, without deploying")
+	applyCmd.Flags().Bool(globals.ForceLabel, false, "Deploys again the sandboxes that differ from the manifest")
+}
@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 
 	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
@@ -29,9 +30,28 @@ import (
 	"github.com/datacharmer/dbdeployer/globals"
 )
 
+// archiveRecord is the structured output of a data load archive
+type archiveRecord struct {
+	Name string `json:"name"`
+	data_load.DataDefinition
+}
+
 func listArchives(cmd *cobra.Command, args []string) error {
 	flags := cmd.Flags()
 	full, _ := flags.GetBool(globals.FullInfoLabel)
+	outputFormat, err := getOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
+	if outputFormat != globals.OutputTable {
+		archives, _ := data_load.Archives()
+		var records []archiveRecord
+		for name, archive := range archives {
+			records = append(records, archiveRecord{Name: name, DataDefinition: archive})
+		}
+		sort.Slice(records, func(i, j int) bool { return records[i].Name < records[j].Name })
+		return writeStructured(os.Stdout, outputFormat, records)
+	}
 	if full {
 		result, err := data_load.ArchivesAsJson()
 		if err != nil {
@@ -45,17 +45,20 @@ func showDefaults(cmd *cobra.Command, args []string) {
 			fmt.Printf("%s %v\n", k, v)
 		}
 	} else {
-		defaults.ShowDefaults(defaults.Defaults())
+		err := defaults.ShowDefaults(defaults.Defaults())
+		common.ErrCheckExitf(err, 1, "%s", err)
 	}
 }
 
 func writeDefaults(cmd *cobra.Command, args []string) {
-	defaults.WriteDefaultsFile(defaults.ConfigurationFile, defaults.Defaults())
+	err := defaults.WriteDefaultsFile(defaults.ConfigurationFile, defaults.Defaults())
+	common.ErrCheckExitf(err, 1, "%s", err)
 	common.CondPrintf("# Default values exported to %s\n", defaults.ConfigurationFile)
 }
 
 func removeDefaults(cmd *cobra.Command, args []string) {
-	defaults.RemoveDefaultsFile()
+	err := defaults.RemoveDefaultsFile()
+	common.ErrCheckExitf(err, 1, "%s", err)
 }
 
 func loadDefaults(cmd *cobra.Command, args []string) {
@@ -63,9 +66,11 @@ func loadDefaults(cmd *cobra.Command, args []string) {
 		common.Exit(1, "'load' requires a file name")
 	}
 	filename := args[0]
-	newDefaults := defaults.ReadDefaultsFile(filename)
+	newDefaults, err := defaults.ReadDefaultsFile(filename)
+	common.ErrCheckExitf(err, 1, "%s", err)
 	if defaults.ValidateDefaults(newDefaults) {
-		defaults.WriteDefaultsFile(defaults.ConfigurationFile, newDefaults)
+		err = defaults.WriteDefaultsFile(defaults.ConfigurationFile, newDefaults)
+		common.ErrCheckExitf(err, 1, "%s", err)
 	} else {
 		return
 	}
@@ -80,7 +85,8 @@ func exportDefaults(cmd *cobra.Command, args []string) {
 	if common.FileExists(filename) {
 		common.Exitf(1, "file '%s' already exists. Will not overwrite", filename)
 	}
-	defaults.WriteDefaultsFile(filename, defaults.Defaults())
+	err := defaults.WriteDefaultsFile(filename, defaults.Defaults())
+	common.ErrCheckExitf(err, 1, "%s", err)
 	common.CondPrintf("# Defaults exported to file %s\n", filename)
 }
 
@@ -92,8 +98,10 @@ func updateDefaults(cmd *cobra.Command, args []string) {
 	}
 	label := args[0]
 	value := args[1]
-	defaults.UpdateDefaults(label, value, true)
-	defaults.ShowDefaults(defaults.Defaults())
+	err := defaults.UpdateDefaults(label, value, true)
+	common.ErrCheckExitf(err, 1, "%s", err)
+	err = defaults.ShowDefaults(defaults.Defaults())
+	common.ErrCheckExitf(err, 1, "%s", err)
 }
 
 func enableBashCompletion(cmd *cobra.Command, args []string) {
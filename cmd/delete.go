@@ -25,6 +25,7 @@ import (
 	"github.com/datacharmer/dbdeployer/concurrent"
 	"github.com/datacharmer/dbdeployer/defaults"
 	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/ops"
 	"github.com/datacharmer/dbdeployer/sandbox"
 	"github.com/spf13/cobra"
 )
@@ -109,6 +110,14 @@ func deleteSandbox(cmd *cobra.Command, args []string) {
 			}
 		}
 	}
+	if len(deletionList) == 1 && !deletionList[0].Locked {
+		// A single sandbox is deleted together with the proxies attached to it
+		err = ops.DeleteSandbox(path.Join(sandboxDir, deletionList[0].SandboxName), useStop)
+		if err != nil {
+			common.Exitf(1, "%s", err)
+		}
+		return
+	}
 	for _, sb := range deletionList {
 		if sb.Locked {
 			common.CondPrintf("Sandbox %s is locked\n", sb.SandboxName)
@@ -20,6 +20,7 @@ import (
 	"math/rand"
 	"os"
 	"path"
+	"time"
 
 	"github.com/datacharmer/dbdeployer/common"
 	"github.com/datacharmer/dbdeployer/defaults"
@@ -33,6 +34,13 @@ var deployCmd = &cobra.Command{
 	Long:  `Deploys single, multiple, or replicated sandboxes`,
 }
 
+// deployExpiration returns the expiration time of a new sandbox, from either --ttl or --expires-at
+func deployExpiration(cmd *cobra.Command) (string, error) {
+	ttl, _ := cmd.Flags().GetString(globals.TtlLabel)
+	expiresAt, _ := cmd.Flags().GetString(globals.ExpiresAtLabel)
+	return common.ExpirationTime(ttl, expiresAt, time.Now())
+}
+
 func init() {
 	myloginCnf := path.Join(os.Getenv("HOME"), ".mylogin.cnf")
 	if common.FileExists(myloginCnf) {
@@ -67,7 +75,10 @@ func init() {
 	deployCmd.PersistentFlags().Bool(globals.SocketInDatadirLabel, false, "Create socket in datadir instead of $TMPDIR")
 	deployCmd.PersistentFlags().Bool(globals.FlavorInPromptLabel, false, "Add flavor values to prompt")
 	deployCmd.PersistentFlags().Bool(globals.PortAsServerIdLabel, false, "Use the port number as server ID")
+	deployCmd.PersistentFlags().Bool(globals.DatadirCacheLabel, false, "Copies the data directory from a cache of initialized ones")
 
+	setPflag(deployCmd, globals.TtlLabel, "", "", "", "Time to live of the sandbox, after which 'dbdeployer gc' removes it (such as 2h, 90m, 3d)", false)
+	setPflag(deployCmd, globals.ExpiresAtLabel, "", "", "", "Date and time after which 'dbdeployer gc' removes the sandbox", false)
 	setPflag(deployCmd, globals.LogLogDirectoryLabel, "", "", defaults.Defaults().LogDirectory, "Where to store dbdeployer logs", false)
 	setPflag(deployCmd, globals.RemoteAccessLabel, "", "", globals.RemoteAccessValue, "defines the database access ", false)
 	setPflag(deployCmd, globals.BindAddressLabel, "", "", globals.BindAddressValue, "defines the database bind-address ", false)
@@ -92,11 +103,11 @@ func init() {
 	setPflag(deployCmd, globals.HistoryDirLabel, "", "", "", "Where to store mysql client history (default: in sandbox directory)", false)
 	setPflag(deployCmd, globals.FlavorLabel, "", "", "", "Defines the tarball flavor (MySQL, NDB, Percona Server, etc)", false)
 	setPflag(deployCmd, globals.ClientFromLabel, "", "", "", "Where to get the client binaries from", false)
-	setPflag(deployCmd, globals.DefaultRoleLabel, "", "", "R_DO_IT_ALL", "Which role to assign to default user (8.0+)", false)
+	setPflag(deployCmd, globals.DefaultRoleLabel, "", "", globals.DefaultRoleValue, "Which role to assign to default user (8.0+)", false)
 	setPflag(deployCmd, globals.TaskUserLabel, "", "", "", "Task user to be created (8.0+)", false)
 	setPflag(deployCmd, globals.TaskUserRoleLabel, "", "", "", "Role to be assigned to task user (8.0+)", false)
-	setPflag(deployCmd, globals.CustomRoleNameLabel, "", "", "R_CUSTOM", "Name for custom role (8.0+)", false)
-	setPflag(deployCmd, globals.CustomRolePrivilegesLabel, "", "", "ALL PRIVILEGES", "Privileges for custom role (8.0+)", false)
-	setPflag(deployCmd, globals.CustomRoleTargetLabel, "", "", "*.*", "Target for custom role (8.0+)", false)
-	setPflag(deployCmd, globals.CustomRoleExtraLabel, "", "", "WITH GRANT OPTION", "Extra instructions for custom role (8.0+)", false)
+	setPflag(deployCmd, globals.CustomRoleNameLabel, "", "", globals.CustomRoleNameValue, "Name for custom role (8.0+)", false)
+	setPflag(deployCmd, globals.CustomRolePrivilegesLabel, "", "", globals.CustomRolePrivilegesValue, "Privileges for custom role (8.0+)", false)
+	setPflag(deployCmd, globals.CustomRoleTargetLabel, "", "", globals.CustomRoleTargetValue, "Target for custom role (8.0+)", false)
+	setPflag(deployCmd, globals.CustomRoleExtraLabel, "", "", globals.CustomRoleExtraValue, "Extra instructions for custom role (8.0+)", false)
 }
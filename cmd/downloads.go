@@ -160,22 +160,7 @@ func listRemoteTarballs(cmd *cobra.Command, args []string) {
 	if OS == "macos" || OS == "osx" {
 		OS = "darwin"
 	}
-	table := simpletable.New()
-
-	headerName := "name"
-	if showUrl {
-		headerName = "URL"
-	}
-	table.Header = &simpletable.Header{
-		Cells: []*simpletable.Cell{
-			{Align: simpletable.AlignCenter, Text: headerName},
-			{Align: simpletable.AlignCenter, Text: "OS-arch"},
-			{Align: simpletable.AlignRight, Text: "version"},
-			{Align: simpletable.AlignCenter, Text: "flavor"},
-			{Align: simpletable.AlignRight, Text: "size"},
-			{Align: simpletable.AlignCenter, Text: "minimal"},
-		},
-	}
+	outputFormat, isStructured := structuredOutputFormat(cmd)
 
 	var tarballList = downloads.DefaultTarballRegistry.Tarballs
 	notes := ""
@@ -192,10 +177,48 @@ func listRemoteTarballs(cmd *cobra.Command, args []string) {
 		}
 		tarballList = tarballObj.Tarballs
 	}
-	fmt.Printf("Available tarballs %s (%s)\n", notes, downloads.DefaultTarballRegistry.UpdatedOn)
 	//tarballList := downloads.DefaultTarballRegistry.Tarballs
 	tarballList = downloads.SortedTarballList(tarballList, sortBy)
+	var selectedTarballs []downloads.TarballDescription
 	for _, tb := range tarballList {
+		if version != "" && version != "all" && version != tb.Version && version != tb.ShortVersion {
+			continue
+		}
+		if flavor != "" && flavor != "all" && flavor != strings.ToLower(tb.Flavor) {
+			continue
+		}
+		if OS != "" && strings.ToLower(OS) != "all" && OS != strings.ToLower(tb.OperatingSystem) {
+			continue
+		}
+		if arch != "" && !strings.EqualFold(arch, tb.Arch) {
+			continue
+		}
+		selectedTarballs = append(selectedTarballs, tb)
+	}
+	if isStructured {
+		printStructured(outputFormat, selectedTarballs)
+		return
+	}
+
+	table := simpletable.New()
+
+	headerName := "name"
+	if showUrl {
+		headerName = "URL"
+	}
+	table.Header = &simpletable.Header{
+		Cells: []*simpletable.Cell{
+			{Align: simpletable.AlignCenter, Text: headerName},
+			{Align: simpletable.AlignCenter, Text: "OS-arch"},
+			{Align: simpletable.AlignRight, Text: "version"},
+			{Align: simpletable.AlignCenter, Text: "flavor"},
+			{Align: simpletable.AlignRight, Text: "size"},
+			{Align: simpletable.AlignCenter, Text: "minimal"},
+		},
+	}
+
+	fmt.Printf("Available tarballs %s (%s)\n", notes, downloads.DefaultTarballRegistry.UpdatedOn)
+	for _, tb := range selectedTarballs {
 		var cells []*simpletable.Cell
 		minimalTag := ""
 		if tb.Minimal {
@@ -215,18 +238,6 @@ func listRemoteTarballs(cmd *cobra.Command, args []string) {
 		cells = append(cells, &simpletable.Cell{Text: tb.Flavor})
 		cells = append(cells, &simpletable.Cell{Align: simpletable.AlignRight, Text: humanize.Bytes(uint64(tb.Size))})
 		cells = append(cells, &simpletable.Cell{Text: minimalTag})
-		if version != "" && version != "all" && version != tb.Version && version != tb.ShortVersion {
-			continue
-		}
-		if flavor != "" && flavor != "all" && flavor != strings.ToLower(tb.Flavor) {
-			continue
-		}
-		if OS != "" && strings.ToLower(OS) != "all" && OS != strings.ToLower(tb.OperatingSystem) {
-			continue
-		}
-		if arch != "" && !strings.EqualFold(arch, tb.Arch) {
-			continue
-		}
 		table.Body.Cells = append(table.Body.Cells, cells)
 	}
 	table.SetStyle(simpletable.StyleCompactLite)
@@ -93,7 +93,7 @@ func TestExportImport(t *testing.T) {
 			subCommandName:      "",
 			expectedName:        "admin",
 			expectedAncestors:   2,
-			expectedSubCommands: 6,
+			expectedSubCommands: 15,
 			expectedArgument:    "",
 		},
 		{
@@ -128,6 +128,38 @@ func TestExportImport(t *testing.T) {
 			expectedSubCommands: 0,
 			expectedArgument:    globals.ExportSandboxDir,
 		},
+		{
+			commandName:         "admin",
+			subCommandName:      "clone",
+			expectedName:        "clone",
+			expectedAncestors:   3,
+			expectedSubCommands: 0,
+			expectedArgument:    globals.ExportSandboxDir,
+		},
+		{
+			commandName:         "admin",
+			subCommandName:      "snapshot",
+			expectedName:        "snapshot",
+			expectedAncestors:   3,
+			expectedSubCommands: 4,
+			expectedArgument:    "",
+		},
+		{
+			commandName:         "admin",
+			subCommandName:      "cache",
+			expectedName:        "cache",
+			expectedAncestors:   3,
+			expectedSubCommands: 2,
+			expectedArgument:    "",
+		},
+		{
+			commandName:         "admin",
+			subCommandName:      "catalog",
+			expectedName:        "catalog",
+			expectedAncestors:   3,
+			expectedSubCommands: 3,
+			expectedArgument:    "",
+		},
 		{
 			commandName:         "defaults",
 			subCommandName:      "templates",
@@ -165,7 +197,7 @@ func TestExportImport(t *testing.T) {
 			subCommandName:      "",
 			expectedName:        "deploy",
 			expectedAncestors:   2,
-			expectedSubCommands: 3,
+			expectedSubCommands: 5,
 			expectedArgument:    "",
 		},
 		{
@@ -0,0 +1,88 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/ops"
+)
+
+func runGc(cmd *cobra.Command, args []string) error {
+	outputFormat, isStructured := structuredOutputFormat(cmd)
+	sandboxHome, err := getAbsolutePathFromFlag(cmd, "sandbox-home")
+	if err != nil {
+		return err
+	}
+	dryRun, _ := cmd.Flags().GetBool(globals.DryRunLabel)
+	collected, err := ops.CollectGarbage(sandboxHome, time.Now(), dryRun)
+	if err != nil {
+		return err
+	}
+	if isStructured {
+		if collected == nil {
+			collected = []ops.CollectedSandbox{}
+		}
+		printStructured(outputFormat, collected)
+		return nil
+	}
+	if len(collected) == 0 {
+		fmt.Printf("No expired sandboxes in %s\n", common.ReplaceLiteralHome(sandboxHome))
+		return nil
+	}
+	failures := 0
+	for _, sb := range collected {
+		expiresAt := sb.ExpiresAt
+		if expiresAt == "" {
+			expiresAt = "(attached to expired sandbox)"
+		}
+		fmt.Printf("%-30s %-25s %s %s\n", sb.Name, expiresAt, sb.Status, sb.Error)
+		if sb.Status == ops.GcFailed {
+			failures++
+		}
+	}
+	if failures > 0 {
+		return fmt.Errorf("%d expired sandboxes could not be deleted", failures)
+	}
+	return nil
+}
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Deletes expired sandboxes",
+	Long: `Stops and deletes the sandboxes in $SANDBOX_HOME whose expiration time has passed.
+The expiration is set at deployment, using --ttl (such as 2h, 90m, 3d) or --expires-at.
+Sandboxes without expiration are never removed, and locked sandboxes (see "dbdeployer admin lock")
+are skipped. ProxySQL sandboxes attached to an expired sandbox are removed together with it.
+Use --dry-run to see which sandboxes would be deleted.`,
+	Example: `
+	$ dbdeployer deploy single 8.0.36 --ttl=2h
+	$ dbdeployer gc --dry-run
+	$ dbdeployer gc
+`,
+	Args: cobra.NoArgs,
+	RunE: runGc,
+}
+
+func init() {
+	rootCmd.AddCommand(gcCmd)
+	gcCmd.Flags().Bool(globals.DryRunLabel, false, "Shows the expired sandboxes without deleting them")
+}
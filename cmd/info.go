@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
@@ -77,6 +78,25 @@ func displayAllVersions(basedir, wantedVersion, flavor string) {
 	}
 }
 
+// versionWithSeries adds the release series information to a version, when available
+func versionWithSeries(version, flavor string, withSeries bool) string {
+	if !withSeries {
+		return version
+	}
+	series, err := common.FindReleaseSeries(flavor, version)
+	if err != nil {
+		return version
+	}
+	info := fmt.Sprintf("%s (%s %s", version, series.Series, series.Type)
+	if series.EOL != "" {
+		info += ", EOL " + series.EOL
+		if series.IsEOL(time.Now()) {
+			info += " - end of life"
+		}
+	}
+	return info + ")"
+}
+
 func displayVersion(cmd *cobra.Command, args []string) {
 	wantedVersion := ""
 	allVersions := ""
@@ -90,6 +110,7 @@ func displayVersion(cmd *cobra.Command, args []string) {
 	}
 	flavor, _ := cmd.Flags().GetString(globals.FlavorLabel)
 	showEarliest, _ := cmd.Flags().GetBool(globals.EarliestLabel)
+	withSeries, _ := cmd.Flags().GetBool(globals.SeriesLabel)
 	if flavor == "" {
 		flavor = common.MySQLFlavor
 	}
@@ -100,13 +121,21 @@ func displayVersion(cmd *cobra.Command, args []string) {
 	} else {
 		if strings.ToLower(wantedVersion) == "all" {
 			result := ""
-			for _, v := range globals.SupportedAllVersions {
+			separator := " "
+			if withSeries {
+				separator = "\n"
+			}
+			shortVersions := common.ReleaseSeriesNames(flavor)
+			if len(shortVersions) == 0 {
+				shortVersions = globals.SupportedAllVersions
+			}
+			for _, v := range shortVersions {
 				latest := common.GetLatestVersion(defaults.Defaults().SandboxBinary, v, flavor)
 				if !reNotFound.MatchString(latest) {
 					if result != "" {
-						result += " "
+						result += separator
 					}
-					result += latest
+					result += versionWithSeries(latest, flavor, withSeries)
 				}
 			}
 			if result != "" {
@@ -120,8 +149,7 @@ func displayVersion(cmd *cobra.Command, args []string) {
 				result = common.GetLatestVersion(defaults.Defaults().SandboxBinary, wantedVersion, flavor)
 			}
 			if !reNotFound.MatchString(result) {
-				fmt.Println(result)
-
+				fmt.Println(versionWithSeries(result, flavor, withSeries))
 			}
 		}
 	}
@@ -264,11 +292,17 @@ var infoVersionCmd = &cobra.Command{
     # shows all the versions for a given short version
     $ dbdeployer info version 8.0 all
     8.0.11 8.0.12 8.0.13 8.0.14 8.0.15 8.0.16
+
+    # shows the release series of the latest version
+    $ dbdeployer info version 8.4 --series
+    8.4.2 (8.4 LTS, EOL 2032-04)
 `,
 	Long: `Displays the latest version available for deployment.
 If a short version is indicated (such as 5.7, or 8.0), only the versions belonging to that short
 version are searched.
 If "all" is indicated after the short version, displays all versions belonging to that short version.
+With --series, each version is followed by its release series type (GA, LTS, innovation)
+and its end of life.
 `,
 	Run:         displayVersion,
 	Annotations: map[string]string{"export": ExportAnnotationToJson(StringExport)},
@@ -281,6 +315,7 @@ func init() {
 	infoCmd.AddCommand(infoReleaseCmd)
 	setPflag(infoCmd, globals.FlavorLabel, "", "", "", "For which flavor this info is", false)
 	infoCmd.PersistentFlags().Bool(globals.EarliestLabel, false, "Return the earliest version")
+	infoVersionCmd.Flags().Bool(globals.SeriesLabel, false, "Show the release series type and end of life")
 	infoReleaseCmd.PersistentFlags().Int(globals.LimitLabel, 3, "Limit number of releases to show (0 = unlimited)")
 	infoReleaseCmd.PersistentFlags().Bool(globals.RawLabel, false, "Show the original data")
 	infoReleaseCmd.PersistentFlags().Bool(globals.StatsLabel, false, "Show downloads statistics")
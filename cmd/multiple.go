@@ -24,9 +24,10 @@ import (
 
 func multipleSandbox(cmd *cobra.Command, args []string) {
 	var sd sandbox.SandboxDef
-	common.CheckOrigin(args)
+	err := common.CheckOrigin(args)
+	common.ErrCheckExitf(err, 1, "%s", err)
 	flags := cmd.Flags()
-	sd, err := fillSandboxDefinition(cmd, args, false)
+	sd, err = fillSandboxDefinition(cmd, args, false)
 	common.ErrCheckExitf(err, 1, "error filling sandbox definition")
 	nodes, _ := flags.GetInt(globals.NodesLabel)
 	sd.SBType = "multiple"
@@ -0,0 +1,217 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/globals"
+)
+
+var outputFormats = []string{globals.OutputTable, globals.OutputJson, globals.OutputYaml, globals.OutputCsv}
+
+// getOutputFormat returns the validated value of the global --output flag
+func getOutputFormat(cmd *cobra.Command) (string, error) {
+	format, _ := cmd.Flags().GetString(globals.OutputLabel)
+	format = strings.ToLower(format)
+	for _, allowed := range outputFormats {
+		if format == allowed {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("invalid value '%s' for '--%s'. Allowed: %s",
+		format, globals.OutputLabel, strings.Join(outputFormats, ", "))
+}
+
+// structuredOutputFormat returns the output format, and whether it requires structured output.
+// It exits on invalid formats
+func structuredOutputFormat(cmd *cobra.Command) (string, bool) {
+	format, err := getOutputFormat(cmd)
+	common.ErrCheckExitf(err, 1, "%s", err)
+	return format, format != globals.OutputTable
+}
+
+// jsonFieldNames returns the names that encoding/json uses for the fields of a struct,
+// in the order of declaration. Fields of embedded structs are included in place.
+func jsonFieldNames(structType reflect.Type) []string {
+	var names []string
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		tag := field.Tag.Get("json")
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				names = append(names, jsonFieldNames(embedded)...)
+				continue
+			}
+		}
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// toGenericValue converts a value to maps, slices, and scalars, using the JSON field names
+func toGenericValue(data interface{}) (interface{}, error) {
+	text, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(text))
+	decoder.UseNumber()
+	var value interface{}
+	err = decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+	return convertJsonNumbers(value), nil
+}
+
+// convertJsonNumbers replaces json.Number with integers or floats
+func convertJsonNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = convertJsonNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = convertJsonNumbers(item)
+		}
+	}
+	return value
+}
+
+// csvCell returns the text of a value in a CSV cell. Lists and objects are encoded as JSON
+func csvCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	text, _ := json.Marshal(value)
+	return string(text)
+}
+
+// writeCsv writes a slice of structs as CSV, with a header made of the JSON field names
+func writeCsv(writer io.Writer, records interface{}) error {
+	recordsValue := reflect.ValueOf(records)
+	if recordsValue.Kind() != reflect.Slice {
+		return fmt.Errorf("CSV output requires a list of records")
+	}
+	elemType := recordsValue.Type().Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return fmt.Errorf("CSV output requires a list of records")
+	}
+	columns := jsonFieldNames(elemType)
+	csvWriter := csv.NewWriter(writer)
+	err := csvWriter.Write(columns)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < recordsValue.Len(); i++ {
+		value, err := toGenericValue(recordsValue.Index(i).Interface())
+		if err != nil {
+			return err
+		}
+		fields, _ := value.(map[string]interface{})
+		var row []string
+		for _, column := range columns {
+			row = append(row, csvCell(fields[column]))
+		}
+		err = csvWriter.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// writeStructured writes data in JSON, YAML, or CSV format.
+// Field names are always the ones of the JSON encoding.
+// For CSV, data must be a slice of structs.
+func writeStructured(writer io.Writer, format string, data interface{}) error {
+	// Empty lists are written as such, rather than as null
+	dataValue := reflect.ValueOf(data)
+	if dataValue.Kind() == reflect.Slice && dataValue.IsNil() {
+		data = reflect.MakeSlice(dataValue.Type(), 0, 0).Interface()
+	}
+	switch format {
+	case globals.OutputJson:
+		encoder := json.NewEncoder(writer)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(data)
+	case globals.OutputYaml:
+		value, err := toGenericValue(data)
+		if err != nil {
+			return err
+		}
+		text, err := yaml.Marshal(value)
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(text)
+		return err
+	case globals.OutputCsv:
+		return writeCsv(writer, data)
+	}
+	return fmt.Errorf("format '%s' is not a structured output format", format)
+}
+
+// printStructured writes data to the standard output in a structured format, and exits on error
+func printStructured(format string, data interface{}) {
+	err := writeStructured(os.Stdout, format, data)
+	common.ErrCheckExitf(err, 1, "error writing %s output: %s", format, err)
+}
@@ -0,0 +1,93 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/datacharmer/dbdeployer/compare"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/ops"
+)
+
+func TestWriteStructured(t *testing.T) {
+	records := []ops.SandboxRecord{
+		{
+			Name: "msb_8_0_36",
+			SandboxItem: defaults.SandboxItem{
+				SBType:      "single",
+				Version:     "8.0.36",
+				Port:        []int{8036, 18036},
+				Destination: "/sandboxes/msb_8_0_36",
+				CommandLine: "dbdeployer deploy single 8.0.36 --my-cnf-options=a<b",
+			},
+		},
+	}
+	type outputTest struct {
+		format   string
+		data     interface{}
+		expected string
+	}
+	var tests = []outputTest{
+		{
+			format: globals.OutputCsv,
+			data:   records,
+			expected: "name,origin,type,version,flavor,host,port,nodes,destination,dbdeployer-version,timestamp,log-directory,command-line,snapshots,node-versions,backend,expires-at\n" +
+				"msb_8_0_36,,single,8.0.36,,,\"[8036,18036]\",,/sandboxes/msb_8_0_36,,,,dbdeployer deploy single 8.0.36 --my-cnf-options=a<b,,,,\n",
+		},
+		{
+			format:   globals.OutputJson,
+			data:     []ops.SandboxRecord{},
+			expected: "[]\n",
+		},
+		{
+			format: globals.OutputJson,
+			data:   []TemplateInfo{{Group: "mock", Name: "no_op_mock", Description: "a < b"}},
+			expected: "[\n" +
+				"  {\n" +
+				"    \"in-file\": false,\n" +
+				"    \"group\": \"mock\",\n" +
+				"    \"name\": \"no_op_mock\",\n" +
+				"    \"description\": \"a < b\"\n" +
+				"  }\n" +
+				"]\n",
+		},
+		{
+			format:   globals.OutputYaml,
+			data:     []capabilityRecord{{Flavor: "mysql", Feature: "GTID", Since: "5.6.9"}},
+			expected: "- description: \"\"\n  feature: GTID\n  flavor: mysql\n  since: 5.6.9\n  until: \"\"\n",
+		},
+		{
+			format:   globals.OutputYaml,
+			data:     map[string]int64{"size": 35607473},
+			expected: "size: 35607473\n",
+		},
+	}
+	for _, test := range tests {
+		var buffer bytes.Buffer
+		err := writeStructured(&buffer, test.format, test.data)
+		compare.OkIsNil(test.format+" output error", err, t)
+		compare.OkEqualString(test.format+" output", buffer.String(), test.expected, t)
+	}
+
+	var buffer bytes.Buffer
+	err := writeStructured(&buffer, globals.OutputCsv, map[string]string{"a": "b"})
+	compare.OkIsNotNil("CSV output of a map", err, t)
+	err = writeStructured(&buffer, globals.OutputTable, records)
+	compare.OkIsNotNil("table as structured output", err, t)
+}
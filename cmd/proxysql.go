@@ -0,0 +1,109 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os/exec"
+	"path"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/sandbox"
+)
+
+func deployProxySQL(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	sandboxHome, err := getAbsolutePathFromFlag(cmd, globals.SandboxHomeLabel)
+	if err != nil {
+		return err
+	}
+	proxySQL, _ := flags.GetString(globals.ProxySQLBinaryLabel)
+	if proxySQL == "" {
+		proxySQL, err = exec.LookPath(globals.FnProxySQL)
+		if err != nil {
+			return fmt.Errorf("executable '%s' not found in PATH. Use --%s to indicate its location",
+				globals.FnProxySQL, globals.ProxySQLBinaryLabel)
+		}
+	}
+	proxySQL, err = common.AbsolutePath(proxySQL)
+	if err != nil {
+		return err
+	}
+	backendName, _ := flags.GetString(globals.AttachLabel)
+	backendDir := path.Join(sandboxHome, backendName)
+	if !common.DirExists(backendDir) {
+		return fmt.Errorf(globals.ErrDirectoryNotFound, backendDir)
+	}
+	installedPorts, err := common.GetInstalledPorts(sandboxHome)
+	if err != nil {
+		return err
+	}
+	proxyDef := sandbox.ProxySQLDef{
+		ProxySQL:       proxySQL,
+		SandboxDir:     sandboxHome,
+		BackendDir:     backendDir,
+		InstalledPorts: append(installedPorts, defaults.Defaults().ReservedPorts...),
+		ShellPath:      defaults.Defaults().ShellPath,
+	}
+	proxyDef.DirName, _ = flags.GetString(globals.SandboxDirectoryLabel)
+	proxyDef.BasePort, _ = flags.GetInt(globals.BasePortLabel)
+	proxyDef.SkipStart, _ = flags.GetBool(globals.SkipStartLabel)
+	proxyDef.ExpiresAt, err = deployExpiration(cmd)
+	if err != nil {
+		return err
+	}
+	return sandbox.CreateProxySQLSandbox(proxyDef)
+}
+
+var proxySQLCmd = &cobra.Command{
+	Use:   "proxysql --attach=sandbox_name",
+	Short: "deploys ProxySQL in front of an existing sandbox",
+	Long: `Creates a ProxySQL sandbox that uses the servers of an existing sandbox as backends.
+The proxysql executable is searched in $PATH, unless --proxysql-binary is used.
+The hostgroups depend on the topology of the backend sandbox:
+* master-slave: the master is in the writer hostgroup (0) and the slaves in the reader
+  hostgroup (1), with rules that send SELECT queries to the readers;
+* group replication and InnoDB Cluster: all nodes are monitored through
+  mysql_group_replication_hostgroups, and ProxySQL moves them to the writer (0),
+  reader (1), backup writer (2), and offline (3) hostgroups;
+* single sandbox and other topologies: all nodes are in the writer hostgroup.
+ProxySQL uses two consecutive ports, starting at --base-port (default: proxysql-base-port):
+admin and MySQL protocol.
+The sandbox contains a data directory, the configuration file proxysql.cnf, and the scripts
+start, stop, send_kill, status, use_proxy (connects through ProxySQL), and use_admin
+(connects to the ProxySQL admin interface).
+The ProxySQL sandbox is linked to its backend: "dbdeployer delete" on the backend
+removes the ProxySQL sandbox too.`,
+	Example: `
+	$ dbdeployer deploy replication 8.0.36
+	$ dbdeployer deploy proxysql --attach=rsandbox_8_0_36
+	$ ~/sandboxes/proxysql_rsandbox_8_0_36/use_proxy -e 'select @@port'
+	$ ~/sandboxes/proxysql_rsandbox_8_0_36/use_admin -e 'select * from runtime_mysql_servers'
+	`,
+	Args: cobra.NoArgs,
+	RunE: deployProxySQL,
+}
+
+func init() {
+	deployCmd.AddCommand(proxySQLCmd)
+	proxySQLCmd.Flags().String(globals.AttachLabel, "", "Sandbox that ProxySQL connects to")
+	proxySQLCmd.Flags().String(globals.ProxySQLBinaryLabel, "", "Path of the proxysql executable (default: found in $PATH)")
+	_ = proxySQLCmd.MarkFlagRequired(globals.AttachLabel)
+}
@@ -25,21 +25,24 @@ import (
 func replicationSandbox(cmd *cobra.Command, args []string) {
 	var sd sandbox.SandboxDef
 	var semisync bool
-	common.CheckOrigin(args)
-	sd, err := fillSandboxDefinition(cmd, args, false)
+	err := common.CheckOrigin(args)
+	common.ErrCheckExitf(err, 1, "%s", err)
+	sd, err = fillSandboxDefinition(cmd, args, false)
 	common.ErrCheckExitf(err, 1, "error filling sandbox definition : %s", err)
-	if sd.Flavor == common.TiDbFlavor {
-		common.Exitf(1, "flavor '%s' is not suitable to create replication sandboxes", common.TiDbFlavor)
-	}
 	sd.ReplOptions = sandbox.SingleTemplates[globals.TmplReplicationOptions].Contents
 	flags := cmd.Flags()
 	semisync, _ = flags.GetBool(globals.SemiSyncLabel)
 	ndbNodes, _ := flags.GetInt(globals.NdbNodesLabel)
 	nodes, _ := flags.GetInt(globals.NodesLabel)
 	topology, _ := flags.GetString(globals.TopologyLabel)
+	if sd.Flavor == common.TiDbFlavor && topology != globals.TiDBClusterLabel {
+		common.Exitf(1, "flavor '%s' is only suitable to create '%s' sandboxes", common.TiDbFlavor, globals.TiDBClusterLabel)
+	}
+	tikvNodes, _ := flags.GetInt(globals.TiKVNodesLabel)
 	masterIp, _ := flags.GetString(globals.MasterIpLabel)
 	masterList, _ := flags.GetString(globals.MasterListLabel)
 	slaveList, _ := flags.GetString(globals.SlaveListLabel)
+	chainSpec, _ := flags.GetString(globals.ChainSpecLabel)
 	sd.SinglePrimary, _ = flags.GetBool(globals.SinglePrimaryLabel)
 	replHistoryDir, _ := flags.GetBool(globals.ReplHistoryDirLabel)
 	if replHistoryDir {
@@ -49,6 +52,19 @@ func replicationSandbox(cmd *cobra.Command, args []string) {
 		masterList = ""
 		slaveList = ""
 	}
+	if chainSpec != "" {
+		if topology != globals.ChainLabel {
+			common.Exitf(1, "option '%s' can only be used with '%s' topology ",
+				globals.ChainSpecLabel,
+				globals.ChainLabel)
+		}
+		// When the number of nodes is not given explicitly, it is taken from the chain specification
+		if !flags.Changed(globals.NodesLabel) {
+			_, links, err := sandbox.ParseChainSpec(chainSpec)
+			common.ErrCheckExitf(err, 1, "error parsing chain specification: %s", err)
+			nodes = len(links) + 1
+		}
+	}
 	if semisync {
 		if topology != globals.MasterSlaveLabel {
 			common.Exit(1, "--semi-sync is only available with master/slave topology")
@@ -77,6 +93,16 @@ func replicationSandbox(cmd *cobra.Command, args []string) {
 			globals.NdbLabel)
 
 	}
+	if tikvNodes != globals.TiKVNodesValue && topology != globals.TiDBClusterLabel {
+		common.Exitf(1, "option '%s' can only be used with '%s' topology ",
+			globals.TiKVNodesLabel,
+			globals.TiDBClusterLabel)
+	}
+	nodeVersions, _ := flags.GetString(globals.NodeVersionsLabel)
+	if nodeVersions != "" {
+		sd.NodeVersions, err = sandbox.ParseNodeVersions(nodeVersions, common.DirName(sd.Basedir))
+		common.ErrCheckExitf(err, 1, "error parsing node versions: %s", err)
+	}
 	origin := args[0]
 	if args[0] != sd.BasedirName {
 		origin = sd.BasedirName
@@ -86,9 +112,11 @@ func replicationSandbox(cmd *cobra.Command, args []string) {
 			Topology:   topology,
 			Nodes:      nodes,
 			NdbNodes:   ndbNodes,
+			TiKVNodes:  tikvNodes,
 			MasterIp:   masterIp,
 			MasterList: masterList,
-			SlaveList:  slaveList})
+			SlaveList:  slaveList,
+			ChainSpec:  chainSpec})
 	if err != nil {
 		common.Exitf(1, globals.ErrCreatingSandbox, err)
 	}
@@ -101,7 +129,21 @@ var replicationCmd = &cobra.Command{
 	Long: `The replication command allows you to deploy several nodes in replication.
 Allowed topologies are "master-slave" for all versions, and  "group", "all-masters", "fan-in"
 for  5.7.17+.
+Topology "circular" (each node replicates from the previous one, in a ring) requires 5.6.9+.
+Topology "chain" deploys cascading replication, where some slaves are masters of other slaves.
+The shape of the tree can be set with --chain-spec (e.g. "1>2>3,2>4": node 2 replicates from 1,
+nodes 3 and 4 replicate from 2). Without it, nodes are deployed as a linear chain.
+With topologies "master-slave", "fan-in", and "all-masters", nodes can use different versions
+or flavors, with --node-versions (e.g. "1:5.7.44,2:8.0.36"): the listed nodes use the given
+binaries, and the other nodes use the main version.
+Topology "innodb-cluster" (8.0.11+) deploys a group that MySQL Shell makes an InnoDB Cluster
+through the AdminAPI. It needs mysqlsh, either merged into the server binaries with
+"dbdeployer unpack --shell" or in $PATH. A router for the cluster is deployed with "dbdeployer deploy router".
 Topologies "pcx" and "ndb" are available for binaries of type Percona Xtradb Cluster and MySQL Cluster.
+Topology "galera" is available for MariaDB binaries (10.1+) that include the Galera library.
+With --gtid, MariaDB master-slave replication uses MariaDB GTID (MASTER_USE_GTID=slave_pos).
+Topology "tidb-cluster" deploys, from TiDB binaries, one PD server, several TiKV servers (--tikv-nodes),
+and the TiDB servers (--nodes). Like a single TiDB sandbox, it needs a MySQL client (--client-from).
 For this command to work, there must be a directory $HOME/opt/mysql/5.7.21, containing
 the binary files from mysql-5.7.21-$YOUR_OS-x86_64.tar.gz
 Use the "unpack" command to get the tarball into the right directory.
@@ -124,8 +166,16 @@ Use the "unpack" command to get the tarball into the right directory.
 		$ dbdeployer deploy --topology=group replication 8.0 --single-primary
 		$ dbdeployer deploy --topology=all-masters replication 5.7
 		$ dbdeployer deploy --topology=fan-in replication 5.7
+		$ dbdeployer deploy --topology=circular replication 8.0 --nodes=4
+		$ dbdeployer deploy --topology=innodb-cluster replication 8.0
+		$ dbdeployer deploy --topology=chain replication 8.0
+		$ dbdeployer deploy --topology=chain replication 8.0 --chain-spec='1>2>3,2>4,1>5'
+		$ dbdeployer deploy replication 8.0.36 --node-versions='1:5.7.44,3:ps8.0.35'
 		$ dbdeployer deploy --topology=pxc replication pxc5.7.25
+		$ dbdeployer deploy --topology=galera replication 10.11.6
+		$ dbdeployer deploy replication 10.11.6 --gtid
 		$ dbdeployer deploy --topology=ndb replication ndb8.0.14
+		$ dbdeployer deploy --topology=tidb-cluster replication tidb7.5.0 --tikv-nodes=3 --nodes=1 --client-from=8.0.36
 	`,
 	Annotations: map[string]string{"export": ExportAnnotationToJson(ReplicationExport)},
 }
@@ -134,10 +184,13 @@ func init() {
 	deployCmd.AddCommand(replicationCmd)
 	replicationCmd.PersistentFlags().StringP(globals.MasterListLabel, "", "", "Which nodes are masters in a multi-source deployment")
 	replicationCmd.PersistentFlags().StringP(globals.SlaveListLabel, "", "", "Which nodes are slaves in a multi-source deployment")
+	replicationCmd.PersistentFlags().StringP(globals.ChainSpecLabel, "", "", "Shape of the replication tree for chain topology (e.g. '1>2>3,2>4')")
+	replicationCmd.PersistentFlags().String(globals.NodeVersionsLabel, "", "Binaries for specific nodes, overriding the main version (e.g. '1:5.7.44,2:8.0.36')")
 	replicationCmd.PersistentFlags().StringP(globals.MasterIpLabel, "", globals.MasterIpValue, "Which IP the slaves will connect to")
 	replicationCmd.PersistentFlags().StringP(globals.TopologyLabel, "t", globals.TopologyValue, "Which topology will be installed")
 	replicationCmd.PersistentFlags().IntP(globals.NodesLabel, "n", globals.NodesValue, "How many nodes will be installed")
 	replicationCmd.PersistentFlags().IntP(globals.NdbNodesLabel, "", globals.NdbNodesValue, "How many NDB nodes will be installed")
+	replicationCmd.PersistentFlags().IntP(globals.TiKVNodesLabel, "", globals.TiKVNodesValue, "How many TiKV servers will be installed (tidb-cluster)")
 	replicationCmd.PersistentFlags().BoolP(globals.SinglePrimaryLabel, "", false, "Using single primary for group replication")
 	replicationCmd.PersistentFlags().BoolP(globals.SemiSyncLabel, "", false, "Use semi-synchronous plugin")
 	replicationCmd.PersistentFlags().BoolP(globals.ReadOnlyLabel, "", false, "Set read-only for slaves")
@@ -94,16 +94,18 @@ func checkDefaultsFile() {
 			common.Exitf(1, globals.ErrFileNotFound, defaults.CustomConfigurationFile)
 		}
 	}
-	defaults.LoadConfiguration()
+	err := defaults.LoadConfiguration()
+	common.ErrCheckExitf(err, 1, "%s", err)
 
 	shellPath, _ := flags.GetString(globals.ShellPathLabel)
 
-	shellPath, err := common.GetBashPath(shellPath)
+	shellPath, err = common.GetBashPath(shellPath)
 	if err != nil {
 		common.Exitf(1, "error validating shell '%s'", err)
 	}
 	if defaults.ValidateDefaults(defaults.Defaults()) {
-		defaults.UpdateDefaults(globals.ShellPathLabel, shellPath, false)
+		err = defaults.UpdateDefaults(globals.ShellPathLabel, shellPath, false)
+		common.ErrCheckExitf(err, 1, "%s", err)
 	}
 	err = sandbox.FillMockTemplates()
 	if err != nil {
@@ -150,6 +152,7 @@ func init() {
 	setPflag(rootCmd, globals.SandboxBinaryLabel, "", "SANDBOX_BINARY", defaults.Defaults().SandboxBinary, "Binary repository", false)
 	setPflag(rootCmd, globals.ShellPathLabel, "", "SHELL_PATH", common.Which("bash"), "Path to Bash, used for generated scripts", false)
 	rootCmd.PersistentFlags().BoolP(globals.SkipLibraryCheck, "", false, "Skip check for needed libraries (may cause nasty errors)")
+	rootCmd.PersistentFlags().String(globals.OutputLabel, globals.OutputTable, "Output format of listing commands {table|json|yaml|csv}")
 
 	rootCmd.InitDefaultVersionFlag()
 
@@ -0,0 +1,103 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/sandbox"
+)
+
+func deployRouter(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	sandboxBinary, err := getAbsolutePathFromFlag(cmd, globals.SandboxBinaryLabel)
+	if err != nil {
+		return err
+	}
+	sandboxHome, err := getAbsolutePathFromFlag(cmd, globals.SandboxHomeLabel)
+	if err != nil {
+		return err
+	}
+	basedir := path.Join(sandboxBinary, args[0])
+	if !common.DirExists(basedir) {
+		return fmt.Errorf(globals.ErrDirectoryNotFound, basedir)
+	}
+	version := regexp.MustCompile(`\d+\.\d+\.\d+`).FindString(args[0])
+	if version == "" {
+		return fmt.Errorf("no version found in router directory name '%s'", args[0])
+	}
+	clusterName, _ := flags.GetString(globals.ClusterLabel)
+	clusterDir := path.Join(sandboxHome, clusterName)
+	if !common.DirExists(clusterDir) {
+		return fmt.Errorf(globals.ErrDirectoryNotFound, clusterDir)
+	}
+	installedPorts, err := common.GetInstalledPorts(sandboxHome)
+	if err != nil {
+		return err
+	}
+	routerDef := sandbox.RouterDef{
+		Basedir:        basedir,
+		Version:        version,
+		SandboxDir:     sandboxHome,
+		ClusterDir:     clusterDir,
+		InstalledPorts: append(installedPorts, defaults.Defaults().ReservedPorts...),
+		ShellPath:      defaults.Defaults().ShellPath,
+	}
+	routerDef.DirName, _ = flags.GetString(globals.SandboxDirectoryLabel)
+	routerDef.BasePort, _ = flags.GetInt(globals.BasePortLabel)
+	routerDef.SkipStart, _ = flags.GetBool(globals.SkipStartLabel)
+	routerDef.ExpiresAt, err = deployExpiration(cmd)
+	if err != nil {
+		return err
+	}
+	return sandbox.CreateRouterSandbox(routerDef)
+}
+
+var routerCmd = &cobra.Command{
+	Use:   "router router-binaries-dir --cluster=sandbox_name",
+	Short: "deploys a MySQL Router for an InnoDB Cluster sandbox",
+	Long: `Bootstraps MySQL Router against a running InnoDB Cluster sandbox
+(deployed with "dbdeployer deploy replication --topology=innodb-cluster").
+The router binaries must be in a directory under $SANDBOX_BINARY, such as the one
+created by "dbdeployer unpack --prefix=router mysql-router-8.0.36-linux-glibc2.28-x86_64.tar.xz",
+which is named "router8.0.36".
+The router sandbox uses six consecutive ports, starting at --base-port
+(default: router-base-port): classic read-write, classic read-only, X read-write,
+X read-only, read-write splitting (8.2+), and HTTP server.
+The sandbox contains the scripts start, stop, send_kill, status, and use_rw and use_ro,
+which connect to the cluster through the read-write and read-only ports.`,
+	Example: `
+	$ dbdeployer deploy replication 8.0.36 --topology=innodb-cluster
+	$ dbdeployer deploy router router8.0.36 --cluster=ic_msb_8_0_36
+	$ ~/sandboxes/router_ic_msb_8_0_36/use_rw -e 'select @@port'
+	`,
+	Args:        cobra.ExactArgs(1),
+	RunE:        deployRouter,
+	Annotations: map[string]string{"export": makeExportArgs(globals.ExportVersionDir, 1)},
+}
+
+func init() {
+	deployCmd.AddCommand(routerCmd)
+	routerCmd.Flags().String(globals.ClusterLabel, "", "InnoDB Cluster sandbox that the router connects to")
+	_ = routerCmd.MarkFlagRequired(globals.ClusterLabel)
+}
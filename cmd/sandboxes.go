@@ -17,6 +17,8 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"path"
 	"sort"
 	"time"
 
@@ -27,8 +29,148 @@ import (
 	"github.com/datacharmer/dbdeployer/common"
 	"github.com/datacharmer/dbdeployer/defaults"
 	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/ops"
 )
 
+// sandboxNodeHealthRecord is the CSV output of a sandbox node health
+type sandboxNodeHealthRecord struct {
+	Sandbox string `json:"sandbox"`
+	ops.NodeHealth
+}
+
+// sandboxInfoRecords converts the sandboxes found in a directory to the structured output format.
+// The catalog entry is used when available. Otherwise, the record is built from the sandbox description
+func sandboxInfoRecords(sandboxHome string, sandboxList common.SandboxInfoList) []ops.SandboxRecord {
+	catalog, err := defaults.ReadCatalog()
+	common.ErrCheckExitf(err, 1, "error getting sandboxes from catalog: %s", err)
+	var records []ops.SandboxRecord
+	for _, sb := range sandboxList {
+		sandboxDir := path.Join(sandboxHome, sb.SandboxName)
+		item, found := catalog[sandboxDir]
+		if !found {
+			item = defaults.SandboxItem{
+				Origin:            sb.SandboxDesc.Basedir,
+				SBType:            sb.SandboxDesc.SBType,
+				Version:           sb.SandboxDesc.Version,
+				Flavor:            sb.SandboxDesc.Flavor,
+				Host:              sb.SandboxDesc.Host,
+				Port:              sb.SandboxDesc.Port,
+				Destination:       sandboxDir,
+				DbDeployerVersion: sb.SandboxDesc.DbDeployerVersion,
+				Timestamp:         sb.SandboxDesc.Timestamp,
+				CommandLine:       sb.SandboxDesc.CommandLine,
+			}
+		}
+		records = append(records, ops.SandboxRecord{Name: sb.SandboxName, SandboxItem: item})
+	}
+	return records
+}
+
+// Sandboxes that expire within this interval get a warning in the sandboxes list
+const expirationWarningInterval = time.Hour
+
+// expirationWarnings returns a warning for each of the given sandboxes that has expired,
+// or will expire within expirationWarningInterval
+func expirationWarnings(catalog defaults.SandboxCatalog, sandboxDirs []string, now time.Time) []string {
+	var warnings []string
+	for _, sandboxDir := range sandboxDirs {
+		expiration, ok := catalog[sandboxDir].ExpirationTime()
+		if !ok || expiration.Sub(now) > expirationWarningInterval {
+			continue
+		}
+		name := common.BaseName(sandboxDir)
+		if expiration.After(now) {
+			warnings = append(warnings, fmt.Sprintf("sandbox %s expires in %s (%s)",
+				name, expiration.Sub(now).Round(time.Minute), expiration.Format(time.RFC3339)))
+		} else {
+			warnings = append(warnings, fmt.Sprintf("sandbox %s expired at %s: 'dbdeployer gc' will remove it",
+				name, expiration.Format(time.RFC3339)))
+		}
+	}
+	return warnings
+}
+
+// warnExpiringSandboxes prints the expiration warnings to the standard error,
+// so that the list of sandboxes can still be used by other tools
+func warnExpiringSandboxes(catalog defaults.SandboxCatalog, sandboxDirs []string) {
+	for _, warning := range expirationWarnings(catalog, sandboxDirs, time.Now()) {
+		_, _ = fmt.Fprintf(os.Stderr, "# WARNING: %s\n", warning)
+	}
+}
+
+func showSandboxesHealth(outputFormat string) {
+	healthList, err := ops.SandboxesHealthCheck()
+	common.ErrCheckExitf(err, 1, "error getting sandboxes health: %s", err)
+	switch outputFormat {
+	case globals.OutputTable:
+	case globals.OutputCsv:
+		var records []sandboxNodeHealthRecord
+		for _, sb := range healthList {
+			for _, node := range sb.Nodes {
+				records = append(records, sandboxNodeHealthRecord{Sandbox: sb.Name, NodeHealth: node})
+			}
+		}
+		printStructured(outputFormat, records)
+		return
+	default:
+		printStructured(outputFormat, healthList)
+		return
+	}
+	if len(healthList) == 0 {
+		return
+	}
+	table := simpletable.New()
+	table.Header = &simpletable.Header{
+		Cells: []*simpletable.Cell{
+			{Align: simpletable.AlignCenter, Text: "name"},
+			{Align: simpletable.AlignCenter, Text: "node"},
+			{Align: simpletable.AlignCenter, Text: "port"},
+			{Align: simpletable.AlignCenter, Text: "status"},
+			{Align: simpletable.AlignCenter, Text: "version"},
+			{Align: simpletable.AlignCenter, Text: "uptime"},
+			{Align: simpletable.AlignCenter, Text: "read-only"},
+			{Align: simpletable.AlignCenter, Text: "replication"},
+			{Align: simpletable.AlignCenter, Text: "group"},
+		},
+	}
+	for _, sb := range healthList {
+		for _, node := range sb.Nodes {
+			status := "off"
+			if node.Running {
+				status = "on"
+			}
+			readOnly := ""
+			if node.ReadOnly {
+				readOnly = "yes"
+			}
+			replication := ""
+			for _, channel := range node.Replication {
+				lag := "-"
+				if channel.Lag != nil {
+					lag = fmt.Sprintf("%d", *channel.Lag)
+				}
+				if replication != "" {
+					replication += " "
+				}
+				replication += fmt.Sprintf("%d:%s/%s/%s", channel.MasterPort, channel.IoRunning, channel.SqlRunning, lag)
+			}
+			table.Body.Cells = append(table.Body.Cells, []*simpletable.Cell{
+				{Text: sb.Name},
+				{Text: node.Node},
+				{Align: simpletable.AlignRight, Text: fmt.Sprintf("%d", node.Port)},
+				{Text: status},
+				{Text: node.Version},
+				{Align: simpletable.AlignRight, Text: fmt.Sprintf("%d", node.Uptime)},
+				{Text: readOnly},
+				{Text: replication},
+				{Text: node.GroupMemberState},
+			})
+		}
+	}
+	table.SetStyle(simpletable.StyleCompactLite)
+	table.Println()
+}
+
 func showSandboxesFromCatalog(currentSandboxHome string, useFlavor, useHeader, useTable bool) {
 	var sandboxList defaults.SandboxCatalog
 	var err error
@@ -80,6 +222,12 @@ func showSandboxesFromCatalog(currentSandboxHome string, useFlavor, useHeader, u
 		table.SetStyle(simpletable.StyleRounded)
 	}
 	table.Println()
+	var sandboxDirs []string
+	for name := range sandboxList {
+		sandboxDirs = append(sandboxDirs, name)
+	}
+	sort.Strings(sandboxDirs)
+	warnExpiringSandboxes(sandboxList, sandboxDirs)
 }
 
 // Shows installed sandboxes
@@ -114,7 +262,19 @@ func showSandboxes(cmd *cobra.Command, args []string) {
 		useTable = true
 		useHost = true
 	}
+	showHealth, _ := flags.GetBool(globals.HealthLabel)
+	outputFormat, isStructured := structuredOutputFormat(cmd)
+	if showHealth {
+		showSandboxesHealth(outputFormat)
+		return
+	}
 	if readCatalog {
+		if isStructured {
+			catalog, err := defaults.ReadCatalog()
+			common.ErrCheckExitf(err, 1, "error getting sandboxes from catalog: %s", err)
+			printStructured(outputFormat, ops.CatalogRecords(catalog))
+			return
+		}
 		showSandboxesFromCatalog(SandboxHome, useFlavor, useHeader, useTable)
 		return
 	}
@@ -136,7 +296,7 @@ func showSandboxes(cmd *cobra.Command, args []string) {
 			useHost = true
 		}
 	}
-	if len(sandboxList) == 0 {
+	if len(sandboxList) == 0 && !isStructured {
 		return
 	}
 
@@ -153,12 +313,16 @@ func showSandboxes(cmd *cobra.Command, args []string) {
 			return sandboxList[i].SandboxDesc.Flavor < sandboxList[j].SandboxDesc.Flavor
 		})
 	}
-	if oldest {
+	if oldest && len(sandboxList) > 0 {
 		sandboxList = common.SandboxInfoList{sandboxList[0]}
 	}
-	if latest {
+	if latest && len(sandboxList) > 0 {
 		sandboxList = common.SandboxInfoList{sandboxList[len(sandboxList)-1]}
 	}
+	if isStructured {
+		printStructured(outputFormat, sandboxInfoRecords(SandboxHome, sandboxList))
+		return
+	}
 
 	table := simpletable.New()
 
@@ -252,6 +416,14 @@ func showSandboxes(cmd *cobra.Command, args []string) {
 		table.SetStyle(simpletable.StyleRounded)
 	}
 	table.Println()
+	catalog, err := defaults.ReadCatalog()
+	if err == nil {
+		var sandboxDirs []string
+		for _, sb := range sandboxList {
+			sandboxDirs = append(sandboxDirs, path.Join(SandboxHome, sb.SandboxName))
+		}
+		warnExpiringSandboxes(catalog, sandboxDirs)
+	}
 }
 
 var sandboxesCmd = &cobra.Command{
@@ -262,6 +434,17 @@ If sandboxes are installed in a different location, use --sandbox-home to
 indicate where to look.
 Alternatively, using --catalog will list all sandboxes, regardless of where 
 they were deployed.
+Using --health, dbdeployer connects to every node of the sandboxes in the catalog
+and reports uptime, version, read_only, executed GTIDs, replication threads and lag,
+group replication member state, and the last lines of the error log.
+Use --output=json|yaml|csv to get data that can be parsed by other tools.
+Sandboxes deployed with --ttl or --expires-at get a warning when they expire within one hour,
+or when they have expired and are waiting for "dbdeployer gc".
+`,
+	Example: `
+	$ dbdeployer sandboxes --health
+	$ dbdeployer sandboxes --health --output=json
+	$ dbdeployer sandboxes --catalog --output=json
 `,
 	Aliases: []string{"installed", "deployed"},
 	Run:     showSandboxes,
@@ -280,4 +463,5 @@ func init() {
 	sandboxesCmd.Flags().BoolP(globals.ByVersionLabel, "", false, "Show sandboxes sorted by version")
 	sandboxesCmd.Flags().BoolP(globals.LatestLabel, "", false, "Show only latest sandbox")
 	sandboxesCmd.Flags().BoolP(globals.OldestLabel, "", false, "Show only oldest sandbox")
+	sandboxesCmd.Flags().BoolP(globals.HealthLabel, "", false, "Show live health data for each node of the catalogued sandboxes")
 }
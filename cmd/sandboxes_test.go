@@ -0,0 +1,41 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/datacharmer/dbdeployer/compare"
+	"github.com/datacharmer/dbdeployer/defaults"
+)
+
+func TestExpirationWarnings(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	catalog := defaults.SandboxCatalog{
+		"/sandboxes/msb_expired":   {ExpiresAt: now.Add(-time.Minute).Format(time.RFC3339)},
+		"/sandboxes/msb_expiring":  {ExpiresAt: now.Add(20 * time.Minute).Format(time.RFC3339)},
+		"/sandboxes/msb_later":     {ExpiresAt: now.Add(3 * time.Hour).Format(time.RFC3339)},
+		"/sandboxes/msb_permanent": {},
+	}
+	sandboxDirs := []string{"/sandboxes/msb_expired", "/sandboxes/msb_expiring",
+		"/sandboxes/msb_later", "/sandboxes/msb_permanent", "/sandboxes/msb_uncatalogued"}
+	warnings := expirationWarnings(catalog, sandboxDirs, now)
+	compare.OkEqualStringSlices(t, warnings, []string{
+		"sandbox msb_expired expired at 2024-05-10T11:59:00Z: 'dbdeployer gc' will remove it",
+		"sandbox msb_expiring expires in 20m0s (2024-05-10T12:20:00Z)",
+	})
+}
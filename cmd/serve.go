@@ -0,0 +1,93 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/spf13/cobra"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/ops"
+)
+
+func runServe(cmd *cobra.Command, args []string) error {
+	var options ops.ServeOptions
+	var err error
+	options.Listen, _ = cmd.Flags().GetString(globals.ListenLabel)
+	options.SandboxHome, err = getAbsolutePathFromFlag(cmd, globals.SandboxHomeLabel)
+	if err != nil {
+		return err
+	}
+	options.SandboxBinary, err = getAbsolutePathFromFlag(cmd, globals.SandboxBinaryLabel)
+	if err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(options.Listen)
+	if err != nil {
+		return fmt.Errorf("invalid listen address '%s': %s", options.Listen, err)
+	}
+	ip := net.ParseIP(host)
+	if host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		common.CondPrintf("WARNING: the API has no authentication, and %s is not a loopback address\n", host)
+	}
+	return ops.Serve(options)
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Runs a local REST API server",
+	Long: `Runs a server that exposes the main dbdeployer operations as a REST API with JSON bodies.
+The server uses the sandbox home and the binary repository given in the global options.
+Deployments run inside the server process. Operations that change sandboxes or binaries
+are executed one at a time, and hold the catalog lock until they end: meanwhile, other
+dbdeployer commands that use the catalog fail with a lock error.
+The API has no authentication: keep the server listening on a loopback address.
+
+    GET    /api/v1/sandboxes              list of catalogued sandboxes
+    POST   /api/v1/sandboxes              deploys a sandbox
+    GET    /api/v1/sandboxes/NAME         live status of a sandbox
+    DELETE /api/v1/sandboxes/NAME         deletes a sandbox
+    POST   /api/v1/sandboxes/NAME/start   starts a sandbox
+    POST   /api/v1/sandboxes/NAME/stop    stops a sandbox
+    GET    /api/v1/versions[?flavor=F]    list of available versions
+    POST   /api/v1/downloads              downloads a tarball
+
+The body of a deployment has the field names of the sandbox definition (Version, DirName,
+Port, DbUser, MyCnfOptions, etc.) plus Type (single, multiple, replication), Topology,
+Nodes, Gtid, SemiSync, MasterList, SlaveList, and ChainSpec. The fields that name files
+on the server (MyCnfFile, PreGrantsSqlFile, PostGrantsSqlFile, HistoryDir) are rejected.
+The body of a download has the field names of the downloads options
+(TarballName, Version, Flavor, Minimal, Newest, Unpack, etc.).
+Errors are returned as {"error": "..."}.
+`,
+	Example: `
+	$ dbdeployer serve --listen=127.0.0.1:8123
+	$ curl -X POST -d '{"Type":"single","Version":"8.0.36","Gtid":true}' http://127.0.0.1:8123/api/v1/sandboxes
+	$ curl http://127.0.0.1:8123/api/v1/sandboxes/msb_8_0_36
+	$ curl -X POST http://127.0.0.1:8123/api/v1/sandboxes/msb_8_0_36/stop
+	$ curl -X DELETE http://127.0.0.1:8123/api/v1/sandboxes/msb_8_0_36
+`,
+	Args: cobra.NoArgs,
+	RunE: runServe,
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().String(globals.ListenLabel, globals.DefaultListenAddress, "Address where the API server listens")
+}
@@ -72,7 +72,8 @@ func processDefaults(newDefaults []string) {
 		if len(list) == 2 {
 			label := list[0]
 			value := list[1]
-			defaults.UpdateDefaults(label, value, false)
+			err := defaults.UpdateDefaults(label, value, false)
+			common.ErrCheckExitf(err, 1, "%s", err)
 		}
 	}
 }
@@ -90,15 +91,15 @@ func getAbsolutePathFromFlag(cmd *cobra.Command, name string) (string, error) {
 }
 
 func checkIfAbridgedVersion(version, basedir string) string {
-	fullPattern := regexp.MustCompile(`\d\.\d+\.\d+$`)
-	if fullPattern.MatchString(version) {
+	if common.IsVersion(version) {
 		return version
 	}
 	validPattern := regexp.MustCompile(`\d+\.\d+$`)
 	if !validPattern.MatchString(version) {
 		return version
 	}
-	fullVersion := common.LatestVersion(basedir, version)
+	fullVersion, err := common.LatestVersion(basedir, version)
+	common.ErrCheckExitf(err, 1, "%s", err)
 	if fullVersion == "" {
 		common.Exitf(1, "FATAL: no full version found for %s in %s\n", version, basedir)
 	} else {
@@ -120,33 +121,8 @@ func checkForRootValue(value, label, defaultVal string) {
 // Gets the Database flavor
 // If none is found, defaults to MySQL
 func getFlavor(userDefinedFlavor, basedir string) string {
-	flavorOrigin := ""
-	flavor := userDefinedFlavor
-	if userDefinedFlavor != "" {
-		flavorOrigin = "flag"
-	}
-	flavorFile := path.Join(basedir, globals.FlavorFileName)
-	if common.FileExists(flavorFile) {
-		flavorText, err := common.SlurpAsString(flavorFile)
-		if err != nil {
-			common.Exitf(1, "error reading flavor file %s: %s", flavorFile, err)
-		}
-		flavorText = strings.TrimSpace(flavorText)
-		if userDefinedFlavor != "" && userDefinedFlavor != flavorText {
-			common.Exitf(1, "user defined flavor %s doesn't match found flavor %s", userDefinedFlavor, flavorText)
-		}
-		flavor = flavorText
-		flavorOrigin = "FLAVOR file"
-	}
-	// Flavor detection based on tarball contents
-	if flavor == "" {
-		flavor = common.DetectBinaryFlavor(basedir)
-		flavorOrigin = "Binary examination"
-	}
-	err := common.CheckFlavorSupport(flavor)
-	if err != nil {
-		common.Exitf(1, "flavor detected from %s unsupported: %s", flavorOrigin, err)
-	}
+	flavor, err := common.GetBinaryFlavor(userDefinedFlavor, basedir)
+	common.ErrCheckExitf(err, 1, "%s", err)
 	return flavor
 }
 
@@ -170,7 +146,10 @@ func fillSandboxDefinition(cmd *cobra.Command, args []string, usingImport bool)
 			return sd, err
 		}
 		if logDir != "" {
-			defaults.UpdateDefaults(globals.LogLogDirectoryLabel, logDir, false)
+			err = defaults.UpdateDefaults(globals.LogLogDirectoryLabel, logDir, false)
+			if err != nil {
+				return sd, err
+			}
 		}
 	}
 	templateRequests, _ := flags.GetStringArray(globals.UseTemplateLabel)
@@ -200,6 +179,13 @@ func fillSandboxDefinition(cmd *cobra.Command, args []string, usingImport bool)
 		sd.Version = args[0]
 		oldVersion := sd.Version
 		sd.Version = checkIfAbridgedVersion(sd.Version, basedir)
+		if !strings.Contains(sd.Version, "/") {
+			// 8.0.35 can select the only build of that version, such as 8.0.35-27
+			sd.Version, err = common.ResolveVersionBuild(basedir, sd.Version)
+			if err != nil {
+				return sd, err
+			}
+		}
 		if oldVersion != sd.Version {
 			sd.BasedirName = sd.Version
 		}
@@ -352,6 +338,11 @@ func fillSandboxDefinition(cmd *cobra.Command, args []string, usingImport bool)
 	sd.MyCnfFile, _ = flags.GetString(globals.MyCnfFileLabel)
 	sd.NativeAuthPlugin, _ = flags.GetBool(globals.NativeAuthPluginLabel)
 	sd.KeepUuid, _ = flags.GetBool(globals.KeepServerUuidLabel)
+	sd.UseDatadirCache, _ = flags.GetBool(globals.DatadirCacheLabel)
+	sd.ExpiresAt, err = deployExpiration(cmd)
+	if err != nil {
+		return sd, err
+	}
 	sd.Force, _ = flags.GetBool(globals.ForceLabel)
 	sd.ExposeDdTables, _ = flags.GetBool(globals.ExposeDdTablesLabel)
 	sd.InitGeneralLog, _ = flags.GetBool(globals.InitGeneralLogLabel)
@@ -369,57 +360,12 @@ func fillSandboxDefinition(cmd *cobra.Command, args []string, usingImport bool)
 	newDefaults, _ := flags.GetStringArray(globals.DefaultsLabel)
 	processDefaults(newDefaults)
 
-	var gtid bool
-	var master bool
-	var replCrashSafe bool
-	master, _ = flags.GetBool(globals.MasterLabel)
-	gtid, _ = flags.GetBool(globals.GtidLabel)
-	replCrashSafe, _ = flags.GetBool(globals.ReplCrashSafeLabel)
-	if master {
-		sd.ReplOptions = sandbox.SingleTemplates[globals.TmplReplicationOptions].Contents
-		if sd.ServerId == 0 {
-			sd.PortAsServerId = true
-		} else {
-			sd.PortAsServerId = false
-		}
-	}
-	if gtid {
-		templateName := globals.TmplGtidOptions56
-		// 5.7.0
-		// isEnhancedGtid, err := common.GreaterOrEqualVersion(sd.Version, globals.MinimumEnhancedGtidVersion)
-		isEnhancedGtid, err := common.HasCapability(sd.Flavor, common.EnhancedGTID, sd.Version)
-		common.ErrCheckExitf(err, 1, globals.ErrWhileComparingVersions)
-		if isEnhancedGtid {
-			templateName = globals.TmplGtidOptions57
-		}
-		// 5.6.9
-		//isMinimumGtid, err := common.GreaterOrEqualVersion(sd.Version, globals.MinimumGtidVersion)
-		isMinimumGtid, err := common.HasCapability(sd.Flavor, common.GTID, sd.Version)
-		common.ErrCheckExitf(err, 1, globals.ErrWhileComparingVersions)
-		if isMinimumGtid {
-			sd.GtidOptions = sandbox.SingleTemplates[templateName].Contents
-			sd.ReplCrashSafeOptions = sandbox.SingleTemplates[globals.TmplReplCrashSafeOptions].Contents
-			sd.ReplOptions = sandbox.SingleTemplates[globals.TmplReplicationOptions].Contents
-			if sd.ServerId == 0 {
-				sd.PortAsServerId = true
-			} else {
-				sd.PortAsServerId = false
-			}
-		} else {
-			common.Exitf(1, globals.ErrOptionRequiresVersion, globals.GtidLabel, common.IntSliceToDottedString(globals.MinimumGtidVersion))
-		}
-	}
-	if replCrashSafe && sd.ReplCrashSafeOptions == "" {
-		// 5.6.2
-
-		// isMinimumCrashSafe, err := common.GreaterOrEqualVersion(sd.Version, globals.MinimumCrashSafeVersion)
-		isMinimumCrashSafe, err := common.HasCapability(sd.Flavor, common.CrashSafe, sd.Version)
-		common.ErrCheckExitf(err, 1, globals.ErrWhileComparingVersions)
-		if isMinimumCrashSafe {
-			sd.ReplCrashSafeOptions = sandbox.SingleTemplates[globals.TmplReplCrashSafeOptions].Contents
-		} else {
-			common.Exitf(1, globals.ErrOptionRequiresVersion, globals.ReplCrashSafeLabel, common.IntSliceToDottedString(globals.MinimumCrashSafeVersion))
-		}
+	master, _ := flags.GetBool(globals.MasterLabel)
+	gtid, _ := flags.GetBool(globals.GtidLabel)
+	replCrashSafe, _ := flags.GetBool(globals.ReplCrashSafeLabel)
+	sd, err = sandbox.SetReplicationOptions(sd, master, gtid, replCrashSafe)
+	if err != nil {
+		common.Exitf(1, "%s", err)
 	}
 	if flags.Changed(globals.DefaultRoleLabel) ||
 		flags.Changed(globals.CustomRoleNameLabel) ||
@@ -440,7 +386,8 @@ func fillSandboxDefinition(cmd *cobra.Command, args []string, usingImport bool)
 func singleSandbox(cmd *cobra.Command, args []string) {
 	var sd sandbox.SandboxDef
 	var err error
-	common.CheckOrigin(args)
+	err = common.CheckOrigin(args)
+	common.ErrCheckExitf(err, 1, "%s", err)
 	sd, err = fillSandboxDefinition(cmd, args, false)
 	if err != nil {
 		common.Exitf(1, "error while filling the sandbox definition: %+v", err)
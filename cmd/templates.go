@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"sort"
 	"strings"
 
 	"github.com/datacharmer/dbdeployer/common"
@@ -29,10 +30,10 @@ import (
 )
 
 type TemplateInfo struct {
-	TemplateInFile bool
-	Group          string
-	Name           string
-	Description    string
+	TemplateInFile bool   `json:"in-file"`
+	Group          string `json:"group"`
+	Name           string `json:"name"`
+	Description    string `json:"description"`
 }
 
 func findTemplate(requested string) (group, templateName, contents string) {
@@ -103,6 +104,17 @@ func listTemplates(cmd *cobra.Command, args []string) {
 	simpleList, _ := flags.GetBool(globals.SimpleLabel)
 
 	templates := getTemplatesList(wanted)
+	outputFormat, isStructured := structuredOutputFormat(cmd)
+	if isStructured {
+		sort.Slice(templates, func(i, j int) bool {
+			if templates[i].Group != templates[j].Group {
+				return templates[i].Group < templates[j].Group
+			}
+			return templates[i].Name < templates[j].Name
+		})
+		printStructured(outputFormat, templates)
+		return
+	}
 	for _, template := range templates {
 		origin := "   "
 		if template.TemplateInFile {
@@ -73,11 +73,18 @@ you can call 'deploy single', 'deploy multiple', and 'deploy replication' comman
 the MySQL version for that tarball.
 If the version is not contained in the tarball name, it should be supplied using --unpack-version.
 If there is already an expanded tarball with the same version, a new one can be differentiated with --prefix.
+The vendor build number, the pre-release tag, and the build variant (debug, valgrind, asan)
+found after the version are kept in the directory name (e.g. 8.0.35-27 for Percona Server 8.0.35-27),
+so that several builds of the same version can coexist. Such builds can be deployed using the full name
+(8.0.35-27), or using the version alone (8.0.35) when there is only one build.
 `,
 	Run: unpackTarball,
 	Example: `
     $ dbdeployer unpack mysql-8.0.4-rc-linux-glibc2.12-x86_64.tar.gz
-    Unpacking tarball mysql-8.0.4-rc-linux-glibc2.12-x86_64.tar.gz to $HOME/opt/mysql/8.0.4
+    Unpacking tarball mysql-8.0.4-rc-linux-glibc2.12-x86_64.tar.gz to $HOME/opt/mysql/8.0.4-rc
+
+    $ dbdeployer unpack Percona-Server-8.0.35-27-Linux.x86_64.glibc2.17-minimal.tar.gz
+    Unpacking tarball Percona-Server-8.0.35-27-Linux.x86_64.glibc2.17-minimal.tar.gz to $HOME/opt/mysql/8.0.35-27
 
     $ dbdeployer unpack --prefix=ps Percona-Server-5.7.21-linux.tar.gz
     Unpacking tarball Percona-Server-5.7.21-linux.tar.gz to $HOME/opt/mysql/ps5.7.21
@@ -31,12 +31,22 @@ func showVersions(cmd *cobra.Command, args []string) {
 	common.ErrCheckExitf(err, 1, "error getting absolute path for 'sandbox-binary'")
 	flavor, _ := cmd.Flags().GetString(globals.FlavorLabel)
 	byFlavor, _ := cmd.Flags().GetBool(globals.ByFlavorLabel)
-
-	err = ops.ShowVersions(ops.VersionOptions{
+	options := ops.VersionOptions{
 		SandboxBinary: basedir,
 		Flavor:        flavor,
 		ByFlavor:      byFlavor,
-	})
+	}
+	outputFormat, isStructured := structuredOutputFormat(cmd)
+	if isStructured {
+		versions, err := ops.ListVersions(options)
+		if err != nil {
+			common.Exitf(1, "error listing versions: %s", err)
+		}
+		printStructured(outputFormat, versions)
+		return
+	}
+
+	err = ops.ShowVersions(options)
 	if err != nil {
 		common.Exitf(1, "error showing versions: %s", err)
 	}
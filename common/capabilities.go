@@ -47,11 +47,16 @@ const (
 	// Tarball flavors
 	MySQLFlavor         = "mysql"
 	MySQLShellFlavor    = "mysql-shell"
+	MySQLRouterFlavor   = "mysql-router"
 	PerconaServerFlavor = "percona"
 	MariaDbFlavor       = "mariadb"
 	NdbFlavor           = "ndb"
 	PxcFlavor           = "pxc"
 	TiDbFlavor          = "tidb"
+	PostgreSQLFlavor    = "postgresql"
+
+	// Flavor of ProxySQL sandboxes, which are not deployed from a tarball
+	ProxySQLFlavor = "proxysql"
 
 	// Feature names
 	InstallDb                   = "installdb"
@@ -84,6 +89,14 @@ const (
 	EmbedMySQLShell             = "embed-mysql-shell"
 	CloneServer                 = "clone-server"
 	CircularReplication         = "circular-replication"
+	InnoDBCluster               = "innodb-cluster"
+	StreamingReplication        = "streaming-replication"
+	TiDBCluster                 = "tidb-cluster"
+	MariaDbGTID                 = "mariadb-gtid"
+	MariaDbGalera               = "mariadb-galera"
+	MariaDbBinaries             = "mariadb-binaries"
+	ReplicaTerminology          = "replica-terminology"
+	BinaryLogStatus             = "binary-log-status"
 )
 
 var MySQLCapabilities = Capabilities{
@@ -180,6 +193,18 @@ var MySQLCapabilities = Capabilities{
 			Description: "Allow circular replication",
 			Since:       globals.MinimumMySQLAutoIncrementIncrement,
 		},
+		InnoDBCluster: {
+			Description: "InnoDB Cluster through MySQL Shell AdminAPI",
+			Since:       globals.MinimumInnoDBClusterVersion,
+		},
+		ReplicaTerminology: {
+			Description: "replication statements and variables using 'source' and 'replica'",
+			Since:       globals.MinimumReplicaTerminologyVersion,
+		},
+		BinaryLogStatus: {
+			Description: "SHOW BINARY LOG STATUS and RESET BINARY LOGS AND GTIDS",
+			Since:       globals.MinimumBinaryLogStatusVersion,
+		},
 	},
 }
 
@@ -262,6 +287,14 @@ var FlavorCompositionList = []flavorIndicator{
 		},
 		flavor: TiDbFlavor,
 	},
+	{
+		AllNeeded: true,
+		elements: []elementPath{
+			{"bin", globals.FnPostgres},
+			{"bin", globals.FnInitDb},
+		},
+		flavor: PostgreSQLFlavor,
+	},
 	{
 		AllNeeded: false,
 		elements: []elementPath{
@@ -279,6 +312,13 @@ var FlavorCompositionList = []flavorIndicator{
 		},
 		flavor: MySQLShellFlavor,
 	},
+	{
+		AllNeeded: false,
+		elements: []elementPath{
+			{"bin", globals.FnMysqlRouter},
+		},
+		flavor: MySQLRouterFlavor,
+	},
 }
 
 var PerconaCapabilities = Capabilities{
@@ -290,8 +330,11 @@ var PerconaCapabilities = Capabilities{
 var TiDBCapabilities = Capabilities{
 	Flavor:      TiDbFlavor,
 	Description: "TiDB isolated server",
-	Features:    FeatureList{
-		// No capabilities so far
+	Features: FeatureList{
+		TiDBCluster: {
+			Description: "TiDB cluster with PD and TiKV servers",
+			Since:       globals.MinimumTiDBClusterVersion,
+		},
 	},
 }
 var NdbCapabilities = Capabilities{
@@ -310,9 +353,11 @@ var NdbCapabilities = Capabilities{
 			Description: "uses mysqld initialize",
 			Since:       globals.MinimumNdbInitialize,
 		},
-		MySQLXDefault: MySQLCapabilities.Features[MySQLXDefault],
-		Roles:         MySQLCapabilities.Features[Roles],
-		SetPersist:    MySQLCapabilities.Features[SetPersist],
+		MySQLXDefault:      MySQLCapabilities.Features[MySQLXDefault],
+		Roles:              MySQLCapabilities.Features[Roles],
+		SetPersist:         MySQLCapabilities.Features[SetPersist],
+		ReplicaTerminology: MySQLCapabilities.Features[ReplicaTerminology],
+		BinaryLogStatus:    MySQLCapabilities.Features[BinaryLogStatus],
 		NdbCluster: {
 			Description: "MySQL NDB Cluster",
 			Since:       globals.MinimumNdbClusterVersion,
@@ -365,6 +410,18 @@ var MariadbCapabilities = Capabilities{
 		},
 		DynVariables: MySQLCapabilities.Features[DynVariables],
 		SemiSynch:    MySQLCapabilities.Features[SemiSynch],
+		MariaDbGTID: {
+			Description: "MariaDB GTID, with domains and MASTER_USE_GTID",
+			Since:       globals.MinimumMariaDbGtidVersion,
+		},
+		MariaDbGalera: {
+			Description: "Galera cluster with wsrep provider",
+			Since:       globals.MinimumMariaDbGaleraVersion,
+		},
+		MariaDbBinaries: {
+			Description: "server executables named mariadbd and mariadb-install-db",
+			Since:       globals.MinimumMariaDbBinariesVersion,
+		},
 	},
 }
 
@@ -379,6 +436,25 @@ var MySQLShellCapabilities = Capabilities{
 	},
 }
 
+var MySQLRouterCapabilities = Capabilities{
+	Flavor:      MySQLRouterFlavor,
+	Description: "MySQL Router",
+	Features:    FeatureList{
+		// No capabilities so far
+	},
+}
+
+var PostgreSQLCapabilities = Capabilities{
+	Flavor:      PostgreSQLFlavor,
+	Description: "PostgreSQL server",
+	Features: FeatureList{
+		StreamingReplication: {
+			Description: "Primary and standbys through pg_basebackup and streaming replication",
+			Since:       globals.MinimumPostgreSQLVersion,
+		},
+	},
+}
+
 var AllCapabilities = map[string]Capabilities{
 	MySQLFlavor:         MySQLCapabilities,
 	PerconaServerFlavor: PerconaCapabilities,
@@ -387,6 +463,8 @@ var AllCapabilities = map[string]Capabilities{
 	NdbFlavor:           NdbCapabilities,
 	PxcFlavor:           PxcCapabilities,
 	MySQLShellFlavor:    MySQLShellCapabilities,
+	MySQLRouterFlavor:   MySQLRouterCapabilities,
+	PostgreSQLFlavor:    PostgreSQLCapabilities,
 }
 
 // Returns a set of existing capabilities with custom ones
@@ -420,11 +498,13 @@ func copyCapabilities(flavor string, names []string) FeatureList {
 }
 
 // Returns true if a given flavor and version support the wanted feature
+// Only the version numbers are considered: 8.0.35-27-debug has the capabilities of 8.0.35
 func HasCapability(flavor, feature, version string) (bool, error) {
-	versionList, err := VersionToList(version)
+	serverVersion, err := ParseServerVersion(version)
 	if err != nil {
 		return false, err
 	}
+	versionList := serverVersion.List()
 	for flavorName, capabilities := range AllCapabilities {
 		if flavorName == flavor {
 			featureDefinition, ok := capabilities.Features[feature]
@@ -446,3 +526,85 @@ func HasCapability(flavor, feature, version string) (bool, error) {
 	}
 	return false, nil
 }
+
+// ReplicationSyntax contains the replication statements and names that a server understands.
+// MySQL 8.0.26 uses "source" and "replica" instead of "master" and "slave",
+// and MySQL 8.4 removed the old statements.
+type ReplicationSyntax struct {
+	ChangeSource      string // CHANGE MASTER TO
+	SourceOption      string // prefix of the options for ChangeSource, as in MASTER_HOST
+	StartReplica      string // START SLAVE
+	StopReplica       string // STOP SLAVE
+	ResetReplica      string // RESET SLAVE
+	ShowReplicaStatus string // SHOW SLAVE STATUS
+	ShowSourceStatus  string // SHOW MASTER STATUS
+	ResetSource       string // RESET MASTER
+	SourcePosWait     string // MASTER_POS_WAIT
+	ReplicaUpdates    string // log_slave_updates
+	SemiSyncSource    string // rpl_semi_sync_master
+	SemiSyncReplica   string // rpl_semi_sync_slave
+}
+
+// LegacyReplicationSyntax is the syntax understood by MySQL before 8.0.26, and by the other flavors
+var LegacyReplicationSyntax = ReplicationSyntax{
+	ChangeSource:      "CHANGE MASTER TO",
+	SourceOption:      "MASTER",
+	StartReplica:      "START SLAVE",
+	StopReplica:       "STOP SLAVE",
+	ResetReplica:      "RESET SLAVE",
+	ShowReplicaStatus: "SHOW SLAVE STATUS",
+	ShowSourceStatus:  "SHOW MASTER STATUS",
+	ResetSource:       "RESET MASTER",
+	SourcePosWait:     "MASTER_POS_WAIT",
+	ReplicaUpdates:    "log_slave_updates",
+	SemiSyncSource:    "rpl_semi_sync_master",
+	SemiSyncReplica:   "rpl_semi_sync_slave",
+}
+
+// GetReplicationSyntax returns the replication syntax for a given flavor and version
+func GetReplicationSyntax(flavor, version string) (ReplicationSyntax, error) {
+	syntax := LegacyReplicationSyntax
+	isReplicaTerminology, err := HasCapability(flavor, ReplicaTerminology, version)
+	if err != nil {
+		return syntax, err
+	}
+	if isReplicaTerminology {
+		syntax.ChangeSource = "CHANGE REPLICATION SOURCE TO"
+		syntax.SourceOption = "SOURCE"
+		syntax.StartReplica = "START REPLICA"
+		syntax.StopReplica = "STOP REPLICA"
+		syntax.ResetReplica = "RESET REPLICA"
+		syntax.ShowReplicaStatus = "SHOW REPLICA STATUS"
+		syntax.SourcePosWait = "SOURCE_POS_WAIT"
+		syntax.ReplicaUpdates = "log_replica_updates"
+		syntax.SemiSyncSource = "rpl_semi_sync_source"
+		syntax.SemiSyncReplica = "rpl_semi_sync_replica"
+	}
+	isBinaryLogStatus, err := HasCapability(flavor, BinaryLogStatus, version)
+	if err != nil {
+		return syntax, err
+	}
+	if isBinaryLogStatus {
+		syntax.ShowSourceStatus = "SHOW BINARY LOG STATUS"
+		syntax.ResetSource = "RESET BINARY LOGS AND GTIDS"
+	}
+	return syntax, nil
+}
+
+// ToMap returns the replication syntax as template data
+func (syntax ReplicationSyntax) ToMap() StringMap {
+	return StringMap{
+		"ChangeSource":      syntax.ChangeSource,
+		"SourceOption":      syntax.SourceOption,
+		"StartReplica":      syntax.StartReplica,
+		"StopReplica":       syntax.StopReplica,
+		"ResetReplica":      syntax.ResetReplica,
+		"ShowReplicaStatus": syntax.ShowReplicaStatus,
+		"ShowSourceStatus":  syntax.ShowSourceStatus,
+		"ResetSource":       syntax.ResetSource,
+		"SourcePosWait":     syntax.SourcePosWait,
+		"ReplicaUpdates":    syntax.ReplicaUpdates,
+		"SemiSyncSource":    syntax.SemiSyncSource,
+		"SemiSyncReplica":   syntax.SemiSyncReplica,
+	}
+}
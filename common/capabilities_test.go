@@ -79,11 +79,43 @@ func TestHasCapability(t *testing.T) {
 		{[]string{MySQLFlavor, PerconaServerFlavor}, NativeAuth, "8.0.12", true},
 		{[]string{MySQLFlavor, PerconaServerFlavor}, DataDict, "5.7.40", false},
 		{[]string{MySQLFlavor, PerconaServerFlavor}, DataDict, "8.0.12", true},
+		{[]string{MySQLFlavor, PerconaServerFlavor}, ReplicaTerminology, "8.0.25", false},
+		{[]string{MySQLFlavor, PerconaServerFlavor}, ReplicaTerminology, "8.0.26", true},
+		{[]string{MySQLFlavor, PerconaServerFlavor}, BinaryLogStatus, "8.1.0", false},
+		{[]string{MySQLFlavor, PerconaServerFlavor}, BinaryLogStatus, "8.4.0", true},
+		{[]string{MariaDbFlavor}, ReplicaTerminology, "11.4.2", false},
 		{[]string{"no-such-flavor"}, "no-such-feature", "8.0.22", false},
 	}
 	testHasCapability(capabilitiesList, t)
 }
 
+func TestGetReplicationSyntax(t *testing.T) {
+	var syntaxList = []struct {
+		flavor           string
+		version          string
+		changeSource     string
+		showReplica      string
+		showSourceStatus string
+	}{
+		{MySQLFlavor, "5.7.44", "CHANGE MASTER TO", "SHOW SLAVE STATUS", "SHOW MASTER STATUS"},
+		{MySQLFlavor, "8.0.25", "CHANGE MASTER TO", "SHOW SLAVE STATUS", "SHOW MASTER STATUS"},
+		{MySQLFlavor, "8.0.36", "CHANGE REPLICATION SOURCE TO", "SHOW REPLICA STATUS", "SHOW MASTER STATUS"},
+		{MySQLFlavor, "8.4.0", "CHANGE REPLICATION SOURCE TO", "SHOW REPLICA STATUS", "SHOW BINARY LOG STATUS"},
+		{MySQLFlavor, "9.1.0", "CHANGE REPLICATION SOURCE TO", "SHOW REPLICA STATUS", "SHOW BINARY LOG STATUS"},
+		{PerconaServerFlavor, "8.4.0", "CHANGE REPLICATION SOURCE TO", "SHOW REPLICA STATUS", "SHOW BINARY LOG STATUS"},
+		{MariaDbFlavor, "11.4.2", "CHANGE MASTER TO", "SHOW SLAVE STATUS", "SHOW MASTER STATUS"},
+	}
+	for _, s := range syntaxList {
+		syntax, err := GetReplicationSyntax(s.flavor, s.version)
+		compare.OkIsNil(fmt.Sprintf("syntax for %s %s", s.flavor, s.version), err, t)
+		compare.OkEqualString(fmt.Sprintf("change source %s %s", s.flavor, s.version), syntax.ChangeSource, s.changeSource, t)
+		compare.OkEqualString(fmt.Sprintf("replica status %s %s", s.flavor, s.version), syntax.ShowReplicaStatus, s.showReplica, t)
+		compare.OkEqualString(fmt.Sprintf("source status %s %s", s.flavor, s.version), syntax.ShowSourceStatus, s.showSourceStatus, t)
+		compare.OkEqualString(fmt.Sprintf("data for %s %s", s.flavor, s.version), syntax.ToMap()["ChangeSource"].(string), s.changeSource, t)
+	}
+	compare.OkEqualString("legacy syntax", LegacyReplicationSyntax.SourceOption, "MASTER", t)
+}
+
 func testHasCapability(capabilitiesList []TestCapabilities, t *testing.T) {
 
 	for _, cl := range capabilitiesList {
@@ -17,6 +17,7 @@ package common
 
 import (
 	"fmt"
+	"net"
 	"net/url"
 	"os"
 	"path"
@@ -40,14 +41,44 @@ type SandboxInfo struct {
 }
 
 type VersionInfo struct {
-	Version string
-	Flavor  string
+	Version string `json:"version"`
+	Flavor  string `json:"flavor"`
 }
 
 var portDebug bool = IsEnvSet("PORT_DEBUG")
 
+// When set, the ports that are bound by other processes are not used for new sandboxes
+var portProbe bool = !IsEnvSet("SKIP_DBDEPLOYER_PORT_PROBE")
+
 type PortMap map[int]bool
 
+// IsPortBusy returns true if a TCP port can't be bound, because another process is using it,
+// either on all interfaces or on the loopback one
+func IsPortBusy(port int) bool {
+	for _, address := range []string{fmt.Sprintf(":%d", port), fmt.Sprintf("%s:%d", globals.LocalHostIP, port)} {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return true
+		}
+		_ = listener.Close()
+	}
+	return false
+}
+
+// portIsTaken returns true if a port is used by a sandbox, or by any other process
+func portIsTaken(port int, usedPorts PortMap) bool {
+	if usedPorts[port] {
+		return true
+	}
+	if portProbe && IsPortBusy(port) {
+		if portDebug {
+			CondPrintf("- port %d is bound by another process\n", port)
+		}
+		return true
+	}
+	return false
+}
+
 type SandboxInfoList []SandboxInfo
 
 func GetFullSandboxInfo(sandboxHome string) SandboxInfoList {
@@ -195,7 +226,7 @@ func GetCompatibleClientVersion(basedir, serverVersion string) (string, error) {
 	return globals.EmptyString, fmt.Errorf("no suitable client version found for version %s", serverVersion)
 }
 
-// Returns the list of versions available for deployment
+// Returns the list of versions available for deployment, in version order
 func GetVersionsFromDir(basedir string) ([]string, error) {
 	var dirs []string
 	files, err := os.ReadDir(basedir)
@@ -207,12 +238,16 @@ func GetVersionsFromDir(basedir string) ([]string, error) {
 		if f.IsDir() {
 			mysqld := path.Join(basedir, fname, "bin", "mysqld")
 			mysqldDebug := path.Join(basedir, fname, "bin", "mysqld-debug")
+			mariadbd := path.Join(basedir, fname, "bin", globals.FnMariadbd)
 			tidb := path.Join(basedir, fname, "bin", "tidb-server")
-			if FileExists(mysqld) || FileExists(mysqldDebug) || FileExists(tidb) {
+			postgres := path.Join(basedir, fname, "bin", globals.FnPostgres)
+			if FileExists(mysqld) || FileExists(mysqldDebug) || FileExists(mariadbd) || FileExists(tidb) || FileExists(postgres) {
 				dirs = append(dirs, fname)
 			}
 		}
 	}
+	// Builds of the same version (8.0.35, 8.0.35-27, 8.0.35-debug) are listed together
+	sortVersionNames(dirs)
 	return dirs, nil
 }
 
@@ -419,6 +454,40 @@ func DetectBinaryFlavor(basedir string) string {
 	return MySQLFlavor
 }
 
+// GetBinaryFlavor returns the flavor of the binaries in basedir.
+// The flavor is taken from the FLAVOR file, if there is one, or detected from the files in the directory.
+// A flavor defined by the user must match the one in the FLAVOR file.
+func GetBinaryFlavor(userDefinedFlavor, basedir string) (string, error) {
+	flavorOrigin := ""
+	flavor := userDefinedFlavor
+	if userDefinedFlavor != "" {
+		flavorOrigin = "flag"
+	}
+	flavorFile := path.Join(basedir, globals.FlavorFileName)
+	if FileExists(flavorFile) {
+		flavorText, err := SlurpAsString(flavorFile)
+		if err != nil {
+			return "", fmt.Errorf("error reading flavor file %s: %s", flavorFile, err)
+		}
+		flavorText = strings.TrimSpace(flavorText)
+		if userDefinedFlavor != "" && userDefinedFlavor != flavorText {
+			return "", fmt.Errorf("user defined flavor %s doesn't match found flavor %s", userDefinedFlavor, flavorText)
+		}
+		flavor = flavorText
+		flavorOrigin = "FLAVOR file"
+	}
+	// Flavor detection based on tarball contents
+	if flavor == "" {
+		flavor = DetectBinaryFlavor(basedir)
+		flavorOrigin = "Binary examination"
+	}
+	err := CheckFlavorSupport(flavor)
+	if err != nil {
+		return "", fmt.Errorf("flavor detected from %s unsupported: %s", flavorOrigin, err)
+	}
+	return flavor, nil
+}
+
 /*
 Checks that the extracted tarball directory
 
@@ -446,6 +515,7 @@ func CheckTarballOperatingSystem(basedir string) error {
 		globals.FnLibPerconaServerClientDylib: {"lib", "darwin", PerconaServerFlavor, true},
 		globals.FnLibMySQLClientDylib:         {"lib", "darwin", MySQLFlavor, true},
 		globals.FnTiDbServer:                  {"bin", "any", TiDbFlavor, true},
+		globals.FnPostgres:                    {"bin", "any", PostgreSQLFlavor, true},
 		globals.FnTableH:                      {"sql", "source", "any", false},
 		globals.FnMysqlProvisionZip:           {"share/mysqlsh", "shell", "any", false},
 	}
@@ -502,19 +572,19 @@ func IsATarball(fileName string) bool {
 }
 
 // Checks the initial argument for a sandbox deployment
-func CheckOrigin(args []string) {
+func CheckOrigin(args []string) error {
 	if len(args) < 1 {
-		Exit(1, "this command requires the MySQL version (x.xx[.xx]) as argument ")
+		return fmt.Errorf("this command requires the MySQL version (x.xx[.xx]) as argument ")
 	}
 	if len(args) > 1 {
-		Exit(1, "extra argument detected. This command requires only the MySQL version (x.xx[.xx]) as argument ")
+		return fmt.Errorf("extra argument detected. This command requires only the MySQL version (x.xx[.xx]) as argument ")
 	}
 	origin := args[0]
 	if FileExists(origin) && IsATarball(origin) {
-		Exit(1,
-			"tarball detected. - If you want to use a tarball to create a sandbox,",
+		return fmt.Errorf("tarball detected. - If you want to use a tarball to create a sandbox,\n" +
 			"you should first use the 'unpack' command")
 	}
+	return nil
 }
 
 // Creates a sandbox directory if it does not exist
@@ -528,9 +598,15 @@ func CheckSandboxDir(sandboxHome string) error {
 
 // Returns true if a given string looks contains a version
 // number (major.minor.rev)
+// Versions with vendor build, pre-release tag, or build variant (8.0.35-27, 8.0.3-rc, 8.0.36-debug)
+// are also accepted
 func IsVersion(version string) bool {
 	re := regexp.MustCompile(`(\d+)\.(\d+)\.(\d+)$`)
-	return re.MatchString(version)
+	if re.MatchString(version) {
+		return true
+	}
+	_, err := ParseServerVersion(version)
+	return err == nil
 }
 
 // Return true if a given string is a valid URL
@@ -574,36 +650,14 @@ func IsIPV4(ip string) bool {
 
 // Gets three integers for a version string
 // Converts "1.2.3" into []int{1, 2, 3}
+// The version may have a prefix ("ps8.0.35") and qualifiers ("8.0.35-27-debug"):
+// see ParseServerVersion
 func VersionToList(version string) ([]int, error) {
-	// A valid version must be made of 3 integers
-	re1 := regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)$`)
-	// Also valid version is 3 numbers with a prefix
-	re2 := regexp.MustCompile(`^[^.0-9-]+(\d+)\.(\d+)\.(\d+)$`)
-	verList1 := re1.FindAllStringSubmatch(version, -1)
-	verList2 := re2.FindAllStringSubmatch(version, -1)
-	verList := verList1
-	//CondPrintf("%#v\n", verList)
-	if verList == nil {
-		verList = verList2
-	}
-	if verList == nil {
-		return []int{-1}, fmt.Errorf("required version format: x.x.xx - Got '%s'", version)
-	}
-
-	var intList = make([]int, 3)
-	newCount := 0
-	for N, item := range verList[0] {
-		if N == 0 {
-			continue
-		}
-		intVal, err := strconv.Atoi(item)
-		if err != nil {
-			return []int{-1}, fmt.Errorf("(%d) error converting %s (list: %+v) [%s] ", N, version, verList, err)
-		}
-		intList[newCount] = intVal
-		newCount++
+	sv, err := ParseServerVersion(version)
+	if err != nil {
+		return []int{-1}, err
 	}
-	return intList, nil
+	return sv.List(), nil
 }
 
 // Converts a version string into a name.
@@ -711,14 +765,14 @@ func GreaterOrEqualVersionList(verList, comparedTo []int) (bool, error) {
 // Finds the first free port available, starting at
 // requestedPort.
 // usedPorts is a map of ports already used by other sandboxes.
+// Ports bound by other processes are skipped as well.
 // This function should not be used alone, but through FindFreePort.
 // Returns the first free port
 func findFreePortSingle(requestedPort int, usedPorts PortMap) (int, error) {
 	foundPort := 0
 	candidatePort := requestedPort
 	for foundPort == 0 {
-		_, exists := usedPorts[candidatePort]
-		if exists {
+		if portIsTaken(candidatePort, usedPorts) {
 			if portDebug {
 				CondPrintf("- port %d not free\n", candidatePort)
 			}
@@ -748,8 +802,7 @@ func findFreePortRange(basePort int, usedPorts PortMap, howMany int) (int, error
 	for foundPort == 0 {
 		numPorts := 0
 		for counter < howMany {
-			_, exists := usedPorts[candidatePort+counter]
-			if exists {
+			if portIsTaken(candidatePort+counter, usedPorts) {
 				if portDebug {
 					CondPrintf("- port %d is not free\n", candidatePort+counter)
 				}
@@ -783,6 +836,8 @@ func findFreePortRange(basePort int, usedPorts PortMap, howMany int) (int, error
 // Finds the a range of howMany free ports available, starting at
 // basePort.
 // installedPorts is a slice of ports already used by other sandboxes.
+// Ports that are bound by other processes are also skipped, unless
+// SKIP_DBDEPLOYER_PORT_PROBE is set.
 // Calls either findFreePortRange or findFreePortSingle, depending on the
 // amount of ports requested.
 // Returns the first port of the requested range
@@ -850,19 +905,18 @@ func getSortedVersion(sandboxBinary, wantedVersion, flavor string, position int)
 	return latestVersion
 }
 
+// FindTarballInfo returns flavor, version, and short version of a tarball.
+// The version contains only the numbers (8.0.35 for Percona-Server-8.0.35-27):
+// use ParseTarballVersion to get the vendor build and the other qualifiers
 func FindTarballInfo(fileName string) (flavor, version, shortVersion string, err error) {
 	baseName := BaseName(fileName)
 	flavor = DetectTarballFlavor(baseName)
 
-	reVersion := regexp.MustCompile(`(\d+)\.(\d+)\.(\d+)`)
-	versionList := reVersion.FindAllStringSubmatch(baseName, -1)
-	if len(versionList) == 0 || len(versionList[0]) < 2 {
-		return "", "", "", fmt.Errorf("error detecting version %v", versionList)
+	sv, err := ParseTarballVersion(baseName)
+	if err != nil {
+		return "", "", "", err
 	}
-
-	version = fmt.Sprintf("%s.%s.%s", versionList[0][1], versionList[0][2], versionList[0][3])
-	shortVersion = fmt.Sprintf("%s.%s", versionList[0][1], versionList[0][2])
-	return
+	return flavor, sv.Numeric(), sv.ShortVersion(), nil
 }
 
 // Tries to detect the database flavor from tarball name
@@ -875,6 +929,8 @@ func DetectTarballFlavor(tarballName string) string {
 		TiDbFlavor:          `tidb`,
 		PxcFlavor:           `Percona-XtraDB-Cluster`,
 		MySQLShellFlavor:    `mysql-shell`,
+		MySQLRouterFlavor:   `mysql-router`,
+		PostgreSQLFlavor:    `postgres`,
 		MySQLFlavor:         `mysql`,
 	}
 
@@ -887,6 +943,8 @@ func DetectTarballFlavor(tarballName string) string {
 		TiDbFlavor,
 		PxcFlavor,
 		MySQLShellFlavor,
+		MySQLRouterFlavor,
+		PostgreSQLFlavor,
 		MySQLFlavor,
 	}
 
@@ -18,6 +18,7 @@ package common
 import (
 	"fmt"
 	"github.com/datacharmer/dbdeployer/compare"
+	"net"
 	"testing"
 )
 
@@ -34,6 +35,9 @@ func TestIsVersion(t *testing.T) {
 		{"1.2.3abc", false},
 		{"abc1.2", false},
 		{"11.22.30", true},
+		{"8.0.35-27", true},
+		{"ps8.0.35-27-debug", true},
+		{"8.0.3-rc", true},
 	}
 	for _, tv := range data {
 		result := IsVersion(tv.input)
@@ -91,6 +95,10 @@ func TestFindFreePort(t *testing.T) {
 		{usedPorts: []int{5000, 5001, 5002, 5006, 5007, 5008}, basePort: 5000, howMany: 3, expected: 5003},
 		{usedPorts: []int{5000, 5001, 5002, 5006, 5007, 5008}, basePort: 5000, howMany: 4, expected: 5009},
 	}
+	// The expected values don't depend on the ports used by other processes on this host
+	savedProbe := portProbe
+	portProbe = false
+	defer func() { portProbe = savedProbe }()
 	for _, d := range data {
 		result, err := FindFreePort(d.basePort, d.usedPorts, d.howMany)
 		compare.OkIsNil("FindFreePort result", err, t)
@@ -98,6 +106,27 @@ func TestFindFreePort(t *testing.T) {
 	}
 }
 
+func TestFindFreePortProbe(t *testing.T) {
+	savedProbe := portProbe
+	portProbe = true
+	defer func() { portProbe = savedProbe }()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	compare.OkIsNil("listener creation", err, t)
+	busyPort := listener.Addr().(*net.TCPAddr).Port
+	compare.OkEqualBool("port in use", IsPortBusy(busyPort), true, t)
+
+	port, err := FindFreePort(busyPort, []int{}, 1)
+	compare.OkIsNil("single port", err, t)
+	compare.OkEqualBool("busy port skipped", port > busyPort, true, t)
+	port, err = FindFreePort(busyPort-1, []int{}, 3)
+	compare.OkIsNil("port range", err, t)
+	compare.OkEqualBool("range without busy port", port > busyPort, true, t)
+
+	err = listener.Close()
+	compare.OkIsNil("listener close", err, t)
+	compare.OkEqualBool("port released", IsPortBusy(busyPort), false, t)
+}
+
 func TestFindSandbox(t *testing.T) {
 	type testFIndSb struct {
 		sample      []SandboxInfo
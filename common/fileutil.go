@@ -48,19 +48,37 @@ type SandboxUser struct {
 }
 
 type SandboxDescription struct {
-	Basedir           string `json:"basedir"`
-	ClientBasedir     string `json:"client_basedir,omitempty"`
-	SBType            string `json:"type"` // single multi master-slave group
-	Version           string `json:"version"`
-	Flavor            string `json:"flavor,omitempty"`
-	Host              string `json:"host,omitempty"`
-	Port              []int  `json:"port"`
-	Nodes             int    `json:"nodes"`
-	NodeNum           int    `json:"node_num"`
-	DbDeployerVersion string `json:"dbdeployer-version"`
-	Timestamp         string `json:"timestamp"`
-	CommandLine       string `json:"command-line"`
-	LogFile           string `json:"log-file,omitempty"`
+	Basedir           string               `json:"basedir"`
+	ClientBasedir     string               `json:"client_basedir,omitempty"`
+	SBType            string               `json:"type"` // single multi master-slave group
+	Version           string               `json:"version"`
+	Flavor            string               `json:"flavor,omitempty"`
+	Host              string               `json:"host,omitempty"`
+	Port              []int                `json:"port"`
+	Nodes             int                  `json:"nodes"`
+	NodeNum           int                  `json:"node_num"`
+	DbDeployerVersion string               `json:"dbdeployer-version"`
+	Timestamp         string               `json:"timestamp"`
+	CommandLine       string               `json:"command-line"`
+	LogFile           string               `json:"log-file,omitempty"`
+	ReplicationTree   *ReplicationTreeNode `json:"replication-tree,omitempty"`
+	NodeVersions      []NodeVersion        `json:"node-versions,omitempty"`
+	Backend           string               `json:"backend,omitempty"`
+}
+
+// NodeVersion describes the binaries of one node, in sandboxes where nodes use different versions
+type NodeVersion struct {
+	Node    string `json:"node,omitempty"`
+	Version string `json:"version"`
+	Flavor  string `json:"flavor,omitempty"`
+	Basedir string `json:"basedir"`
+}
+
+// ReplicationTreeNode describes a node in a replication hierarchy,
+// together with the nodes that replicate from it
+type ReplicationTreeNode struct {
+	Node   int                   `json:"node"`
+	Slaves []ReplicationTreeNode `json:"slaves,omitempty"`
 }
 
 type KeyValue struct {
@@ -169,6 +187,21 @@ func WriteSandboxDescription(destination string, sd SandboxDescription) error {
 	return WriteString(jsonString, filename)
 }
 
+// UpdateSandboxDescription writes again the description of an existing sandbox,
+// keeping the command line that deployed it
+func UpdateSandboxDescription(destination string, sd SandboxDescription) error {
+	if sd.CommandLine == "" {
+		return WriteSandboxDescription(destination, sd)
+	}
+	sd.DbDeployerVersion = VersionDef
+	sd.Timestamp = time.Now().Format(time.UnixDate)
+	b, err := json.MarshalIndent(sd, " ", "\t")
+	if err != nil {
+		return errors.Wrapf(err, "error encoding sandbox description")
+	}
+	return WriteString(string(b), path.Join(destination, globals.SandboxDescriptionName))
+}
+
 // Reads sandbox description from a given directory
 func ReadSandboxDescription(sandboxDirectory string) (SandboxDescription, error) {
 	filename := path.Join(sandboxDirectory, globals.SandboxDescriptionName)
@@ -382,6 +415,10 @@ func CheckLibraries(basedir string) error {
 	if strings.ToLower(runtime.GOOS) != "linux" {
 		return nil
 	}
+	// The libraries checked below are the ones needed by MySQL
+	if ExecExists(path.Join(basedir, "bin", globals.FnPostgres)) {
+		return nil
+	}
 
 	var (
 		missingAll = ""
@@ -391,6 +428,9 @@ func CheckLibraries(basedir string) error {
 		mysqlBin   = path.Join(basedir, "bin", "mysql")
 		mysqldBin  = path.Join(basedir, "bin", "mysqld")
 	)
+	if !ExecExists(mysqldBin) && ExecExists(path.Join(basedir, "bin", globals.FnMariadbd)) {
+		mysqldBin = path.Join(basedir, "bin", globals.FnMariadbd)
+	}
 
 	// Make sure that the libraries from the expanded tarball are found
 	_ = os.Setenv("LD_LIBRARY_PATH", fmt.Sprintf("%s:%s", basedirLib, os.Getenv("LD_LIBRARY_PATH")))
@@ -0,0 +1,149 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2020 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// Release series types
+	SeriesGA         = "GA"
+	SeriesLTS        = "LTS"
+	SeriesInnovation = "innovation"
+
+	// Format of the end-of-life dates in the release series table
+	eolDateFormat = "2006-01"
+)
+
+// ReleaseSeries describes a short version (major.minor) of a flavor
+type ReleaseSeries struct {
+	Series string `json:"series"`
+	Type   string `json:"type"`
+	// End of life, as YYYY-MM. Empty when not announced yet
+	EOL string `json:"eol"`
+	// Tarballs for this series are listed in the vendor downloads pages
+	Downloadable bool `json:"downloadable"`
+	// Series that can be upgraded to directly from this one
+	UpgradeTo []string `json:"upgrade_to"`
+}
+
+// MySQLReleaseSeries lists the MySQL release series, oldest first.
+// Since 8.1, innovation releases are supported until the next one comes out,
+// and can be upgraded to any later innovation release up to the next LTS.
+var MySQLReleaseSeries = []ReleaseSeries{
+	{Series: "4.1", Type: SeriesGA, EOL: "2009-12", UpgradeTo: []string{"5.0"}},
+	{Series: "5.0", Type: SeriesGA, EOL: "2012-01", UpgradeTo: []string{"5.1"}},
+	{Series: "5.1", Type: SeriesGA, EOL: "2013-12", UpgradeTo: []string{"5.5"}},
+	{Series: "5.5", Type: SeriesGA, EOL: "2018-12", UpgradeTo: []string{"5.6"}},
+	{Series: "5.6", Type: SeriesGA, EOL: "2021-02", UpgradeTo: []string{"5.7"}},
+	{Series: "5.7", Type: SeriesGA, EOL: "2023-10", Downloadable: true, UpgradeTo: []string{"8.0"}},
+	{Series: "8.0", Type: SeriesGA, EOL: "2026-04", Downloadable: true, UpgradeTo: []string{"8.1", "8.2", "8.3", "8.4"}},
+	{Series: "8.1", Type: SeriesInnovation, EOL: "2023-10", Downloadable: true, UpgradeTo: []string{"8.2", "8.3", "8.4"}},
+	{Series: "8.2", Type: SeriesInnovation, EOL: "2024-01", Downloadable: true, UpgradeTo: []string{"8.3", "8.4"}},
+	{Series: "8.3", Type: SeriesInnovation, EOL: "2024-04", Downloadable: true, UpgradeTo: []string{"8.4"}},
+	{Series: "8.4", Type: SeriesLTS, EOL: "2032-04", Downloadable: true, UpgradeTo: []string{"9.0", "9.1", "9.2", "9.3", "9.4", "9.5"}},
+	{Series: "9.0", Type: SeriesInnovation, EOL: "2024-10", Downloadable: true, UpgradeTo: []string{"9.1", "9.2", "9.3", "9.4", "9.5"}},
+	{Series: "9.1", Type: SeriesInnovation, EOL: "2025-01", Downloadable: true, UpgradeTo: []string{"9.2", "9.3", "9.4", "9.5"}},
+	{Series: "9.2", Type: SeriesInnovation, EOL: "2025-04", Downloadable: true, UpgradeTo: []string{"9.3", "9.4", "9.5"}},
+	{Series: "9.3", Type: SeriesInnovation, EOL: "2025-07", Downloadable: true, UpgradeTo: []string{"9.4", "9.5"}},
+	{Series: "9.4", Type: SeriesInnovation, EOL: "2025-10", Downloadable: true, UpgradeTo: []string{"9.5"}},
+	{Series: "9.5", Type: SeriesInnovation, Downloadable: true},
+}
+
+// PerconaReleaseSeries lists the Percona Server release series, which follow the
+// MySQL LTS releases only
+var PerconaReleaseSeries = []ReleaseSeries{
+	{Series: "5.5", Type: SeriesGA, EOL: "2018-12", UpgradeTo: []string{"5.6"}},
+	{Series: "5.6", Type: SeriesGA, EOL: "2021-02", UpgradeTo: []string{"5.7"}},
+	{Series: "5.7", Type: SeriesGA, EOL: "2023-10", UpgradeTo: []string{"8.0"}},
+	{Series: "8.0", Type: SeriesGA, EOL: "2026-04", UpgradeTo: []string{"8.4"}},
+	{Series: "8.4", Type: SeriesLTS, EOL: "2032-04"},
+}
+
+// AllReleaseSeries collects the release series of the flavors that have one
+var AllReleaseSeries = map[string][]ReleaseSeries{
+	MySQLFlavor:         MySQLReleaseSeries,
+	PerconaServerFlavor: PerconaReleaseSeries,
+}
+
+// IsEOL returns true if the series has reached its end of life at the given time
+func (rs ReleaseSeries) IsEOL(when time.Time) bool {
+	if rs.EOL == "" {
+		return false
+	}
+	eol, err := time.Parse(eolDateFormat, rs.EOL)
+	if err != nil {
+		return false
+	}
+	// The series is supported until the end of the EOL month
+	return !when.Before(eol.AddDate(0, 1, 0))
+}
+
+// CanUpgradeTo returns true if the series can be upgraded directly to the given one
+func (rs ReleaseSeries) CanUpgradeTo(series string) bool {
+	for _, s := range rs.UpgradeTo {
+		if s == series {
+			return true
+		}
+	}
+	return false
+}
+
+// FindReleaseSeries returns the release series of a version, which can be given
+// either as a short version (8.4) or as a full one (8.4.2)
+func FindReleaseSeries(flavor, version string) (ReleaseSeries, error) {
+	seriesList, ok := AllReleaseSeries[flavor]
+	if !ok {
+		return ReleaseSeries{}, fmt.Errorf("no release series defined for flavor '%s'", flavor)
+	}
+	series := version
+	if IsVersion(version) {
+		versionList, err := VersionToList(version)
+		if err != nil {
+			return ReleaseSeries{}, err
+		}
+		series = fmt.Sprintf("%d.%d", versionList[0], versionList[1])
+	}
+	for _, rs := range seriesList {
+		if rs.Series == series {
+			return rs, nil
+		}
+	}
+	return ReleaseSeries{}, fmt.Errorf("release series '%s' not found for flavor '%s'", series, flavor)
+}
+
+// ReleaseSeriesNames returns the short versions of all the series of a flavor
+func ReleaseSeriesNames(flavor string) []string {
+	var names []string
+	for _, rs := range AllReleaseSeries[flavor] {
+		names = append(names, rs.Series)
+	}
+	return names
+}
+
+// DownloadableSeries returns the short versions of the series of a flavor
+// that can be retrieved from the vendor downloads pages
+func DownloadableSeries(flavor string) []string {
+	var names []string
+	for _, rs := range AllReleaseSeries[flavor] {
+		if rs.Downloadable {
+			names = append(names, rs.Series)
+		}
+	}
+	return names
+}
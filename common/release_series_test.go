@@ -0,0 +1,97 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2020 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/datacharmer/dbdeployer/compare"
+)
+
+func TestFindReleaseSeries(t *testing.T) {
+	var seriesList = []struct {
+		flavor     string
+		version    string
+		series     string
+		seriesType string
+		found      bool
+	}{
+		{MySQLFlavor, "5.7.44", "5.7", SeriesGA, true},
+		{MySQLFlavor, "8.0", "8.0", SeriesGA, true},
+		{MySQLFlavor, "8.4.2", "8.4", SeriesLTS, true},
+		{MySQLFlavor, "9.1.0", "9.1", SeriesInnovation, true},
+		{PerconaServerFlavor, "ps8.4.0", "8.4", SeriesLTS, true},
+		{PerconaServerFlavor, "9.1.0", "", "", false},
+		{MySQLFlavor, "7.1.0", "", "", false},
+		{MariaDbFlavor, "10.6.16", "", "", false},
+	}
+	for _, s := range seriesList {
+		label := fmt.Sprintf("%s %s", s.flavor, s.version)
+		series, err := FindReleaseSeries(s.flavor, s.version)
+		if !s.found {
+			compare.OkIsNotNil(label+" not found", err, t)
+			continue
+		}
+		compare.OkIsNil(label, err, t)
+		compare.OkEqualString(label+" series", series.Series, s.series, t)
+		compare.OkEqualString(label+" type", series.Type, s.seriesType, t)
+	}
+}
+
+func TestReleaseSeriesUpgrades(t *testing.T) {
+	var upgrades = []struct {
+		from     string
+		to       string
+		expected bool
+	}{
+		{"5.7", "8.0", true},
+		{"5.7", "8.4", false},
+		{"8.0", "8.4", true},
+		{"8.0", "9.1", false},
+		{"8.2", "8.4", true},
+		{"8.4", "9.0", true},
+		{"8.4", "8.0", false},
+		{"9.1", "9.3", true},
+		{"9.3", "9.1", false},
+	}
+	for _, u := range upgrades {
+		series, err := FindReleaseSeries(MySQLFlavor, u.from)
+		compare.OkIsNil(u.from, err, t)
+		compare.OkEqualBool(fmt.Sprintf("upgrade %s to %s", u.from, u.to), series.CanUpgradeTo(u.to), u.expected, t)
+	}
+	// Every target of an upgrade path must be a known series
+	for flavor, seriesList := range AllReleaseSeries {
+		for _, series := range seriesList {
+			for _, target := range series.UpgradeTo {
+				_, err := FindReleaseSeries(flavor, target)
+				compare.OkIsNil(fmt.Sprintf("%s %s upgrade target %s", flavor, series.Series, target), err, t)
+			}
+		}
+	}
+}
+
+func TestReleaseSeriesEOL(t *testing.T) {
+	series := ReleaseSeries{Series: "8.0", EOL: "2026-04"}
+	compare.OkEqualBool("before EOL", series.IsEOL(time.Date(2026, 4, 30, 0, 0, 0, 0, time.UTC)), false, t)
+	compare.OkEqualBool("after EOL", series.IsEOL(time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)), true, t)
+	compare.OkEqualBool("no EOL", ReleaseSeries{Series: "9.5"}.IsEOL(time.Now()), false, t)
+	compare.OkEqualStringSlices(t, DownloadableSeries(PerconaServerFlavor), nil)
+	downloadable := DownloadableSeries(MySQLFlavor)
+	compare.OkEqualString("first downloadable", downloadable[0], "5.7", t)
+	compare.OkEqualString("8.4 downloadable", downloadable[5], "8.4", t)
+}
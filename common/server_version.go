@@ -0,0 +1,295 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2020 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/datacharmer/dbdeployer/globals"
+)
+
+// ServerVersion is the structured form of a database server version, as found
+// in tarball names and in the directories under the sandbox binary directory.
+// For example, "ps8.0.35-27-debug" has prefix "ps", numbers 8.0.35,
+// vendor build "27", and build variant "debug".
+type ServerVersion struct {
+	Prefix     string `json:"prefix,omitempty"`
+	Major      int    `json:"major"`
+	Minor      int    `json:"minor"`
+	Rev        int    `json:"rev"`
+	Build      string `json:"build,omitempty"`       // vendor build number (Percona 8.0.35-27)
+	PreRelease string `json:"pre_release,omitempty"` // rc, dmr, beta, m5, ...
+	Variant    string `json:"variant,omitempty"`     // debug, valgrind, asan, or any custom label
+}
+
+var (
+	// A version made of three numbers, with an optional non-numeric prefix and optional qualifiers
+	reServerVersion = regexp.MustCompile(`^([^.0-9-]*)(\d+)\.(\d+)\.(\d+)((?:[-_][0-9A-Za-z.]+)*)$`)
+	// The first three-numbers version inside a tarball name
+	reTarballVersion = regexp.MustCompile(`(\d+)\.(\d+)\.(\d+)`)
+	reBuildNumber    = regexp.MustCompile(`^\d+(\.\d+)*$`)
+	rePreRelease     = regexp.MustCompile(`(?i)^((rc|dmr|alpha|beta|preview)\d*|m\d+)$`)
+	reQualifierSep   = regexp.MustCompile(`[-_]`)
+
+	// Build variants that are recognized inside tarball names
+	knownVariants = map[string]bool{
+		"debug":    true,
+		"valgrind": true,
+		"asan":     true,
+		"ubsan":    true,
+		"tsan":     true,
+		"msan":     true,
+	}
+	// Words that appear in the version reported by a server, but don't identify a build
+	vendorWords = map[string]bool{
+		"mariadb": true,
+		"log":     true,
+	}
+)
+
+// addQualifier classifies a component found after the version numbers.
+// In strict mode, unknown words become part of the variant.
+// Otherwise, they are rejected, as they belong to the rest of a tarball name
+func (v *ServerVersion) addQualifier(item string, strict bool) bool {
+	lower := strings.ToLower(item)
+	switch {
+	case reBuildNumber.MatchString(item) && v.Build == "" && v.PreRelease == "" && v.Variant == "":
+		v.Build = item
+	case rePreRelease.MatchString(item) && v.PreRelease == "":
+		v.PreRelease = lower
+	case vendorWords[lower]:
+		// ignored
+	case knownVariants[lower] || strict:
+		if v.Variant != "" {
+			v.Variant += "-"
+		}
+		v.Variant += lower
+	default:
+		return false
+	}
+	return true
+}
+
+// ParseServerVersion converts a version string such as "8.0.35", "ps8.0.35-27",
+// "8.0.3-rc", "8.0.36-debug", or "10.11.6-MariaDB" into its components
+func ParseServerVersion(version string) (ServerVersion, error) {
+	matches := reServerVersion.FindStringSubmatch(version)
+	if matches == nil {
+		return ServerVersion{}, fmt.Errorf("required version format: x.x.xx - Got '%s'", version)
+	}
+	var sv = ServerVersion{Prefix: matches[1]}
+	for i, target := range []*int{&sv.Major, &sv.Minor, &sv.Rev} {
+		number, err := strconv.Atoi(matches[i+2])
+		if err != nil {
+			return ServerVersion{}, fmt.Errorf("error converting %s [%s]", version, err)
+		}
+		*target = number
+	}
+	if matches[5] != "" {
+		for _, item := range reQualifierSep.Split(matches[5][1:], -1) {
+			if item != "" {
+				sv.addQualifier(item, true)
+			}
+		}
+	}
+	return sv, nil
+}
+
+// ParseTarballVersion finds the version inside a tarball name, such as
+// "Percona-Server-8.0.35-27-Linux.x86_64.glibc2.17.tar.gz" (8.0.35, build 27).
+// The components after the version are examined until one that is not
+// a build number, a pre-release tag, or a known build variant
+func ParseTarballVersion(tarballName string) (ServerVersion, error) {
+	baseName := BaseName(tarballName)
+	for _, ext := range []string{globals.TarGzExt, globals.TarXzExt, ".tgz"} {
+		baseName = strings.TrimSuffix(baseName, ext)
+	}
+	position := reTarballVersion.FindStringSubmatchIndex(baseName)
+	if position == nil {
+		return ServerVersion{}, fmt.Errorf("error detecting version in '%s'", tarballName)
+	}
+	sv, err := ParseServerVersion(baseName[position[0]:position[1]])
+	if err != nil {
+		return ServerVersion{}, err
+	}
+	rest := baseName[position[1]:]
+	for rest != "" && (rest[0] == '-' || rest[0] == '_') {
+		rest = rest[1:]
+		item := rest
+		if next := reQualifierSep.FindStringIndex(rest); next != nil {
+			item = rest[:next[0]]
+		}
+		if item == "" || !sv.addQualifier(item, false) {
+			break
+		}
+		rest = rest[len(item):]
+	}
+	return sv, nil
+}
+
+// List returns the three version numbers
+func (v ServerVersion) List() []int {
+	return []int{v.Major, v.Minor, v.Rev}
+}
+
+// Numeric returns the version numbers only, such as "8.0.35"
+func (v ServerVersion) Numeric() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Rev)
+}
+
+// ShortVersion returns major and minor version, such as "8.0"
+func (v ServerVersion) ShortVersion() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// Qualifiers returns the build, pre-release, and variant, such as "-27-debug"
+func (v ServerVersion) Qualifiers() string {
+	qualifiers := ""
+	for _, item := range []string{v.Build, v.PreRelease, v.Variant} {
+		if item != "" {
+			qualifiers += "-" + item
+		}
+	}
+	return qualifiers
+}
+
+// String returns the full version, which is also the name of its binaries directory
+func (v ServerVersion) String() string {
+	return v.Prefix + v.Numeric() + v.Qualifiers()
+}
+
+// compareBuilds compares two vendor build numbers, component by component
+func compareBuilds(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return -1
+	case b == "":
+		return 1
+	}
+	listA := strings.Split(a, ".")
+	listB := strings.Split(b, ".")
+	for i := 0; i < len(listA) && i < len(listB); i++ {
+		numA, _ := strconv.Atoi(listA[i])
+		numB, _ := strconv.Atoi(listB[i])
+		if numA != numB {
+			if numA < numB {
+				return -1
+			}
+			return 1
+		}
+	}
+	if len(listA) < len(listB) {
+		return -1
+	}
+	return 1
+}
+
+// Compare returns -1, 0, or 1 when v sorts before, together with, or after the other version.
+// Versions are sorted by their numbers, then by vendor build.
+// A pre-release sorts before the release with the same numbers, and
+// a plain build sorts before its variants
+func (v ServerVersion) Compare(other ServerVersion) int {
+	for i, number := range v.List() {
+		otherNumber := other.List()[i]
+		if number < otherNumber {
+			return -1
+		}
+		if number > otherNumber {
+			return 1
+		}
+	}
+	if result := compareBuilds(v.Build, other.Build); result != 0 {
+		return result
+	}
+	if v.PreRelease != other.PreRelease {
+		switch {
+		case v.PreRelease == "":
+			return 1
+		case other.PreRelease == "":
+			return -1
+		}
+		return strings.Compare(v.PreRelease, other.PreRelease)
+	}
+	if v.Variant != other.Variant {
+		return strings.Compare(v.Variant, other.Variant)
+	}
+	return strings.Compare(v.Prefix, other.Prefix)
+}
+
+// sortVersionNames sorts a list of names, putting the ones that are versions
+// first, in version order, and the rest in alphabetical order
+func sortVersionNames(names []string) {
+	sort.SliceStable(names, func(a, b int) bool {
+		versionA, errA := ParseServerVersion(names[a])
+		versionB, errB := ParseServerVersion(names[b])
+		switch {
+		case errA == nil && errB == nil:
+			return versionA.Compare(versionB) < 0
+		case errA == nil:
+			return true
+		case errB == nil:
+			return false
+		}
+		return names[a] < names[b]
+	})
+}
+
+// FindVersionBuilds returns the directories in sandboxBinary that have the same prefix and
+// numbers of the wanted version, such as "8.0.35-27" and "8.0.35-28-debug" for "8.0.35"
+func FindVersionBuilds(sandboxBinary, wanted string) []string {
+	var builds []string
+	wantedVersion, err := ParseServerVersion(wanted)
+	if err != nil {
+		return builds
+	}
+	versions, _ := GetVersionsFromDir(sandboxBinary)
+	for _, name := range versions {
+		sv, err := ParseServerVersion(name)
+		if err != nil {
+			continue
+		}
+		if sv.Prefix == wantedVersion.Prefix && sv.Numeric() == wantedVersion.Numeric() {
+			builds = append(builds, name)
+		}
+	}
+	return builds
+}
+
+// ResolveVersionBuild returns the name of the binaries directory for a full version.
+// When there is no directory with the exact name, but only one build with the same numbers
+// (e.g. "8.0.35-27" for "8.0.35"), that build is used. When there are several builds,
+// the user must choose one explicitly
+func ResolveVersionBuild(sandboxBinary, version string) (string, error) {
+	if DirExists(path.Join(sandboxBinary, version)) {
+		return version, nil
+	}
+	builds := FindVersionBuilds(sandboxBinary, version)
+	switch len(builds) {
+	case 0:
+		return version, nil
+	case 1:
+		return builds[0], nil
+	}
+	return "", fmt.Errorf("version %s has several builds in %s: %s - choose one explicitly",
+		version, sandboxBinary, strings.Join(builds, ", "))
+}
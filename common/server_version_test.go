@@ -0,0 +1,136 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2020 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/datacharmer/dbdeployer/compare"
+)
+
+func TestParseServerVersion(t *testing.T) {
+	var versions = []struct {
+		input    string
+		expected ServerVersion
+		isValid  bool
+	}{
+		{"8.0.35", ServerVersion{Major: 8, Minor: 0, Rev: 35}, true},
+		{"ps8.0.35-27", ServerVersion{Prefix: "ps", Major: 8, Minor: 0, Rev: 35, Build: "27"}, true},
+		{"8.0.35-27.1", ServerVersion{Major: 8, Minor: 0, Rev: 35, Build: "27.1"}, true},
+		{"8.0.3-rc", ServerVersion{Major: 8, Minor: 0, Rev: 3, PreRelease: "rc"}, true},
+		{"8.0.36-debug", ServerVersion{Major: 8, Minor: 0, Rev: 36, Variant: "debug"}, true},
+		{"8.0.35-27-debug", ServerVersion{Major: 8, Minor: 0, Rev: 35, Build: "27", Variant: "debug"}, true},
+		{"10.11.6-MariaDB", ServerVersion{Major: 10, Minor: 11, Rev: 6}, true},
+		{"10.11.6-MariaDB-log", ServerVersion{Major: 10, Minor: 11, Rev: 6}, true},
+		{"8.0.36-mybuild", ServerVersion{Major: 8, Minor: 0, Rev: 36, Variant: "mybuild"}, true},
+		{"5.0.96.2", ServerVersion{}, false},
+		{"1.2.3abc", ServerVersion{}, false},
+		{"-5.0.9", ServerVersion{}, false},
+		{"8.0", ServerVersion{}, false},
+	}
+	for _, v := range versions {
+		sv, err := ParseServerVersion(v.input)
+		if !v.isValid {
+			compare.OkIsNotNil(v.input+" invalid", err, t)
+			continue
+		}
+		compare.OkIsNil(v.input, err, t)
+		compare.OkEqualInterface(v.input, sv, v.expected, t)
+	}
+	sv, _ := ParseServerVersion("ps8.0.35-27-debug")
+	compare.OkEqualString("full version", sv.String(), "ps8.0.35-27-debug", t)
+	compare.OkEqualString("numeric version", sv.Numeric(), "8.0.35", t)
+	compare.OkEqualString("short version", sv.ShortVersion(), "8.0", t)
+	compare.OkEqualString("qualifiers", sv.Qualifiers(), "-27-debug", t)
+}
+
+func TestParseTarballVersion(t *testing.T) {
+	var tarballs = []struct {
+		name     string
+		expected string
+	}{
+		{"mysql-8.0.36-linux-glibc2.28-x86_64.tar.xz", "8.0.36"},
+		{"mysql-8.0.4-rc-linux-glibc2.12-x86_64.tar.gz", "8.0.4-rc"},
+		{"mysql-8.0.0-dmr-linux-glibc2.12-x86_64.tar.gz", "8.0.0-dmr"},
+		{"Percona-Server-8.0.35-27-Linux.x86_64.glibc2.17-minimal.tar.gz", "8.0.35-27"},
+		{"Percona-XtraDB-Cluster_8.0.35-27.1_Linux.x86_64.glibc2.17-minimal.tar.gz", "8.0.35-27.1"},
+		{"mariadb-10.11.6-linux-systemd-x86_64.tar.gz", "10.11.6"},
+		{"mysql-8.0.36-debug-linux-x86_64.tar.gz", "8.0.36-debug"},
+		{"/tmp/mysql-5.7.44-27.tar.gz", "5.7.44-27"},
+		{"tidb-v3.0.0-linux-amd64.tar.gz", "3.0.0"},
+	}
+	for _, tb := range tarballs {
+		sv, err := ParseTarballVersion(tb.name)
+		compare.OkIsNil(tb.name, err, t)
+		compare.OkEqualString(tb.name, sv.String(), tb.expected, t)
+	}
+	_, err := ParseTarballVersion("mysql-mybuild.tar.gz")
+	compare.OkIsNotNil("no version in tarball", err, t)
+
+	flavor, version, shortVersion, err := FindTarballInfo("Percona-Server-8.0.35-27-Linux.x86_64.glibc2.17.tar.gz")
+	compare.OkIsNil("tarball info", err, t)
+	compare.OkEqualString("tarball flavor", flavor, PerconaServerFlavor, t)
+	compare.OkEqualString("tarball version", version, "8.0.35", t)
+	compare.OkEqualString("tarball short version", shortVersion, "8.0", t)
+}
+
+func TestSortVersionBuilds(t *testing.T) {
+	versions := []string{"8.0.35-28", "8.0.35-27-debug", "8.0.36", "8.0.35", "8.0.35-27", "8.0.36-rc", "not-a-version"}
+	sorted := SortVersions(versions)
+	compare.OkEqualStringSlices(t, sorted, []string{"8.0.35", "8.0.35-27", "8.0.35-27-debug", "8.0.35-28", "8.0.36-rc", "8.0.36"})
+
+	capable, err := HasCapability(MySQLFlavor, ReplicaTerminology, "8.0.35-27-debug")
+	compare.OkIsNil("capability with qualifiers", err, t)
+	compare.OkEqualBool("capability with qualifiers", capable, true, t)
+}
+
+func TestResolveVersionBuild(t *testing.T) {
+	sandboxBinary, err := os.MkdirTemp("", "server_version")
+	compare.OkIsNil("temporary directory", err, t)
+	defer os.RemoveAll(sandboxBinary)
+	for _, dir := range []string{"8.0.35-27", "8.0.36-27", "8.0.36-28-debug", "8.0.37", "custom"} {
+		err = os.MkdirAll(path.Join(sandboxBinary, dir, "bin"), 0755)
+		compare.OkIsNil(dir, err, t)
+		err = WriteString("", path.Join(sandboxBinary, dir, "bin", "mysqld"))
+		compare.OkIsNil(dir, err, t)
+	}
+	versions, err := GetVersionsFromDir(sandboxBinary)
+	compare.OkIsNil("versions from dir", err, t)
+	compare.OkEqualStringSlices(t, versions, []string{"8.0.35-27", "8.0.36-27", "8.0.36-28-debug", "8.0.37", "custom"})
+
+	var resolutions = []struct {
+		wanted   string
+		expected string
+		isValid  bool
+	}{
+		{"8.0.35", "8.0.35-27", true},
+		{"8.0.36-27", "8.0.36-27", true},
+		{"8.0.37", "8.0.37", true},
+		{"8.0.38", "8.0.38", true},
+		{"8.0.36", "", false},
+	}
+	for _, r := range resolutions {
+		resolved, err := ResolveVersionBuild(sandboxBinary, r.wanted)
+		if !r.isValid {
+			compare.OkIsNotNil(r.wanted+" ambiguous", err, t)
+			continue
+		}
+		compare.OkIsNil(r.wanted, err, t)
+		compare.OkEqualString(r.wanted, resolved, r.expected, t)
+	}
+}
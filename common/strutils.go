@@ -22,6 +22,9 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/araddon/dateparse"
 
 	"github.com/datacharmer/dbdeployer/globals"
 )
@@ -171,12 +174,14 @@ func Coalesce(items ...interface{}) interface{} {
 // this function returns an ordered list, taking into account the
 // components of the versions, so that 5.6.2 sorts lower than 5.6.11
 // while a text sort would put 5.6.11 before 5.6.2
+// Builds of the same version are sorted by vendor build, then pre-release
+// and variant (see ServerVersion.Compare). Items that are not versions are skipped.
 // If wanted is not empty, it will be interpreted as a short version to match.
 // For example, when wanted is "5.6", only the versions starting with '5.6' will be considered.
 func SortVersionsSubset(versions []string, wanted string) (sorted []string) {
-	type versionList struct {
-		text      string
-		majMinRev []int
+	type versionItem struct {
+		text    string
+		version ServerVersion
 	}
 	reNonNumeric := regexp.MustCompile(`^\D+`)
 	wanted = reNonNumeric.ReplaceAllString(wanted, "")
@@ -191,22 +196,18 @@ func SortVersionsSubset(versions []string, wanted string) (sorted []string) {
 			wantedMin, _ = strconv.Atoi(verList[1])
 		}
 	}
-	var vlist []versionList
+	var vlist []versionItem
 	for _, line := range versions {
-		vl, err := VersionToList(line)
+		sv, err := ParseServerVersion(line)
 		if err != nil {
 			CondPrintf("%s\n", err)
-			return versions
-		}
-		rec := versionList{
-			text:      line,
-			majMinRev: vl,
+			continue
 		}
-		if vl[0] > 0 {
+		if sv.Major > 0 {
 			willAppend := true
 			if wantedMaj > 0 {
-				if vl[0] == wantedMaj {
-					if vl[1] != wantedMin {
+				if sv.Major == wantedMaj {
+					if sv.Minor != wantedMin {
 						willAppend = false
 					}
 				} else {
@@ -214,20 +215,12 @@ func SortVersionsSubset(versions []string, wanted string) (sorted []string) {
 				}
 			}
 			if willAppend {
-				vlist = append(vlist, rec)
+				vlist = append(vlist, versionItem{text: line, version: sv})
 			}
 		}
 	}
-	sort.Slice(vlist, func(a, b int) bool {
-		majA := vlist[a].majMinRev[0]
-		minA := vlist[a].majMinRev[1]
-		revA := vlist[a].majMinRev[2]
-		majB := vlist[b].majMinRev[0]
-		minB := vlist[b].majMinRev[1]
-		revB := vlist[b].majMinRev[2]
-		return majA < majB ||
-			(majA == majB && minA < minB) ||
-			(majA == majB && minA == minB && revA < revB)
+	sort.SliceStable(vlist, func(a, b int) bool {
+		return vlist[a].version.Compare(vlist[b].version) < 0
 	})
 	for _, v := range vlist {
 		sorted = append(sorted, v.text)
@@ -361,15 +354,18 @@ func Exit(exitCode int, messages ...string) {
 	os.Exit(exitCode)
 }
 
-// Returns the latest version among the ones found in a Sandbox binary directory
-func LatestVersion(searchDir, pattern string) string {
-	files, err := os.ReadDir(searchDir)
-	ErrCheckExitf(err, 1, "ERROR reading directory %s: %s", searchDir, err)
-	var matchingList []string
+// Returns the latest version among the ones found in a Sandbox binary directory.
+// If no version matches the pattern, it returns an empty string
+func LatestVersion(searchDir, pattern string) (string, error) {
 	validPattern := regexp.MustCompile(`\d+\.\d+$`)
 	if !validPattern.MatchString(pattern) {
-		Exit(1, "Invalid pattern. Must be '#.#'")
+		return "", fmt.Errorf("invalid pattern '%s'. Must be '#.#'", pattern)
+	}
+	files, err := os.ReadDir(searchDir)
+	if err != nil {
+		return "", fmt.Errorf("error reading directory %s: %s", searchDir, err)
 	}
+	var matchingList []string
 	re := regexp.MustCompile(fmt.Sprintf(`^%s\.\d+$`, pattern))
 	for _, f := range files {
 		if f.IsDir() && re.MatchString(f.Name()) {
@@ -379,9 +375,9 @@ func LatestVersion(searchDir, pattern string) string {
 	sortedList := SortVersions(matchingList)
 	if len(sortedList) > 0 {
 		latest := sortedList[len(sortedList)-1]
-		return latest
+		return latest, nil
 	}
-	return ""
+	return "", nil
 }
 
 func OptionComponents(s string) (value string, negation bool) {
@@ -401,3 +397,58 @@ func OptionCompare(option, value string) bool {
 	}
 	return matches
 }
+
+// ParseTTL converts a time-to-live such as "2h", "90m", "3d", or "1d12h" into a duration.
+// Besides the units accepted by time.ParseDuration, it accepts days ("d") as leading component
+func ParseTTL(ttl string) (time.Duration, error) {
+	var days time.Duration
+	rest := ttl
+	reDays := regexp.MustCompile(`^(\d+)d(.*)$`)
+	matches := reDays.FindStringSubmatch(ttl)
+	if matches != nil {
+		numDays, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid time-to-live '%s': %s", ttl, err)
+		}
+		days = time.Duration(numDays) * 24 * time.Hour
+		rest = matches[2]
+	}
+	var duration time.Duration
+	if rest != "" {
+		var err error
+		duration, err = time.ParseDuration(rest)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time-to-live '%s': %s", ttl, err)
+		}
+	}
+	duration += days
+	if duration <= 0 {
+		return 0, fmt.Errorf("invalid time-to-live '%s': it must be greater than zero", ttl)
+	}
+	return duration, nil
+}
+
+// ExpirationTime returns the expiration of a sandbox, in RFC3339 format, from either a time-to-live
+// or an explicit date and time. It returns an empty string when neither is given
+func ExpirationTime(ttl, expiresAt string, now time.Time) (string, error) {
+	switch {
+	case ttl != "" && expiresAt != "":
+		return "", fmt.Errorf("only one of --%s and --%s can be used", globals.TtlLabel, globals.ExpiresAtLabel)
+	case ttl != "":
+		duration, err := ParseTTL(ttl)
+		if err != nil {
+			return "", err
+		}
+		return now.Add(duration).Format(time.RFC3339), nil
+	case expiresAt != "":
+		expiration, err := dateparse.ParseLocal(expiresAt)
+		if err != nil {
+			return "", fmt.Errorf("invalid expiration time '%s': %s", expiresAt, err)
+		}
+		if !expiration.After(now) {
+			return "", fmt.Errorf("expiration time '%s' is not in the future", expiresAt)
+		}
+		return expiration.Format(time.RFC3339), nil
+	}
+	return "", nil
+}
@@ -22,6 +22,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 type pathInfo struct {
@@ -433,3 +434,61 @@ func TestOptionComponents(t *testing.T) {
 		}
 	}
 }
+
+func TestParseTTL(t *testing.T) {
+	var data = []struct {
+		ttl      string
+		expected time.Duration
+		isError  bool
+	}{
+		{"2h", 2 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"3d", 72 * time.Hour, false},
+		{"1d12h", 36 * time.Hour, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"0h", 0, true},
+		{"-2h", 0, true},
+		{"2 hours", 0, true},
+		{"d", 0, true},
+		{"", 0, true},
+	}
+	for _, d := range data {
+		duration, err := ParseTTL(d.ttl)
+		if d.isError {
+			compare.OkIsNotNil(fmt.Sprintf("TTL '%s'", d.ttl), err, t)
+			continue
+		}
+		compare.OkIsNil(fmt.Sprintf("TTL '%s'", d.ttl), err, t)
+		compare.OkEqualInt(fmt.Sprintf("TTL '%s'", d.ttl), int(duration/time.Second), int(d.expected/time.Second), t)
+	}
+}
+
+func TestExpirationTime(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.Local)
+	var data = []struct {
+		ttl       string
+		expiresAt string
+		expected  string
+		isError   bool
+	}{
+		{"", "", "", false},
+		{"2h", "", now.Add(2 * time.Hour).Format(time.RFC3339), false},
+		{"1d", "", now.Add(24 * time.Hour).Format(time.RFC3339), false},
+		{"", "2024-05-11 08:30", time.Date(2024, 5, 11, 8, 30, 0, 0, time.Local).Format(time.RFC3339), false},
+		{"", "2024-05-11T08:30:00Z", "2024-05-11T08:30:00Z", false},
+		{"", "2024-05-09 08:30", "", true},
+		{"", "next week", "", true},
+		{"2h", "2024-05-11 08:30", "", true},
+		{"two", "", "", true},
+	}
+	for _, d := range data {
+		label := fmt.Sprintf("ttl '%s' expires-at '%s'", d.ttl, d.expiresAt)
+		expiration, err := ExpirationTime(d.ttl, d.expiresAt, now)
+		if d.isError {
+			compare.OkIsNotNil(label, err, t)
+			continue
+		}
+		compare.OkIsNil(label, err, t)
+		compare.OkEqualString(label, expiration, d.expected, t)
+	}
+}
@@ -64,8 +64,11 @@ func TestVersionToPort(t *testing.T) {
 		{"8.0.4", 8004},       // OK: 8.0
 		{"8.0.4", 8004},       // OK: 8.0
 		{"8.9.4", 8904},       // OK: 8.9
+		{"8.4.0", 8400},       // OK: 8.4 LTS
+		{"8.4.12", 8412},      // OK: 8.4 LTS
 		{"8.10.4", 21004},     // OK: 8.10
 		{"9.0.4", 9004},       // OK: 9.0
+		{"9.5.0", 9500},       // OK: 9.5 innovation
 		{"9.10.04", 31004},    // OK: 9.10
 		{"22.0.0", 22000},     // OK: 22.0
 		{"22.1.0", 22100},     // OK: 22.1
@@ -124,6 +127,8 @@ func TestVersionToList(t *testing.T) {
 		{"ma10.10.1", []int{10, 10, 1}}, // OK: 10.10 with prefix
 		{"ma15.15.1", []int{15, 15, 1}}, // OK: 15.15 with prefix
 		{"22.12.2", []int{22, 12, 2}},   // OK: 12.12
+		{"8.0.35-27", []int{8, 0, 35}},  // OK: vendor build
+		{"8.0.4-rc", []int{8, 0, 4}},    // OK: pre-release
 	}
 	for _, vl := range versions {
 		version := vl.version
@@ -157,17 +157,20 @@ func ListArchives() {
 }
 
 func LoadArchive(archiveName, sandboxName string, overwrite bool) error {
+	sandboxHome := defaults.Defaults().SandboxHome
+	return LoadArchiveIntoDir(archiveName, path.Join(sandboxHome, sandboxName), overwrite)
+}
+
+// LoadArchiveIntoDir loads an archive into the sandbox found at sandboxPath
+func LoadArchiveIntoDir(archiveName, sandboxPath string, overwrite bool) error {
 
 	archives, _ := Archives()
 	archive, found := archives[archiveName]
 	if !found {
 		return fmt.Errorf("archive %s not found", archiveName)
 	}
-	sandboxHome := defaults.Defaults().SandboxHome
-
-	sandboxPath := path.Join(sandboxHome, sandboxName)
 	if !common.DirExists(sandboxPath) {
-		return fmt.Errorf("sandbox %s not found", sandboxName)
+		return fmt.Errorf("sandbox %s not found", common.BaseName(sandboxPath))
 	}
 	ext := ""
 	if strings.HasSuffix(archive.FileName, globals.TarGzExt) {
@@ -0,0 +1,222 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dbdeployertest deploys ephemeral sandboxes from within Go tests.
+// Each sandbox is deployed in a temporary directory, using ports that are free
+// in the operating system, and it is stopped and removed when the test ends.
+package dbdeployertest
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/datacharmer/dbdeployer/api"
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/importing"
+	"github.com/datacharmer/dbdeployer/ops"
+	"github.com/datacharmer/dbdeployer/sandbox"
+)
+
+const (
+	minTestPort     = 10000
+	maxTestPort     = 40000
+	maxPortAttempts = 100
+)
+
+// Options changes the defaults of a test sandbox.
+// The sandbox home and the ports are always chosen by this package
+type Options struct {
+	SandboxBinary string // where the expanded tarballs are (default: from dbdeployer defaults)
+	Flavor        string // default: detected from the binaries
+	DbUser        string
+	DbPassword    string
+	MyCnfOptions  []string // options to add to my.sandbox.cnf
+	InitOptions   []string // options for the server initialization
+	PreGrantsSql  []string // queries to run before loading grants
+	PostGrantsSql []string // queries to run after loading grants
+	Gtid          bool
+	// Customize, when set, can change the sandbox definition before the deployment
+	Customize func(*sandbox.SandboxDef) error
+}
+
+// ReplicationOptions changes the defaults of a test replication sandbox
+type ReplicationOptions struct {
+	Options
+	Topology      string // default: master-slave
+	Nodes         int    // default: 3
+	SemiSync      bool   // master-slave only
+	SinglePrimary bool   // group only
+}
+
+// Server is a database server of a test sandbox
+type Server struct {
+	Node       string // name of the node directory. Empty for single sandboxes
+	Dir        string
+	Connection ops.SandboxConnection // credentials of the database user
+	DB         *sql.DB
+}
+
+// Sandbox is a test sandbox, with a connection handle for each of its servers
+type Sandbox struct {
+	api.Sandbox
+	Servers []Server
+}
+
+// DB returns the connection handle of the first server (the master, in replication sandboxes)
+func (s *Sandbox) DB() *sql.DB {
+	return s.Servers[0].DB
+}
+
+// freeBasePort returns a port such that the ports of all the nodes of a sandbox
+// are free, including the ones for X protocol, admin, and group replication.
+// Nodes use the ports following the base one.
+// The search starts at a random port, so that parallel tests don't compete for the same ones
+func freeBasePort(nodes int) (int, error) {
+	d := defaults.Defaults()
+	deltas := []int{d.MysqlXPortDelta, d.AdminPortDelta, d.GroupPortDelta}
+	generator := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for attempt := 0; attempt < maxPortAttempts; attempt++ {
+		basePort, err := common.FindFreePort(minTestPort+generator.Intn(maxTestPort-minTestPort), nil, nodes+1)
+		if err != nil {
+			return 0, err
+		}
+		allFree := basePort < maxTestPort
+		for node := 0; node <= nodes && allFree; node++ {
+			for _, delta := range deltas {
+				if common.IsPortBusy(basePort + node + delta) {
+					allFree = false
+					break
+				}
+			}
+		}
+		if allFree {
+			return basePort, nil
+		}
+	}
+	return 0, fmt.Errorf("no free ports found after %d attempts", maxPortAttempts)
+}
+
+// deployOptions converts the test options into the options of the api package
+func (options Options) deployOptions(version, sandboxHome string) api.DeployOptions {
+	return api.DeployOptions{
+		Version:       version,
+		SandboxBinary: options.SandboxBinary,
+		SandboxHome:   sandboxHome,
+		Flavor:        options.Flavor,
+		DbUser:        options.DbUser,
+		DbPassword:    options.DbPassword,
+		MyCnfOptions:  options.MyCnfOptions,
+		InitOptions:   options.InitOptions,
+		PreGrantsSql:  options.PreGrantsSql,
+		PostGrantsSql: options.PostGrantsSql,
+		Gtid:          options.Gtid,
+		Customize:     options.Customize,
+	}
+}
+
+// openServer reads the connection credentials of a server, and opens a handle to it.
+// The handle connects lazily: no query is sent here
+func openServer(dir, node string) (Server, error) {
+	server := Server{Node: node, Dir: path.Join(dir, node)}
+	connection, err := ops.GetSandboxConnection(server.Dir, true)
+	if err != nil {
+		return server, err
+	}
+	server.Connection = connection
+	db, err := importing.Connect(importing.ParamsToConfig(connection.Host, connection.User, connection.Password, connection.Port))
+	if err != nil {
+		return server, err
+	}
+	server.DB = db.DB
+	return server, nil
+}
+
+// register registers the removal of the sandbox at the end of the test, and opens the server handles
+func register(t testing.TB, deployed api.Sandbox) *Sandbox {
+	t.Helper()
+	result := &Sandbox{Sandbox: deployed}
+	t.Cleanup(func() {
+		for _, server := range result.Servers {
+			if server.DB != nil {
+				_ = server.DB.Close()
+			}
+		}
+		err := api.Delete(deployed.Dir)
+		if err != nil {
+			t.Errorf("error removing sandbox %s: %s", deployed.Dir, err)
+		}
+	})
+	nodes := deployed.Nodes
+	if len(nodes) == 0 {
+		nodes = []string{""}
+	}
+	for _, node := range nodes {
+		server, err := openServer(deployed.Dir, node)
+		if err != nil {
+			t.Fatalf("error connecting to sandbox %s: %s", server.Dir, err)
+		}
+		result.Servers = append(result.Servers, server)
+	}
+	return result
+}
+
+// StartSingle deploys a single sandbox of the given version, and removes it when the test ends.
+// The version can be full (8.0.36) or short (8.0)
+func StartSingle(t testing.TB, version string, options Options) *Sandbox {
+	t.Helper()
+	port, err := freeBasePort(0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	deployOptions := options.deployOptions(version, t.TempDir())
+	deployOptions.Port = port
+	deployed, err := api.DeploySingle(deployOptions)
+	if err != nil {
+		t.Fatalf("error deploying single sandbox %s: %s", version, err)
+	}
+	return register(t, deployed)
+}
+
+// StartReplication deploys a replication sandbox of the given version, and removes it when the test ends.
+// The servers are listed in the order of the sandbox nodes, starting with the master
+func StartReplication(t testing.TB, version string, options ReplicationOptions) *Sandbox {
+	t.Helper()
+	nodes := options.Nodes
+	if nodes == 0 {
+		nodes = 3
+	}
+	basePort, err := freeBasePort(nodes)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	deployOptions := options.deployOptions(version, t.TempDir())
+	deployOptions.BasePort = basePort
+	deployed, err := api.DeployReplication(api.ReplicationOptions{
+		DeployOptions: deployOptions,
+		Topology:      options.Topology,
+		Nodes:         nodes,
+		SemiSync:      options.SemiSync,
+		SinglePrimary: options.SinglePrimary,
+	})
+	if err != nil {
+		t.Fatalf("error deploying replication sandbox %s: %s", version, err)
+	}
+	return register(t, deployed)
+}
@@ -0,0 +1,74 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbdeployertest
+
+import (
+	"path"
+	"testing"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/sandbox"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreeBasePort(t *testing.T) {
+	port, err := freeBasePort(3)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, port, minTestPort)
+	require.Less(t, port, maxTestPort)
+	require.False(t, common.IsPortBusy(port+1))
+}
+
+// The mock binaries don't run real servers: these tests check the deployment,
+// the connection data, and the removal, but don't send queries
+func TestStartWithMockBinaries(t *testing.T) {
+	require.NoError(t, sandbox.SetMockEnvironment(sandbox.DefaultMockDir))
+	defer func() { _ = sandbox.RemoveMockEnvironment(sandbox.DefaultMockDir) }()
+	require.NoError(t, sandbox.CreateMockVersion("8.0.36"))
+
+	var single, replication *Sandbox
+	t.Run("single", func(t *testing.T) {
+		single = StartSingle(t, "8.0", Options{})
+		require.True(t, common.DirExists(single.Dir))
+		require.Len(t, single.Servers, 1)
+		server := single.Servers[0]
+		require.Equal(t, single.Dir, server.Dir)
+		require.Equal(t, single.Port[0], server.Connection.Port)
+		require.Equal(t, globals.DbUserValue, server.Connection.User)
+		require.NotNil(t, single.DB())
+	})
+	t.Run("replication", func(t *testing.T) {
+		replication = StartReplication(t, "8.0.36", ReplicationOptions{Nodes: 2})
+		require.Equal(t, []string{"master", "node1"}, replication.Nodes)
+		require.Len(t, replication.Servers, 2)
+		for _, server := range replication.Servers {
+			require.Equal(t, path.Join(replication.Dir, server.Node), server.Dir)
+			require.NotNil(t, server.DB)
+		}
+		require.NotEqual(t, replication.Servers[0].Connection.Port, replication.Servers[1].Connection.Port)
+	})
+	// The sandboxes are removed, together with their catalog entries, when each test ends
+	catalog, err := defaults.ReadCatalog()
+	require.NoError(t, err)
+	for _, sb := range []*Sandbox{single, replication} {
+		require.NotNil(t, sb)
+		require.False(t, common.DirExists(sb.Dir))
+		_, found := catalog[sb.Dir]
+		require.False(t, found)
+	}
+}
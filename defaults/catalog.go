@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/nightlyone/lockfile"
@@ -29,18 +30,52 @@ import (
 )
 
 type SandboxItem struct {
-	Origin            string   `json:"origin"`
-	SBType            string   `json:"type"` // single multi master-slave group all-masters fan-in ndb pxc
-	Version           string   `json:"version"`
-	Flavor            string   `json:"flavor,omitempty"`
-	Host              string   `json:"host,omitempty"`
-	Port              []int    `json:"port"`
-	Nodes             []string `json:"nodes"`
-	Destination       string   `json:"destination"`
-	DbDeployerVersion string   `json:"dbdeployer-version"`
-	Timestamp         string   `json:"timestamp"`
-	LogDirectory      string   `json:"log-directory,omitempty"`
-	CommandLine       string   `json:"command-line"`
+	Origin            string         `json:"origin"`
+	SBType            string         `json:"type"` // single multi master-slave group all-masters fan-in ndb pxc
+	Version           string         `json:"version"`
+	Flavor            string         `json:"flavor,omitempty"`
+	Host              string         `json:"host,omitempty"`
+	Port              []int          `json:"port"`
+	Nodes             []string       `json:"nodes"`
+	Destination       string         `json:"destination"`
+	DbDeployerVersion string         `json:"dbdeployer-version"`
+	Timestamp         string         `json:"timestamp"`
+	LogDirectory      string         `json:"log-directory,omitempty"`
+	CommandLine       string         `json:"command-line"`
+	Snapshots         []SnapshotItem `json:"snapshots,omitempty"`
+	// NodeVersions is only filled for sandboxes where nodes use different versions
+	NodeVersions []common.NodeVersion `json:"node-versions,omitempty"`
+	// Backend is the sandbox that a proxy sandbox connects to
+	Backend string `json:"backend,omitempty"`
+	// ExpiresAt is the time (RFC3339) after which "dbdeployer gc" can remove the sandbox
+	ExpiresAt string `json:"expires-at,omitempty"`
+}
+
+// SnapshotItem describes a copy of the data directories of a sandbox
+type SnapshotItem struct {
+	Label     string   `json:"label"`
+	Timestamp string   `json:"timestamp"`
+	Method    string   `json:"method"` // stop or clone
+	Directory string   `json:"directory"`
+	Nodes     []string `json:"nodes"`
+}
+
+// ExpirationTime returns the time when the sandbox expires, and false if it has no expiration
+func (item SandboxItem) ExpirationTime() (time.Time, bool) {
+	if item.ExpiresAt == "" {
+		return time.Time{}, false
+	}
+	expiration, err := time.Parse(time.RFC3339, item.ExpiresAt)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return expiration, true
+}
+
+// IsExpired returns true if the sandbox has an expiration that is not later than the given time
+func (item SandboxItem) IsExpired(when time.Time) bool {
+	expiration, ok := item.ExpirationTime()
+	return ok && !expiration.After(when)
 }
 
 type SandboxCatalog map[string]SandboxItem
@@ -57,7 +92,9 @@ func writeCatalog(sc SandboxCatalog) error {
 		return nil
 	}
 	byteBuf, err := json.MarshalIndent(sc, " ", "\t")
-	common.ErrCheckExitf(err, 1, "error encoding sandbox catalog: %s", err)
+	if err != nil {
+		return fmt.Errorf("error encoding sandbox catalog: %s", err)
+	}
 	jsonString := string(byteBuf)
 	filename := SandboxRegistry
 	return common.WriteString(jsonString, filename)
@@ -106,10 +143,33 @@ func unsafeReadCatalog() (sc SandboxCatalog, err error) {
 	return
 }
 
-// Sets the catalog lock, waiting up to lockTimeout milliseconds
+// catalogLock is the lock that protects the catalog.
+// The lock file excludes other processes, and catalogMutex the other goroutines of this process
+type catalogLock struct {
+	file lockfile.Lockfile
+}
+
+var (
+	catalogMutex sync.Mutex
+	// operationMutex serializes the operations run by WithCatalogLock
+	operationMutex sync.Mutex
+	// operationLock is the lock file held by the operation that is running under WithCatalogLock
+	operationLock lockfile.Lockfile
+)
+
+// Unlock releases the catalog lock
+func (lock catalogLock) Unlock() error {
+	var err error
+	if lock.file != "" {
+		err = lock.file.Unlock()
+	}
+	catalogMutex.Unlock()
+	return err
+}
+
+// tryLockFile sets the catalog lock file, waiting up to lockTimeout milliseconds
 // if a concurrent operation is under way.
-// This approach guarantees thread and inter-process safety
-func setLock(label string) (lockfile.Lockfile, error) {
+func tryLockFile(label string) (lockfile.Lockfile, error) {
 	lock, err := lockfile.New(SandboxRegistryLock)
 	if err != nil {
 		return lockfile.Lockfile(""), fmt.Errorf("could not establish lock file for %s: %s", label, err)
@@ -130,6 +190,49 @@ func setLock(label string) (lockfile.Lockfile, error) {
 	return lock, nil
 }
 
+// Sets the catalog lock, waiting up to lockTimeout milliseconds
+// if a concurrent operation is under way.
+// This approach guarantees thread and inter-process safety.
+// While an operation runs under WithCatalogLock, this process already owns
+// the lock file, and only the other goroutines need to be excluded
+func setLock(label string) (catalogLock, error) {
+	catalogMutex.Lock()
+	if operationLock != "" {
+		return catalogLock{}, nil
+	}
+	lock, err := tryLockFile(label)
+	if err != nil {
+		catalogMutex.Unlock()
+		return catalogLock{}, err
+	}
+	return catalogLock{file: lock}, nil
+}
+
+// WithCatalogLock runs an operation that must not overlap with other changes to the sandboxes.
+// The operations of this process run one at a time, and the catalog lock is held
+// until the operation ends, so that other dbdeployer processes can't change the catalog.
+// The catalog functions called by the operation can still read and update it.
+func WithCatalogLock(label string, operation func() error) error {
+	operationMutex.Lock()
+	defer operationMutex.Unlock()
+	catalogMutex.Lock()
+	lock, err := tryLockFile(label)
+	if err != nil {
+		catalogMutex.Unlock()
+		return err
+	}
+	operationLock = lock
+	catalogMutex.Unlock()
+
+	defer func() {
+		catalogMutex.Lock()
+		operationLock = ""
+		_ = lock.Unlock()
+		catalogMutex.Unlock()
+	}()
+	return operation()
+}
+
 // Safe update of the catalog, protected by a lock
 func UpdateCatalog(sbName string, details SandboxItem) error {
 	details.DbDeployerVersion = common.VersionDef
@@ -156,7 +259,11 @@ func UpdateCatalog(sbName string, details SandboxItem) error {
 	}
 	current[sbName] = details
 	err = writeCatalog(current)
-	return err
+	if err != nil {
+		return err
+	}
+	// The ports of the sandbox are now in the catalog, and don't need a lease anymore
+	return unsafeReleasePorts(details.Port)
 }
 
 // Safe deletion of a catalog entry
@@ -185,6 +292,104 @@ func DeleteFromCatalog(sbName string) error {
 	return err
 }
 
+// Safe modification of an existing catalog entry, protected by a lock
+func modifyCatalogEntry(sbName string, modify func(item *SandboxItem) error) error {
+	if !enableCatalogManagement {
+		return nil
+	}
+	lock, err := setLock(sbName)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	err = checkCatalog()
+	if err != nil {
+		return err
+	}
+	current, err := unsafeReadCatalog()
+	if err != nil {
+		return err
+	}
+	item, ok := current[sbName]
+	if !ok {
+		return fmt.Errorf("sandbox %s not found in catalog", sbName)
+	}
+	err = modify(&item)
+	if err != nil {
+		return err
+	}
+	current[sbName] = item
+	return writeCatalog(current)
+}
+
+// Safe replacement of the whole catalog, protected by a lock.
+// The function receives the current catalog and returns the one to be written
+func RewriteCatalog(rewrite func(current SandboxCatalog) (SandboxCatalog, error)) error {
+	if !enableCatalogManagement {
+		return nil
+	}
+	lock, err := setLock("rewrite")
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	err = checkCatalog()
+	if err != nil {
+		return err
+	}
+	current, err := unsafeReadCatalog()
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		current = make(SandboxCatalog)
+	}
+	newCatalog, err := rewrite(current)
+	if err != nil {
+		return err
+	}
+	return writeCatalog(newCatalog)
+}
+
+// Records a snapshot in the catalog entry of a sandbox.
+// A snapshot with the same label is replaced
+func AddSnapshotToCatalog(sbName string, snapshot SnapshotItem) error {
+	return modifyCatalogEntry(sbName, func(item *SandboxItem) error {
+		var snapshots []SnapshotItem
+		for _, s := range item.Snapshots {
+			if s.Label != snapshot.Label {
+				snapshots = append(snapshots, s)
+			}
+		}
+		item.Snapshots = append(snapshots, snapshot)
+		return nil
+	})
+}
+
+// Removes a snapshot from the catalog entry of a sandbox
+func DeleteSnapshotFromCatalog(sbName, label string) error {
+	return modifyCatalogEntry(sbName, func(item *SandboxItem) error {
+		var snapshots []SnapshotItem
+		for _, s := range item.Snapshots {
+			if s.Label != label {
+				snapshots = append(snapshots, s)
+			}
+		}
+		item.Snapshots = snapshots
+		return nil
+	})
+}
+
+// Records the nodes and ports of a sandbox whose nodes were added or removed
+func UpdateCatalogNodes(sbName string, nodes []string, ports []int, nodeVersions []common.NodeVersion) error {
+	return modifyCatalogEntry(sbName, func(item *SandboxItem) error {
+		item.Nodes = nodes
+		item.Port = ports
+		item.NodeVersions = nodeVersions
+		return nil
+	})
+}
+
 // Check that the configuration directory exists and creates it if needed
 // If no catalog exists, creates an empty one.
 func checkCatalog() error {
@@ -17,8 +17,10 @@ package defaults
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path"
+	"strconv"
 	"time"
 
 	"github.com/datacharmer/dbdeployer/common"
@@ -39,10 +41,17 @@ type DbdeployerDefaults struct {
 	GroupReplicationSpBasePort    int    `json:"group-replication-sp-base-port"`
 	FanInReplicationBasePort      int    `json:"fan-in-replication-base-port"`
 	AllMastersReplicationBasePort int    `json:"all-masters-replication-base-port"`
+	CircularReplicationBasePort   int    `json:"circular-replication-base-port"`
+	ChainReplicationBasePort      int    `json:"chain-replication-base-port"`
+	InnoDBClusterBasePort         int    `json:"innodb-cluster-base-port"`
+	RouterBasePort                int    `json:"router-base-port"`
+	ProxySQLBasePort              int    `json:"proxysql-base-port"`
 	MultipleBasePort              int    `json:"multiple-base-port"`
 	PxcBasePort                   int    `json:"pxc-base-port"`
 	NdbBasePort                   int    `json:"ndb-base-port"`
 	NdbClusterPort                int    `json:"ndb-cluster-port"`
+	TidbClusterBasePort           int    `json:"tidb-cluster-base-port"`
+	GaleraBasePort                int    `json:"galera-base-port"`
 	GroupPortDelta                int    `json:"group-port-delta"`
 	MysqlXPortDelta               int    `json:"mysqlx-port-delta"`
 	AdminPortDelta                int    `json:"admin-port-delta"`
@@ -59,6 +68,11 @@ type DbdeployerDefaults struct {
 	MultiplePrefix                string `json:"multiple-prefix"`
 	FanInPrefix                   string `json:"fan-in-prefix"`
 	AllMastersPrefix              string `json:"all-masters-prefix"`
+	CircularPrefix                string `json:"circular-prefix"`
+	ChainPrefix                   string `json:"chain-prefix"`
+	InnoDBClusterPrefix           string `json:"innodb-cluster-prefix"`
+	RouterPrefix                  string `json:"router-prefix"`
+	ProxySQLPrefix                string `json:"proxysql-prefix"`
 	ReservedPorts                 []int  `json:"reserved-ports"`
 	RemoteRepository              string `json:"remote-repository"`
 	RemoteIndexFile               string `json:"remote-index-file"`
@@ -66,6 +80,8 @@ type DbdeployerDefaults struct {
 	RemoteTarballUrl              string `json:"remote-tarball-url"`
 	PxcPrefix                     string `json:"pxc-prefix"`
 	NdbPrefix                     string `json:"ndb-prefix"`
+	TidbClusterPrefix             string `json:"tidb-cluster-prefix"`
+	GaleraPrefix                  string `json:"galera-prefix"`
 	DefaultSandboxExecutable      string `json:"default-sandbox-executable"`
 	DownloadNameLinux             string `json:"download-name-linux"`
 	DownloadNameMacOs             string `json:"download-name-macos"`
@@ -81,6 +97,7 @@ const (
 	ArchivesFileName        string = "archives.json"
 	SandboxRegistryName     string = "sandboxes.json"
 	SandboxRegistryLockName string = "sandboxes.lock"
+	PortLeasesName          string = "port-leases.json"
 )
 
 var (
@@ -91,6 +108,7 @@ var (
 	CustomConfigurationFile string = ""
 	SandboxRegistry         string = path.Join(ConfigurationDir, SandboxRegistryName)
 	SandboxRegistryLock     string = path.Join(common.GlobalTempDir(), SandboxRegistryLockName)
+	PortLeasesFile          string = path.Join(ConfigurationDir, PortLeasesName)
 	LogSBOperations         bool   = common.IsEnvSet("DBDEPLOYER_LOGGING")
 
 	factoryDefaults = DbdeployerDefaults{
@@ -107,10 +125,17 @@ var (
 		GroupReplicationSpBasePort:    13000,
 		FanInReplicationBasePort:      14000,
 		AllMastersReplicationBasePort: 15000,
+		CircularReplicationBasePort:   17000,
+		ChainReplicationBasePort:      21000,
+		InnoDBClusterBasePort:         22000,
+		RouterBasePort:                6446,
+		ProxySQLBasePort:              6032,
 		MultipleBasePort:              16000,
 		PxcBasePort:                   18000,
 		NdbBasePort:                   19000,
 		NdbClusterPort:                20000,
+		TidbClusterBasePort:           23000,
+		GaleraBasePort:                24000,
 		GroupPortDelta:                125,
 		MysqlXPortDelta:               10000,
 		AdminPortDelta:                11000,
@@ -127,6 +152,11 @@ var (
 		MultiplePrefix:                "multi_msb_",
 		FanInPrefix:                   "fan_in_msb_",
 		AllMastersPrefix:              "all_masters_msb_",
+		CircularPrefix:                "circular_msb_",
+		ChainPrefix:                   "chain_msb_",
+		InnoDBClusterPrefix:           "ic_msb_",
+		RouterPrefix:                  "router_",
+		ProxySQLPrefix:                "proxysql_",
 		ReservedPorts:                 globals.ReservedPorts,
 		RemoteRepository:              "https://raw.githubusercontent.com/datacharmer/mysql-docker-minimal/master/dbdata",
 		RemoteIndexFile:               "available.json",
@@ -134,6 +164,8 @@ var (
 		RemoteTarballUrl:              "https://raw.githubusercontent.com/datacharmer/dbdeployer/master/downloads/tarball_list.json",
 		NdbPrefix:                     "ndb_msb_",
 		PxcPrefix:                     "pxc_msb_",
+		TidbClusterPrefix:             "tidb_cluster_",
+		GaleraPrefix:                  "galera_msb_",
 		DefaultSandboxExecutable:      "default",
 		DownloadNameLinux:             "mysql-{{.Version}}-linux-glibc2.17-x86_64{{.Minimal}}.{{.Ext}}",
 		DownloadNameMacOs:             "mysql-{{.Version}}-macos11-x86_64.{{.Ext}}",
@@ -145,10 +177,14 @@ var (
 
 func Defaults() DbdeployerDefaults {
 	if currentDefaults.Version == "" {
+		currentDefaults = factoryDefaults
 		if common.FileExists(ConfigurationFile) {
-			currentDefaults = ReadDefaultsFile(ConfigurationFile)
-		} else {
-			currentDefaults = factoryDefaults
+			// A configuration file that can't be read is reported by LoadConfiguration.
+			// Here we fall back to the factory defaults
+			fileDefaults, err := ReadDefaultsFile(ConfigurationFile)
+			if err == nil {
+				currentDefaults = fileDefaults
+			}
 		}
 	}
 	if currentDefaults.LogSBOperations {
@@ -157,29 +193,40 @@ func Defaults() DbdeployerDefaults {
 	return currentDefaults
 }
 
-func ShowDefaults(defaults DbdeployerDefaults) {
+func ShowDefaults(defaults DbdeployerDefaults) error {
 	defaults = replaceLiteralEnvValues(defaults)
+	b, err := json.MarshalIndent(defaults, " ", "\t")
+	if err != nil {
+		return fmt.Errorf(globals.ErrEncodingDefaults, err)
+	}
 	if common.FileExists(ConfigurationFile) {
 		common.CondPrintf("# Configuration file: %s\n", ConfigurationFile)
 	} else {
 		common.CondPrintln("# Internal values:")
 	}
-	b, err := json.MarshalIndent(defaults, " ", "\t")
-	common.ErrCheckExitf(err, 1, globals.ErrEncodingDefaults, err)
 	common.CondPrintf("%s\n", b)
+	return nil
 }
 
-func WriteDefaultsFile(filename string, defaults DbdeployerDefaults) {
+func WriteDefaultsFile(filename string, defaults DbdeployerDefaults) error {
 	defaults = replaceLiteralEnvValues(defaults)
 	defaultsDir := common.DirName(filename)
 	if !common.DirExists(defaultsDir) {
-		common.Mkdir(defaultsDir)
+		err := os.Mkdir(defaultsDir, globals.PublicDirectoryAttr)
+		if err != nil {
+			return fmt.Errorf("error creating directory %s: %s", defaultsDir, err)
+		}
 	}
 	b, err := json.MarshalIndent(defaults, " ", "\t")
-	common.ErrCheckExitf(err, 1, globals.ErrEncodingDefaults, err)
+	if err != nil {
+		return fmt.Errorf(globals.ErrEncodingDefaults, err)
+	}
 	jsonString := string(b)
 	err = common.WriteString(jsonString, filename)
-	common.ErrCheckExitf(err, 1, "error writing defaults file")
+	if err != nil {
+		return fmt.Errorf("error writing defaults file %s: %s", filename, err)
+	}
+	return nil
 }
 
 func expandEnvironmentVariables(defaults DbdeployerDefaults) DbdeployerDefaults {
@@ -198,14 +245,22 @@ func replaceLiteralEnvValues(defaults DbdeployerDefaults) DbdeployerDefaults {
 	return defaults
 }
 
-func ReadDefaultsFile(filename string) (defaults DbdeployerDefaults) {
+func ReadDefaultsFile(filename string) (DbdeployerDefaults, error) {
 	defaultsBlob, err := common.SlurpAsBytes(filename)
-	common.ErrCheckExitf(err, 1, "error reading defaults file %s: %s", filename, err)
+	if err != nil {
+		return DbdeployerDefaults{}, fmt.Errorf("error reading defaults file %s: %s", filename, err)
+	}
 
+	// Values that were added after the file was written are taken from the factory defaults
+	defaults := factoryDefaults
+	// json.Unmarshal reuses the backing array of a slice: without a copy,
+	// the reserved ports in the file would overwrite globals.ReservedPorts
+	defaults.ReservedPorts = append([]int{}, factoryDefaults.ReservedPorts...)
 	err = json.Unmarshal(defaultsBlob, &defaults)
-	common.ErrCheckExitf(err, 1, globals.ErrEncodingDefaults, err)
-	defaults = expandEnvironmentVariables(defaults)
-	return
+	if err != nil {
+		return DbdeployerDefaults{}, fmt.Errorf(globals.ErrEncodingDefaults, err)
+	}
+	return expandEnvironmentVariables(defaults), nil
 }
 
 func checkInt(name string, val, min, max int) bool {
@@ -223,9 +278,16 @@ func ValidateDefaults(nd DbdeployerDefaults) bool {
 		checkInt("multiple-base-port", nd.MultipleBasePort, minPortValue, maxPortValue) &&
 		checkInt("fan-in-base-port", nd.FanInReplicationBasePort, minPortValue, maxPortValue) &&
 		checkInt("all-masters-base-port", nd.AllMastersReplicationBasePort, minPortValue, maxPortValue) &&
+		checkInt("circular-base-port", nd.CircularReplicationBasePort, minPortValue, maxPortValue) &&
+		checkInt("chain-base-port", nd.ChainReplicationBasePort, minPortValue, maxPortValue) &&
+		checkInt("innodb-cluster-base-port", nd.InnoDBClusterBasePort, minPortValue, maxPortValue) &&
+		checkInt("router-base-port", nd.RouterBasePort, minPortValue, maxPortValue) &&
+		checkInt("proxysql-base-port", nd.ProxySQLBasePort, minPortValue, maxPortValue) &&
 		checkInt("pxc-base-port", nd.PxcBasePort, minPortValue, maxPortValue) &&
 		checkInt("ndb-base-port", nd.NdbBasePort, minPortValue, maxPortValue) &&
 		checkInt("ndb-cluster-port", nd.NdbClusterPort, minPortValue, maxPortValue) &&
+		checkInt("tidb-cluster-base-port", nd.TidbClusterBasePort, minPortValue, maxPortValue) &&
+		checkInt("galera-base-port", nd.GaleraBasePort, minPortValue, maxPortValue) &&
 		checkInt("group-port-delta", nd.GroupPortDelta, 101, 299) &&
 		checkInt("mysqlx-port-delta", nd.MysqlXPortDelta, 2000, 15000) &&
 		checkInt("admin-port-delta", nd.AdminPortDelta, 2000, 15000)
@@ -237,9 +299,16 @@ func ValidateDefaults(nd DbdeployerDefaults) bool {
 		nd.MultipleBasePort != nd.MasterSlaveBasePort &&
 		nd.MultipleBasePort != nd.FanInReplicationBasePort &&
 		nd.MultipleBasePort != nd.AllMastersReplicationBasePort &&
+		nd.MultipleBasePort != nd.CircularReplicationBasePort &&
+		nd.MultipleBasePort != nd.ChainReplicationBasePort &&
+		nd.MultipleBasePort != nd.InnoDBClusterBasePort &&
 		nd.MultipleBasePort != nd.NdbBasePort &&
 		nd.MultipleBasePort != nd.NdbClusterPort &&
 		nd.MultipleBasePort != nd.PxcBasePort &&
+		nd.MultipleBasePort != nd.TidbClusterBasePort &&
+		nd.NdbBasePort != nd.TidbClusterBasePort &&
+		nd.MultipleBasePort != nd.GaleraBasePort &&
+		nd.PxcBasePort != nd.GaleraBasePort &&
 		nd.MultiplePrefix != nd.GroupSpPrefix &&
 		nd.MultiplePrefix != nd.GroupPrefix &&
 		nd.MultiplePrefix != nd.MasterSlavePrefix &&
@@ -247,13 +316,22 @@ func ValidateDefaults(nd DbdeployerDefaults) bool {
 		nd.MultiplePrefix != nd.ImportedSandboxPrefix &&
 		nd.MultiplePrefix != nd.FanInPrefix &&
 		nd.MultiplePrefix != nd.AllMastersPrefix &&
+		nd.MultiplePrefix != nd.CircularPrefix &&
+		nd.MultiplePrefix != nd.ChainPrefix &&
+		nd.MultiplePrefix != nd.InnoDBClusterPrefix &&
+		nd.InnoDBClusterPrefix != nd.RouterPrefix &&
+		nd.RouterPrefix != nd.ProxySQLPrefix &&
+		nd.RouterBasePort != nd.ProxySQLBasePort &&
 		nd.MasterAbbr != nd.SlaveAbbr &&
 		nd.MultiplePrefix != nd.NdbPrefix &&
 		nd.MultiplePrefix != nd.PxcPrefix &&
+		nd.MultiplePrefix != nd.TidbClusterPrefix &&
+		nd.MultiplePrefix != nd.GaleraPrefix &&
+		nd.PxcPrefix != nd.GaleraPrefix &&
 		nd.SandboxHome != nd.SandboxBinary
 	if !noConflicts {
 		common.CondPrintf("Conflicts found in defaults values:\n")
-		ShowDefaults(nd)
+		_ = ShowDefaults(nd)
 		return false
 	}
 	allStrings := nd.SandboxPrefix != "" &&
@@ -267,9 +345,16 @@ func ValidateDefaults(nd DbdeployerDefaults) bool {
 		nd.SlaveAbbr != "" &&
 		nd.GroupPrefix != "" &&
 		nd.GroupSpPrefix != "" &&
+		nd.CircularPrefix != "" &&
+		nd.ChainPrefix != "" &&
+		nd.InnoDBClusterPrefix != "" &&
+		nd.RouterPrefix != "" &&
+		nd.ProxySQLPrefix != "" &&
 		nd.MultiplePrefix != "" &&
 		nd.PxcPrefix != "" &&
 		nd.NdbPrefix != "" &&
+		nd.TidbClusterPrefix != "" &&
+		nd.GaleraPrefix != "" &&
 		nd.DefaultSandboxExecutable != "" &&
 		nd.DownloadUrl != "" &&
 		nd.DownloadNameLinux != "" &&
@@ -282,7 +367,7 @@ func ValidateDefaults(nd DbdeployerDefaults) bool {
 		nd.RemoteRepository != ""
 	if !allStrings {
 		common.CondPrintf("One or more empty values found in defaults\n")
-		ShowDefaults(nd)
+		_ = ShowDefaults(nd)
 		return false
 	}
 	compatibleVersionList, err := common.VersionToList(common.CompatibleVersion)
@@ -294,7 +379,10 @@ func ValidateDefaults(nd DbdeployerDefaults) bool {
 		return false
 	}
 	compatibleVersion, err := common.GreaterOrEqualVersionList(versionList, compatibleVersionList)
-	common.ErrCheckExitf(err, 1, globals.ErrWhileComparingVersions)
+	if err != nil {
+		common.CondPrintln(globals.ErrWhileComparingVersions)
+		return false
+	}
 	if !compatibleVersion {
 		common.CondPrintf("Provided defaults are for version %s. Current version is %s\n", nd.Version, common.CompatibleVersion)
 		return false
@@ -302,26 +390,40 @@ func ValidateDefaults(nd DbdeployerDefaults) bool {
 	return true
 }
 
-func RemoveDefaultsFile() {
-	if common.FileExists(ConfigurationFile) {
-		err := os.Remove(ConfigurationFile)
-		common.ErrCheckExitf(err, 1, "%s", err)
-		common.CondPrintf("#File %s removed\n", ConfigurationFile)
-	} else {
-		common.Exitf(1, "configuration file %s not found", ConfigurationFile)
+func RemoveDefaultsFile() error {
+	if !common.FileExists(ConfigurationFile) {
+		return fmt.Errorf("configuration file %s not found", ConfigurationFile)
+	}
+	err := os.Remove(ConfigurationFile)
+	if err != nil {
+		return err
 	}
+	common.CondPrintf("#File %s removed\n", ConfigurationFile)
+	return nil
 }
 
-func strToSlice(label, s string) []int {
+func strToSlice(label, s string) ([]int, error) {
 	intList, err := common.StringToIntSlice(s)
 	if err != nil {
-		common.Exitf(1, "bad input for %s: %s (%s) ", label, s, err)
+		return nil, fmt.Errorf("bad input for %s: %s (%s) ", label, s, err)
 	}
-	return intList
+	return intList, nil
 }
 
-func UpdateDefaults(label, value string, storeDefaults bool) {
+func UpdateDefaults(label, value string, storeDefaults bool) error {
 	newDefaults := Defaults()
+	var err error
+	// Converts the value for labels that require a number
+	atoi := func(value string) int {
+		var num int
+		if err == nil {
+			num, err = strconv.Atoi(value)
+			if err != nil {
+				err = fmt.Errorf("not a valid number for %s: %s (%s)", label, value, err)
+			}
+		}
+		return num
+	}
 	switch label {
 	case "version":
 		newDefaults.Version = value
@@ -340,29 +442,43 @@ func UpdateDefaults(label, value string, storeDefaults bool) {
 	case "shell-path":
 		newDefaults.ShellPath = value
 	case "master-slave-base-port":
-		newDefaults.MasterSlaveBasePort = common.Atoi(value)
+		newDefaults.MasterSlaveBasePort = atoi(value)
 	case "group-replication-base-port":
-		newDefaults.GroupReplicationBasePort = common.Atoi(value)
+		newDefaults.GroupReplicationBasePort = atoi(value)
 	case "group-replication-sp-base-port":
-		newDefaults.GroupReplicationSpBasePort = common.Atoi(value)
+		newDefaults.GroupReplicationSpBasePort = atoi(value)
 	case "multiple-base-port":
-		newDefaults.MultipleBasePort = common.Atoi(value)
+		newDefaults.MultipleBasePort = atoi(value)
 	case "fan-in-base-port":
-		newDefaults.FanInReplicationBasePort = common.Atoi(value)
+		newDefaults.FanInReplicationBasePort = atoi(value)
 	case "all-masters-base-port":
-		newDefaults.AllMastersReplicationBasePort = common.Atoi(value)
+		newDefaults.AllMastersReplicationBasePort = atoi(value)
+	case "circular-base-port":
+		newDefaults.CircularReplicationBasePort = atoi(value)
+	case "chain-base-port":
+		newDefaults.ChainReplicationBasePort = atoi(value)
+	case "innodb-cluster-base-port":
+		newDefaults.InnoDBClusterBasePort = atoi(value)
+	case "router-base-port":
+		newDefaults.RouterBasePort = atoi(value)
+	case "proxysql-base-port":
+		newDefaults.ProxySQLBasePort = atoi(value)
 	case "ndb-base-port":
-		newDefaults.NdbBasePort = common.Atoi(value)
+		newDefaults.NdbBasePort = atoi(value)
 	case "ndb-cluster-port":
-		newDefaults.NdbClusterPort = common.Atoi(value)
+		newDefaults.NdbClusterPort = atoi(value)
+	case "tidb-cluster-base-port":
+		newDefaults.TidbClusterBasePort = atoi(value)
+	case "galera-base-port":
+		newDefaults.GaleraBasePort = atoi(value)
 	case "pxc-base-port":
-		newDefaults.PxcBasePort = common.Atoi(value)
+		newDefaults.PxcBasePort = atoi(value)
 	case "group-port-delta":
-		newDefaults.GroupPortDelta = common.Atoi(value)
+		newDefaults.GroupPortDelta = atoi(value)
 	case "mysqlx-port-delta":
-		newDefaults.MysqlXPortDelta = common.Atoi(value)
+		newDefaults.MysqlXPortDelta = atoi(value)
 	case "admin-port-delta":
-		newDefaults.AdminPortDelta = common.Atoi(value)
+		newDefaults.AdminPortDelta = atoi(value)
 	case "master-name":
 		newDefaults.MasterName = value
 	case "master-abbr":
@@ -389,6 +505,16 @@ func UpdateDefaults(label, value string, storeDefaults bool) {
 		newDefaults.FanInPrefix = value
 	case "all-masters-prefix":
 		newDefaults.AllMastersPrefix = value
+	case "circular-prefix":
+		newDefaults.CircularPrefix = value
+	case "chain-prefix":
+		newDefaults.ChainPrefix = value
+	case "innodb-cluster-prefix":
+		newDefaults.InnoDBClusterPrefix = value
+	case "router-prefix":
+		newDefaults.RouterPrefix = value
+	case "proxysql-prefix":
+		newDefaults.ProxySQLPrefix = value
 	case "remote-repository":
 		newDefaults.RemoteRepository = value
 	case "remote-index-file":
@@ -398,11 +524,15 @@ func UpdateDefaults(label, value string, storeDefaults bool) {
 	case "remote-tarball-url":
 		newDefaults.RemoteTarballUrl = value
 	case "reserved-ports":
-		newDefaults.ReservedPorts = strToSlice("reserved-ports", value)
+		newDefaults.ReservedPorts, err = strToSlice("reserved-ports", value)
 	case "pxc-prefix":
 		newDefaults.PxcPrefix = value
 	case "ndb-prefix":
 		newDefaults.NdbPrefix = value
+	case "tidb-cluster-prefix":
+		newDefaults.TidbClusterPrefix = value
+	case "galera-prefix":
+		newDefaults.GaleraPrefix = value
 	case "default-sandbox-executable":
 		newDefaults.DefaultSandboxExecutable = value
 	case "download-url":
@@ -412,25 +542,34 @@ func UpdateDefaults(label, value string, storeDefaults bool) {
 	case "download-name-macos":
 		newDefaults.DownloadNameMacOs = value
 	default:
-		common.Exitf(1, "unrecognized label %s", label)
+		return fmt.Errorf("unrecognized label %s", label)
 	}
-	if ValidateDefaults(newDefaults) {
-		currentDefaults = newDefaults
-		if storeDefaults {
-			WriteDefaultsFile(ConfigurationFile, Defaults())
-			common.CondPrintf("# Updated %s -> \"%s\"\n", label, value)
+	if err != nil {
+		return err
+	}
+	if !ValidateDefaults(newDefaults) {
+		return fmt.Errorf("invalid defaults data %s : %s", label, value)
+	}
+	currentDefaults = newDefaults
+	if storeDefaults {
+		err = WriteDefaultsFile(ConfigurationFile, Defaults())
+		if err != nil {
+			return err
 		}
-	} else {
-		common.Exitf(1, "invalid defaults data %s : %s", label, value)
+		common.CondPrintf("# Updated %s -> \"%s\"\n", label, value)
 	}
+	return nil
 }
 
-func LoadConfiguration() {
+func LoadConfiguration() error {
 	if !common.FileExists(ConfigurationFile) {
 		// WriteDefaultsFile(ConfigurationFile, Defaults())
-		return
+		return nil
+	}
+	newDefaults, err := ReadDefaultsFile(ConfigurationFile)
+	if err != nil {
+		return err
 	}
-	newDefaults := ReadDefaultsFile(ConfigurationFile)
 	if ValidateDefaults(newDefaults) {
 		currentDefaults = newDefaults
 	} else {
@@ -441,6 +580,7 @@ func LoadConfiguration() {
 		common.CondPrintln("")
 		time.Sleep(1000 * time.Millisecond)
 	}
+	return nil
 }
 
 // Converts the defaults to a string map,
@@ -482,6 +622,16 @@ func DefaultsToMap() common.StringMap {
 		"fan-in-replication-base-port":      currentDefaults.FanInReplicationBasePort,
 		"AllMastersReplicationBasePort":     currentDefaults.AllMastersReplicationBasePort,
 		"all-masters-replication-base-port": currentDefaults.AllMastersReplicationBasePort,
+		"CircularReplicationBasePort":       currentDefaults.CircularReplicationBasePort,
+		"circular-replication-base-port":    currentDefaults.CircularReplicationBasePort,
+		"ChainReplicationBasePort":          currentDefaults.ChainReplicationBasePort,
+		"chain-replication-base-port":       currentDefaults.ChainReplicationBasePort,
+		"InnoDBClusterBasePort":             currentDefaults.InnoDBClusterBasePort,
+		"innodb-cluster-base-port":          currentDefaults.InnoDBClusterBasePort,
+		"RouterBasePort":                    currentDefaults.RouterBasePort,
+		"router-base-port":                  currentDefaults.RouterBasePort,
+		"ProxySQLBasePort":                  currentDefaults.ProxySQLBasePort,
+		"proxysql-base-port":                currentDefaults.ProxySQLBasePort,
 		"MultipleBasePort":                  currentDefaults.MultipleBasePort,
 		"multiple-base-port":                currentDefaults.MultipleBasePort,
 		"PxcBasePort":                       currentDefaults.PxcBasePort,
@@ -490,6 +640,10 @@ func DefaultsToMap() common.StringMap {
 		"ndb-base-port":                     currentDefaults.NdbBasePort,
 		"NdbClusterPort":                    currentDefaults.NdbClusterPort,
 		"ndb-cluster-port":                  currentDefaults.NdbClusterPort,
+		"TidbClusterBasePort":               currentDefaults.TidbClusterBasePort,
+		"tidb-cluster-base-port":            currentDefaults.TidbClusterBasePort,
+		"GaleraBasePort":                    currentDefaults.GaleraBasePort,
+		"galera-base-port":                  currentDefaults.GaleraBasePort,
 		"GroupPortDelta":                    currentDefaults.GroupPortDelta,
 		"group-port-delta":                  currentDefaults.GroupPortDelta,
 		"MysqlXPortDelta":                   currentDefaults.MysqlXPortDelta,
@@ -522,6 +676,16 @@ func DefaultsToMap() common.StringMap {
 		"fan-in-prefix":                     currentDefaults.FanInPrefix,
 		"AllMastersPrefix":                  currentDefaults.AllMastersPrefix,
 		"all-masters-prefix":                currentDefaults.AllMastersPrefix,
+		"CircularPrefix":                    currentDefaults.CircularPrefix,
+		"circular-prefix":                   currentDefaults.CircularPrefix,
+		"ChainPrefix":                       currentDefaults.ChainPrefix,
+		"chain-prefix":                      currentDefaults.ChainPrefix,
+		"InnoDBClusterPrefix":               currentDefaults.InnoDBClusterPrefix,
+		"innodb-cluster-prefix":             currentDefaults.InnoDBClusterPrefix,
+		"RouterPrefix":                      currentDefaults.RouterPrefix,
+		"router-prefix":                     currentDefaults.RouterPrefix,
+		"ProxySQLPrefix":                    currentDefaults.ProxySQLPrefix,
+		"proxysql-prefix":                   currentDefaults.ProxySQLPrefix,
 		"ReservedPorts":                     currentDefaults.ReservedPorts,
 		"reserved-ports":                    currentDefaults.ReservedPorts,
 		"RemoteRepository":                  currentDefaults.RemoteRepository,
@@ -538,6 +702,10 @@ func DefaultsToMap() common.StringMap {
 		"pxc-prefix":                        currentDefaults.PxcPrefix,
 		"NdbPrefix":                         currentDefaults.NdbPrefix,
 		"ndb-prefix":                        currentDefaults.NdbPrefix,
+		"TidbClusterPrefix":                 currentDefaults.TidbClusterPrefix,
+		"tidb-cluster-prefix":               currentDefaults.TidbClusterPrefix,
+		"GaleraPrefix":                      currentDefaults.GaleraPrefix,
+		"galera-prefix":                     currentDefaults.GaleraPrefix,
 		"DefaultSandboxExecutable":          currentDefaults.DefaultSandboxExecutable,
 		"default-sandbox-executable":        currentDefaults.DefaultSandboxExecutable,
 		"download-url":                      currentDefaults.DownloadUrl,
@@ -558,6 +726,7 @@ func ResetDefaults() {
 	CustomConfigurationFile = ""
 	SandboxRegistry = path.Join(ConfigurationDir, SandboxRegistryName)
 	SandboxRegistryLock = path.Join(common.GlobalTempDir(), SandboxRegistryLockName)
+	PortLeasesFile = path.Join(ConfigurationDir, PortLeasesName)
 	LogSBOperations = common.IsEnvSet("DBDEPLOYER_LOGGING")
 	factoryDefaults.SandboxBinary = path.Join(homeDir, "opt", "mysql")
 	factoryDefaults.SandboxHome = path.Join(homeDir, "sandboxes")
@@ -0,0 +1,218 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package defaults
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/datacharmer/dbdeployer/common"
+)
+
+// PortLease records the ports chosen by a deployment that is still in progress.
+// Concurrent deployments skip the leased ports. The lease ends when the sandbox
+// that uses the ports is recorded in the catalog, when the deploying process
+// terminates, or when it expires
+type PortLease struct {
+	Pid       int    `json:"pid"`
+	Owner     string `json:"owner"`
+	Ports     []int  `json:"ports"`
+	ExpiresAt string `json:"expires-at"`
+}
+
+// How long a lease protects its ports, from the latest port chosen by the deployment
+const PortLeaseDuration = 10 * time.Minute
+
+// processExists returns true if a process with the given ID is running
+func processExists(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
+
+// IsActive returns true if the lease still protects its ports at the given time
+func (lease PortLease) IsActive(when time.Time) bool {
+	expiration, err := time.Parse(time.RFC3339, lease.ExpiresAt)
+	if err != nil || !expiration.After(when) {
+		return false
+	}
+	return processExists(lease.Pid)
+}
+
+// Reads the active leases, without waiting for a lock
+func unsafeReadPortLeases() ([]PortLease, error) {
+	var leases []PortLease
+	if !common.FileExists(PortLeasesFile) {
+		return leases, nil
+	}
+	text, err := common.SlurpAsBytes(PortLeasesFile)
+	if err != nil {
+		return leases, err
+	}
+	var allLeases []PortLease
+	err = json.Unmarshal(text, &allLeases)
+	if err != nil {
+		// A damaged lease file only protects deployments that are in progress: it can be discarded
+		return leases, nil
+	}
+	now := time.Now()
+	for _, lease := range allLeases {
+		if lease.IsActive(now) && len(lease.Ports) > 0 {
+			leases = append(leases, lease)
+		}
+	}
+	return leases, nil
+}
+
+// Writes the leases on file
+// This is an unsafe operation, which must be kept under a lock
+func writePortLeases(leases []PortLease) error {
+	if leases == nil {
+		leases = []PortLease{}
+	}
+	byteBuf, err := json.MarshalIndent(leases, " ", "\t")
+	if err != nil {
+		return fmt.Errorf("error encoding port leases: %s", err)
+	}
+	return common.WriteString(string(byteBuf), PortLeasesFile)
+}
+
+// Removes the given ports from the leases of the current process
+// This is an unsafe operation, which must be kept under a lock
+func unsafeReleasePorts(ports []int) error {
+	leases, err := unsafeReadPortLeases()
+	if err != nil {
+		return err
+	}
+	released := make(map[int]bool)
+	for _, port := range ports {
+		released[port] = true
+	}
+	var remaining []PortLease
+	for _, lease := range leases {
+		if lease.Pid == os.Getpid() {
+			var kept []int
+			for _, port := range lease.Ports {
+				if !released[port] {
+					kept = append(kept, port)
+				}
+			}
+			lease.Ports = kept
+		}
+		if len(lease.Ports) > 0 {
+			remaining = append(remaining, lease)
+		}
+	}
+	return writePortLeases(remaining)
+}
+
+// LeasePorts chooses ports for the current process, protected by the catalog lock.
+// The find function receives the ports that are leased by deployments in progress,
+// or used by the sandboxes in the catalog, and returns the ports that it has chosen.
+// Those ports are then leased to the current process
+func LeasePorts(find func(usedPorts []int) ([]int, error)) ([]int, error) {
+	if !enableCatalogManagement {
+		return find([]int{})
+	}
+	lock, err := setLock("leasing ports")
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+	err = checkCatalog()
+	if err != nil {
+		return nil, err
+	}
+	leases, err := unsafeReadPortLeases()
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := unsafeReadCatalog()
+	if err != nil {
+		return nil, err
+	}
+	var usedPorts []int
+	for _, lease := range leases {
+		usedPorts = append(usedPorts, lease.Ports...)
+	}
+	for _, item := range catalog {
+		usedPorts = append(usedPorts, item.Port...)
+	}
+	ports, err := find(usedPorts)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(PortLeaseDuration).Format(time.RFC3339)
+	found := false
+	for i, lease := range leases {
+		if lease.Pid == os.Getpid() {
+			leases[i].Ports = append(leases[i].Ports, ports...)
+			leases[i].ExpiresAt = expiresAt
+			found = true
+		}
+	}
+	if !found {
+		leases = append(leases, PortLease{
+			Pid:       os.Getpid(),
+			Owner:     strings.Join(common.CommandLineArgs, " "),
+			Ports:     ports,
+			ExpiresAt: expiresAt,
+		})
+	}
+	return ports, writePortLeases(leases)
+}
+
+// ReleasePorts ends the lease of the given ports by the current process
+func ReleasePorts(ports []int) error {
+	if !enableCatalogManagement {
+		return nil
+	}
+	lock, err := setLock("releasing ports")
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	return unsafeReleasePorts(ports)
+}
+
+// ActivePortLeases returns the leases of the deployments in progress, sorted by their first port
+func ActivePortLeases() ([]PortLease, error) {
+	if !enableCatalogManagement {
+		return nil, nil
+	}
+	lock, err := setLock("reading port leases")
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+	leases, err := unsafeReadPortLeases()
+	if err != nil {
+		return nil, err
+	}
+	for _, lease := range leases {
+		sort.Ints(lease.Ports)
+	}
+	sort.Slice(leases, func(i, j int) bool { return leases[i].Ports[0] < leases[j].Ports[0] })
+	return leases, nil
+}
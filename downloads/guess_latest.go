@@ -14,12 +14,15 @@
 // limitations under the License.
 package downloads
 
+import "github.com/datacharmer/dbdeployer/common"
+
 type GuessInfo struct {
 	Version string
 	Url     string
 }
 
-var allowedGuessVersions = []string{"5.7", "8.0"}
+// allowedGuessVersions are the MySQL series whose tarballs can be found in the downloads pages
+var allowedGuessVersions = common.DownloadableSeries(common.MySQLFlavor)
 
 func isAllowedForGuessing(s string) bool {
 	for _, v := range allowedGuessVersions {
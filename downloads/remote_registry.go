@@ -279,7 +279,12 @@ func FindOrGuessTarballByVersionFlavorOS(version, flavor, OS, arch string, minim
 
 		shortVersion := tbd[0].ShortVersion
 		ext := "tar.gz"
-		if OS == "linux" && shortVersion == "8.0" {
+		// Linux tarballs are compressed with xz since 8.0
+		isXzCompressed, err := common.GreaterOrEqualVersion(newVersion, globals.MinimumXzTarballVersion)
+		if err != nil {
+			return TarballDescription{}, fmt.Errorf("[guess version] error comparing versions %s", err)
+		}
+		if OS == "linux" && isXzCompressed {
 			ext = "tar.xz"
 		}
 		minimalData := ""
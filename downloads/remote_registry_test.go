@@ -66,6 +66,7 @@ func TestFindOrGuessTarballByVersionFlavorOS(t *testing.T) {
 		"5.6":     []string{"5.6.31", "5.6.33"},
 		"5.7":     []string{"5.7.31", "5.7.33"},
 		"5.7-8.0": []string{"5.7.31", "5.7.33", "8.0.19", "8.0.20", "8.0.22", "8.0.23"},
+		"8.4-9.x": []string{"8.0.40", "8.4.2", "8.4.3", "9.1.0"},
 	}
 	var versionCollectionData = []VersionCollectionInfo{
 		{
@@ -113,6 +114,16 @@ func TestFindOrGuessTarballByVersionFlavorOS(t *testing.T) {
 			requestedShortVersion: "5.6",
 			expected:              boolMap{true: "", false: "5.6.33"},
 		},
+		{
+			foundVersions:         versionCollections["8.4-9.x"],
+			requestedShortVersion: "8.4",
+			expected:              boolMap{true: "8.4.4", false: "8.4.3"},
+		},
+		{
+			foundVersions:         versionCollections["8.4-9.x"],
+			requestedShortVersion: "9.1",
+			expected:              boolMap{true: "9.1.1", false: "9.1.0"},
+		},
 	}
 	saveTarballCollection := DefaultTarballRegistry.Tarballs
 
@@ -133,6 +144,9 @@ func TestFindOrGuessTarballByVersionFlavorOS(t *testing.T) {
 			compare.OkEqualString(
 				label,
 				tb.Version, expected, t)
+			if guess && expected != "" && tb.ShortVersion != "5.7" {
+				compare.OkMatchesString(label+" extension", tb.Url, `tar\.xz$`, t)
+			}
 		}
 
 	}
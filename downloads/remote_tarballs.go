@@ -68,7 +68,7 @@ var downloadsSettings = map[TarballType]TarballDef{
 		NameInFile:  "mysql",
 		NameInUrl:   "mysql",
 		DownloadDir: "MySQL-VERSION",
-		Versions:    []string{"5.7", "8.0"},
+		Versions:    common.DownloadableSeries(common.MySQLFlavor),
 	},
 	TtShell: {
 		Flavor:      "shell",
@@ -27,12 +27,20 @@ const (
 	SbTypeSingle         = "single"
 	SbTypeMultiple       = "multiple"
 	SbTypeSingleImported = "single-imported"
+	SbTypeReplication    = "replication"
+	SbTypeRouter         = "router"
+	SbTypeProxySQL       = "proxysql"
 
 	// Instantiated in cmd/root.go
 	ConfigLabel        = "config"
 	SandboxBinaryLabel = "sandbox-binary"
 	SandboxHomeLabel   = "sandbox-home"
 	SkipLibraryCheck   = "skip-library-check"
+	OutputLabel        = "output"
+	OutputTable        = "table"
+	OutputJson         = "json"
+	OutputYaml         = "yaml"
+	OutputCsv          = "csv"
 
 	// Instantiated in cmd/admin.go
 	RemoteLabel              = "remote"
@@ -50,10 +58,15 @@ const (
 
 	// Instantiated in cmd/deploy.go
 	DefaultRoleLabel          = "default-role"
+	DefaultRoleValue          = "R_DO_IT_ALL"
 	CustomRoleNameLabel       = "custom-role-name"
+	CustomRoleNameValue       = "R_CUSTOM"
 	CustomRolePrivilegesLabel = "custom-role-privileges"
+	CustomRolePrivilegesValue = "ALL PRIVILEGES"
 	CustomRoleTargetLabel     = "custom-role-target"
+	CustomRoleTargetValue     = "*.*"
 	CustomRoleExtraLabel      = "custom-role-extra"
+	CustomRoleExtraValue      = "WITH GRANT OPTION"
 	TaskUserLabel             = "task-user"
 	TaskUserRoleLabel         = "task-user-role"
 	BasePortLabel             = "base-port"
@@ -63,6 +76,7 @@ const (
 	BindAddressValue          = LocalHostIP
 	ConcurrentLabel           = "concurrent"
 	CustomMysqldLabel         = "custom-mysqld"
+	DatadirCacheLabel         = "datadir-cache"
 	DbPasswordLabel           = "db-password"
 	DbPasswordValue           = "msandbox"
 	DbUserLabel               = "db-user"
@@ -72,6 +86,7 @@ const (
 	EnableGeneralLogLabel     = "enable-general-log"
 	EnableMysqlXLabel         = "enable-mysqlx"
 	EnableAdminAddressLabel   = "enable-admin-address"
+	ExpiresAtLabel            = "expires-at"
 	ExposeDdTablesLabel       = "expose-dd-tables"
 	ForceLabel                = "force"
 	GtidLabel                 = "gtid"
@@ -103,6 +118,7 @@ const (
 	SkipReportHostLabel       = "skip-report-host"
 	SkipReportPortLabel       = "skip-report-port"
 	SkipStartLabel            = "skip-start"
+	TtlLabel                  = "ttl"
 	UseTemplateLabel          = "use-template"
 	ClientFromLabel           = "client-from"
 	PromptLabel               = "prompt"
@@ -121,6 +137,7 @@ const (
 	EarliestLabel = "earliest"
 	LimitLabel    = "limit"
 	StatsLabel    = "stats"
+	SeriesLabel   = "series"
 
 	// Instantiated in cmd/remote.go
 	MB                = 1024 * 1024
@@ -150,10 +167,37 @@ const (
 	VerboseLabel = "verbose"
 	DryRunLabel  = "dry-run"
 
+	// Instantiated in cmd/admin_cache.go
+	StaleOnlyLabel = "stale-only"
+
+	// Instantiated in cmd/admin_snapshot.go
+	NoCloneLabel = "no-clone"
+
+	// Instantiated in cmd/admin_switchover.go
+	NewMasterLabel = "new-master"
+
+	// Instantiated in cmd/apply.go
+	ManifestFileLabel = "file"
+
+	// Instantiated in cmd/router.go
+	ClusterLabel = "cluster"
+
+	// Instantiated in cmd/proxysql.go
+	AttachLabel         = "attach"
+	ProxySQLBinaryLabel = "proxysql-binary"
+
+	// Instantiated in cmd/serve.go
+	ListenLabel          = "listen"
+	DefaultListenAddress = "127.0.0.1:8123"
+
 	// Instantiated in cmd/replication.go
 	AllMastersLabel     = "all-masters"
+	CircularLabel       = "circular"
+	ChainLabel          = "chain"
+	ChainSpecLabel      = "chain-spec"
 	FanInLabel          = "fan-in"
 	GroupLabel          = "group"
+	InnoDBClusterLabel  = "innodb-cluster"
 	MasterIpLabel       = "master-ip"
 	MasterIpValue       = LocalHostIP
 	MasterListLabel     = "master-list"
@@ -163,6 +207,7 @@ const (
 	NdbNodesLabel       = "ndb-nodes"
 	NodesValue          = 3
 	NdbNodesValue       = 3
+	NodeVersionsLabel   = "node-versions"
 	ReplHistoryDirLabel = "repl-history-dir"
 	SemiSyncLabel       = "semi-sync"
 	ReadOnlyLabel       = "read-only-slaves"
@@ -174,6 +219,10 @@ const (
 	TopologyValue       = "master-slave"
 	PxcLabel            = "pxc"
 	NdbLabel            = "ndb"
+	TiDBClusterLabel    = "tidb-cluster"
+	GaleraLabel         = "galera"
+	TiKVNodesLabel      = "tikv-nodes"
+	TiKVNodesValue      = 3
 	ChangeMasterOptions = "change-master-options"
 
 	// Instantiated in cmd/unpack.go and unpack/unpack.go
@@ -212,6 +261,7 @@ const (
 	FullInfoLabel  = "full-info"
 	ByDateLabel    = "by-date"
 	ByVersionLabel = "by-version"
+	HealthLabel    = "health"
 	LatestLabel    = "latest"
 	OldestLabel    = "oldest"
 	LocalHostIP    = "127.0.0.1"
@@ -289,8 +339,12 @@ const (
 
 	ScriptCheckMsNodes      = "check_ms_nodes"
 	ScriptCheckNodes        = "check_nodes"
+	ScriptCheckCluster      = "check_cluster"
+	ScriptInitializeCluster = "initialize_cluster"
 	ScriptClearAll          = "clear_all"
 	ScriptInitializeMsNodes = "initialize_ms_nodes"
+	ScriptInitializeRing    = "initialize_ring"
+	ScriptCheckRing         = "check_ring"
 	ScriptInitializeNodes   = "initialize_nodes"
 	ScriptNoClearAll        = "no_clear_all"
 	ScriptRestartAll        = "restart_all"
@@ -305,6 +359,9 @@ const (
 	ScriptExecAll           = "exec_all"
 	ScriptWipeRestartAll    = "wipe_and_restart_all"
 	ScriptMetadataAll       = "metadata_all"
+	ScriptUseRw             = "use_rw"
+	ScriptUseRo             = "use_ro"
+	ScriptUseProxy          = "use_proxy"
 
 	// These constants are kept for reference
 	// although they are not used directly in the code.
@@ -416,6 +473,15 @@ var (
 	MinimumRootAuthVersion                    = NumericVersion{10, 4, 3}
 	MinimumAdminAddressVersion                = NumericVersion{8, 0, 14}
 	MinimumMySQLShellEmbed                    = NumericVersion{8, 0, 4}
+	MinimumInnoDBClusterVersion               = NumericVersion{8, 0, 11}
+	MinimumPostgreSQLVersion                  = NumericVersion{10, 0, 0}
+	MinimumTiDBClusterVersion                 = NumericVersion{3, 0, 0}
+	MinimumMariaDbGtidVersion                 = NumericVersion{10, 0, 2}
+	MinimumMariaDbGaleraVersion               = NumericVersion{10, 1, 0}
+	MinimumMariaDbBinariesVersion             = NumericVersion{10, 5, 2}
+	MinimumReplicaTerminologyVersion          = NumericVersion{8, 0, 26}
+	MinimumBinaryLogStatusVersion             = NumericVersion{8, 2, 0}
+	MinimumXzTarballVersion                   = NumericVersion{8, 0, 0}
 )
 
 const (
@@ -442,8 +508,13 @@ const (
 	FnLibPerconaServerClientA     = "libperconaserverclient.a"
 	FnLibPerconaServerClientDylib = "libperconaserverclient.dylib"
 	FnLibPerconaServerClientSo    = "libperconaserverclient.so"
+	FnMariadbd                    = "mariadbd"
+	FnMariadbdSafe                = "mariadbd-safe"
+	FnMariadbInstallDb            = "mariadb-install-db"
 	FnMysql                       = "mysql"
 	FnMysqlsh                     = "mysqlsh"
+	FnMysqlRouter                 = "mysqlrouter"
+	FnProxySQL                    = "proxysql"
 	FnMysqlInstallDb              = "mysql_install_db"
 	FnMysqlProvisionZip           = "mysqlprovision.zip"
 	FnMysqld                      = "mysqld"
@@ -456,15 +527,27 @@ const (
 	FnNdbdMtd                     = "ndbmtd"
 	FnTableH                      = "table.h"
 	FnTiDbServer                  = "tidb-server"
+	FnPdServer                    = "pd-server"
+	FnTiKVServer                  = "tikv-server"
+	FnPostgres                    = "postgres"
+	FnInitDb                      = "initdb"
+	FnPgCtl                       = "pg_ctl"
+	FnPsql                        = "psql"
+	FnPgBasebackup                = "pg_basebackup"
 )
 
 var AllowedTopologies = []string{
 	MasterSlaveLabel,
 	GroupLabel,
+	InnoDBClusterLabel,
 	PxcLabel,
+	GaleraLabel,
 	FanInLabel,
 	AllMastersLabel,
 	NdbLabel,
+	TiDBClusterLabel,
+	CircularLabel,
+	ChainLabel,
 }
 
 // This structure is not used directly by dbdeployer.
@@ -506,6 +589,8 @@ var (
 	}
 	// Extra executables needed for PXC
 	NeededPxcExecutables = []string{"rsync", "lsof", "socat"}
+	// Extra executables needed for MariaDB Galera, which uses rsync for SST
+	NeededGaleraExecutables = []string{"rsync"}
 )
 
 var ShellScriptCopyright string = `
@@ -90,6 +90,10 @@ const (
 	TmplExecAllSlaves          = "exec_all_slaves"
 	TmplMaster                 = "master"
 	TmplMultiSourceUseMasters  = "multi_source_use_masters"
+	TmplCircularReplication    = "circular_replication"
+	TmplCheckRing              = "check_ring"
+	TmplChainInitSlaves        = "chain_init_slaves"
+	TmplChainCheckSlaves       = "chain_check_slaves"
 
 	// mock
 	TmplNoOpMock       = "no_op_mock"
@@ -133,6 +137,10 @@ const (
 	TmplReplicateFrom           = "replicate_from"
 	TmplGtidOptions56           = "gtid_options_56"
 	TmplGtidOptions57           = "gtid_options_57"
+	TmplGtidOptionsMariaDb      = "gtid_options_mariadb"
+	TmplSemisyncSourceOptions   = "semisync_source_options"
+	TmplSemisyncReplicaOptions  = "semisync_replica_options"
+	TmplReplCrashSafeReplica    = "repl_crash_safe_options_replica"
 	TmplCloneConnectionSql      = "clone_connection_sql"
 	TmplInitDb                  = "init_db"
 	TmplUse                     = "use"
@@ -148,6 +156,9 @@ const (
 	TmplPxcStart       = "pxc_start"
 	TmplPxcCheckNodes  = "check_pxc_nodes"
 
+	// galera
+	TmplGaleraReplication = "galera_replication"
+
 	//ndb
 	TmplNdbStartCluster = "ndb_start_cluster"
 	TmplNdbStopCluster  = "ndb_stop_cluster"
@@ -168,4 +179,47 @@ const (
 	TmplInitNodes        = "init_nodes"
 	TmplCheckNodes       = "check_nodes"
 	TmplGroupReplOptions = "group_repl_options"
+	TmplInitCluster      = "init_cluster"
+	TmplCheckCluster     = "check_cluster"
+	TmplClusterOptions   = "cluster_options"
+
+	// router
+	TmplRouterStart    = "router_start"
+	TmplRouterStop     = "router_stop"
+	TmplRouterSendKill = "router_send_kill"
+	TmplRouterStatus   = "router_status"
+	TmplRouterUse      = "router_use"
+
+	// proxysql
+	TmplProxySQLConfig   = "proxysql_config"
+	TmplProxySQLStart    = "proxysql_start"
+	TmplProxySQLStop     = "proxysql_stop"
+	TmplProxySQLSendKill = "proxysql_send_kill"
+	TmplProxySQLStatus   = "proxysql_status"
+	TmplProxySQLUse      = "proxysql_use"
+
+	// tidb cluster
+	TmplTidbClusterPdStart      = "tidb_cluster_pd_start"
+	TmplTidbClusterTiKVStart    = "tidb_cluster_tikv_start"
+	TmplTidbClusterStop         = "tidb_cluster_component_stop"
+	TmplTidbClusterSendKill     = "tidb_cluster_component_send_kill"
+	TmplTidbClusterStatus       = "tidb_cluster_component_status"
+	TmplTidbClusterStartAll     = "tidb_cluster_start_all"
+	TmplTidbClusterStopAll      = "tidb_cluster_stop_all"
+	TmplTidbClusterSendKillAll  = "tidb_cluster_send_kill_all"
+	TmplTidbClusterStatusAll    = "tidb_cluster_status_all"
+	TmplTidbClusterCheckCluster = "tidb_cluster_check_cluster"
+
+	// postgresql
+	TmplPostgreSQLOptions         = "postgresql_options"
+	TmplPostgreSQLStart           = "postgresql_start"
+	TmplPostgreSQLStop            = "postgresql_stop"
+	TmplPostgreSQLRestart         = "postgresql_restart"
+	TmplPostgreSQLStatus          = "postgresql_status"
+	TmplPostgreSQLSendKill        = "postgresql_send_kill"
+	TmplPostgreSQLUse             = "postgresql_use"
+	TmplPostgreSQLTestSb          = "postgresql_test_sb"
+	TmplPostgreSQLStatusAll       = "postgresql_status_all"
+	TmplPostgreSQLCheckSlaves     = "postgresql_check_slaves"
+	TmplPostgreSQLTestReplication = "postgresql_test_replication"
 )
@@ -55,3 +55,37 @@ func (db *DB) GetSingleResult(config *mysql.Config, query string, result interfa
 
 	return nil
 }
+
+// GetRows returns all the rows of a query, as maps of column name to value.
+// Columns with a NULL value are not included in the row.
+func (db *DB) GetRows(config *mysql.Config, query string) ([]map[string]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("error running query on server %s: - %s", config.Addr, err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var result []map[string]string
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		err = rows.Scan(pointers...)
+		if err != nil {
+			return nil, fmt.Errorf("error getting query result from server %s: - %s", config.Addr, err)
+		}
+		row := make(map[string]string)
+		for i, column := range columns {
+			if values[i].Valid {
+				row[column] = values[i].String
+			}
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
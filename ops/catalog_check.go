@@ -0,0 +1,298 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+)
+
+const (
+	// Discrepancies between the catalog and the sandboxes on disk
+	CatalogMissingSandbox  = "missing-sandbox"  // a catalog entry without sandbox directory
+	CatalogMissingEntry    = "missing-entry"    // a sandbox directory without catalog entry
+	CatalogNoDescription   = "no-description"   // a sandbox directory without a readable sbdescription.json
+	CatalogPortMismatch    = "port-mismatch"    // catalog and sbdescription.json list different ports
+	CatalogVersionMismatch = "version-mismatch" // catalog and sbdescription.json show different versions
+)
+
+// CatalogIssue describes a discrepancy between the catalog and a sandbox on disk
+type CatalogIssue struct {
+	Sandbox  string `json:"sandbox"`
+	Issue    string `json:"issue"`
+	Catalog  string `json:"catalog,omitempty"`
+	Disk     string `json:"disk,omitempty"`
+	Repaired bool   `json:"repaired"`
+}
+
+// diskSandbox is a sandbox found in one of the sandbox homes
+type diskSandbox struct {
+	directory   string
+	description common.SandboxDescription
+	err         error
+}
+
+// isSandboxDir uses the same criteria as common.GetInstalledSandboxes
+func isSandboxDir(sandboxDir string) bool {
+	for _, name := range []string{globals.SandboxDescriptionName, globals.ScriptStart, globals.ScriptStartAll} {
+		if common.FileExists(path.Join(sandboxDir, name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// diskSandboxes returns the sandboxes installed in the given homes, sorted by directory
+func diskSandboxes(sandboxHomes []string) ([]diskSandbox, error) {
+	var sandboxes []diskSandbox
+	seen := make(map[string]bool)
+	for _, sandboxHome := range sandboxHomes {
+		if seen[sandboxHome] {
+			continue
+		}
+		seen[sandboxHome] = true
+		installed, err := common.GetInstalledSandboxes(sandboxHome)
+		if err != nil {
+			return nil, fmt.Errorf("error reading sandboxes in %s: %s", sandboxHome, err)
+		}
+		for _, sb := range installed {
+			sandboxDir := path.Join(sandboxHome, sb.SandboxName)
+			description, err := common.ReadSandboxDescription(sandboxDir)
+			sandboxes = append(sandboxes, diskSandbox{directory: sandboxDir, description: description, err: err})
+		}
+	}
+	sort.Slice(sandboxes, func(i, j int) bool { return sandboxes[i].directory < sandboxes[j].directory })
+	return sandboxes, nil
+}
+
+// sandboxNodes returns the node directories of a multiple sandbox, or an empty list for a single one
+func sandboxNodes(sandboxDir string) []string {
+	nodes := []string{}
+	entries, err := os.ReadDir(sandboxDir)
+	if err != nil {
+		return nodes
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && common.FileExists(path.Join(sandboxDir, entry.Name(), globals.SandboxDescriptionName)) {
+			nodes = append(nodes, entry.Name())
+		}
+	}
+	return nodes
+}
+
+// catalogItemFromDescription builds the catalog entry of a sandbox from its description
+func catalogItemFromDescription(sandboxDir string, description common.SandboxDescription) defaults.SandboxItem {
+	return defaults.SandboxItem{
+		Origin:            description.Basedir,
+		SBType:            description.SBType,
+		Version:           description.Version,
+		Flavor:            description.Flavor,
+		Host:              description.Host,
+		Port:              description.Port,
+		Nodes:             sandboxNodes(sandboxDir),
+		Destination:       sandboxDir,
+		DbDeployerVersion: description.DbDeployerVersion,
+		Timestamp:         description.Timestamp,
+		CommandLine:       description.CommandLine,
+		NodeVersions:      description.NodeVersions,
+		Backend:           description.Backend,
+	}
+}
+
+func samePorts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]int{}, a...)
+	sortedB := append([]int{}, b...)
+	sort.Ints(sortedA)
+	sort.Ints(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sameVersion compares the flavor only when both sides have it, as older catalog entries don't record it
+func sameVersion(item defaults.SandboxItem, description common.SandboxDescription) bool {
+	if item.Version != description.Version {
+		return false
+	}
+	return item.Flavor == "" || description.Flavor == "" || item.Flavor == description.Flavor
+}
+
+func versionLabel(flavor, version string) string {
+	if flavor == "" {
+		return version
+	}
+	return flavor + " " + version
+}
+
+// catalogIssues compares the catalog with the sandboxes found on disk.
+// Catalog entries are checked regardless of their home, while only the given
+// sandboxes are checked against the catalog
+func catalogIssues(catalog defaults.SandboxCatalog, sandboxes []diskSandbox) []CatalogIssue {
+	var issues []CatalogIssue
+	var names []string
+	for name := range catalog {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !isSandboxDir(name) {
+			issues = append(issues, CatalogIssue{Sandbox: name, Issue: CatalogMissingSandbox,
+				Catalog: versionLabel(catalog[name].Flavor, catalog[name].Version)})
+		}
+	}
+	for _, sb := range sandboxes {
+		item, inCatalog := catalog[sb.directory]
+		if sb.err != nil {
+			issues = append(issues, CatalogIssue{Sandbox: sb.directory, Issue: CatalogNoDescription, Disk: sb.err.Error()})
+			continue
+		}
+		if !inCatalog {
+			issues = append(issues, CatalogIssue{Sandbox: sb.directory, Issue: CatalogMissingEntry,
+				Disk: versionLabel(sb.description.Flavor, sb.description.Version)})
+			continue
+		}
+		if !sameVersion(item, sb.description) {
+			issues = append(issues, CatalogIssue{Sandbox: sb.directory, Issue: CatalogVersionMismatch,
+				Catalog: versionLabel(item.Flavor, item.Version),
+				Disk:    versionLabel(sb.description.Flavor, sb.description.Version)})
+		}
+		if !samePorts(item.Port, sb.description.Port) {
+			issues = append(issues, CatalogIssue{Sandbox: sb.directory, Issue: CatalogPortMismatch,
+				Catalog: fmt.Sprintf("%v", item.Port),
+				Disk:    fmt.Sprintf("%v", sb.description.Port)})
+		}
+	}
+	return issues
+}
+
+// repairedCatalog returns a copy of the catalog where the issues found in the given homes are fixed,
+// using the sandbox descriptions as reference. Sandboxes without a description can't be repaired
+func repairedCatalog(catalog defaults.SandboxCatalog, sandboxHomes []string) (defaults.SandboxCatalog, []CatalogIssue, error) {
+	sandboxes, err := diskSandboxes(sandboxHomes)
+	if err != nil {
+		return nil, nil, err
+	}
+	issues := catalogIssues(catalog, sandboxes)
+	repaired := make(defaults.SandboxCatalog)
+	for name, item := range catalog {
+		repaired[name] = item
+	}
+	descriptions := make(map[string]common.SandboxDescription)
+	for _, sb := range sandboxes {
+		descriptions[sb.directory] = sb.description
+	}
+	for i, issue := range issues {
+		description := descriptions[issue.Sandbox]
+		switch issue.Issue {
+		case CatalogMissingSandbox:
+			delete(repaired, issue.Sandbox)
+		case CatalogMissingEntry:
+			repaired[issue.Sandbox] = catalogItemFromDescription(issue.Sandbox, description)
+		case CatalogVersionMismatch:
+			item := repaired[issue.Sandbox]
+			item.Version = description.Version
+			item.Flavor = description.Flavor
+			item.Origin = description.Basedir
+			item.NodeVersions = description.NodeVersions
+			repaired[issue.Sandbox] = item
+		case CatalogPortMismatch:
+			item := repaired[issue.Sandbox]
+			item.Port = description.Port
+			repaired[issue.Sandbox] = item
+		default:
+			continue
+		}
+		issues[i].Repaired = true
+	}
+	return repaired, issues, nil
+}
+
+// rebuiltCatalog returns a catalog made only of the sandboxes found in the given homes.
+// Snapshots, expiration, and log directory, which are not in the sandbox description,
+// are kept from the current catalog
+func rebuiltCatalog(catalog defaults.SandboxCatalog, sandboxHomes []string) (defaults.SandboxCatalog, []CatalogIssue, error) {
+	sandboxes, err := diskSandboxes(sandboxHomes)
+	if err != nil {
+		return nil, nil, err
+	}
+	rebuilt := make(defaults.SandboxCatalog)
+	var skipped []CatalogIssue
+	for _, sb := range sandboxes {
+		if sb.err != nil {
+			skipped = append(skipped, CatalogIssue{Sandbox: sb.directory, Issue: CatalogNoDescription, Disk: sb.err.Error()})
+			continue
+		}
+		item := catalogItemFromDescription(sb.directory, sb.description)
+		if previous, found := catalog[sb.directory]; found {
+			item.Snapshots = previous.Snapshots
+			item.ExpiresAt = previous.ExpiresAt
+			item.LogDirectory = previous.LogDirectory
+		}
+		rebuilt[sb.directory] = item
+	}
+	return rebuilt, skipped, nil
+}
+
+// VerifyCatalog reports the discrepancies between the catalog and the sandboxes in the given homes
+func VerifyCatalog(sandboxHomes []string) ([]CatalogIssue, error) {
+	sandboxes, err := diskSandboxes(sandboxHomes)
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := defaults.ReadCatalog()
+	if err != nil {
+		return nil, err
+	}
+	return catalogIssues(catalog, sandboxes), nil
+}
+
+// RepairCatalog fixes the discrepancies between the catalog and the sandboxes in the given homes,
+// and returns the issues found, marking the ones that were repaired
+func RepairCatalog(sandboxHomes []string) ([]CatalogIssue, error) {
+	var issues []CatalogIssue
+	err := defaults.RewriteCatalog(func(current defaults.SandboxCatalog) (defaults.SandboxCatalog, error) {
+		repaired, found, err := repairedCatalog(current, sandboxHomes)
+		issues = found
+		return repaired, err
+	})
+	return issues, err
+}
+
+// RebuildCatalog replaces the catalog with the sandboxes found in the given homes.
+// Entries for sandboxes in other homes are removed. It returns the new catalog and
+// the sandboxes that were skipped because they have no readable description
+func RebuildCatalog(sandboxHomes []string) (defaults.SandboxCatalog, []CatalogIssue, error) {
+	var rebuilt defaults.SandboxCatalog
+	var skipped []CatalogIssue
+	err := defaults.RewriteCatalog(func(current defaults.SandboxCatalog) (defaults.SandboxCatalog, error) {
+		var err error
+		rebuilt, skipped, err = rebuiltCatalog(current, sandboxHomes)
+		return rebuilt, err
+	})
+	return rebuilt, skipped, err
+}
@@ -0,0 +1,155 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/compare"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+)
+
+// makeDescribedSandbox creates a sandbox directory with a description and the given node directories
+func makeDescribedSandbox(t *testing.T, sandboxHome, name, version string, ports []int, nodes ...string) string {
+	sbType := globals.SbTypeSingle
+	if len(nodes) > 0 {
+		sbType = globals.SbTypeMultiple
+	}
+	return makeFakeSandbox(t, path.Join(sandboxHome, name), fakeSandbox{
+		nodes: nodes,
+		description: common.SandboxDescription{
+			Basedir: path.Join("/opt/mysql", version),
+			SBType:  sbType,
+			Version: version,
+			Flavor:  common.MySQLFlavor,
+			Port:    ports,
+		},
+	})
+}
+
+func TestCatalogIssues(t *testing.T) {
+	home1 := t.TempDir()
+	home2 := t.TempDir()
+	consistent := makeDescribedSandbox(t, home1, "msb_8_0_36", "8.0.36", []int{8036, 18036})
+	wrongPorts := makeDescribedSandbox(t, home1, "msb_8_4_0", "8.4.0", []int{8400, 18400})
+	wrongVersion := makeDescribedSandbox(t, home2, "multi_msb_8_0_35", "8.0.35", []int{24036, 24037}, "node1", "node2")
+	notInCatalog := makeDescribedSandbox(t, home2, "msb_5_7_44", "5.7.44", []int{5744})
+	noDescription := path.Join(home2, "msb_broken")
+	err := os.MkdirAll(noDescription, globals.PublicDirectoryAttr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = common.WriteString("#!/bin/sh\n", path.Join(noDescription, globals.ScriptStart))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ghost := path.Join(home1, "msb_removed_by_hand")
+
+	catalog := defaults.SandboxCatalog{
+		consistent:   {Version: "8.0.36", Flavor: common.MySQLFlavor, Port: []int{18036, 8036}, Destination: consistent},
+		wrongPorts:   {Version: "8.4.0", Port: []int{8400}, Destination: wrongPorts},
+		wrongVersion: {Version: "8.0.36", Flavor: common.MySQLFlavor, Port: []int{24036, 24037}, Destination: wrongVersion},
+		ghost:        {Version: "8.0.36", Port: []int{8037}, Destination: ghost, ExpiresAt: "2024-01-01T00:00:00Z"},
+	}
+
+	sandboxes, err := diskSandboxes([]string{home1, home2, home1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare.OkEqualInt("sandboxes on disk", len(sandboxes), 5, t)
+	issues := catalogIssues(catalog, sandboxes)
+	found := make(map[string]string)
+	for _, issue := range issues {
+		found[issue.Sandbox] = issue.Issue
+		compare.OkEqualBool(issue.Sandbox+" repaired", issue.Repaired, false, t)
+	}
+	var expected = map[string]string{
+		ghost:         CatalogMissingSandbox,
+		wrongPorts:    CatalogPortMismatch,
+		wrongVersion:  CatalogVersionMismatch,
+		notInCatalog:  CatalogMissingEntry,
+		noDescription: CatalogNoDescription,
+	}
+	compare.OkEqualInt("sandboxes with issues", len(found), len(expected), t)
+	for sandboxDir, issue := range expected {
+		compare.OkEqualString("issue of "+path.Base(sandboxDir), found[sandboxDir], issue, t)
+	}
+
+	// Only the sandboxes in the given homes are compared with the catalog
+	sandboxes, err = diskSandboxes([]string{home1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare.OkEqualInt("issues in first home", len(catalogIssues(catalog, sandboxes)), 2, t)
+
+	_, err = diskSandboxes([]string{path.Join(home1, "no-such-home")})
+	compare.OkIsNotNil("missing sandbox home error", err, t)
+
+	repaired, issues, err := repairedCatalog(catalog, []string{home1, home2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare.OkEqualInt("issues found during repair", len(issues), 5, t)
+	for _, issue := range issues {
+		compare.OkEqualBool(issue.Sandbox+" repaired", issue.Repaired, issue.Issue != CatalogNoDescription, t)
+	}
+	_, exists := repaired[ghost]
+	compare.OkEqualBool("missing sandbox in repaired catalog", exists, false, t)
+	_, exists = repaired[noDescription]
+	compare.OkEqualBool("sandbox without description in repaired catalog", exists, false, t)
+	compare.OkEqualIntSlices(t, repaired[wrongPorts].Port, []int{8400, 18400})
+	compare.OkEqualString("repaired version", repaired[wrongVersion].Version, "8.0.35", t)
+	compare.OkEqualString("added entry version", repaired[notInCatalog].Version, "5.7.44", t)
+	compare.OkEqualString("added entry destination", repaired[notInCatalog].Destination, notInCatalog, t)
+	sandboxes, err = diskSandboxes([]string{home1, home2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues = catalogIssues(repaired, sandboxes)
+	compare.OkEqualInt("issues after repair", len(issues), 1, t)
+	if len(issues) == 1 {
+		compare.OkEqualString("issue after repair", issues[0].Issue, CatalogNoDescription, t)
+	}
+	// The original catalog is not modified
+	_, exists = catalog[ghost]
+	compare.OkEqualBool("missing sandbox in original catalog", exists, true, t)
+
+	catalog[consistent] = defaults.SandboxItem{Version: "8.0.36", Port: []int{8036, 18036}, Destination: consistent,
+		ExpiresAt: "2030-01-01T00:00:00Z",
+		Snapshots: []defaults.SnapshotItem{{Label: "before-upgrade"}}}
+	rebuilt, skipped, err := rebuiltCatalog(catalog, []string{home1, home2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare.OkEqualInt("rebuilt entries", len(rebuilt), 4, t)
+	compare.OkEqualInt("skipped sandboxes", len(skipped), 1, t)
+	if len(skipped) == 1 {
+		compare.OkEqualString("skipped sandbox", skipped[0].Sandbox, noDescription, t)
+	}
+	_, exists = rebuilt[ghost]
+	compare.OkEqualBool("missing sandbox in rebuilt catalog", exists, false, t)
+	compare.OkEqualString("preserved expiration", rebuilt[consistent].ExpiresAt, "2030-01-01T00:00:00Z", t)
+	compare.OkEqualInt("preserved snapshots", len(rebuilt[consistent].Snapshots), 1, t)
+	compare.OkEqualBool("single sandbox nodes list", rebuilt[consistent].Nodes != nil, true, t)
+	compare.OkEqualInt("single sandbox nodes", len(rebuilt[consistent].Nodes), 0, t)
+	compare.OkEqualString("rebuilt origin", rebuilt[consistent].Origin, "/opt/mysql/8.0.36", t)
+	compare.OkEqualString("rebuilt version", rebuilt[wrongVersion].Version, "8.0.35", t)
+	compare.OkEqualStringSlices(t, rebuilt[wrongVersion].Nodes, []string{"node1", "node2"})
+}
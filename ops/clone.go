@@ -0,0 +1,405 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/sandbox"
+)
+
+// replicationChannel contains the fields of SHOW SLAVE STATUS needed to re-point a channel
+type replicationChannel struct {
+	Name          string
+	MasterPort    int
+	MasterLogFile string
+	MasterLogPos  int
+	AutoPosition  bool
+}
+
+// parseReplicationChannels extracts the replication channels from the vertical output of SHOW SLAVE STATUS
+// (or SHOW REPLICA STATUS, which uses "Source" instead of "Master" in the column names)
+func parseReplicationChannels(slaveStatus string) []replicationChannel {
+	var channels []replicationChannel
+	reRow := regexp.MustCompile(`^\*+ \d+\. row \*+$`)
+	reField := regexp.MustCompile(`^(\w+):\s*(.*)$`)
+	for _, line := range strings.Split(slaveStatus, "\n") {
+		line = strings.TrimSpace(line)
+		if reRow.MatchString(line) {
+			channels = append(channels, replicationChannel{})
+			continue
+		}
+		fields := reField.FindStringSubmatch(line)
+		if fields == nil || len(channels) == 0 {
+			continue
+		}
+		channel := &channels[len(channels)-1]
+		value := strings.TrimSpace(fields[2])
+		switch fields[1] {
+		case "Channel_Name":
+			channel.Name = value
+		case "Master_Port", "Source_Port":
+			channel.MasterPort, _ = strconv.Atoi(value)
+		case "Relay_Master_Log_File", "Relay_Source_Log_File":
+			channel.MasterLogFile = value
+		case "Exec_Master_Log_Pos", "Exec_Source_Log_Pos":
+			channel.MasterLogPos, _ = strconv.Atoi(value)
+		case "Auto_Position":
+			channel.AutoPosition = value == "1"
+		}
+	}
+	return channels
+}
+
+// repointChannelQuery returns the statement that moves a replication channel to a new master port,
+// starting from the last event executed from the old master
+func repointChannelQuery(channel replicationChannel, newPort int, syntax common.ReplicationSyntax) string {
+	query := fmt.Sprintf("%s %s_PORT=%d", syntax.ChangeSource, syntax.SourceOption, newPort)
+	if !channel.AutoPosition && channel.MasterLogFile != "" {
+		query += fmt.Sprintf(", %s_LOG_FILE='%s', %s_LOG_POS=%d",
+			syntax.SourceOption, channel.MasterLogFile, syntax.SourceOption, channel.MasterLogPos)
+	}
+	if channel.Name != "" {
+		query += fmt.Sprintf(" FOR CHANNEL '%s'", channel.Name)
+	}
+	return query
+}
+
+// sandboxPorts returns all the ports of a sandbox, as listed in its description and in the ones of its nodes
+func sandboxPorts(sandboxDir string, nodes []string) ([]int, error) {
+	var ports []int
+	seen := make(map[int]bool)
+	for _, node := range append([]string{""}, nodes...) {
+		sbDesc, err := common.ReadSandboxDescription(path.Join(sandboxDir, node))
+		if err != nil {
+			return nil, err
+		}
+		for _, port := range sbDesc.Port {
+			if !seen[port] {
+				seen[port] = true
+				ports = append(ports, port)
+			}
+		}
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports found in the description of %s", sandboxDir)
+	}
+	return ports, nil
+}
+
+// allocateClonePorts finds a free port for each port of the source sandbox, and leases it
+// until the clone is registered in the catalog. It returns the map from old to new ports
+func allocateClonePorts(sourcePorts []int) (map[int]int, error) {
+	portMap := make(map[int]int)
+	_, err := defaults.LeasePorts(func(usedPorts []int) ([]int, error) {
+		used := append(append([]int{}, usedPorts...), sourcePorts...)
+		used = append(used, defaults.Defaults().ReservedPorts...)
+		var newPorts []int
+		for _, port := range sourcePorts {
+			newPort, err := common.FindFreePort(port, used, 1)
+			if err != nil {
+				return nil, err
+			}
+			used = append(used, newPort)
+			newPorts = append(newPorts, newPort)
+			portMap[port] = newPort
+		}
+		return newPorts, nil
+	})
+	return portMap, err
+}
+
+// clonePortContext matches the places where a sandbox file refers to a port: options and
+// variables whose name ends with "port" (port = 8036, --report-port=8036, MYSQL_PORT=8036, "port": 8036),
+// the -P option of the client, host:port addresses and the client prompt ([\h:8036]), the names of
+// sockets and pid files (mysql_sandbox8036.sock, mysqlx-18036.sock), the report-host of single sandboxes,
+// and the ports shown in parentheses by the status scripts
+const clonePortContext = `(?:(?i:port(?:number)?"?\s*[=:]?\s*"?)|-P\s*|(?:localhost|\d+\.\d+\.\d+\.\d+|\\h):|mysql_sandbox|mysqlx-|report-host=single-|\(\s*)\d+`
+
+var (
+	reDescriptionPorts = regexp.MustCompile(`"port":\s*\[[^\]]*\]`)
+	reNumber           = regexp.MustCompile(`\d+`)
+)
+
+// cloneReplacer returns a function that replaces, in the text of a sandbox file, the source directory
+// with the clone directory, and the ports of the source with the corresponding clone ports.
+// Only the numbers found where a port is expected are replaced, together with the port list
+// of the sandbox description. Other numbers, such as server IDs or option values, are left as they are
+func cloneReplacer(sourceDir, cloneDir string, portMap map[int]int) func(string) string {
+	reToken := regexp.MustCompile(regexp.QuoteMeta(sourceDir) + `|` + reDescriptionPorts.String() + `|` + clonePortContext)
+	replacePorts := func(text string) string {
+		return reNumber.ReplaceAllStringFunc(text, func(token string) string {
+			number, err := strconv.Atoi(token)
+			if err != nil || strconv.Itoa(number) != token {
+				return token
+			}
+			if newPort, found := portMap[number]; found {
+				return strconv.Itoa(newPort)
+			}
+			return token
+		})
+	}
+	return func(text string) string {
+		return reToken.ReplaceAllStringFunc(text, func(token string) string {
+			if token == sourceDir {
+				return cloneDir
+			}
+			if reDescriptionPorts.MatchString(token) {
+				return replacePorts(token)
+			}
+			// The port is the last number of the token: the numbers of an IP address are left alone
+			loc := reNumber.FindAllStringIndex(token, -1)
+			last := loc[len(loc)-1]
+			return token[:last[0]] + replacePorts(token[last[0]:])
+		})
+	}
+}
+
+// isDataFile tells whether a file belongs to a data directory
+func isDataFile(relativeName string) bool {
+	for _, part := range strings.Split(relativeName, string(os.PathSeparator)) {
+		if part == globals.DataDirName {
+			return true
+		}
+	}
+	return false
+}
+
+// copySandboxFiles copies a sandbox directory. Scripts and configuration files are rewritten with replace,
+// while the files in the data directories are copied unchanged.
+// Server UUIDs, pid files, snapshots, sockets, and other special files are not copied.
+func copySandboxFiles(source, destination string, replace func(string) string) error {
+	return filepath.Walk(source, func(fileName string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		relativeName, err := filepath.Rel(source, fileName)
+		if err != nil {
+			return err
+		}
+		target := path.Join(destination, relativeName)
+		baseName := path.Base(relativeName)
+		mode := info.Mode()
+		switch {
+		case mode.IsDir():
+			if relativeName == SnapshotDirName {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(target, mode.Perm())
+		case baseName == globals.AutoCnfName || strings.HasSuffix(baseName, ".pid"):
+			return nil
+		case mode&os.ModeSymlink != 0:
+			linkName, err := os.Readlink(fileName)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(replace(linkName), target)
+		case mode.IsRegular() && isDataFile(relativeName):
+			return common.CopyFile(fileName, target)
+		case mode.IsRegular():
+			contents, err := os.ReadFile(fileName) // #nosec G304
+			if err != nil {
+				return err
+			}
+			// Binary files are copied unchanged
+			if !bytes.Contains(contents, []byte{0}) {
+				contents = []byte(replace(string(contents)))
+			}
+			return os.WriteFile(target, contents, mode.Perm())
+		}
+		return nil
+	})
+}
+
+// nodePort returns the main port of a sandbox node
+func nodePort(nodeDir string) (int, error) {
+	sbDesc, err := common.ReadSandboxDescription(nodeDir)
+	if err != nil {
+		return 0, err
+	}
+	if len(sbDesc.Port) == 0 {
+		return 0, fmt.Errorf("no port found in the description of %s", nodeDir)
+	}
+	return sbDesc.Port[0], nil
+}
+
+// repointReplication moves the replication channels of a cloned node to the
+// clone ports, and starts replication
+func repointReplication(nodeDir string, portMap map[int]int) error {
+	useScript := path.Join(nodeDir, globals.ScriptUse)
+	syntax := sandbox.NodeReplicationSyntax(nodeDir)
+	slaveStatus, err := common.RunCmdCtrlWithArgs(useScript, []string{"-u", "root", "-e", syntax.ShowReplicaStatus + "\\G"}, true)
+	if err != nil {
+		return fmt.Errorf("error getting replication status in %s: %s", nodeDir, err)
+	}
+	channels := parseReplicationChannels(slaveStatus)
+	if len(channels) == 0 {
+		return nil
+	}
+	queries := []string{syntax.StopReplica}
+	for _, channel := range channels {
+		newPort, found := portMap[channel.MasterPort]
+		if !found {
+			// The master is outside of the sandbox: replication continues from it
+			continue
+		}
+		queries = append(queries, repointChannelQuery(channel, newPort, syntax))
+	}
+	queries = append(queries, syntax.StartReplica)
+	_, err = common.RunCmdCtrlWithArgs(useScript, []string{"-u", "root", "-e", strings.Join(queries, ";")}, true)
+	if err != nil {
+		return fmt.Errorf("error re-pointing replication in %s: %s", nodeDir, err)
+	}
+	return nil
+}
+
+// CloneSandbox creates a new sandbox with the same options and the same data of an existing one.
+// The sandbox directory is copied, and its scripts and configuration files are rewritten with
+// the new directory and with fresh ports. Each node gets a new server UUID, replication is moved
+// to the new ports, and the clone is registered in the catalog.
+// The source sandbox is stopped during the copy, and restarted afterwards.
+func CloneSandbox(sourceDir, newName string) (cloneDir string, err error) {
+	sbDesc, err := common.ReadSandboxDescription(sourceDir)
+	if err != nil {
+		return "", err
+	}
+	switch sbDesc.Flavor {
+	case common.NdbFlavor, common.PxcFlavor, common.TiDbFlavor, common.PostgreSQLFlavor:
+		return "", fmt.Errorf("cloning sandboxes of flavor '%s' is not supported", sbDesc.Flavor)
+	}
+	if strings.Contains(newName, "/") || newName == "." || newName == ".." {
+		return "", fmt.Errorf("invalid sandbox name '%s'", newName)
+	}
+	cloneDir = path.Join(path.Dir(sourceDir), newName)
+	if common.DirExists(cloneDir) {
+		return "", fmt.Errorf(globals.ErrNamedDirectoryAlreadyExists, "sandbox", cloneDir)
+	}
+	nodes, err := sandboxDataNodes(sourceDir)
+	if err != nil {
+		return "", err
+	}
+	sourcePorts, err := sandboxPorts(sourceDir, nodes)
+	if err != nil {
+		return "", err
+	}
+
+	running := runningNodes(sourceDir, nodes)
+	if len(running) > 0 {
+		err = runSandboxScript(sourceDir, nodes, globals.ScriptStop)
+		if err != nil {
+			return "", err
+		}
+		defer func() {
+			restartErr := runSandboxScript(sourceDir, nodes, globals.ScriptStart)
+			if restartErr != nil && err == nil {
+				err = restartErr
+			}
+		}()
+	}
+
+	portMap, err := allocateClonePorts(sourcePorts)
+	if err != nil {
+		return "", err
+	}
+	// If anything fails from here on, the incomplete clone is removed.
+	// The directory is saved, as the error returns reset cloneDir
+	success := false
+	incompleteDir := cloneDir
+	defer func() {
+		if success {
+			return
+		}
+		if common.DirExists(incompleteDir) {
+			_ = runSandboxScript(incompleteDir, nodes, globals.ScriptSendKill)
+			_ = os.RemoveAll(incompleteDir)
+		}
+		_ = defaults.DeleteFromCatalog(incompleteDir)
+		var newPorts []int
+		for _, port := range portMap {
+			newPorts = append(newPorts, port)
+		}
+		_ = defaults.ReleasePorts(newPorts)
+	}()
+
+	err = copySandboxFiles(sourceDir, cloneDir, cloneReplacer(sourceDir, cloneDir, portMap))
+	if err != nil {
+		return "", fmt.Errorf("error copying %s to %s: %s", sourceDir, cloneDir, err)
+	}
+	for _, node := range nodes {
+		nodeDir := path.Join(cloneDir, node)
+		nodeDesc, err := common.ReadSandboxDescription(nodeDir)
+		if err != nil {
+			return "", err
+		}
+		err = sandbox.WriteServerUuid(nodeDir, nodeDesc)
+		if err != nil {
+			return "", fmt.Errorf("error writing server UUID in %s: %s", nodeDir, err)
+		}
+	}
+	cloneDesc, err := common.ReadSandboxDescription(cloneDir)
+	if err != nil {
+		return "", err
+	}
+	err = defaults.UpdateCatalog(cloneDir, catalogItemFromDescription(cloneDir, cloneDesc))
+	if err != nil {
+		return "", err
+	}
+	if common.FileExists(path.Join(cloneDir, "needs_initialization")) {
+		// The source was never started: the clone is initialized at its first start, like the source
+		success = true
+		return cloneDir, nil
+	}
+
+	isGroup := strings.HasPrefix(sbDesc.SBType, "group")
+	for _, node := range nodes {
+		_, err = common.RunCmdCtrlWithArgs(path.Join(cloneDir, node, globals.ScriptStart), []string{"--skip-slave-start"}, true)
+		if err != nil {
+			return "", fmt.Errorf("error starting node '%s' of %s: %s", node, cloneDir, err)
+		}
+	}
+	if isGroup {
+		// The group is created again using the clone ports
+		_, err = common.RunCmdCtrl(path.Join(cloneDir, globals.ScriptInitializeNodes), true)
+		if err != nil {
+			return "", fmt.Errorf("error initializing group in %s: %s", cloneDir, err)
+		}
+	} else {
+		for _, node := range nodes {
+			err = repointReplication(path.Join(cloneDir, node), portMap)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+	if len(running) == 0 {
+		err = runSandboxScript(cloneDir, nodes, globals.ScriptStop)
+		if err != nil {
+			return "", err
+		}
+	}
+	success = true
+	return cloneDir, nil
+}
@@ -0,0 +1,268 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/compare"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+)
+
+func TestCloneReplacer(t *testing.T) {
+	replace := cloneReplacer("/sandboxes/msb_8_0_36", "/sandboxes/msb_copy", map[int]int{8036: 8037, 18036: 18037})
+	compare.OkEqualString("replaced configuration",
+		replace("datadir = /sandboxes/msb_8_0_36/data\nport = 8036\nsocket = /tmp/mysql_sandbox8036.sock\n"+
+			"mysqlx-socket = /tmp/mysqlx-18036.sock\nserver-id = 100\nmax_connections = 80360\n"),
+		"datadir = /sandboxes/msb_copy/data\nport = 8037\nsocket = /tmp/mysql_sandbox8037.sock\n"+
+			"mysqlx-socket = /tmp/mysqlx-18037.sock\nserver-id = 100\nmax_connections = 80360\n", t)
+	// The directory is replaced as a whole, even if it contains a number matching a port
+	replace = cloneReplacer("/sandboxes/rsandbox_8036", "/sandboxes/rsandbox_copy", map[int]int{8036: 8037})
+	compare.OkEqualString("replaced directory",
+		replace("SBDIR=/sandboxes/rsandbox_8036\nPORT=8036"),
+		"SBDIR=/sandboxes/rsandbox_copy\nPORT=8037", t)
+	compare.OkEqualString("number inside a UUID",
+		replace(`group_name="00008036-bbbb-cccc-dddd-eeeeeeeeeeee"`),
+		`group_name="00008036-bbbb-cccc-dddd-eeeeeeeeeeee"`, t)
+
+	replace = cloneReplacer("/sandboxes/msb_8_0_36", "/sandboxes/msb_copy", map[int]int{8036: 8037, 18036: 18037})
+	var replacements = []struct {
+		text     string
+		expected string
+	}{
+		{"$CLIENT_BASEDIR/bin/mysql -P 8036 -h 127.0.0.1", "$CLIENT_BASEDIR/bin/mysql -P 8037 -h 127.0.0.1"},
+		{"report-port=8036\nreport-host=single-8036", "report-port=8037\nreport-host=single-8037"},
+		{`prompt='mysql [\h:8036] {\u} ((\d)) > '`, `prompt='mysql [\h:8037] {\u} ((\d)) > '`},
+		{`group_replication_group_seeds="127.0.0.1:18036"`, `group_replication_group_seeds="127.0.0.1:18037"`},
+		{`msb_8_0_36 on  -  port 8036 (8036)`, `msb_8_0_36 on  -  port 8037 (8037)`},
+		{`"port": [8036, 18036],`, `"port": [8037, 18037],`},
+		// Numbers that are not in a port context are left alone, even when they match a port
+		{"server-id=8036\ntable_open_cache = 8036", "server-id=8036\ntable_open_cache = 8036"},
+		{`"server_id": 18036`, `"server_id": 18036`},
+	}
+	for _, r := range replacements {
+		compare.OkEqualString(r.text, replace(r.text), r.expected, t)
+	}
+}
+
+const sampleSlaveStatus = `*************************** 1. row ***************************
+               Slave_IO_State: Waiting for master to send event
+                  Master_Host: 127.0.0.1
+                  Master_Port: 21001
+        Relay_Master_Log_File: mysql-bin.000002
+          Exec_Master_Log_Pos: 1234
+                 Channel_Name: node1
+                Auto_Position: 0
+*************************** 2. row ***************************
+               Slave_IO_State: Waiting for master to send event
+                  Master_Port: 21002
+        Relay_Master_Log_File: mysql-bin.000001
+          Exec_Master_Log_Pos: 155
+                 Channel_Name: node2
+                Auto_Position: 1
+`
+
+func TestParseReplicationChannels(t *testing.T) {
+	channels := parseReplicationChannels(sampleSlaveStatus)
+	expected := []replicationChannel{
+		{Name: "node1", MasterPort: 21001, MasterLogFile: "mysql-bin.000002", MasterLogPos: 1234},
+		{Name: "node2", MasterPort: 21002, MasterLogFile: "mysql-bin.000001", MasterLogPos: 155, AutoPosition: true},
+	}
+	compare.OkEqualInt("channels", len(channels), len(expected), t)
+	for i := 0; i < len(channels) && i < len(expected); i++ {
+		compare.OkEqualInterface("channel "+expected[i].Name, channels[i], expected[i], t)
+	}
+
+	compare.OkEqualInt("channels in empty status", len(parseReplicationChannels("")), 0, t)
+
+	compare.OkEqualString("repoint with coordinates",
+		repointChannelQuery(channels[0], 31001, common.LegacyReplicationSyntax),
+		"CHANGE MASTER TO MASTER_PORT=31001, MASTER_LOG_FILE='mysql-bin.000002', MASTER_LOG_POS=1234 FOR CHANNEL 'node1'", t)
+	compare.OkEqualString("repoint with auto position",
+		repointChannelQuery(channels[1], 31002, common.LegacyReplicationSyntax),
+		"CHANGE MASTER TO MASTER_PORT=31002 FOR CHANNEL 'node2'", t)
+	compare.OkEqualString("repoint without channel",
+		repointChannelQuery(replicationChannel{MasterPort: 21003, MasterLogFile: "mysql-bin.000003", MasterLogPos: 4}, 31003, common.LegacyReplicationSyntax),
+		"CHANGE MASTER TO MASTER_PORT=31003, MASTER_LOG_FILE='mysql-bin.000003', MASTER_LOG_POS=4", t)
+
+	replicaSyntax, err := common.GetReplicationSyntax(common.MySQLFlavor, "8.4.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicaChannels := parseReplicationChannels(`*************************** 1. row ***************************
+                  Source_Port: 21001
+        Relay_Source_Log_File: mysql-bin.000002
+          Exec_Source_Log_Pos: 1234
+                 Channel_Name: 
+                Auto_Position: 0
+`)
+	compare.OkEqualInt("replica channels", len(replicaChannels), 1, t)
+	if len(replicaChannels) == 1 {
+		compare.OkEqualInterface("replica channel", replicaChannels[0],
+			replicationChannel{MasterPort: 21001, MasterLogFile: "mysql-bin.000002", MasterLogPos: 1234}, t)
+		compare.OkEqualString("repoint with replica syntax",
+			repointChannelQuery(replicaChannels[0], 31001, replicaSyntax),
+			"CHANGE REPLICATION SOURCE TO SOURCE_PORT=31001, SOURCE_LOG_FILE='mysql-bin.000002', SOURCE_LOG_POS=1234", t)
+	}
+}
+
+// makeCloneSource creates a fake sandbox with the files that a clone rewrites. The start script fails
+// in directories whose name contains "broken"
+func makeCloneSource(t *testing.T, sandboxHome string, nodes []string) string {
+	sandboxDir := path.Join(sandboxHome, "msb_source")
+	offScript := "#!/bin/sh\necho \"$(basename $(dirname $0)) off\"\n"
+	makeFakeSandbox(t, sandboxDir, fakeSandbox{
+		nodes: nodes,
+		scripts: map[string]string{
+			globals.ScriptStart:        "#!/bin/sh\ncase $0 in *broken*) exit 1;; esac\nexit 0\n",
+			globals.ScriptStop:         "#!/bin/sh\nexit 0\n",
+			globals.ScriptSendKill:     "#!/bin/sh\nexit 0\n",
+			globals.ScriptStatus:       offScript,
+			globals.ScriptUse:          "#!/bin/sh\nexit 0\n",
+			globals.ScriptMySandboxCnf: "[mysqld]\nport = 8036\nsocket = /tmp/mysql_sandbox8036.sock\ndatadir = " + sandboxDir + "/data\n",
+			"ibdata1.copy":             "binary\x008036",
+		},
+		dataFiles: map[string]string{
+			"test/t1.ibd":        "source data {node}",
+			globals.AutoCnfName:  "[auto]\nserver-uuid=source",
+			"mysql_sandbox.pid":  "1234",
+			"msandbox.err":       "port: 8036",
+			"binlog.index":       "./binlog.000001",
+			"mysql/innodb_table": "\x00\x01",
+		},
+		description: common.SandboxDescription{
+			SBType:  globals.SbTypeSingle,
+			Version: "8.0.36",
+			Flavor:  common.MySQLFlavor,
+			Port:    []int{8036, 18036},
+		},
+		catalog: &defaults.SandboxItem{Port: []int{8036, 18036}},
+	})
+	writeFakeFile(t, path.Join(sandboxDir, SnapshotDirName, "before-test", "marker"), "")
+	if len(nodes) > 1 {
+		for _, script := range []string{globals.ScriptStopAll, globals.ScriptSendKillAll} {
+			writeFakeFile(t, path.Join(sandboxDir, script), "#!/bin/sh\nexit 0\n")
+			err := os.Chmod(path.Join(sandboxDir, script), globals.ExecutableFileAttr)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return sandboxDir
+}
+
+// readCloneFile returns the contents of a file in a cloned sandbox, or stops the test
+func readCloneFile(t *testing.T, fileName string) string {
+	contents, err := common.SlurpAsString(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contents
+}
+
+func TestCloneSandbox(t *testing.T) {
+	useMockEnvironment(t)
+	for _, nodes := range [][]string{{""}, {"node1", "node2"}} {
+		sandboxHome := t.TempDir()
+		sourceDir := makeCloneSource(t, sandboxHome, nodes)
+
+		cloneDir, err := CloneSandbox(sourceDir, "msb_copy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		compare.OkEqualString("clone directory", cloneDir, path.Join(sandboxHome, "msb_copy"), t)
+		catalog, err := defaults.ReadCatalog()
+		if err != nil {
+			t.Fatal(err)
+		}
+		clonePorts := catalog[cloneDir].Port
+		if len(clonePorts) != 2 {
+			t.Fatalf("expected 2 ports in the catalog entry of the clone - found %v", clonePorts)
+		}
+		for _, port := range clonePorts {
+			compare.OkEqualBool(fmt.Sprintf("clone port %d is new", port), port != 8036 && port != 18036, true, t)
+		}
+		leases, err := defaults.ActivePortLeases()
+		if err != nil {
+			t.Fatal(err)
+		}
+		compare.OkEqualInt("port leases after clone", len(leases), 0, t)
+
+		cloneDesc, err := common.ReadSandboxDescription(cloneDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compare.OkEqualIntSlices(t, cloneDesc.Port, clonePorts)
+		compare.OkEqualBool("snapshots copied", common.DirExists(path.Join(cloneDir, SnapshotDirName)), false, t)
+		var uuids []string
+		for _, node := range nodes {
+			nodeDir := path.Join(cloneDir, node)
+			compare.OkEqualString("clone configuration",
+				readCloneFile(t, path.Join(nodeDir, globals.ScriptMySandboxCnf)),
+				fmt.Sprintf("[mysqld]\nport = %d\nsocket = /tmp/mysql_sandbox%d.sock\ndatadir = %s/data\n",
+					clonePorts[0], clonePorts[0], cloneDir), t)
+			compare.OkEqualBool("start script executable", common.ExecExists(path.Join(nodeDir, globals.ScriptStart)), true, t)
+			compare.OkEqualString("binary file", readCloneFile(t, path.Join(nodeDir, "ibdata1.copy")), "binary\x008036", t)
+
+			dataDir := path.Join(nodeDir, globals.DataDirName)
+			compare.OkEqualString("copied data", readCloneFile(t, path.Join(dataDir, "test", "t1.ibd")), "source data "+node, t)
+			// Files in the data directory are not rewritten
+			compare.OkEqualString("error log", readCloneFile(t, path.Join(dataDir, "msandbox.err")), "port: 8036", t)
+			compare.OkEqualBool("pid file copied", common.FileExists(path.Join(dataDir, "mysql_sandbox.pid")), false, t)
+			autoCnf := readCloneFile(t, path.Join(dataDir, globals.AutoCnfName))
+			compare.OkMatchesString("clone server UUID", autoCnf, `^\[auto\]\nserver-uuid=[0-9a-f-]{36}\n$`, t)
+			uuids = append(uuids, autoCnf)
+		}
+		if len(uuids) > 1 {
+			compare.OkEqualBool("server UUIDs differ", uuids[0] != uuids[1], true, t)
+		}
+		// The source is unchanged
+		compare.OkEqualString("source server UUID",
+			readCloneFile(t, path.Join(sourceDir, nodes[0], globals.DataDirName, globals.AutoCnfName)),
+			"[auto]\nserver-uuid=source", t)
+
+		_, err = CloneSandbox(sourceDir, "msb_copy")
+		compare.OkIsNotNil("existing clone error", err, t)
+		_, err = CloneSandbox(sourceDir, "../msb_copy")
+		compare.OkIsNotNil("invalid clone name error", err, t)
+
+		// A failed clone leaves nothing behind
+		brokenDir := path.Join(sandboxHome, "msb_broken")
+		_, err = CloneSandbox(sourceDir, "msb_broken")
+		compare.OkIsNotNil("failed clone error", err, t)
+		compare.OkEqualBool("failed clone directory", common.DirExists(brokenDir), false, t)
+		catalog, err = defaults.ReadCatalog()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, found := catalog[brokenDir]
+		compare.OkEqualBool("failed clone in catalog", found, false, t)
+		leases, err = defaults.ActivePortLeases()
+		if err != nil {
+			t.Fatal(err)
+		}
+		compare.OkEqualInt("port leases after failed clone", len(leases), 0, t)
+		err = defaults.DeleteFromCatalog(cloneDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
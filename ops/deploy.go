@@ -0,0 +1,378 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/sandbox"
+)
+
+// DeployOptions define a single sandbox, or the nodes of a multiple or replication sandbox.
+// Only Version is required. Empty fields get the same defaults of "dbdeployer deploy".
+type DeployOptions struct {
+	Version       string // full version (8.0.36), short version (8.0), or path of an expanded tarball
+	SandboxBinary string // where the expanded tarballs are (default: from dbdeployer defaults)
+	SandboxHome   string // where the sandboxes are deployed (default: from dbdeployer defaults)
+	DirName       string // name of the sandbox directory (default: derived from type and version)
+	Flavor        string // default: detected from the binaries
+	Port          int    // default: derived from the version
+	BasePort      int    // base port for the nodes of a multiple or replication sandbox
+	DbUser        string
+	DbPassword    string
+	RplUser       string
+	RplPassword   string
+	MyCnfOptions  []string // options to add to my.sandbox.cnf
+	InitOptions   []string // options for the server initialization
+	PreGrantsSql  []string // queries to run before loading grants
+	PostGrantsSql []string // queries to run after loading grants
+	Master        bool     // enables binary log and server ID
+	Gtid          bool
+	ReplCrashSafe bool
+	SkipStart     bool
+	Force         bool // replaces an existing sandbox with the same name
+	// Customize, when set, can change the sandbox definition before the deployment
+	Customize func(*sandbox.SandboxDef) error
+}
+
+// ReplicationOptions define a replication sandbox
+type ReplicationOptions struct {
+	DeployOptions
+	Topology      string // default: master-slave
+	Nodes         int    // default: 3, or the number of nodes in ChainSpec
+	MasterIp      string // default: 127.0.0.1
+	SemiSync      bool   // master-slave only
+	SinglePrimary bool   // group only
+	MasterList    string // fan-in and all-masters only
+	SlaveList     string // fan-in and all-masters only
+	ChainSpec     string // chain only
+	NodeVersions  string // binaries for specific nodes, such as "1:5.7.44,2:8.0.36"
+}
+
+var reShortVersion = regexp.MustCompile(`^\d+\.\d+$`)
+
+// replicationPrefix returns the default directory prefix of a replication topology
+func replicationPrefix(topology string, singlePrimary bool) (string, error) {
+	d := defaults.Defaults()
+	switch topology {
+	case globals.MasterSlaveLabel:
+		return d.MasterSlavePrefix, nil
+	case globals.GroupLabel:
+		if singlePrimary {
+			return d.GroupSpPrefix, nil
+		}
+		return d.GroupPrefix, nil
+	case globals.InnoDBClusterLabel:
+		return d.InnoDBClusterPrefix, nil
+	case globals.FanInLabel:
+		return d.FanInPrefix, nil
+	case globals.AllMastersLabel:
+		return d.AllMastersPrefix, nil
+	case globals.CircularLabel:
+		return d.CircularPrefix, nil
+	case globals.ChainLabel:
+		return d.ChainPrefix, nil
+	case globals.PxcLabel:
+		return d.PxcPrefix, nil
+	case globals.GaleraLabel:
+		return d.GaleraPrefix, nil
+	case globals.NdbLabel:
+		return d.NdbPrefix, nil
+	case globals.TiDBClusterLabel:
+		return d.TidbClusterPrefix, nil
+	}
+	return "", fmt.Errorf("unrecognized topology '%s'. Accepted: '%v'", topology, globals.AllowedTopologies)
+}
+
+// absoluteDir returns the absolute path of a directory, using a default when the path is empty
+func absoluteDir(dir, defaultDir string) (string, error) {
+	if dir == "" {
+		dir = defaultDir
+	}
+	return common.AbsolutePath(dir)
+}
+
+// resolveVersion finds the binaries for a version, which can also be a short version or a path.
+// It returns the directory that contains the binaries, the name of the binaries directory, and the full version
+func resolveVersion(version, sandboxBinary string) (binaryDir, basedirName, fullVersion string, err error) {
+	if strings.Contains(version, "/") && common.DirExists(version) {
+		basedir, err := common.AbsolutePath(common.RemoveTrailingSlash(version))
+		if err != nil {
+			return "", "", "", errors.Wrapf(err, "couldn't get an absolute path for %s", version)
+		}
+		basedirName = path.Base(basedir)
+		if !common.IsVersion(basedirName) {
+			return "", "", "", fmt.Errorf("no version detected for directory %s", basedir)
+		}
+		return path.Dir(basedir), basedirName, basedirName, nil
+	}
+	if !common.IsVersion(version) && reShortVersion.MatchString(version) {
+		latest, err := common.LatestVersion(sandboxBinary, version)
+		if err != nil {
+			return "", "", "", err
+		}
+		if latest == "" {
+			return "", "", "", fmt.Errorf("no full version found for %s in %s", version, sandboxBinary)
+		}
+		version = latest
+	}
+	version, err = common.ResolveVersionBuild(sandboxBinary, version)
+	if err != nil {
+		return "", "", "", err
+	}
+	return sandboxBinary, version, version, nil
+}
+
+// NewSandboxDef builds the definition of a sandbox from the deployment options.
+// It returns the definition and the name of the binaries directory
+func NewSandboxDef(options DeployOptions) (sandbox.SandboxDef, string, error) {
+	var sd sandbox.SandboxDef
+	if options.Version == "" {
+		return sd, "", fmt.Errorf("no version was given for the deployment")
+	}
+	err := common.CheckPrerequisites("dbdeployer needed tools", globals.NeededExecutables)
+	if err != nil {
+		return sd, "", err
+	}
+	sandboxBinary, err := absoluteDir(options.SandboxBinary, defaults.Defaults().SandboxBinary)
+	if err != nil {
+		return sd, "", err
+	}
+	if !common.DirExists(sandboxBinary) {
+		return sd, "", fmt.Errorf("sandbox binary directory %s not found", sandboxBinary)
+	}
+	sd.SandboxDir, err = absoluteDir(options.SandboxHome, defaults.Defaults().SandboxHome)
+	if err != nil {
+		return sd, "", err
+	}
+
+	binaryDir, basedirName, version, err := resolveVersion(options.Version, sandboxBinary)
+	if err != nil {
+		return sd, "", err
+	}
+	sd.Version = version
+	sd.BasedirName = basedirName
+	sd.Basedir = path.Join(binaryDir, basedirName)
+	if !common.DirExists(sd.Basedir) {
+		return sd, "", fmt.Errorf(globals.ErrBaseDirectoryNotFound, sd.Basedir)
+	}
+	if sd.SandboxDir == sd.Basedir {
+		return sd, "", fmt.Errorf("sandbox-binary and sandbox-home cannot be the same directory (%s)", sd.SandboxDir)
+	}
+	if os.Getenv("SB_MOCKING") == "" {
+		err = common.CheckLibraries(sd.Basedir)
+		if err != nil {
+			return sd, "", err
+		}
+	}
+	err = common.CheckTarballOperatingSystem(sd.Basedir)
+	if err != nil {
+		return sd, "", errors.Wrapf(err, "incorrect tarball detected")
+	}
+
+	sd.Port, err = common.VersionToPort(sd.Version)
+	if err != nil {
+		return sd, "", errors.Wrapf(err, "can't convert '%s' into port number", sd.Version)
+	}
+	if sd.Port < 0 {
+		return sd, "", fmt.Errorf("unsupported version format (%s)", sd.Version)
+	}
+	if options.Port > 0 {
+		sd.UserPort = options.Port
+		sd.Port = options.Port
+	}
+	sd.BasePort = options.BasePort
+
+	err = common.CheckSandboxDir(sd.SandboxDir)
+	if err != nil {
+		return sd, "", err
+	}
+	sd.InstalledPorts, err = common.GetInstalledPorts(sd.SandboxDir)
+	if err != nil {
+		return sd, "", err
+	}
+	sd.InstalledPorts = append(sd.InstalledPorts, defaults.Defaults().ReservedPorts...)
+
+	sd.Flavor, err = common.GetBinaryFlavor(options.Flavor, sd.Basedir)
+	if err != nil {
+		return sd, "", err
+	}
+
+	sd.SbHost = globals.LocalHostIP
+	sd.DirName = options.DirName
+	sd.DbUser = common.CoalesceString(options.DbUser, globals.DbUserValue)
+	sd.DbPassword = common.CoalesceString(options.DbPassword, globals.DbPasswordValue)
+	sd.RplUser = common.CoalesceString(options.RplUser, globals.RplUserValue)
+	sd.RplPassword = common.CoalesceString(options.RplPassword, globals.RplPasswordValue)
+	for _, user := range []string{sd.DbUser, sd.RplUser} {
+		if user == "root" {
+			return sd, "", fmt.Errorf("the database user and the replication user cannot be 'root'")
+		}
+	}
+	sd.RemoteAccess = globals.RemoteAccessValue
+	sd.BindAddress = globals.BindAddressValue
+	sd.DefaultRole = globals.DefaultRoleValue
+	sd.CustomRoleName = globals.CustomRoleNameValue
+	sd.CustomRolePrivileges = globals.CustomRolePrivilegesValue
+	sd.CustomRoleTarget = globals.CustomRoleTargetValue
+	sd.CustomRoleExtra = globals.CustomRoleExtraValue
+	sd.ShellPath = defaults.Defaults().ShellPath
+	sd.MyCnfOptions = options.MyCnfOptions
+	sd.InitOptions = options.InitOptions
+	sd.PreGrantsSql = options.PreGrantsSql
+	sd.PostGrantsSql = options.PostGrantsSql
+	sd.SkipStart = options.SkipStart
+	sd.LoadGrants = !options.SkipStart
+	sd.Force = options.Force
+
+	sd, err = sandbox.SetReplicationOptions(sd, options.Master, options.Gtid, options.ReplCrashSafe)
+	if err != nil {
+		return sd, "", err
+	}
+	if options.Customize != nil {
+		err = options.Customize(&sd)
+		if err != nil {
+			return sd, "", err
+		}
+	}
+	return sd, basedirName, nil
+}
+
+// DeploySingle deploys a single sandbox, and returns its directory
+func DeploySingle(options DeployOptions) (string, error) {
+	sd, origin, err := NewSandboxDef(options)
+	if err != nil {
+		return "", err
+	}
+	if sd.DirName == "" {
+		sd.DirName = defaults.Defaults().SandboxPrefix + common.VersionToName(origin)
+	}
+	sd.RunConcurrently = false
+	err = sandbox.CreateStandaloneSandbox(sd)
+	if err != nil {
+		return "", fmt.Errorf(globals.ErrCreatingSandbox, err)
+	}
+	return path.Join(sd.SandboxDir, sd.DirName), nil
+}
+
+// DeployMultiple deploys a sandbox made of several nodes without replication, and returns its directory
+func DeployMultiple(options DeployOptions, nodes int) (string, error) {
+	sd, origin, err := NewSandboxDef(options)
+	if err != nil {
+		return "", err
+	}
+	if nodes == 0 {
+		nodes = globals.NodesValue
+	}
+	if sd.DirName == "" {
+		sd.DirName = defaults.Defaults().MultiplePrefix + common.VersionToName(origin)
+	}
+	sd.SBType = globals.SbTypeMultiple
+	_, err = sandbox.CreateMultipleSandbox(sd, origin, nodes)
+	if err != nil {
+		return "", fmt.Errorf(globals.ErrCreatingSandbox, err)
+	}
+	return path.Join(sd.SandboxDir, sd.DirName), nil
+}
+
+// DeployReplication deploys a replication sandbox, and returns its directory
+func DeployReplication(options ReplicationOptions) (string, error) {
+	sd, origin, err := NewSandboxDef(options.DeployOptions)
+	if err != nil {
+		return "", err
+	}
+	if sd.Flavor == common.TiDbFlavor {
+		return "", fmt.Errorf("flavor '%s' is not suitable to create replication sandboxes", common.TiDbFlavor)
+	}
+	topology := common.CoalesceString(options.Topology, globals.TopologyValue)
+	nodes := options.Nodes
+	if options.ChainSpec != "" {
+		if topology != globals.ChainLabel {
+			return "", fmt.Errorf("option '%s' can only be used with '%s' topology", globals.ChainSpecLabel, globals.ChainLabel)
+		}
+		if nodes == 0 {
+			_, links, err := sandbox.ParseChainSpec(options.ChainSpec)
+			if err != nil {
+				return "", errors.Wrapf(err, "error parsing chain specification")
+			}
+			nodes = len(links) + 1
+		}
+	}
+	if nodes == 0 {
+		nodes = globals.NodesValue
+	}
+	if options.SemiSync {
+		if topology != globals.MasterSlaveLabel {
+			return "", fmt.Errorf("--%s is only available with master/slave topology", globals.SemiSyncLabel)
+		}
+		isMinimumSync, err := common.HasCapability(sd.Flavor, common.SemiSynch, sd.Version)
+		if err != nil {
+			return "", errors.Wrapf(err, globals.ErrWhileComparingVersions)
+		}
+		if !isMinimumSync {
+			return "", fmt.Errorf("--%s requires version %s+", globals.SemiSyncLabel,
+				common.IntSliceToDottedString(globals.MinimumSemiSyncVersion))
+		}
+		sd.SemiSyncOptions = sandbox.SingleTemplates[globals.TmplSemisyncMasterOptions].Contents
+	}
+	if options.SinglePrimary && topology != globals.GroupLabel {
+		return "", fmt.Errorf("option '%s' can only be used with '%s' topology", globals.SinglePrimaryLabel, globals.GroupLabel)
+	}
+	sd.SinglePrimary = options.SinglePrimary
+	if options.NodeVersions != "" {
+		sd.NodeVersions, err = sandbox.ParseNodeVersions(options.NodeVersions, common.DirName(sd.Basedir))
+		if err != nil {
+			return "", err
+		}
+	}
+	sd.ReplOptions = sandbox.SingleTemplates[globals.TmplReplicationOptions].Contents
+	if sd.DirName == "" {
+		prefix, err := replicationPrefix(topology, options.SinglePrimary)
+		if err != nil {
+			return "", err
+		}
+		sd.DirName = prefix + common.VersionToName(origin)
+	}
+	masterList := options.MasterList
+	slaveList := options.SlaveList
+	if topology != globals.FanInLabel && topology != globals.AllMastersLabel {
+		masterList = ""
+		slaveList = ""
+	}
+	err = sandbox.CreateReplicationSandbox(sd, origin,
+		sandbox.ReplicationData{
+			Topology:   topology,
+			Nodes:      nodes,
+			NdbNodes:   globals.NdbNodesValue,
+			MasterIp:   common.CoalesceString(options.MasterIp, globals.MasterIpValue),
+			MasterList: masterList,
+			SlaveList:  slaveList,
+			ChainSpec:  options.ChainSpec,
+		})
+	if err != nil {
+		return "", fmt.Errorf(globals.ErrCreatingSandbox, err)
+	}
+	return path.Join(sd.SandboxDir, sd.DirName), nil
+}
@@ -0,0 +1,113 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/sandbox"
+)
+
+// useMockEnvironment points HOME, SANDBOX_HOME and the sandbox catalog
+// to a mock directory, which is removed at the end of the test
+func useMockEnvironment(t *testing.T) {
+	err := sandbox.SetMockEnvironment(sandbox.DefaultMockDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sandbox.RemoveMockEnvironment(sandbox.DefaultMockDir) })
+}
+
+// fakeSandbox describes a sandbox to be created on disk without database servers
+type fakeSandbox struct {
+	// Node directories. A single sandbox has one node named ""
+	nodes []string
+	// Scripts written in every node, by name
+	scripts map[string]string
+	// Files written in the data directory of every node, by path relative to the data directory.
+	// The string "{node}" in the contents is replaced by the node name
+	dataFiles map[string]string
+	// Description of the sandbox, which is also written in every node directory
+	description common.SandboxDescription
+	// When not nil, the sandbox is registered in the catalog with this entry.
+	// Tests using it must call useMockEnvironment first
+	catalog *defaults.SandboxItem
+}
+
+// writeFakeFile writes a file of a fake sandbox, creating its directory if needed
+func writeFakeFile(t *testing.T, fileName, contents string) {
+	err := os.MkdirAll(path.Dir(fileName), globals.PublicDirectoryAttr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = common.WriteString(contents, fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// makeFakeSandbox creates a fake sandbox in sandboxDir and returns its directory
+func makeFakeSandbox(t *testing.T, sandboxDir string, fake fakeSandbox) string {
+	nodes := fake.nodes
+	if len(nodes) == 0 {
+		nodes = []string{""}
+	}
+	for i, node := range nodes {
+		nodeDir := path.Join(sandboxDir, node)
+		dataDir := path.Join(nodeDir, globals.DataDirName)
+		err := os.MkdirAll(dataDir, globals.PublicDirectoryAttr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, contents := range fake.dataFiles {
+			writeFakeFile(t, path.Join(dataDir, name), strings.ReplaceAll(contents, "{node}", node))
+		}
+		for name, contents := range fake.scripts {
+			writeFakeFile(t, path.Join(nodeDir, name), contents)
+			err = os.Chmod(path.Join(nodeDir, name), globals.ExecutableFileAttr)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if node != "" {
+			nodeDescription := fake.description
+			nodeDescription.NodeNum = i + 1
+			err = common.WriteSandboxDescription(nodeDir, nodeDescription)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	err := common.WriteSandboxDescription(sandboxDir, fake.description)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.catalog != nil {
+		item := *fake.catalog
+		item.Destination = sandboxDir
+		err = defaults.UpdateCatalog(sandboxDir, item)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return sandboxDir
+}
@@ -0,0 +1,114 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"path"
+	"time"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/sandbox"
+)
+
+const (
+	// Outcomes of garbage collection for a sandbox
+	GcDeleted = "deleted"
+	GcLocked  = "locked"
+	GcDryRun  = "to be deleted"
+	GcFailed  = "failed"
+)
+
+// CollectedSandbox describes a sandbox examined by garbage collection
+type CollectedSandbox struct {
+	Name      string `json:"name"`
+	Directory string `json:"directory"`
+	ExpiresAt string `json:"expires-at"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// expiredSandboxes returns the sandboxes in sandboxHome whose catalog entry expires not later
+// than the given time. Proxy sandboxes attached to an expired and unlocked sandbox are listed
+// before it, as they are deleted together with their backend
+func expiredSandboxes(sandboxHome string, when time.Time) ([]CollectedSandbox, error) {
+	var expired []CollectedSandbox
+	if !common.DirExists(sandboxHome) {
+		return expired, nil
+	}
+	installed, err := common.GetInstalledSandboxes(sandboxHome)
+	if err != nil {
+		return expired, err
+	}
+	catalog, err := defaults.ReadCatalog()
+	if err != nil {
+		return expired, err
+	}
+	included := make(map[string]bool)
+	add := func(sandboxDir string) {
+		if included[sandboxDir] {
+			return
+		}
+		included[sandboxDir] = true
+		expired = append(expired, CollectedSandbox{Name: path.Base(sandboxDir), Directory: sandboxDir, ExpiresAt: catalog[sandboxDir].ExpiresAt})
+	}
+	for _, sb := range installed {
+		sandboxDir := path.Join(sandboxHome, sb.SandboxName)
+		item, found := catalog[sandboxDir]
+		if !found || !item.IsExpired(when) {
+			continue
+		}
+		if !sb.Locked {
+			proxies, err := attachedProxies(sandboxDir)
+			if err != nil {
+				return expired, err
+			}
+			for _, proxyDir := range proxies {
+				add(proxyDir)
+			}
+		}
+		add(sandboxDir)
+	}
+	return expired, nil
+}
+
+// CollectGarbage stops and deletes the sandboxes in sandboxHome that have expired at the given time,
+// as set with --ttl or --expires-at during deployment. Locked sandboxes are skipped.
+// With dryRun, the sandboxes are only listed.
+// The outcome for each sandbox is reported in its Status
+func CollectGarbage(sandboxHome string, when time.Time, dryRun bool) ([]CollectedSandbox, error) {
+	expired, err := expiredSandboxes(sandboxHome, when)
+	if err != nil {
+		return expired, err
+	}
+	for i, sb := range expired {
+		switch {
+		case sandbox.IsLocked(sb.Directory):
+			expired[i].Status = GcLocked
+		case dryRun:
+			expired[i].Status = GcDryRun
+		default:
+			err = DeleteSandbox(sb.Directory, false)
+			if err != nil {
+				expired[i].Status = GcFailed
+				expired[i].Error = err.Error()
+				continue
+			}
+			expired[i].Status = GcDeleted
+		}
+	}
+	return expired, nil
+}
@@ -0,0 +1,163 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/compare"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+)
+
+// makeExpiringSandbox creates a single sandbox directory that can be deleted,
+// and records it in the catalog with the given expiration
+func makeExpiringSandbox(t *testing.T, sandboxHome, name, expiresAt, backend string) string {
+	exitScript := "#!/bin/sh\nexit 0\n"
+	return makeFakeSandbox(t, path.Join(sandboxHome, name), fakeSandbox{
+		scripts: map[string]string{
+			globals.ScriptStart:    exitScript,
+			globals.ScriptStop:     exitScript,
+			globals.ScriptSendKill: exitScript,
+		},
+		description: common.SandboxDescription{
+			SBType:  globals.SbTypeSingle,
+			Version: "8.0.36",
+			Flavor:  common.MySQLFlavor,
+			Backend: backend,
+		},
+		catalog: &defaults.SandboxItem{ExpiresAt: expiresAt, Backend: backend},
+	})
+}
+
+func TestCollectGarbage(t *testing.T) {
+	useMockEnvironment(t)
+	sandboxHome := t.TempDir()
+	now := time.Now()
+	past := now.Add(-time.Hour).Format(time.RFC3339)
+	future := now.Add(time.Hour).Format(time.RFC3339)
+
+	expiredDir := makeExpiringSandbox(t, sandboxHome, "msb_expired", past, "")
+	proxyDir := makeExpiringSandbox(t, sandboxHome, "proxysql_msb_expired", "", expiredDir)
+	lockedDir := makeExpiringSandbox(t, sandboxHome, "msb_locked", past, "")
+	validDir := makeExpiringSandbox(t, sandboxHome, "msb_valid", future, "")
+	permanentDir := makeExpiringSandbox(t, sandboxHome, "msb_permanent", "", "")
+	err := common.WriteString("", path.Join(lockedDir, globals.ScriptNoClear))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collected, err := CollectGarbage(sandboxHome, now, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := make(map[string]string)
+	for _, sb := range collected {
+		statuses[sb.Name] = sb.Status
+	}
+	var expected = map[string]string{
+		"msb_expired":          GcDryRun,
+		"proxysql_msb_expired": GcDryRun,
+		"msb_locked":           GcLocked,
+	}
+	compare.OkEqualInt("sandboxes collected in dry run", len(statuses), len(expected), t)
+	for name, status := range expected {
+		compare.OkEqualString("dry run status of "+name, statuses[name], status, t)
+	}
+	for _, dir := range []string{expiredDir, proxyDir, lockedDir, validDir, permanentDir} {
+		compare.OkEqualBool(path.Base(dir)+" kept in dry run", common.DirExists(dir), true, t)
+	}
+
+	collected, err = CollectGarbage(sandboxHome, now, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare.OkEqualInt("sandboxes collected", len(collected), 3, t)
+	// The proxy is removed before its backend
+	compare.OkEqualString("first sandbox collected", collected[0].Name, "proxysql_msb_expired", t)
+	catalog, err := defaults.ReadCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{expiredDir, proxyDir} {
+		compare.OkEqualBool(path.Base(dir)+" removed", common.DirExists(dir), false, t)
+		_, found := catalog[dir]
+		compare.OkEqualBool(path.Base(dir)+" in catalog", found, false, t)
+	}
+	for _, dir := range []string{lockedDir, validDir, permanentDir} {
+		compare.OkEqualBool(path.Base(dir)+" kept", common.DirExists(dir), true, t)
+	}
+
+	// Later, the second sandbox expires too
+	collected, err = CollectGarbage(sandboxHome, now.Add(2*time.Hour), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare.OkEqualInt("sandboxes collected later", len(collected), 2, t)
+	compare.OkEqualBool("expired sandbox removed", common.DirExists(validDir), false, t)
+	compare.OkEqualBool("permanent sandbox kept", common.DirExists(permanentDir), true, t)
+}
+
+func TestDeleteSandboxWithProxies(t *testing.T) {
+	useMockEnvironment(t)
+	sandboxHome := t.TempDir()
+	backendDir := makeExpiringSandbox(t, sandboxHome, "msb_backend", "", "")
+	proxyDir := makeExpiringSandbox(t, sandboxHome, "proxysql_msb_backend", "", backendDir)
+	lockedProxyDir := makeExpiringSandbox(t, sandboxHome, "proxysql_msb_locked", "", backendDir)
+	otherDir := makeExpiringSandbox(t, sandboxHome, "msb_other", "", "")
+	err := common.WriteString("", path.Join(lockedProxyDir, globals.ScriptNoClear))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A locked proxy prevents the deletion of its backend and of the other proxies
+	err = DeleteSandbox(backendDir, false)
+	compare.OkIsNotNil("deletion with locked proxy error", err, t)
+	for _, dir := range []string{backendDir, proxyDir, lockedProxyDir} {
+		compare.OkEqualBool(path.Base(dir)+" kept while a proxy is locked", common.DirExists(dir), true, t)
+	}
+	err = DeleteSandbox(lockedProxyDir, false)
+	compare.OkIsNotNil("locked proxy deletion error", err, t)
+
+	err = os.Remove(path.Join(lockedProxyDir, globals.ScriptNoClear))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = DeleteSandbox(backendDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := defaults.ReadCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{backendDir, proxyDir, lockedProxyDir} {
+		compare.OkEqualBool(path.Base(dir)+" removed", common.DirExists(dir), false, t)
+		_, found := catalog[dir]
+		compare.OkEqualBool(path.Base(dir)+" in catalog", found, false, t)
+	}
+	// Unrelated sandboxes are left alone
+	compare.OkEqualBool(path.Base(otherDir)+" kept", common.DirExists(otherDir), true, t)
+	_, found := catalog[otherDir]
+	compare.OkEqualBool(path.Base(otherDir)+" in catalog", found, true, t)
+
+	err = DeleteSandbox(backendDir, false)
+	compare.OkIsNotNil("second deletion error", err, t)
+}
@@ -0,0 +1,194 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/sandbox"
+)
+
+const (
+	errorLogName      = "msandbox.err"
+	errorLogTailLines = 5
+)
+
+// ReplicationHealth describes the state of a replication channel
+type ReplicationHealth struct {
+	Channel    string `json:"channel"`
+	MasterHost string `json:"master-host"`
+	MasterPort int    `json:"master-port"`
+	IoRunning  string `json:"io-running"`
+	SqlRunning string `json:"sql-running"`
+	// Lag is nil when the server can't compute it (for example, when a thread is stopped)
+	Lag         *int64 `json:"lag"`
+	LastIoError string `json:"last-io-error,omitempty"`
+	LastError   string `json:"last-error,omitempty"`
+}
+
+// NodeHealth describes the live state of a database server in a sandbox
+type NodeHealth struct {
+	Node             string              `json:"node"`
+	Port             int                 `json:"port"`
+	Running          bool                `json:"running"`
+	Version          string              `json:"version,omitempty"`
+	Uptime           int64               `json:"uptime"`
+	ReadOnly         bool                `json:"read-only"`
+	GtidExecuted     string              `json:"gtid-executed,omitempty"`
+	Replication      []ReplicationHealth `json:"replication,omitempty"`
+	GroupMemberState string              `json:"group-member-state,omitempty"`
+	ErrorLogTail     []string            `json:"error-log-tail,omitempty"`
+	Error            string              `json:"error,omitempty"`
+}
+
+// SandboxHealth describes the live state of all the nodes in a sandbox
+type SandboxHealth struct {
+	Name        string       `json:"name"`
+	Destination string       `json:"destination"`
+	Type        string       `json:"type"`
+	Version     string       `json:"version"`
+	Flavor      string       `json:"flavor,omitempty"`
+	Nodes       []NodeHealth `json:"nodes"`
+}
+
+// errorLogTail returns the last lines of a node error log
+func errorLogTail(nodeDir string, numLines int) []string {
+	lines, err := common.SlurpAsLines(path.Join(nodeDir, globals.DataDirName, errorLogName))
+	if err != nil {
+		return nil
+	}
+	if len(lines) > numLines {
+		lines = lines[len(lines)-numLines:]
+	}
+	return lines
+}
+
+// replicationHealthFromRows converts the output of SHOW SLAVE STATUS,
+// or of SHOW REPLICA STATUS, which uses "Source" and "Replica" in the column names
+func replicationHealthFromRows(rows []map[string]string) []ReplicationHealth {
+	var channels []ReplicationHealth
+	for _, row := range rows {
+		channel := ReplicationHealth{
+			Channel:     row["Channel_Name"],
+			MasterHost:  common.CoalesceString(row["Source_Host"], row["Master_Host"]),
+			IoRunning:   common.CoalesceString(row["Replica_IO_Running"], row["Slave_IO_Running"]),
+			SqlRunning:  common.CoalesceString(row["Replica_SQL_Running"], row["Slave_SQL_Running"]),
+			LastIoError: row["Last_IO_Error"],
+			LastError:   row["Last_Error"],
+		}
+		channel.MasterPort, _ = strconv.Atoi(common.CoalesceString(row["Source_Port"], row["Master_Port"]))
+		lag, err := strconv.ParseInt(common.CoalesceString(row["Seconds_Behind_Source"], row["Seconds_Behind_Master"]), 10, 64)
+		if err == nil {
+			channel.Lag = &lag
+		}
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// NodeHealthCheck connects to the server in a node directory and collects its live state.
+// A server that can't be reached is reported as not running, with the reason in Error
+func NodeHealthCheck(nodeDir, nodeName string) NodeHealth {
+	health := NodeHealth{Node: nodeName}
+	health.Port, _ = nodePort(nodeDir)
+	health.ErrorLogTail = errorLogTail(nodeDir, errorLogTailLines)
+
+	db, config, err := connectToSandbox(nodeDir, true)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	defer db.Close()
+	err = db.Ping()
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	health.Running = true
+
+	rows, err := db.GetRows(config, "SELECT @@version AS version, @@read_only AS read_only")
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	if len(rows) > 0 {
+		health.Version = rows[0]["version"]
+		health.ReadOnly = rows[0]["read_only"] == "1"
+	}
+	rows, err = db.GetRows(config, "SHOW GLOBAL STATUS LIKE 'Uptime'")
+	if err == nil && len(rows) > 0 {
+		health.Uptime, _ = strconv.ParseInt(rows[0]["Value"], 10, 64)
+	}
+	// The following items are not available in every version and flavor:
+	// errors only mean that the feature is not there
+	rows, err = db.GetRows(config, "SELECT @@global.gtid_executed AS gtid_executed")
+	if err == nil && len(rows) > 0 {
+		health.GtidExecuted = strings.ReplaceAll(rows[0]["gtid_executed"], "\n", "")
+	}
+	rows, err = db.GetRows(config, sandbox.NodeReplicationSyntax(nodeDir).ShowReplicaStatus)
+	if err == nil {
+		health.Replication = replicationHealthFromRows(rows)
+	}
+	rows, err = db.GetRows(config,
+		"SELECT member_state FROM performance_schema.replication_group_members WHERE member_id = @@server_uuid")
+	if err == nil && len(rows) > 0 {
+		health.GroupMemberState = rows[0]["member_state"]
+	}
+	return health
+}
+
+// SandboxHealthCheck collects the live state of all the nodes in a catalogued sandbox
+func SandboxHealthCheck(sandboxDir string, item defaults.SandboxItem) SandboxHealth {
+	health := SandboxHealth{
+		Name:        path.Base(sandboxDir),
+		Destination: sandboxDir,
+		Type:        item.SBType,
+		Version:     item.Version,
+		Flavor:      item.Flavor,
+	}
+	nodes := item.Nodes
+	if len(nodes) == 0 {
+		nodes = []string{""}
+	}
+	for _, node := range nodes {
+		health.Nodes = append(health.Nodes, NodeHealthCheck(path.Join(sandboxDir, node), node))
+	}
+	return health
+}
+
+// SandboxesHealthCheck collects the live state of all the sandboxes in the catalog, sorted by name
+func SandboxesHealthCheck() ([]SandboxHealth, error) {
+	catalog, err := defaults.ReadCatalog()
+	if err != nil {
+		return nil, err
+	}
+	var sandboxDirs []string
+	for sandboxDir := range catalog {
+		sandboxDirs = append(sandboxDirs, sandboxDir)
+	}
+	sort.Strings(sandboxDirs)
+	var result []SandboxHealth
+	for _, sandboxDir := range sandboxDirs {
+		result = append(result, SandboxHealthCheck(sandboxDir, catalog[sandboxDir]))
+	}
+	return result, nil
+}
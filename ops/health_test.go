@@ -0,0 +1,93 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/compare"
+	"github.com/datacharmer/dbdeployer/globals"
+)
+
+func TestReplicationHealthFromRows(t *testing.T) {
+	rows := []map[string]string{
+		{
+			"Channel_Name":          "",
+			"Master_Host":           "127.0.0.1",
+			"Master_Port":           "19028",
+			"Slave_IO_Running":      "Yes",
+			"Slave_SQL_Running":     "Yes",
+			"Seconds_Behind_Master": "3",
+			"Last_Error":            "",
+		},
+		{
+			"Channel_Name":      "node2",
+			"Master_Host":       "127.0.0.1",
+			"Master_Port":       "19029",
+			"Slave_IO_Running":  "No",
+			"Slave_SQL_Running": "Yes",
+			"Last_IO_Error":     "error connecting to master",
+		},
+	}
+	channels := replicationHealthFromRows(rows)
+	compare.OkEqualInt("channels", len(channels), 2, t)
+	compare.OkEqualInt("first channel master port", channels[0].MasterPort, 19028, t)
+	compare.OkEqualBool("first channel lag detected", channels[0].Lag != nil, true, t)
+	if channels[0].Lag != nil {
+		compare.OkEqualInt("first channel lag", int(*channels[0].Lag), 3, t)
+	}
+	compare.OkEqualString("second channel name", channels[1].Channel, "node2", t)
+	compare.OkEqualBool("second channel lag detected", channels[1].Lag != nil, false, t)
+	compare.OkEqualString("second channel IO error", channels[1].LastIoError, "error connecting to master", t)
+	compare.OkEqualInt("channels without rows", len(replicationHealthFromRows(nil)), 0, t)
+
+	channels = replicationHealthFromRows([]map[string]string{{
+		"Source_Host":           "127.0.0.1",
+		"Source_Port":           "19030",
+		"Replica_IO_Running":    "Yes",
+		"Replica_SQL_Running":   "No",
+		"Seconds_Behind_Source": "0",
+	}})
+	compare.OkEqualInt("replica channels", len(channels), 1, t)
+	if len(channels) == 1 {
+		compare.OkEqualInt("replica channel source port", channels[0].MasterPort, 19030, t)
+		compare.OkEqualString("replica IO running", channels[0].IoRunning, "Yes", t)
+		compare.OkEqualString("replica SQL running", channels[0].SqlRunning, "No", t)
+		compare.OkEqualBool("replica lag detected", channels[0].Lag != nil, true, t)
+	}
+}
+
+func TestNodeHealthCheckNotRunning(t *testing.T) {
+	nodeDir := t.TempDir()
+	dataDir := path.Join(nodeDir, globals.DataDirName)
+	err := os.Mkdir(dataDir, globals.PublicDirectoryAttr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := []string{"line 1", "line 2", "line 3", "line 4", "line 5", "line 6"}
+	err = common.WriteStrings(lines, path.Join(dataDir, errorLogName), "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	health := NodeHealthCheck(nodeDir, "node1")
+	compare.OkEqualBool("node running", health.Running, false, t)
+	compare.OkEqualBool("node error reported", len(health.Error) > 0, true, t)
+	compare.OkEqualStringSlices(t, health.ErrorLogTail, []string{"line 2", "line 3", "line 4", "line 5", "line 6"})
+}
@@ -149,7 +149,10 @@ func InitEnvironment(options InitOptions) error {
 		fmt.Printf("%s defaults for directory %s ($SANDBOX_BINARY)\n", updateLabel, sandboxBinary)
 		fmt.Printf("# dbdeployer defaults update %s %s \n", globals.SandboxBinaryLabel, sandboxBinary)
 		if !dryRun {
-			defaults.UpdateDefaults(globals.SandboxBinaryLabel, sandboxBinary, true)
+			err = defaults.UpdateDefaults(globals.SandboxBinaryLabel, sandboxBinary, true)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
@@ -158,7 +161,10 @@ func InitEnvironment(options InitOptions) error {
 		fmt.Printf("%s defaults for directory %s ($SANDBOX_HOME)\n", updateLabel, sandboxHome)
 		fmt.Printf("# dbdeployer defaults update %s %s \n", globals.SandboxHomeLabel, sandboxHome)
 		if !dryRun {
-			defaults.UpdateDefaults(globals.SandboxHomeLabel, sandboxHome, true)
+			err = defaults.UpdateDefaults(globals.SandboxHomeLabel, sandboxHome, true)
+			if err != nil {
+				return err
+			}
 		}
 	}
 	fmt.Println()
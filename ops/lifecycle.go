@@ -0,0 +1,110 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/concurrent"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/sandbox"
+)
+
+// StartSandbox starts all the nodes of a sandbox
+func StartSandbox(sandboxDir string) error {
+	nodes, err := sandboxDataNodes(sandboxDir)
+	if err != nil {
+		return err
+	}
+	return runSandboxScript(sandboxDir, nodes, globals.ScriptStart)
+}
+
+// StopSandbox stops all the nodes of a sandbox
+func StopSandbox(sandboxDir string) error {
+	nodes, err := sandboxDataNodes(sandboxDir)
+	if err != nil {
+		return err
+	}
+	return runSandboxScript(sandboxDir, nodes, globals.ScriptStop)
+}
+
+// attachedProxies returns the directories of the sandboxes, in the same sandbox home, that use sandboxDir as their backend
+func attachedProxies(sandboxDir string) ([]string, error) {
+	sandboxHome := path.Dir(sandboxDir)
+	installed, err := common.GetInstalledSandboxes(sandboxHome)
+	if err != nil {
+		return nil, err
+	}
+	var proxies []string
+	for _, sb := range installed {
+		if sb.SandboxDesc.Backend == sandboxDir {
+			proxies = append(proxies, path.Join(sandboxHome, sb.SandboxName))
+		}
+	}
+	return proxies, nil
+}
+
+// removeSandbox stops a sandbox, removes its directory, and removes it from the catalog
+func removeSandbox(sandboxDir string, useStop bool) error {
+	sbDesc, err := common.ReadSandboxDescription(sandboxDir)
+	if err != nil {
+		return err
+	}
+	// Clusters, and sandboxes of unknown flavor, are halted with "stop" rather than killed
+	useStop = useStop || sbDesc.Flavor == "" || sbDesc.Flavor == common.NdbFlavor || sbDesc.Flavor == common.PxcFlavor
+	execList, err := sandbox.RemoveCustomSandbox(path.Dir(sandboxDir), path.Base(sandboxDir), false, useStop)
+	if err != nil {
+		return fmt.Errorf(globals.ErrWhileDeletingSandbox, err)
+	}
+	concurrent.RunParallelTasksByPriority(execList)
+	err = defaults.DeleteFromCatalog(sandboxDir)
+	if err != nil {
+		return fmt.Errorf(globals.ErrRemovingFromCatalog, sandboxDir)
+	}
+	return nil
+}
+
+// DeleteSandbox stops a sandbox, removes its directory, and removes it from the catalog.
+// The proxy sandboxes attached to it are deleted first, as they can't work without their backend.
+// With useStop, the servers are halted with "stop" instead of "send_kill".
+// Nothing is deleted when the sandbox, or any of its proxies, is locked
+func DeleteSandbox(sandboxDir string, useStop bool) error {
+	if !common.DirExists(sandboxDir) {
+		return fmt.Errorf(globals.ErrDirectoryNotFound, sandboxDir)
+	}
+	if sandbox.IsLocked(sandboxDir) {
+		return fmt.Errorf("sandbox %s is locked", sandboxDir)
+	}
+	proxies, err := attachedProxies(sandboxDir)
+	if err != nil {
+		return err
+	}
+	for _, proxyDir := range proxies {
+		if sandbox.IsLocked(proxyDir) {
+			return fmt.Errorf("sandbox %s can't be deleted: its proxy %s is locked", sandboxDir, proxyDir)
+		}
+	}
+	for _, proxyDir := range proxies {
+		err = removeSandbox(proxyDir, useStop)
+		if err != nil {
+			return err
+		}
+	}
+	return removeSandbox(sandboxDir, useStop)
+}
@@ -0,0 +1,382 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/data_load"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/sandbox"
+)
+
+// ManifestSandbox describes one sandbox in a deployment manifest.
+// Its fields map onto the options of "dbdeployer deploy"
+type ManifestSandbox struct {
+	Name                string   `yaml:"name"`
+	Version             string   `yaml:"version"`
+	Flavor              string   `yaml:"flavor,omitempty"`
+	Type                string   `yaml:"type,omitempty"` // single, multiple, replication
+	Topology            string   `yaml:"topology,omitempty"`
+	Nodes               int      `yaml:"nodes,omitempty"`
+	MasterList          string   `yaml:"master-list,omitempty"`
+	SlaveList           string   `yaml:"slave-list,omitempty"`
+	ChainSpec           string   `yaml:"chain-spec,omitempty"`
+	SinglePrimary       bool     `yaml:"single-primary,omitempty"`
+	SemiSync            bool     `yaml:"semi-sync,omitempty"`
+	ReadOnly            bool     `yaml:"read-only,omitempty"`
+	SuperReadOnly       bool     `yaml:"super-read-only,omitempty"`
+	Gtid                bool     `yaml:"gtid,omitempty"`
+	Master              bool     `yaml:"master,omitempty"`
+	Port                int      `yaml:"port,omitempty"`
+	BasePort            int      `yaml:"base-port,omitempty"`
+	SkipStart           bool     `yaml:"skip-start,omitempty"`
+	DbUser              string   `yaml:"db-user,omitempty"`
+	DbPassword          string   `yaml:"db-password,omitempty"`
+	RplUser             string   `yaml:"rpl-user,omitempty"`
+	RplPassword         string   `yaml:"rpl-password,omitempty"`
+	MyCnfOptions        []string `yaml:"my-cnf-options,omitempty"`
+	MyCnfFile           string   `yaml:"my-cnf-file,omitempty"`
+	InitOptions         []string `yaml:"init-options,omitempty"`
+	ChangeMasterOptions []string `yaml:"change-master-options,omitempty"`
+	PreGrantsSql        []string `yaml:"pre-grants-sql,omitempty"`
+	PostGrantsSql       []string `yaml:"post-grants-sql,omitempty"`
+	PostGrantsSqlFile   string   `yaml:"post-grants-sql-file,omitempty"`
+	DataLoad            []string `yaml:"data-load,omitempty"`
+}
+
+// DeploymentManifest is the contents of a file used by "dbdeployer apply"
+type DeploymentManifest struct {
+	SandboxBinary string            `yaml:"sandbox-binary,omitempty"`
+	SandboxHome   string            `yaml:"sandbox-home,omitempty"`
+	Sandboxes     []ManifestSandbox `yaml:"sandboxes"`
+}
+
+// Actions that "dbdeployer apply" can take for a sandbox
+const (
+	ManifestActionCreate    = "create"
+	ManifestActionUnchanged = "unchanged"
+	ManifestActionChanged   = "changed"
+	ManifestActionRecreate  = "recreate"
+)
+
+// ManifestAction is the result of comparing a manifest entry with the sandbox on disk
+type ManifestAction struct {
+	Sandbox ManifestSandbox
+	Action  string
+	Reasons []string
+}
+
+// ApplyOptions control the behavior of ApplyManifest
+type ApplyOptions struct {
+	DryRun bool
+	// When Force is set, sandboxes that differ from the manifest are deployed again
+	Force bool
+}
+
+// ReadManifest reads a deployment manifest from a YAML or JSON file
+func ReadManifest(fileName string) (DeploymentManifest, error) {
+	var manifest DeploymentManifest
+	if !common.FileExists(fileName) {
+		return manifest, fmt.Errorf(globals.ErrFileNotFound, fileName)
+	}
+	contents, err := os.ReadFile(fileName) // #nosec G304
+	if err != nil {
+		return manifest, err
+	}
+	// JSON is a subset of YAML: the same decoder handles both formats
+	err = yaml.Unmarshal(contents, &manifest)
+	if err != nil {
+		return manifest, fmt.Errorf("error decoding manifest %s: %s", fileName, err)
+	}
+	err = expandManifestPaths(&manifest)
+	if err != nil {
+		return manifest, fmt.Errorf("error in manifest %s: %s", fileName, err)
+	}
+	err = ValidateManifest(manifest)
+	return manifest, err
+}
+
+// expandManifestPath replaces environment variables and "~" in a path, and makes it absolute,
+// as a shell would do with the options of "dbdeployer deploy"
+func expandManifestPath(value string) (string, error) {
+	if value == "" {
+		return value, nil
+	}
+	return common.AbsolutePath(os.ExpandEnv(value))
+}
+
+// expandManifestPaths expands the path fields of a manifest
+func expandManifestPaths(manifest *DeploymentManifest) error {
+	var err error
+	for _, field := range []*string{&manifest.SandboxHome, &manifest.SandboxBinary} {
+		*field, err = expandManifestPath(*field)
+		if err != nil {
+			return err
+		}
+	}
+	for i := range manifest.Sandboxes {
+		sb := &manifest.Sandboxes[i]
+		for _, field := range []*string{&sb.MyCnfFile, &sb.PostGrantsSqlFile} {
+			*field, err = expandManifestPath(*field)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateManifest checks that the manifest entries are complete and consistent
+func ValidateManifest(manifest DeploymentManifest) error {
+	if len(manifest.Sandboxes) == 0 {
+		return fmt.Errorf("no sandboxes defined in manifest")
+	}
+	names := make(map[string]bool)
+	for i, sb := range manifest.Sandboxes {
+		if sb.Name == "" {
+			return fmt.Errorf("sandbox #%d has no name", i+1)
+		}
+		if strings.Contains(sb.Name, "/") {
+			return fmt.Errorf("sandbox name '%s' must not contain a path", sb.Name)
+		}
+		if names[sb.Name] {
+			return fmt.Errorf("sandbox '%s' is defined more than once", sb.Name)
+		}
+		names[sb.Name] = true
+		if sb.Version == "" {
+			return fmt.Errorf("sandbox '%s' has no version", sb.Name)
+		}
+		switch sb.sandboxType() {
+		case globals.SbTypeSingle:
+			if sb.Topology != "" || sb.Nodes != 0 {
+				return fmt.Errorf("sandbox '%s': topology and nodes can't be used with type '%s'", sb.Name, globals.SbTypeSingle)
+			}
+		case globals.SbTypeMultiple:
+			if sb.Topology != "" {
+				return fmt.Errorf("sandbox '%s': topology can't be used with type '%s'", sb.Name, globals.SbTypeMultiple)
+			}
+		case globals.SbTypeReplication:
+			if !isAllowedTopology(sb.topology()) {
+				return fmt.Errorf("sandbox '%s': unrecognized topology '%s'. Accepted: '%v'", sb.Name, sb.Topology, globals.AllowedTopologies)
+			}
+		default:
+			return fmt.Errorf("sandbox '%s': unrecognized type '%s'. Accepted: '%s', '%s', '%s'", sb.Name, sb.Type,
+				globals.SbTypeSingle, globals.SbTypeMultiple, globals.SbTypeReplication)
+		}
+		if sb.Master && sb.sandboxType() != globals.SbTypeSingle {
+			return fmt.Errorf("sandbox '%s': option 'master' can only be used with type '%s'", sb.Name, globals.SbTypeSingle)
+		}
+	}
+	return nil
+}
+
+func isAllowedTopology(topology string) bool {
+	for _, allowed := range globals.AllowedTopologies {
+		if topology == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func (sb ManifestSandbox) sandboxType() string {
+	if sb.Type == "" {
+		return globals.SbTypeSingle
+	}
+	return sb.Type
+}
+
+func (sb ManifestSandbox) topology() string {
+	if sb.Topology == "" {
+		return globals.MasterSlaveLabel
+	}
+	return sb.Topology
+}
+
+// DeployOptions returns the options that deploy the sandbox
+func (sb ManifestSandbox) DeployOptions(manifest DeploymentManifest) ReplicationOptions {
+	return ReplicationOptions{
+		DeployOptions: DeployOptions{
+			Version:       sb.Version,
+			SandboxBinary: manifest.SandboxBinary,
+			SandboxHome:   manifest.SandboxHome,
+			DirName:       sb.Name,
+			Flavor:        sb.Flavor,
+			Port:          sb.Port,
+			BasePort:      sb.BasePort,
+			DbUser:        sb.DbUser,
+			DbPassword:    sb.DbPassword,
+			RplUser:       sb.RplUser,
+			RplPassword:   sb.RplPassword,
+			MyCnfOptions:  sb.MyCnfOptions,
+			InitOptions:   sb.InitOptions,
+			PreGrantsSql:  sb.PreGrantsSql,
+			PostGrantsSql: sb.PostGrantsSql,
+			Master:        sb.Master,
+			Gtid:          sb.Gtid,
+			SkipStart:     sb.SkipStart,
+			Customize: func(sd *sandbox.SandboxDef) error {
+				sd.MyCnfFile = sb.MyCnfFile
+				sd.PostGrantsSqlFile = sb.PostGrantsSqlFile
+				sd.ChangeMasterOptions = sb.ChangeMasterOptions
+				sd.SlavesReadOnly = sb.ReadOnly
+				sd.SlavesSuperReadOnly = sb.SuperReadOnly
+				return nil
+			},
+		},
+		Topology:      sb.Topology,
+		Nodes:         sb.Nodes,
+		SemiSync:      sb.SemiSync,
+		SinglePrimary: sb.SinglePrimary,
+		MasterList:    sb.MasterList,
+		SlaveList:     sb.SlaveList,
+		ChainSpec:     sb.ChainSpec,
+	}
+}
+
+// deployManifestSandbox deploys a manifest entry, and returns the sandbox directory
+func deployManifestSandbox(sb ManifestSandbox, manifest DeploymentManifest, force bool) (string, error) {
+	options := sb.DeployOptions(manifest)
+	options.Force = force
+	common.CondPrintf("deploying %s %s %s\n", sb.sandboxType(), sb.Version, sb.Name)
+	switch sb.sandboxType() {
+	case globals.SbTypeMultiple:
+		return DeployMultiple(options.DeployOptions, options.Nodes)
+	case globals.SbTypeReplication:
+		return DeployReplication(options)
+	}
+	return DeploySingle(options.DeployOptions)
+}
+
+// sandboxDifferences compares a manifest entry with the description of a deployed sandbox
+func sandboxDifferences(sb ManifestSandbox, sbDesc common.SandboxDescription) []string {
+	var reasons []string
+	if sbDesc.Version != sb.Version {
+		reasons = append(reasons, fmt.Sprintf("version: '%s' (manifest: '%s')", sbDesc.Version, sb.Version))
+	}
+	if sb.Flavor != "" && sbDesc.Flavor != sb.Flavor {
+		reasons = append(reasons, fmt.Sprintf("flavor: '%s' (manifest: '%s')", sbDesc.Flavor, sb.Flavor))
+	}
+	expectedType := sb.sandboxType()
+	if expectedType == globals.SbTypeReplication {
+		expectedType = sb.topology()
+	}
+	// Group replication records the primary mode in the type (group-single-primary, group-multi-primary)
+	if !strings.HasPrefix(sbDesc.SBType, expectedType) {
+		reasons = append(reasons, fmt.Sprintf("type: '%s' (manifest: '%s')", sbDesc.SBType, expectedType))
+	}
+	if sb.Nodes != 0 {
+		nodes := sbDesc.Nodes
+		// A master-slave description counts only the slaves
+		if sbDesc.SBType == globals.MasterSlaveLabel {
+			nodes++
+		}
+		if nodes != sb.Nodes {
+			reasons = append(reasons, fmt.Sprintf("nodes: %d (manifest: %d)", nodes, sb.Nodes))
+		}
+	}
+	return reasons
+}
+
+// PlanManifest compares the manifest with the sandboxes in the catalog,
+// and returns the action needed for every entry
+func PlanManifest(manifest DeploymentManifest, force bool) ([]ManifestAction, error) {
+	sandboxHome := manifest.SandboxHome
+	if sandboxHome == "" {
+		sandboxHome = defaults.Defaults().SandboxHome
+	}
+	catalog, err := defaults.ReadCatalog()
+	if err != nil {
+		return nil, fmt.Errorf("error reading sandbox catalog: %s", err)
+	}
+	var actions []ManifestAction
+	for _, sb := range manifest.Sandboxes {
+		sandboxDir := path.Join(sandboxHome, sb.Name)
+		_, inCatalog := catalog[sandboxDir]
+		if !inCatalog && !common.DirExists(sandboxDir) {
+			actions = append(actions, ManifestAction{Sandbox: sb, Action: ManifestActionCreate})
+			continue
+		}
+		sbDesc, err := common.ReadSandboxDescription(sandboxDir)
+		if err != nil {
+			return nil, fmt.Errorf("error reading description of sandbox %s: %s", sandboxDir, err)
+		}
+		reasons := sandboxDifferences(sb, sbDesc)
+		if !inCatalog {
+			reasons = append(reasons, "sandbox not found in catalog")
+		}
+		action := ManifestActionUnchanged
+		if len(reasons) > 0 {
+			action = ManifestActionChanged
+			if force {
+				action = ManifestActionRecreate
+			}
+		}
+		actions = append(actions, ManifestAction{Sandbox: sb, Action: action, Reasons: reasons})
+	}
+	return actions, nil
+}
+
+// ApplyManifest brings the sandboxes in line with the manifest:
+// missing sandboxes are created, and the ones that differ are reported,
+// or removed and deployed again when options.Force is set.
+// Existing sandboxes are never changed in place.
+func ApplyManifest(manifest DeploymentManifest, options ApplyOptions) error {
+	actions, err := PlanManifest(manifest, options.Force)
+	if err != nil {
+		return err
+	}
+	var changed []string
+	for _, action := range actions {
+		fmt.Printf("%-10s %s\n", action.Action, action.Sandbox.Name)
+		for _, reason := range action.Reasons {
+			fmt.Printf("%-10s   - %s\n", "", reason)
+		}
+		if action.Action == ManifestActionChanged {
+			changed = append(changed, action.Sandbox.Name)
+		}
+	}
+	if options.DryRun {
+		return nil
+	}
+	for _, action := range actions {
+		if action.Action != ManifestActionCreate && action.Action != ManifestActionRecreate {
+			continue
+		}
+		sandboxDir, err := deployManifestSandbox(action.Sandbox, manifest, action.Action == ManifestActionRecreate)
+		if err != nil {
+			return fmt.Errorf("error deploying sandbox %s: %s", action.Sandbox.Name, err)
+		}
+		for _, archive := range action.Sandbox.DataLoad {
+			err = data_load.LoadArchiveIntoDir(archive, sandboxDir, false)
+			if err != nil {
+				return fmt.Errorf("error loading %s into sandbox %s: %s", archive, action.Sandbox.Name, err)
+			}
+		}
+	}
+	if len(changed) > 0 {
+		return fmt.Errorf("sandboxes %v differ from the manifest. Use --%s to deploy them again", changed, globals.ForceLabel)
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/compare"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/sandbox"
+)
+
+const sampleManifest = `
+sandbox-home: /tmp/manifest-sandboxes
+sandboxes:
+  - name: app_db
+    version: 8.0.36
+    my-cnf-options:
+      - max_connections=200
+    post-grants-sql:
+      - create schema app
+  - name: app_repl
+    version: 8.0.36
+    type: replication
+    topology: chain
+    chain-spec: 1>2>3,2>4
+    nodes: 4
+    gtid: true
+    data-load:
+      - sakila
+`
+
+func TestReadManifest(t *testing.T) {
+	manifestFile := path.Join(t.TempDir(), "topology.yaml")
+	err := common.WriteString(sampleManifest, manifestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := ReadManifest(manifestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare.OkEqualString("sandbox home", manifest.SandboxHome, "/tmp/manifest-sandboxes", t)
+	compare.OkEqualInt("sandboxes", len(manifest.Sandboxes), 2, t)
+	compare.OkEqualStringSlices(t, manifest.Sandboxes[1].DataLoad, []string{"sakila"})
+
+	options := manifest.Sandboxes[0].DeployOptions(manifest)
+	compare.OkEqualString("single version", options.Version, "8.0.36", t)
+	compare.OkEqualString("single directory", options.DirName, "app_db", t)
+	compare.OkEqualString("single sandbox home", options.SandboxHome, "/tmp/manifest-sandboxes", t)
+	compare.OkEqualStringSlices(t, options.MyCnfOptions, []string{"max_connections=200"})
+	compare.OkEqualStringSlices(t, options.PostGrantsSql, []string{"create schema app"})
+
+	options = manifest.Sandboxes[1].DeployOptions(manifest)
+	compare.OkEqualString("replication directory", options.DirName, "app_repl", t)
+	compare.OkEqualString("replication topology", options.Topology, "chain", t)
+	compare.OkEqualString("replication chain spec", options.ChainSpec, "1>2>3,2>4", t)
+	compare.OkEqualInt("replication nodes", options.Nodes, 4, t)
+	compare.OkEqualBool("replication gtid", options.Gtid, true, t)
+
+	// JSON manifests are read by the same decoder
+	jsonFile := path.Join(t.TempDir(), "topology.json")
+	err = common.WriteString(`{"sandboxes": [{"name": "msb", "version": "5.7.44"}]}`, jsonFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err = ReadManifest(jsonFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare.OkEqualString("JSON sandbox name", manifest.Sandboxes[0].Name, "msb", t)
+
+	// Paths are expanded, as a shell would do for the deploy options
+	t.Setenv("MANIFEST_TEST_DIR", "/tmp/manifest-files")
+	envFile := path.Join(t.TempDir(), "env.yaml")
+	err = common.WriteString(`
+sandbox-home: $HOME/sandboxes
+sandbox-binary: ~/opt/mysql
+sandboxes:
+  - name: msb
+    version: 8.0.36
+    my-cnf-file: ${MANIFEST_TEST_DIR}/my.cnf
+    read-only: true
+    change-master-options:
+      - master_retry_count=10
+`, envFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err = ReadManifest(envFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	home := os.Getenv("HOME")
+	compare.OkEqualString("expanded sandbox home", manifest.SandboxHome, path.Join(home, "sandboxes"), t)
+	compare.OkEqualString("expanded sandbox binary", manifest.SandboxBinary, path.Join(home, "opt/mysql"), t)
+	compare.OkEqualString("expanded my.cnf file", manifest.Sandboxes[0].MyCnfFile, "/tmp/manifest-files/my.cnf", t)
+
+	// The options without a field in DeployOptions are set in the sandbox definition
+	options = manifest.Sandboxes[0].DeployOptions(manifest)
+	compare.OkEqualString("options sandbox home", options.SandboxHome, path.Join(home, "sandboxes"), t)
+	var sd sandbox.SandboxDef
+	err = options.Customize(&sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare.OkEqualString("definition my.cnf file", sd.MyCnfFile, "/tmp/manifest-files/my.cnf", t)
+	compare.OkEqualBool("definition read only", sd.SlavesReadOnly, true, t)
+	compare.OkEqualStringSlices(t, sd.ChangeMasterOptions, []string{"master_retry_count=10"})
+}
+
+func TestApplyManifest(t *testing.T) {
+	useMockEnvironment(t)
+	for _, version := range []string{"8.0.35", "8.0.36"} {
+		err := sandbox.CreateMockVersion(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sandboxHome := defaults.Defaults().SandboxHome
+	manifest := DeploymentManifest{
+		Sandboxes: []ManifestSandbox{
+			{Name: "app_single", Version: "8.0.36", Gtid: true},
+			{Name: "app_multi", Version: "8.0.36", Type: globals.SbTypeMultiple, Nodes: 2},
+			{Name: "app_repl", Version: "8.0.35", Type: globals.SbTypeReplication, Nodes: 3},
+		},
+	}
+	err := ApplyManifest(manifest, ApplyOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sb := range manifest.Sandboxes {
+		compare.OkEqualBool(sb.Name+" deployed by dry run", common.DirExists(path.Join(sandboxHome, sb.Name)), false, t)
+	}
+
+	err = ApplyManifest(manifest, ApplyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := defaults.ReadCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sb := range manifest.Sandboxes {
+		sandboxDir := path.Join(sandboxHome, sb.Name)
+		compare.OkEqualBool(sb.Name+" deployed", common.DirExists(sandboxDir), true, t)
+		_, inCatalog := catalog[sandboxDir]
+		compare.OkEqualBool(sb.Name+" in catalog", inCatalog, true, t)
+	}
+	compare.OkEqualStringSlices(t, catalog[path.Join(sandboxHome, "app_multi")].Nodes, []string{"node1", "node2"})
+
+	actions, err := PlanManifest(manifest, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range actions {
+		compare.OkEqualString(action.Sandbox.Name+" action", action.Action, ManifestActionUnchanged, t)
+	}
+
+	// A sandbox that differs is reported, and deployed again only with Force
+	manifest.Sandboxes[0].Version = "8.0.35"
+	err = ApplyManifest(manifest, ApplyOptions{})
+	compare.OkIsNotNil("changed sandbox error", err, t)
+	sbDesc, err := common.ReadSandboxDescription(path.Join(sandboxHome, "app_single"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare.OkEqualString("version before force", sbDesc.Version, "8.0.36", t)
+
+	err = ApplyManifest(manifest, ApplyOptions{Force: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sbDesc, err = common.ReadSandboxDescription(path.Join(sandboxHome, "app_single"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare.OkEqualString("version after force", sbDesc.Version, "8.0.35", t)
+
+	for _, sb := range manifest.Sandboxes {
+		err = DeleteSandbox(path.Join(sandboxHome, sb.Name), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestValidateManifest(t *testing.T) {
+	var tests = []struct {
+		name      string
+		sandboxes []ManifestSandbox
+		errText   string
+	}{
+		{"empty", nil, "no sandboxes"},
+		{"no-name", []ManifestSandbox{{Version: "8.0.36"}}, "has no name"},
+		{"path-name", []ManifestSandbox{{Name: "a/b", Version: "8.0.36"}}, "must not contain a path"},
+		{"no-version", []ManifestSandbox{{Name: "a"}}, "has no version"},
+		{"duplicate", []ManifestSandbox{{Name: "a", Version: "8.0.36"}, {Name: "a", Version: "5.7.44"}}, "more than once"},
+		{"bad-type", []ManifestSandbox{{Name: "a", Version: "8.0.36", Type: "cluster"}}, "unrecognized type"},
+		{"bad-topology", []ManifestSandbox{{Name: "a", Version: "8.0.36", Type: "replication", Topology: "star"}}, "unrecognized topology"},
+		{"single-nodes", []ManifestSandbox{{Name: "a", Version: "8.0.36", Nodes: 3}}, "can't be used with type"},
+		{"multiple-master", []ManifestSandbox{{Name: "a", Version: "8.0.36", Type: "multiple", Master: true}}, "can only be used"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateManifest(DeploymentManifest{Sandboxes: test.sandboxes})
+			if err == nil {
+				t.Fatalf("no error for manifest %s", test.name)
+			}
+			compare.OkMatchesString("validation error", err.Error(), test.errText, t)
+		})
+	}
+}
+
+func TestSandboxDifferences(t *testing.T) {
+	sb := ManifestSandbox{Name: "rsandbox", Version: "8.0.36", Type: "replication", Nodes: 3}
+	sbDesc := common.SandboxDescription{SBType: "master-slave", Version: "8.0.36", Flavor: "mysql", Nodes: 2}
+	compare.OkEqualInt("master-slave differences", len(sandboxDifferences(sb, sbDesc)), 0, t)
+
+	sbDesc.Version = "8.0.35"
+	sbDesc.Nodes = 3
+	compare.OkEqualInt("version and nodes differences", len(sandboxDifferences(sb, sbDesc)), 2, t)
+
+	sb = ManifestSandbox{Name: "group", Version: "8.0.36", Type: "replication", Topology: "group", SinglePrimary: true}
+	sbDesc = common.SandboxDescription{SBType: "group-single-primary", Version: "8.0.36", Nodes: 3}
+	compare.OkEqualInt("group differences", len(sandboxDifferences(sb, sbDesc)), 0, t)
+
+	sb = ManifestSandbox{Name: "msb", Version: "8.0.36"}
+	compare.OkEqualStringSlices(t, sandboxDifferences(sb, sbDesc), []string{"type: 'group-single-primary' (manifest: 'single')"})
+}
@@ -0,0 +1,384 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/sandbox"
+)
+
+const (
+	// Seconds that a new node can take to become an online member of a group
+	groupJoinTimeout = 60
+	// File containing the data of a donor, while a new node is provisioned
+	provisioningDumpName = "provisioning_dump.sql"
+	// File written by clone_from, with the binary log coordinates of the donor
+	cloneReplicationName = "clone_replication.sql"
+)
+
+var reDumpCoordinates = regexp.MustCompile(`(?:MASTER|SOURCE)_LOG_FILE='([^']+)',\s*(?:MASTER|SOURCE)_LOG_POS=(\d+)`)
+
+// minimumNodes returns the number of nodes below which a sandbox can't go
+func minimumNodes(sbType string) int {
+	if strings.HasPrefix(sbType, globals.GroupLabel) {
+		return 3
+	}
+	return 2
+}
+
+// lastNode returns the node with the highest number
+func lastNode(sbType string, nodes []string) (string, error) {
+	last := ""
+	lastNumber := 0
+	for _, node := range nodes {
+		number, err := sandbox.NodeScriptNumber(sbType, node)
+		if err != nil {
+			return "", err
+		}
+		if number > lastNumber {
+			last = node
+			lastNumber = number
+		}
+	}
+	if last == "" {
+		return "", fmt.Errorf("no nodes found")
+	}
+	return last, nil
+}
+
+// usesGtid tells whether a running node has GTID enabled
+func usesGtid(nodeDir string) bool {
+	gtidMode, err := nodeQuery(nodeDir, "SELECT @@global.gtid_mode")
+	return err == nil && gtidMode == "ON"
+}
+
+// provisionWithClone copies the data of a donor node into a new node using the clone plugin.
+// It returns the binary log coordinates of the donor at the time of the copy
+func provisionWithClone(donorDir, nodeDir string) (string, error) {
+	sandboxHome := path.Dir(path.Dir(donorDir))
+	donorName := path.Join(path.Base(path.Dir(donorDir)), path.Base(donorDir))
+	cmd := exec.Command(path.Join(nodeDir, globals.ScriptCloneFrom), donorName) // #nosec G204
+	cmd.Env = append(os.Environ(), "SANDBOX_HOME="+sandboxHome)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("error cloning %s into %s: %s\n%s", donorDir, nodeDir, err, out)
+	}
+	coordinates, err := common.SlurpAsString(path.Join(nodeDir, cloneReplicationName))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(coordinates), nil
+}
+
+// provisionWithDump loads into a new node a dump of all the databases of a donor node.
+// It returns the binary log coordinates of the donor at the time of the dump
+func provisionWithDump(donorDir, nodeDir string) (string, error) {
+	donorDesc, err := common.ReadSandboxDescription(donorDir)
+	if err != nil {
+		return "", err
+	}
+	// mysqldump 8.0.26 renamed --master-data to --source-data
+	dataOption := "--master-data=2"
+	isSourceData, err := common.GreaterOrEqualVersion(donorDesc.Version, []int{8, 0, 26})
+	if err == nil && isSourceData && donorDesc.Flavor == common.MySQLFlavor {
+		dataOption = "--source-data=2"
+	}
+	dumpFile := path.Join(nodeDir, provisioningDumpName)
+	defer func() { _ = os.Remove(dumpFile) }()
+	_, err = common.RunCmdCtrlWithArgs(path.Join(donorDir, globals.ScriptMy),
+		[]string{"sqldump", "-u", "root", "--all-databases", "--single-transaction", "--routines", "--triggers",
+			"--events", dataOption, "--result-file=" + dumpFile}, true)
+	if err != nil {
+		return "", fmt.Errorf("error dumping data from %s: %s", donorDir, err)
+	}
+	if usesGtid(nodeDir) {
+		// The dump sets the executed transactions of the new node
+		_, err = nodeQuery(nodeDir, sandbox.NodeReplicationSyntax(nodeDir).ResetSource)
+		if err != nil {
+			return "", err
+		}
+	}
+	dump, err := os.Open(dumpFile) // #nosec G304
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = dump.Close() }()
+	cmd := exec.Command(path.Join(nodeDir, globals.ScriptUse), "-u", "root") // #nosec G204
+	cmd.Stdin = dump
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("error loading data from %s into %s: %s\n%s", donorDir, nodeDir, err, out)
+	}
+	_, err = nodeQuery(nodeDir, "FLUSH PRIVILEGES")
+	if err != nil {
+		return "", err
+	}
+	header, err := common.SlurpAsString(dumpFile)
+	if err != nil {
+		return "", err
+	}
+	coordinates := reDumpCoordinates.FindStringSubmatch(header)
+	if coordinates == nil {
+		return "", nil
+	}
+	sourceOption := sandbox.NodeReplicationSyntax(nodeDir).SourceOption
+	return fmt.Sprintf("%s_LOG_FILE='%s', %s_LOG_POS=%s", sourceOption, coordinates[1], sourceOption, coordinates[2]), nil
+}
+
+// provisionNode copies the data of a donor node into a new node. It uses the clone plugin
+// when both nodes have the same version and support it, and a dump otherwise.
+// It returns the binary log coordinates of the donor at the time of the copy
+func provisionNode(donorDir, nodeDir string) (string, error) {
+	donorDesc, err := common.ReadSandboxDescription(donorDir)
+	if err != nil {
+		return "", err
+	}
+	nodeDesc, err := common.ReadSandboxDescription(nodeDir)
+	if err != nil {
+		return "", err
+	}
+	canClone, err := common.HasCapability(nodeDesc.Flavor, common.CloneServer, nodeDesc.Version)
+	if err == nil && canClone && donorDesc.Version == nodeDesc.Version && donorDesc.Flavor == nodeDesc.Flavor &&
+		common.ExecExists(path.Join(nodeDir, globals.ScriptCloneFrom)) {
+		return provisionWithClone(donorDir, nodeDir)
+	}
+	return provisionWithDump(donorDir, nodeDir)
+}
+
+// joinGroup starts group replication in a new node, and waits until the node is an online member
+func joinGroup(nodeDir string) error {
+	connection, err := GetSandboxConnection(nodeDir, false)
+	if err != nil {
+		return err
+	}
+	syntax := sandbox.NodeReplicationSyntax(nodeDir)
+	_, err = nodeQuery(nodeDir, fmt.Sprintf(
+		"%s %s_USER='%s', %s_PASSWORD='%s' FOR CHANNEL 'group_replication_recovery'; START GROUP_REPLICATION",
+		syntax.ChangeSource, syntax.SourceOption, connection.User, syntax.SourceOption, connection.Password))
+	if err != nil {
+		return err
+	}
+	for elapsed := 0; elapsed < groupJoinTimeout; elapsed++ {
+		state, err := nodeQuery(nodeDir,
+			"SELECT MEMBER_STATE FROM performance_schema.replication_group_members WHERE MEMBER_ID=@@server_uuid")
+		if err != nil {
+			return err
+		}
+		if state == "ONLINE" {
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+	return fmt.Errorf("node %s did not become an online group member within %d seconds", nodeDir, groupJoinTimeout)
+}
+
+// AddNode adds a node to a master-slave, group, or multiple sandbox, and returns its name.
+// The new node uses the binaries and the server options of an existing node.
+// In replication sandboxes, which must be running, the new node gets a copy of the data,
+// with the clone plugin where available or with a dump otherwise, and then it replicates
+// from the master or joins the group. In multiple sandboxes, the new node starts empty.
+func AddNode(sandboxDir string) (string, error) {
+	sbDesc, err := common.ReadSandboxDescription(sandboxDir)
+	if err != nil {
+		return "", err
+	}
+	if sandbox.IsLocked(sandboxDir) {
+		return "", fmt.Errorf("sandbox %s is locked", sandboxDir)
+	}
+	nodes, err := sandboxDataNodes(sandboxDir)
+	if err != nil {
+		return "", err
+	}
+	isGroup := strings.HasPrefix(sbDesc.SBType, globals.GroupLabel)
+	isMasterSlave := sbDesc.SBType == globals.MasterSlaveLabel
+	var master string
+	var slaves []string
+	members := nodes
+	reference := nodes[len(nodes)-1]
+	donor := nodes[0]
+	if isMasterSlave {
+		master, slaves, sbDesc, err = replicationRoles(sandboxDir)
+		if err != nil {
+			return "", err
+		}
+		members = append([]string{master}, slaves...)
+		donor = master
+		// A slave has the options that the new node needs, such as read-only flags
+		reference = master
+		if len(slaves) > 0 {
+			reference = slaves[0]
+		}
+	}
+	if isMasterSlave || isGroup {
+		running := runningNodes(sandboxDir, members)
+		if len(running) != len(members) {
+			return "", fmt.Errorf("adding a node requires all nodes to be running. Running: %v", running)
+		}
+	}
+	extraNode, err := sandbox.DeployExtraNode(sandboxDir, nodes, reference)
+	if err != nil {
+		return "", err
+	}
+	// If anything fails from here on, the new node is removed
+	success := false
+	defer func() {
+		if !success {
+			_, _ = common.RunCmdCtrl(path.Join(extraNode.Dir, globals.ScriptSendKill), true)
+			_ = os.RemoveAll(extraNode.Dir)
+		}
+	}()
+	if isMasterSlave || isGroup {
+		donorDir := path.Join(sandboxDir, donor)
+		coordinates, err := provisionNode(donorDir, extraNode.Dir)
+		if err != nil {
+			return "", err
+		}
+		if isMasterSlave {
+			connection, err := GetSandboxConnection(donorDir, false)
+			if err != nil {
+				return "", err
+			}
+			if usesGtid(donorDir) {
+				coordinates = ""
+			} else if coordinates == "" {
+				return "", fmt.Errorf("no binary log coordinates found for master %s", donorDir)
+			}
+			err = attachSlave(extraNode.Dir, connection, coordinates)
+			if err != nil {
+				return "", err
+			}
+		} else {
+			err = joinGroup(extraNode.Dir)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+	err = sandbox.UpdateNodeList(sandboxDir, append(nodes, extraNode.Name))
+	if err != nil {
+		return "", err
+	}
+	if isMasterSlave {
+		sbDesc, err = common.ReadSandboxDescription(sandboxDir)
+		if err != nil {
+			return "", err
+		}
+		err = writeReplicationRoles(sandboxDir, sbDesc, master, append(slaves, extraNode.Name))
+		if err != nil {
+			return "", err
+		}
+	}
+	success = true
+	return extraNode.Name, nil
+}
+
+// RemoveNode removes the node with the highest number from a master-slave, group, or multiple sandbox,
+// and returns its name. A running node leaves replication or the group before being stopped.
+// The master of a master-slave sandbox can't be removed.
+func RemoveNode(sandboxDir string) (string, error) {
+	sbDesc, err := common.ReadSandboxDescription(sandboxDir)
+	if err != nil {
+		return "", err
+	}
+	if sandbox.IsLocked(sandboxDir) {
+		return "", fmt.Errorf("sandbox %s is locked", sandboxDir)
+	}
+	nodes, err := sandboxDataNodes(sandboxDir)
+	if err != nil {
+		return "", err
+	}
+	node, err := lastNode(sbDesc.SBType, nodes)
+	if err != nil {
+		return "", err
+	}
+	minimum := minimumNodes(sbDesc.SBType)
+	if len(nodes) <= minimum {
+		return "", fmt.Errorf("sandbox %s has %d nodes, and can't have less than %d", sandboxDir, len(nodes), minimum)
+	}
+	isMasterSlave := sbDesc.SBType == globals.MasterSlaveLabel
+	var master string
+	var slaves []string
+	if isMasterSlave {
+		master, slaves, sbDesc, err = replicationRoles(sandboxDir)
+		if err != nil {
+			return "", err
+		}
+		if node == master {
+			return "", fmt.Errorf("node '%s' is the master of %s. Run a switchover before removing it", node, sandboxDir)
+		}
+	}
+	nodeDir := path.Join(sandboxDir, node)
+	if len(runningNodes(sandboxDir, []string{node})) > 0 {
+		leaveQuery := ""
+		switch {
+		case isMasterSlave:
+			syntax := sandbox.NodeReplicationSyntax(nodeDir)
+			leaveQuery = fmt.Sprintf("%s; %s ALL", syntax.StopReplica, syntax.ResetReplica)
+		case strings.HasPrefix(sbDesc.SBType, globals.GroupLabel):
+			leaveQuery = "STOP GROUP_REPLICATION"
+		}
+		if leaveQuery != "" {
+			_, err = nodeQuery(nodeDir, leaveQuery)
+			if err != nil {
+				return "", err
+			}
+		}
+		_, err = common.RunCmdCtrl(path.Join(nodeDir, globals.ScriptStop), true)
+		if err != nil {
+			return "", fmt.Errorf("error stopping node %s: %s", nodeDir, err)
+		}
+	}
+	err = os.RemoveAll(nodeDir)
+	if err != nil {
+		return "", err
+	}
+	var remaining []string
+	for _, other := range nodes {
+		if other != node {
+			remaining = append(remaining, other)
+		}
+	}
+	err = sandbox.UpdateNodeList(sandboxDir, remaining)
+	if err != nil {
+		return "", err
+	}
+	if isMasterSlave {
+		var remainingSlaves []string
+		for _, slave := range slaves {
+			if slave != node {
+				remainingSlaves = append(remainingSlaves, slave)
+			}
+		}
+		sbDesc, err = common.ReadSandboxDescription(sandboxDir)
+		if err != nil {
+			return "", err
+		}
+		err = writeReplicationRoles(sandboxDir, sbDesc, master, remainingSlaves)
+		if err != nil {
+			return "", err
+		}
+	}
+	return node, nil
+}
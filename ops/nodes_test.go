@@ -0,0 +1,109 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"path"
+	"testing"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/compare"
+	"github.com/datacharmer/dbdeployer/globals"
+)
+
+func TestLastNode(t *testing.T) {
+	node, err := lastNode(globals.MasterSlaveLabel, []string{"master", "node10", "node2", "node9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare.OkEqualString("last of several nodes", node, "node10", t)
+
+	node, err = lastNode(globals.MasterSlaveLabel, []string{"master"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare.OkEqualString("last of one node", node, "master", t)
+
+	_, err = lastNode(globals.SbTypeMultiple, []string{"node1", "master"})
+	compare.OkIsNotNil("invalid node name error", err, t)
+	_, err = lastNode(globals.SbTypeMultiple, nil)
+	compare.OkIsNotNil("no nodes error", err, t)
+
+	compare.OkEqualInt("minimum group nodes", minimumNodes("group-single-primary"), 3, t)
+	compare.OkEqualInt("minimum master-slave nodes", minimumNodes(globals.MasterSlaveLabel), 2, t)
+	compare.OkEqualInt("minimum multiple nodes", minimumNodes(globals.SbTypeMultiple), 2, t)
+}
+
+func TestLockedSandboxNodes(t *testing.T) {
+	sandboxDir := makeFakeSandbox(t, path.Join(t.TempDir(), "multi_msb"), fakeSandbox{
+		nodes: []string{"node1", "node2", "node3"},
+		description: common.SandboxDescription{
+			SBType:  globals.SbTypeMultiple,
+			Version: "8.0.36",
+			Flavor:  common.MySQLFlavor,
+			Nodes:   3,
+		},
+	})
+	writeFakeFile(t, path.Join(sandboxDir, globals.ScriptNoClear), "")
+
+	_, err := AddNode(sandboxDir)
+	if err == nil {
+		t.Fatal("no error adding a node to a locked sandbox")
+	}
+	compare.OkMatchesString("add node error", err.Error(), "is locked", t)
+	_, err = RemoveNode(sandboxDir)
+	if err == nil {
+		t.Fatal("no error removing a node from a locked sandbox")
+	}
+	compare.OkMatchesString("remove node error", err.Error(), "is locked", t)
+	for _, node := range []string{"node1", "node2", "node3"} {
+		compare.OkEqualBool(node+" kept", common.DirExists(path.Join(sandboxDir, node)), true, t)
+	}
+	compare.OkEqualBool("no new node", common.DirExists(path.Join(sandboxDir, "node4")), false, t)
+}
+
+func TestDumpCoordinates(t *testing.T) {
+	for header, expected := range map[string][]string{
+		"-- CHANGE MASTER TO MASTER_LOG_FILE='mysql-bin.000002', MASTER_LOG_POS=1234;":         {"mysql-bin.000002", "1234"},
+		"-- CHANGE REPLICATION SOURCE TO SOURCE_LOG_FILE='binlog.000010', SOURCE_LOG_POS=157;": {"binlog.000010", "157"},
+	} {
+		matches := reDumpCoordinates.FindStringSubmatch(header)
+		compare.OkEqualInt("coordinates matches", len(matches), 3, t)
+		if len(matches) == 3 {
+			compare.OkEqualStringSlices(t, matches[1:], expected)
+		}
+	}
+	matches := reDumpCoordinates.FindStringSubmatch("-- MySQL dump 10.13")
+	compare.OkEqualInt("matches in header without coordinates", len(matches), 0, t)
+}
+
+func TestNodeListLimits(t *testing.T) {
+	// The nodes of a replication sandbox must be running before adding one
+	sandboxDir := makeReplicationDirs(t, common.SandboxDescription{SBType: globals.MasterSlaveLabel})
+	_, err := AddNode(sandboxDir)
+	compare.OkIsNotNil("add node to stopped sandbox error", err, t)
+
+	// "master", "node1", "node2" are not valid group node names, and a group needs three nodes anyway
+	groupDir := makeReplicationDirs(t, common.SandboxDescription{SBType: "group-multi-primary"})
+	_, err = RemoveNode(groupDir)
+	compare.OkIsNotNil("remove node from group error", err, t)
+
+	singleDir := makeReplicationDirs(t, common.SandboxDescription{SBType: "single"})
+	_, err = AddNode(singleDir)
+	compare.OkIsNotNil("add node to single sandbox error", err, t)
+	_, err = RemoveNode(singleDir)
+	compare.OkIsNotNil("remove node from single sandbox error", err, t)
+}
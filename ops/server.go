@@ -0,0 +1,493 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/sandbox"
+)
+
+const ApiPrefix = "/api/v1/"
+
+// ServeOptions define the behavior of the API server
+type ServeOptions struct {
+	Listen        string
+	SandboxHome   string
+	SandboxBinary string
+}
+
+// SandboxRecord is a catalog entry, together with the sandbox name
+type SandboxRecord struct {
+	Name string `json:"name"`
+	defaults.SandboxItem
+}
+
+// DeployRequest is the body of a deployment request.
+// Besides the fields of sandbox.SandboxDef, it contains the options
+// that define the kind of deployment. As in SandboxDef, the field names
+// are used as JSON keys. The fields that the server computes, such as
+// SandboxDir, Basedir, and InstalledPorts, are ignored, and the fields that
+// name files or directories on the server are rejected.
+type DeployRequest struct {
+	Type           string // single, multiple, or replication
+	Topology       string
+	Nodes          int
+	MasterList     string
+	SlaveList      string
+	ChainSpec      string
+	NodeVersions   string // such as "1:5.7.44,2:8.0.36"
+	Master         bool
+	Gtid           bool
+	SemiSync       bool
+	ReplCrashSafe  bool
+	SkipLoadGrants bool
+	sandbox.SandboxDef
+}
+
+// DeployResponse is the result of a deployment
+type DeployResponse struct {
+	Sandbox SandboxRecord `json:"sandbox"`
+}
+
+// OperationResponse is the result of an operation that doesn't return data
+type OperationResponse struct {
+	Sandbox   string `json:"sandbox,omitempty"`
+	Operation string `json:"operation"`
+}
+
+// ApiError is the body of a failed request
+type ApiError struct {
+	Error string `json:"error"`
+}
+
+// CatalogRecords returns the catalog entries as a list sorted by sandbox directory
+func CatalogRecords(catalog defaults.SandboxCatalog) []SandboxRecord {
+	var records []SandboxRecord
+	for name, item := range catalog {
+		records = append(records, SandboxRecord{Name: common.BaseName(name), SandboxItem: item})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Destination < records[j].Destination })
+	return records
+}
+
+// isPlainName tells whether a name can be used as a directory or file name inside a given directory
+func isPlainName(name string) bool {
+	return !strings.Contains(name, "/") && !strings.Contains(name, "..") &&
+		name != "." && path.Clean(name) == name
+}
+
+// DeployOptions converts a deployment request into the options of the deployment.
+// Sandboxes and binaries are only taken from the directories used by the server
+func (request DeployRequest) DeployOptions(sandboxHome, sandboxBinary string) (ReplicationOptions, error) {
+	var options ReplicationOptions
+	switch request.Type {
+	case globals.SbTypeSingle, globals.SbTypeMultiple, globals.SbTypeReplication:
+	default:
+		return options, fmt.Errorf("invalid deployment type '%s'. Allowed: %s, %s, %s", request.Type,
+			globals.SbTypeSingle, globals.SbTypeMultiple, globals.SbTypeReplication)
+	}
+	if request.Version == "" {
+		return options, fmt.Errorf("no version was given for the deployment")
+	}
+	if strings.Contains(request.Version, "/") {
+		return options, fmt.Errorf("invalid version '%s': the binaries must be in %s", request.Version, sandboxBinary)
+	}
+	// The sandbox directory must be a plain name inside the sandbox home
+	if request.DirName != "" && !isPlainName(request.DirName) {
+		return options, fmt.Errorf("invalid sandbox directory name '%s'", request.DirName)
+	}
+	// The server doesn't read or write files named by the client
+	for field, value := range map[string]string{
+		"MyCnfFile":         request.MyCnfFile,
+		"PreGrantsSqlFile":  request.PreGrantsSqlFile,
+		"PostGrantsSqlFile": request.PostGrantsSqlFile,
+		"HistoryDir":        request.HistoryDir,
+	} {
+		if value != "" {
+			return options, fmt.Errorf("field %s is not accepted in a deployment request", field)
+		}
+	}
+	// The alternative mysqld and the client binaries are looked up inside the binaries directory
+	if request.CustomMysqld != "" && !isPlainName(request.CustomMysqld) {
+		return options, fmt.Errorf("invalid CustomMysqld '%s': it must be the name of an executable in the server bin directory", request.CustomMysqld)
+	}
+	clientBasedir := ""
+	if request.ClientBasedir != "" {
+		if !isPlainName(request.ClientBasedir) {
+			return options, fmt.Errorf("invalid ClientBasedir '%s': it must be a version in %s", request.ClientBasedir, sandboxBinary)
+		}
+		clientBasedir = path.Join(sandboxBinary, request.ClientBasedir)
+		if !common.DirExists(clientBasedir) {
+			return options, fmt.Errorf(globals.ErrDirectoryNotFound, clientBasedir)
+		}
+	}
+	if request.PortAsServerId && request.ServerId != 0 {
+		return options, fmt.Errorf("PortAsServerId and ServerId should not be provided together")
+	}
+	if request.DisableMysqlX && request.EnableMysqlX {
+		return options, fmt.Errorf("EnableMysqlX and DisableMysqlX cannot be used together")
+	}
+	expiresAt, err := common.ExpirationTime("", request.ExpiresAt, time.Now())
+	if err != nil {
+		return options, err
+	}
+	port := request.Port
+	if port == 0 {
+		port = request.UserPort
+	}
+	useRoles := request.DefaultRole != "" || request.CustomRoleName != "" || request.CustomRolePrivileges != "" ||
+		request.CustomRoleTarget != "" || request.CustomRoleExtra != "" || request.TaskUser != "" || request.TaskUserRole != ""
+
+	options = ReplicationOptions{
+		DeployOptions: DeployOptions{
+			Version:       request.Version,
+			SandboxBinary: sandboxBinary,
+			SandboxHome:   sandboxHome,
+			DirName:       request.DirName,
+			Flavor:        request.Flavor,
+			Port:          port,
+			BasePort:      request.BasePort,
+			DbUser:        request.DbUser,
+			DbPassword:    request.DbPassword,
+			RplUser:       request.RplUser,
+			RplPassword:   request.RplPassword,
+			MyCnfOptions:  request.MyCnfOptions,
+			InitOptions:   request.InitOptions,
+			PreGrantsSql:  request.PreGrantsSql,
+			PostGrantsSql: request.PostGrantsSql,
+			Master:        request.Master,
+			Gtid:          request.Gtid,
+			ReplCrashSafe: request.ReplCrashSafe,
+			SkipStart:     request.SkipStart,
+			Force:         request.Force,
+			Customize: func(sd *sandbox.SandboxDef) error {
+				if useRoles {
+					isRoleEnabled, err := common.HasCapability(sd.Flavor, common.Roles, sd.Version)
+					if err != nil {
+						return err
+					}
+					if !isRoleEnabled {
+						return fmt.Errorf("options about roles requires version 8.0+")
+					}
+				}
+				sd.ClientBasedir = clientBasedir
+				sd.CustomMysqld = request.CustomMysqld
+				sd.ServerId = request.ServerId
+				sd.BaseServerId = request.BaseServerId
+				sd.DefaultRole = common.CoalesceString(request.DefaultRole, sd.DefaultRole)
+				sd.CustomRoleName = common.CoalesceString(request.CustomRoleName, sd.CustomRoleName)
+				sd.CustomRolePrivileges = common.CoalesceString(request.CustomRolePrivileges, sd.CustomRolePrivileges)
+				sd.CustomRoleTarget = common.CoalesceString(request.CustomRoleTarget, sd.CustomRoleTarget)
+				sd.CustomRoleExtra = common.CoalesceString(request.CustomRoleExtra, sd.CustomRoleExtra)
+				sd.TaskUser = request.TaskUser
+				sd.TaskUserRole = request.TaskUserRole
+				sd.RemoteAccess = common.CoalesceString(request.RemoteAccess, sd.RemoteAccess)
+				sd.BindAddress = common.CoalesceString(request.BindAddress, sd.BindAddress)
+				sd.ChangeMasterOptions = request.ChangeMasterOptions
+				sd.LoadGrants = !request.SkipLoadGrants && !request.SkipStart
+				sd.SkipReportHost = request.SkipReportHost
+				sd.SkipReportPort = request.SkipReportPort
+				sd.SlavesReadOnly = request.SlavesReadOnly
+				sd.SlavesSuperReadOnly = request.SlavesSuperReadOnly
+				sd.DisableMysqlX = request.DisableMysqlX
+				sd.EnableMysqlX = request.EnableMysqlX
+				sd.EnableAdminAddress = request.EnableAdminAddress
+				sd.SocketInDatadir = request.SocketInDatadir
+				sd.PortAsServerId = request.PortAsServerId
+				sd.FlavorInPrompt = request.FlavorInPrompt
+				sd.NativeAuthPlugin = request.NativeAuthPlugin
+				sd.KeepUuid = request.KeepUuid
+				sd.UseDatadirCache = request.UseDatadirCache
+				sd.ExposeDdTables = request.ExposeDdTables
+				sd.InitGeneralLog = request.InitGeneralLog
+				sd.EnableGeneralLog = request.EnableGeneralLog
+				sd.RunConcurrently = request.RunConcurrently
+				sd.ExpiresAt = expiresAt
+				return nil
+			},
+		},
+		Topology:      request.Topology,
+		Nodes:         request.Nodes,
+		SemiSync:      request.SemiSync,
+		SinglePrimary: request.SinglePrimary,
+		MasterList:    request.MasterList,
+		SlaveList:     request.SlaveList,
+		ChainSpec:     request.ChainSpec,
+		NodeVersions:  request.NodeVersions,
+	}
+	return options, nil
+}
+
+// apiServer executes the API requests. The operations that change sandboxes
+// or binaries run one at a time under the catalog lock
+type apiServer struct {
+	options ServeOptions
+}
+
+func writeJson(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJson(w, status, ApiError{Error: err.Error()})
+}
+
+// findSandbox returns the directory and the catalog entry of a sandbox in the server sandbox home
+func (s *apiServer) findSandbox(name string) (string, defaults.SandboxItem, error) {
+	catalog, err := defaults.ReadCatalog()
+	if err != nil {
+		return "", defaults.SandboxItem{}, err
+	}
+	sandboxDir := path.Join(s.options.SandboxHome, name)
+	item, found := catalog[sandboxDir]
+	if !found {
+		return "", item, fmt.Errorf("sandbox '%s' not found in %s", name, s.options.SandboxHome)
+	}
+	return sandboxDir, item, nil
+}
+
+func (s *apiServer) listSandboxes(w http.ResponseWriter) {
+	catalog, err := defaults.ReadCatalog()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	records := CatalogRecords(catalog)
+	if records == nil {
+		records = []SandboxRecord{}
+	}
+	writeJson(w, http.StatusOK, records)
+}
+
+func (s *apiServer) deploySandbox(w http.ResponseWriter, r *http.Request) {
+	var request DeployRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error decoding deployment request: %s", err))
+		return
+	}
+	options, err := request.DeployOptions(s.options.SandboxHome, s.options.SandboxBinary)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var sandboxDir string
+	err = defaults.WithCatalogLock("deploy", func() error {
+		var err error
+		switch request.Type {
+		case globals.SbTypeSingle:
+			sandboxDir, err = DeploySingle(options.DeployOptions)
+		case globals.SbTypeMultiple:
+			sandboxDir, err = DeployMultiple(options.DeployOptions, options.Nodes)
+		default:
+			sandboxDir, err = DeployReplication(options)
+		}
+		return err
+	})
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, fmt.Errorf("deployment failed: %s", err))
+		return
+	}
+	catalog, err := defaults.ReadCatalog()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(w, http.StatusCreated, DeployResponse{
+		Sandbox: SandboxRecord{Name: common.BaseName(sandboxDir), SandboxItem: catalog[sandboxDir]},
+	})
+}
+
+func (s *apiServer) deleteSandbox(w http.ResponseWriter, name string) {
+	status := http.StatusServiceUnavailable
+	err := defaults.WithCatalogLock("delete", func() error {
+		sandboxDir, _, err := s.findSandbox(name)
+		if err != nil {
+			status = http.StatusNotFound
+			return err
+		}
+		status = http.StatusUnprocessableEntity
+		return DeleteSandbox(sandboxDir, false)
+	})
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	writeJson(w, http.StatusOK, OperationResponse{Sandbox: name, Operation: "delete"})
+}
+
+func (s *apiServer) sandboxStatus(w http.ResponseWriter, name string) {
+	sandboxDir, item, err := s.findSandbox(name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJson(w, http.StatusOK, SandboxHealthCheck(sandboxDir, item))
+}
+
+func (s *apiServer) runSandboxOperation(w http.ResponseWriter, name, operation string) {
+	status := http.StatusServiceUnavailable
+	err := defaults.WithCatalogLock(operation, func() error {
+		sandboxDir, _, err := s.findSandbox(name)
+		if err != nil {
+			status = http.StatusNotFound
+			return err
+		}
+		status = http.StatusUnprocessableEntity
+		if operation == globals.ScriptStart {
+			return StartSandbox(sandboxDir)
+		}
+		return StopSandbox(sandboxDir)
+	})
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	writeJson(w, http.StatusOK, OperationResponse{Sandbox: name, Operation: operation})
+}
+
+func (s *apiServer) listVersions(w http.ResponseWriter, r *http.Request) {
+	versions, err := ListVersions(VersionOptions{
+		SandboxBinary: s.options.SandboxBinary,
+		Flavor:        r.URL.Query().Get(globals.FlavorLabel),
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if versions == nil {
+		versions = []common.VersionInfo{}
+	}
+	writeJson(w, http.StatusOK, versions)
+}
+
+// download gets a tarball, using a body made of the fields of DownloadsOptions
+func (s *apiServer) download(w http.ResponseWriter, r *http.Request) {
+	var options DownloadsOptions
+	err := json.NewDecoder(r.Body).Decode(&options)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error decoding download request: %s", err))
+		return
+	}
+	if options.TarballName == "" && options.TarballUrl == "" && options.Version == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("a download request needs one of TarballName, TarballUrl, or Version"))
+		return
+	}
+	options.SandboxBinary = s.options.SandboxBinary
+	options.Quiet = true
+	err = defaults.WithCatalogLock("download", func() error {
+		return GetRemoteTarball(options)
+	})
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeJson(w, http.StatusOK, OperationResponse{Operation: "download"})
+}
+
+// ServeHTTP routes the requests:
+//
+//	GET    /api/v1/sandboxes              list of catalogued sandboxes
+//	POST   /api/v1/sandboxes              deploy (body: DeployRequest)
+//	GET    /api/v1/sandboxes/NAME         live status of a sandbox
+//	DELETE /api/v1/sandboxes/NAME         delete a sandbox
+//	POST   /api/v1/sandboxes/NAME/start   start a sandbox
+//	POST   /api/v1/sandboxes/NAME/stop    stop a sandbox
+//	GET    /api/v1/versions[?flavor=F]    list of available versions
+//	POST   /api/v1/downloads              download a tarball (body: DownloadsOptions)
+func (s *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, ApiPrefix) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("path %s not found", r.URL.Path))
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, ApiPrefix), "/"), "/")
+	methodNotAllowed := func() {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed for %s", r.Method, r.URL.Path))
+	}
+	switch {
+	case len(parts) == 1 && parts[0] == "sandboxes":
+		switch r.Method {
+		case http.MethodGet:
+			s.listSandboxes(w)
+		case http.MethodPost:
+			s.deploySandbox(w, r)
+		default:
+			methodNotAllowed()
+		}
+	case len(parts) == 2 && parts[0] == "sandboxes":
+		switch r.Method {
+		case http.MethodGet:
+			s.sandboxStatus(w, parts[1])
+		case http.MethodDelete:
+			s.deleteSandbox(w, parts[1])
+		default:
+			methodNotAllowed()
+		}
+	case len(parts) == 3 && parts[0] == "sandboxes" && (parts[2] == globals.ScriptStart || parts[2] == globals.ScriptStop):
+		if r.Method != http.MethodPost {
+			methodNotAllowed()
+			return
+		}
+		s.runSandboxOperation(w, parts[1], parts[2])
+	case len(parts) == 1 && parts[0] == "versions":
+		if r.Method != http.MethodGet {
+			methodNotAllowed()
+			return
+		}
+		s.listVersions(w, r)
+	case len(parts) == 1 && parts[0] == "downloads":
+		if r.Method != http.MethodPost {
+			methodNotAllowed()
+			return
+		}
+		s.download(w, r)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("path %s not found", r.URL.Path))
+	}
+}
+
+// NewApiHandler returns the handler of the dbdeployer API
+func NewApiHandler(options ServeOptions) http.Handler {
+	return &apiServer{options: options}
+}
+
+// Serve runs the API server until it fails
+func Serve(options ServeOptions) error {
+	if options.Listen == "" {
+		return fmt.Errorf("no listen address was given")
+	}
+	server := &http.Server{
+		Addr:              options.Listen,
+		Handler:           NewApiHandler(options),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	fmt.Printf("dbdeployer API listening on http://%s%s\n", options.Listen, ApiPrefix)
+	return server.ListenAndServe()
+}
@@ -0,0 +1,223 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/compare"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/sandbox"
+)
+
+func TestDeployRequestOptions(t *testing.T) {
+	var request DeployRequest
+	err := json.Unmarshal([]byte(`{
+		"Type": "replication",
+		"Version": "8.0.36",
+		"DirName": "repl1",
+		"Topology": "group",
+		"Nodes": 3,
+		"SinglePrimary": true,
+		"UserPort": 9000,
+		"MyCnfOptions": ["max_connections=200", "log_bin"],
+		"DbUser": "app",
+		"SlavesReadOnly": true,
+		"SandboxDir": "/somewhere/else"
+	}`), &request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options, err := request.DeployOptions("/sandboxes", "/opt/mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare.OkEqualString("version", options.Version, "8.0.36", t)
+	compare.OkEqualString("sandbox home", options.SandboxHome, "/sandboxes", t)
+	compare.OkEqualString("sandbox binary", options.SandboxBinary, "/opt/mysql", t)
+	compare.OkEqualString("directory", options.DirName, "repl1", t)
+	compare.OkEqualString("topology", options.Topology, "group", t)
+	compare.OkEqualInt("nodes", options.Nodes, 3, t)
+	compare.OkEqualBool("single primary", options.SinglePrimary, true, t)
+	compare.OkEqualInt("port", options.Port, 9000, t)
+	compare.OkEqualString("db user", options.DbUser, "app", t)
+	compare.OkEqualStringSlices(t, options.MyCnfOptions, []string{"max_connections=200", "log_bin"})
+
+	// The other fields of the request are copied into the sandbox definition,
+	// while the server paths are not changed
+	sd := sandbox.SandboxDef{SandboxDir: "/sandboxes", RemoteAccess: "127.%"}
+	err = options.Customize(&sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare.OkEqualBool("slaves read only", sd.SlavesReadOnly, true, t)
+	compare.OkEqualString("definition sandbox dir", sd.SandboxDir, "/sandboxes", t)
+	compare.OkEqualString("definition remote access", sd.RemoteAccess, "127.%", t)
+
+	_, err = DeployRequest{Type: "single"}.DeployOptions("/sandboxes", "/opt/mysql")
+	compare.OkIsNotNil("missing version error", err, t)
+	_, err = DeployRequest{Type: "cluster", SandboxDef: sandbox.SandboxDef{Version: "8.0.36"}}.DeployOptions("/sandboxes", "/opt/mysql")
+	compare.OkIsNotNil("unknown type error", err, t)
+	for _, dirName := range []string{"../escape", "..", "a/b", "/tmp/msb", "msb/", "."} {
+		_, err = DeployRequest{Type: "single", SandboxDef: sandbox.SandboxDef{Version: "8.0.36", DirName: dirName}}.DeployOptions("/sandboxes", "/opt/mysql")
+		compare.OkIsNotNil("invalid directory name error for '"+dirName+"'", err, t)
+	}
+	var rejected = map[string]sandbox.SandboxDef{
+		"version path":     {Version: "/tmp/8.0.36"},
+		"my.cnf file":      {Version: "8.0.36", MyCnfFile: "/etc/passwd"},
+		"pre-grants file":  {Version: "8.0.36", PreGrantsSqlFile: "/tmp/pre.sql"},
+		"post-grants file": {Version: "8.0.36", PostGrantsSqlFile: "/tmp/post.sql"},
+		"history dir":      {Version: "8.0.36", HistoryDir: "/tmp"},
+		"custom mysqld":    {Version: "8.0.36", CustomMysqld: "../../../bin/sh"},
+		"client basedir":   {Version: "8.0.36", ClientBasedir: "../8.0.36"},
+		"expiration":       {Version: "8.0.36", ExpiresAt: "yesterday"},
+	}
+	for label, sd := range rejected {
+		_, err = DeployRequest{Type: "single", SandboxDef: sd}.DeployOptions("/sandboxes", "/opt/mysql")
+		compare.OkIsNotNil(label+" error", err, t)
+	}
+}
+
+func TestApiDeploy(t *testing.T) {
+	useMockEnvironment(t)
+	err := sandbox.CreateMockVersion("8.0.36")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sandboxHome := defaults.Defaults().SandboxHome
+	server := httptest.NewServer(NewApiHandler(ServeOptions{
+		SandboxHome:   sandboxHome,
+		SandboxBinary: defaults.Defaults().SandboxBinary,
+	}))
+	defer server.Close()
+
+	response, err := http.Post(server.URL+"/api/v1/sandboxes", "application/json",
+		strings.NewReader(`{"Type":"single","Version":"8.0.36","DirName":"msb_api_deploy","Gtid":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare.OkEqualInt("deploy status", response.StatusCode, http.StatusCreated, t)
+	var deployed DeployResponse
+	err = json.NewDecoder(response.Body).Decode(&deployed)
+	_ = response.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sandboxDir := path.Join(sandboxHome, "msb_api_deploy")
+	compare.OkEqualString("deployed name", deployed.Sandbox.Name, "msb_api_deploy", t)
+	compare.OkEqualString("deployed destination", deployed.Sandbox.Destination, sandboxDir, t)
+	compare.OkEqualBool("sandbox directory exists", common.DirExists(sandboxDir), true, t)
+
+	request, err := http.NewRequest(http.MethodDelete, server.URL+"/api/v1/sandboxes/msb_api_deploy", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+	compare.OkEqualInt("delete status", response.StatusCode, http.StatusOK, t)
+	compare.OkEqualBool("sandbox directory removed", common.DirExists(sandboxDir), false, t)
+
+	// The catalog lock is released when the operations end
+	compare.OkEqualBool("catalog lock removed", common.FileExists(defaults.SandboxRegistryLock), false, t)
+}
+
+func TestApiHandler(t *testing.T) {
+	useMockEnvironment(t)
+	sandboxHome := t.TempDir()
+	sandboxDir := path.Join(sandboxHome, "msb_api_test")
+	err := defaults.UpdateCatalog(sandboxDir, defaults.SandboxItem{
+		SBType:      "single",
+		Version:     "8.0.36",
+		Destination: sandboxDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(NewApiHandler(ServeOptions{SandboxHome: sandboxHome, SandboxBinary: t.TempDir()}))
+	defer server.Close()
+
+	type apiTest struct {
+		method string
+		path   string
+		body   string
+		status int
+	}
+	var tests = []apiTest{
+		{http.MethodGet, "/api/v1/sandboxes", "", http.StatusOK},
+		{http.MethodPut, "/api/v1/sandboxes", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/v1/sandboxes", "{not json", http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/sandboxes", `{"Type":"single"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/sandboxes", `{"Type":"single","Version":"8.0.36","DirName":"../escape"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/sandboxes", `{"Type":"single","Version":"8.0.36","MyCnfFile":"/etc/passwd"}`, http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/sandboxes/no_such_sandbox", "", http.StatusNotFound},
+		{http.MethodDelete, "/api/v1/sandboxes/no_such_sandbox", "", http.StatusNotFound},
+		{http.MethodPost, "/api/v1/sandboxes/no_such_sandbox/start", "", http.StatusNotFound},
+		{http.MethodGet, "/api/v1/sandboxes/msb_api_test/stop", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/v1/downloads", `{}`, http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/unknown", "", http.StatusNotFound},
+		{http.MethodGet, "/unknown", "", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		request, err := http.NewRequest(test.method, server.URL+test.path, strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		label := test.method + " " + test.path
+		compare.OkEqualInt(label+" status", response.StatusCode, test.status, t)
+		compare.OkEqualString(label+" content type", response.Header.Get("Content-Type"), "application/json", t)
+		if test.status != http.StatusOK {
+			var apiError ApiError
+			err = json.NewDecoder(response.Body).Decode(&apiError)
+			compare.OkIsNil(label+" error decoding", err, t)
+			compare.OkNotEmptyString(label+" error message", apiError.Error, t)
+		}
+		_ = response.Body.Close()
+	}
+
+	response, err := http.Get(server.URL + "/api/v1/sandboxes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var records []SandboxRecord
+	err = json.NewDecoder(response.Body).Decode(&records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, record := range records {
+		if record.Destination == sandboxDir {
+			found = true
+			compare.OkEqualString("sandbox name", record.Name, "msb_api_test", t)
+			compare.OkEqualString("sandbox version", record.Version, "8.0.36", t)
+		}
+	}
+	compare.OkEqualBool("sandbox found", found, true, t)
+}
@@ -0,0 +1,392 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/unpack"
+)
+
+const (
+	SnapshotDirName      = "snapshots"
+	snapshotDescription  = "snapshot.json"
+	SnapshotMethodStop   = "stop"
+	SnapshotMethodClone  = "clone"
+	snapshotRestoreLabel = "restore"
+)
+
+// A label is used as a directory name: it can't start with a dot, which excludes "." and ".."
+var validSnapshotLabel = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]*$`)
+
+// checkSnapshotLabel makes sure that a label can be used as a directory name inside the snapshots directory
+func checkSnapshotLabel(label string) error {
+	if !validSnapshotLabel.MatchString(label) {
+		return fmt.Errorf("invalid snapshot label '%s'. Use only letters, digits, '.', '_', and '-', "+
+			"and don't start with '.'", label)
+	}
+	return nil
+}
+
+// SnapshotOptions control the creation of a snapshot
+type SnapshotOptions struct {
+	Label string
+	// When NoClone is set, the sandbox is stopped even if the clone plugin is available
+	NoClone bool
+}
+
+// sandboxDataNodes returns the directories containing a data directory in a sandbox.
+// For a single sandbox, the list contains only an empty string (the sandbox itself)
+func sandboxDataNodes(sandboxDir string) ([]string, error) {
+	if common.DirExists(path.Join(sandboxDir, globals.DataDirName)) {
+		return []string{""}, nil
+	}
+	entries, err := os.ReadDir(sandboxDir)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []string
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == SnapshotDirName {
+			continue
+		}
+		nodeDir := path.Join(sandboxDir, entry.Name())
+		if common.DirExists(path.Join(nodeDir, globals.DataDirName)) && common.ExecExists(path.Join(nodeDir, globals.ScriptStart)) {
+			nodes = append(nodes, entry.Name())
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no data directories found in %s", sandboxDir)
+	}
+	sort.Strings(nodes)
+	return nodes, nil
+}
+
+func snapshotTarball(snapshotDir, node string) string {
+	if node == "" {
+		return path.Join(snapshotDir, globals.DataDirName+globals.TarGzExt)
+	}
+	return path.Join(snapshotDir, node+"-"+globals.DataDirName+globals.TarGzExt)
+}
+
+// runningNodes returns the nodes of the sandbox where the database server is running
+func runningNodes(sandboxDir string, nodes []string) []string {
+	var running []string
+	for _, node := range nodes {
+		out, err := common.RunCmdCtrl(path.Join(sandboxDir, node, globals.ScriptStatus), true)
+		if err == nil && strings.HasSuffix(strings.TrimSpace(out), " on") {
+			running = append(running, node)
+		}
+	}
+	return running
+}
+
+// runSandboxScript runs a script in the sandbox, using the "_all" variant for multiple sandboxes
+func runSandboxScript(sandboxDir string, nodes []string, script string) error {
+	scriptName := path.Join(sandboxDir, script)
+	if len(nodes) > 1 || nodes[0] != "" {
+		scriptName += "_all"
+	}
+	_, err := common.RunCmdCtrl(scriptName, true)
+	if err != nil {
+		return fmt.Errorf("error running %s: %s", scriptName, err)
+	}
+	return nil
+}
+
+func readSnapshotDescription(snapshotDir string) (defaults.SnapshotItem, error) {
+	var snapshot defaults.SnapshotItem
+	blob, err := common.SlurpAsBytes(path.Join(snapshotDir, snapshotDescription))
+	if err != nil {
+		return snapshot, err
+	}
+	err = json.Unmarshal(blob, &snapshot)
+	return snapshot, err
+}
+
+func cloneNodeData(nodeDir, destination string) error {
+	useScript := path.Join(nodeDir, globals.ScriptUse)
+	plugins, err := common.RunCmdCtrlWithArgs(useScript, []string{"-BN", "-e", "show plugins"}, true)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(plugins, "clone") {
+		_, err = common.RunCmdCtrlWithArgs(useScript, []string{"-u", "root", "-e", "install plugin clone soname 'mysql_clone.so'"}, true)
+		if err != nil {
+			return fmt.Errorf("error installing clone plugin in %s: %s", nodeDir, err)
+		}
+	}
+	_, err = common.RunCmdCtrlWithArgs(useScript,
+		[]string{"-u", "root", "-e", fmt.Sprintf("CLONE LOCAL DATA DIRECTORY = '%s'", destination)}, true)
+	if err != nil {
+		return fmt.Errorf("error cloning data directory in %s: %s", nodeDir, err)
+	}
+	return nil
+}
+
+// CreateSnapshot archives the data directories of all the nodes in a sandbox.
+// If all the nodes are running and support the clone plugin, the data is cloned
+// while the servers are running. Otherwise, the sandbox is stopped during the copy
+// and restarted afterwards.
+func CreateSnapshot(sandboxDir string, options SnapshotOptions) (snapshot defaults.SnapshotItem, err error) {
+	sbDesc, err := common.ReadSandboxDescription(sandboxDir)
+	if err != nil {
+		return snapshot, err
+	}
+	label := options.Label
+	if label == "" {
+		label = time.Now().Format("20060102-150405")
+	}
+	err = checkSnapshotLabel(label)
+	if err != nil {
+		return snapshot, err
+	}
+	snapshotDir := path.Join(sandboxDir, SnapshotDirName, label)
+	if common.DirExists(snapshotDir) {
+		return snapshot, fmt.Errorf("snapshot '%s' already exists in %s", label, sandboxDir)
+	}
+	nodes, err := sandboxDataNodes(sandboxDir)
+	if err != nil {
+		return snapshot, err
+	}
+	running := runningNodes(sandboxDir, nodes)
+
+	method := SnapshotMethodStop
+	canClone, err := common.HasCapability(sbDesc.Flavor, common.CloneServer, sbDesc.Version)
+	if err != nil {
+		return snapshot, err
+	}
+	if canClone && !options.NoClone && len(running) == len(nodes) {
+		method = SnapshotMethodClone
+	}
+
+	err = os.MkdirAll(snapshotDir, globals.PublicDirectoryAttr)
+	if err != nil {
+		return snapshot, err
+	}
+	// On failure, no partial snapshot is left behind
+	success := false
+	defer func() {
+		if !success {
+			_ = os.RemoveAll(snapshotDir)
+		}
+	}()
+
+	if method == SnapshotMethodStop && len(running) > 0 {
+		err = runSandboxScript(sandboxDir, nodes, globals.ScriptStop)
+		if err != nil {
+			return snapshot, err
+		}
+		defer func() {
+			restartErr := runSandboxScript(sandboxDir, nodes, globals.ScriptStart)
+			if restartErr != nil && err == nil {
+				err = restartErr
+			}
+		}()
+	}
+	for _, node := range nodes {
+		nodeDir := path.Join(sandboxDir, node)
+		dataDir := path.Join(nodeDir, globals.DataDirName)
+		if method == SnapshotMethodClone {
+			stagingDir := path.Join(snapshotDir, "clone-"+node)
+			err = os.Mkdir(stagingDir, globals.PublicDirectoryAttr)
+			if err != nil {
+				return snapshot, err
+			}
+			dataDir = path.Join(stagingDir, globals.DataDirName)
+			err = cloneNodeData(nodeDir, dataDir)
+			if err != nil {
+				return snapshot, err
+			}
+		}
+		err = unpack.PackTarGz(dataDir, snapshotTarball(snapshotDir, node))
+		if err != nil {
+			return snapshot, fmt.Errorf("error archiving %s: %s", dataDir, err)
+		}
+		if method == SnapshotMethodClone {
+			err = os.RemoveAll(path.Dir(dataDir))
+			if err != nil {
+				return snapshot, err
+			}
+		}
+	}
+	snapshot = defaults.SnapshotItem{
+		Label:     label,
+		Timestamp: time.Now().Format(time.UnixDate),
+		Method:    method,
+		Directory: snapshotDir,
+		Nodes:     nodes,
+	}
+	blob, err := json.MarshalIndent(snapshot, " ", "\t")
+	if err != nil {
+		return snapshot, err
+	}
+	err = common.WriteString(string(blob), path.Join(snapshotDir, snapshotDescription))
+	if err != nil {
+		return snapshot, err
+	}
+	err = defaults.AddSnapshotToCatalog(sandboxDir, snapshot)
+	if err != nil {
+		return snapshot, err
+	}
+	success = true
+	return snapshot, nil
+}
+
+// ListSnapshots returns the snapshots of a sandbox, sorted by label
+func ListSnapshots(sandboxDir string) ([]defaults.SnapshotItem, error) {
+	var snapshots []defaults.SnapshotItem
+	snapshotsDir := path.Join(sandboxDir, SnapshotDirName)
+	if !common.DirExists(snapshotsDir) {
+		return snapshots, nil
+	}
+	entries, err := os.ReadDir(snapshotsDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		snapshot, err := readSnapshotDescription(path.Join(snapshotsDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Label < snapshots[j].Label })
+	return snapshots, nil
+}
+
+// RestoreSnapshot replaces the data directories of a sandbox with the ones from a snapshot.
+// All the archives are extracted before any data directory is replaced. If replacing
+// one of them fails, the ones already replaced are put back.
+func RestoreSnapshot(sandboxDir, label string) (err error) {
+	err = checkSnapshotLabel(label)
+	if err != nil {
+		return err
+	}
+	snapshotDir := path.Join(sandboxDir, SnapshotDirName, label)
+	snapshot, err := readSnapshotDescription(snapshotDir)
+	if err != nil {
+		return fmt.Errorf("snapshot '%s' not found in %s", label, sandboxDir)
+	}
+	nodes, err := sandboxDataNodes(sandboxDir)
+	if err != nil {
+		return err
+	}
+	if strings.Join(nodes, ",") != strings.Join(snapshot.Nodes, ",") {
+		return fmt.Errorf("the nodes in snapshot '%s' (%v) don't match the sandbox nodes (%v)", label, snapshot.Nodes, nodes)
+	}
+	for _, node := range nodes {
+		if !common.FileExists(snapshotTarball(snapshotDir, node)) {
+			return fmt.Errorf(globals.ErrFileNotFound, snapshotTarball(snapshotDir, node))
+		}
+	}
+
+	running := runningNodes(sandboxDir, nodes)
+	if len(running) > 0 {
+		err = runSandboxScript(sandboxDir, nodes, globals.ScriptStop)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			restartErr := runSandboxScript(sandboxDir, nodes, globals.ScriptStart)
+			if restartErr != nil && err == nil {
+				err = restartErr
+			}
+		}()
+	}
+
+	// UnpackTar changes the current directory
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Chdir(currentDir) }()
+
+	// Phase 1: extract all archives next to the data directories they will replace
+	var stagingDirs []string
+	defer func() {
+		for _, dir := range stagingDirs {
+			_ = os.RemoveAll(dir)
+		}
+	}()
+	for _, node := range nodes {
+		stagingDir := path.Join(sandboxDir, node, "."+snapshotRestoreLabel+"-"+label)
+		_ = os.RemoveAll(stagingDir)
+		err = os.Mkdir(stagingDir, globals.PublicDirectoryAttr)
+		if err != nil {
+			return err
+		}
+		stagingDirs = append(stagingDirs, stagingDir)
+		err = unpack.UnpackTar(snapshotTarball(snapshotDir, node), stagingDir, unpack.SILENT)
+		if err != nil {
+			return fmt.Errorf("error extracting snapshot for node '%s': %s", node, err)
+		}
+	}
+
+	// Phase 2: swap the data directories
+	var swapped []string
+	for i, node := range nodes {
+		dataDir := path.Join(sandboxDir, node, globals.DataDirName)
+		oldDataDir := path.Join(stagingDirs[i], "old-"+globals.DataDirName)
+		err = os.Rename(dataDir, oldDataDir)
+		if err == nil {
+			err = os.Rename(path.Join(stagingDirs[i], globals.DataDirName), dataDir)
+			if err != nil {
+				_ = os.Rename(oldDataDir, dataDir)
+			}
+		}
+		if err != nil {
+			for j := range swapped {
+				swappedDataDir := path.Join(sandboxDir, swapped[j], globals.DataDirName)
+				_ = os.Rename(swappedDataDir, path.Join(stagingDirs[j], globals.DataDirName))
+				_ = os.Rename(path.Join(stagingDirs[j], "old-"+globals.DataDirName), swappedDataDir)
+			}
+			return fmt.Errorf("error replacing data directory for node '%s': %s", node, err)
+		}
+		swapped = append(swapped, node)
+	}
+	return nil
+}
+
+// DeleteSnapshot removes a snapshot from a sandbox and from the catalog
+func DeleteSnapshot(sandboxDir, label string) error {
+	err := checkSnapshotLabel(label)
+	if err != nil {
+		return err
+	}
+	snapshotDir := path.Join(sandboxDir, SnapshotDirName, label)
+	if !common.DirExists(snapshotDir) {
+		return fmt.Errorf("snapshot '%s' not found in %s", label, sandboxDir)
+	}
+	err = os.RemoveAll(snapshotDir)
+	if err != nil {
+		return err
+	}
+	return defaults.DeleteSnapshotFromCatalog(sandboxDir, label)
+}
@@ -0,0 +1,149 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"path"
+	"testing"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/compare"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+)
+
+// makeSnapshotSandbox creates a sandbox with the minimum components needed for snapshot operations
+func makeSnapshotSandbox(t *testing.T, nodes []string) string {
+	return makeFakeSandbox(t, path.Join(t.TempDir(), "fake_msb"), fakeSandbox{
+		nodes: nodes,
+		scripts: map[string]string{
+			globals.ScriptStart:  "#!/bin/sh\necho \"$(basename $(dirname $0)) off\"\n",
+			globals.ScriptStatus: "#!/bin/sh\necho \"$(basename $(dirname $0)) off\"\n",
+		},
+		dataFiles: map[string]string{"test/t1.ibd": "original {node}"},
+		description: common.SandboxDescription{
+			SBType:  globals.SbTypeMultiple,
+			Version: "5.7.44",
+			Flavor:  common.MySQLFlavor,
+			Nodes:   len(nodes),
+		},
+		catalog: &defaults.SandboxItem{},
+	})
+}
+
+func TestSnapshots(t *testing.T) {
+	useMockEnvironment(t)
+	for _, nodes := range [][]string{{""}, {"node1", "node2", "node3"}} {
+		sandboxDir := makeSnapshotSandbox(t, nodes)
+
+		snapshot, err := CreateSnapshot(sandboxDir, SnapshotOptions{Label: "before-test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		compare.OkEqualString("snapshot method", snapshot.Method, SnapshotMethodStop, t)
+		compare.OkEqualStringSlices(t, snapshot.Nodes, nodes)
+
+		_, err = CreateSnapshot(sandboxDir, SnapshotOptions{Label: "before-test"})
+		compare.OkIsNotNil("duplicate snapshot error", err, t)
+		_, err = CreateSnapshot(sandboxDir, SnapshotOptions{Label: "../wrong"})
+		compare.OkIsNotNil("invalid label error", err, t)
+
+		snapshots, err := ListSnapshots(sandboxDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compare.OkEqualInt("snapshots after creation", len(snapshots), 1, t)
+		compare.OkEqualString("snapshot label", snapshots[0].Label, "before-test", t)
+
+		catalog, err := defaults.ReadCatalog()
+		if err != nil {
+			t.Fatal(err)
+		}
+		compare.OkEqualInt("snapshots in catalog", len(catalog[sandboxDir].Snapshots), 1, t)
+
+		// Wreck the data, then restore it
+		for _, node := range nodes {
+			dataFile := path.Join(sandboxDir, node, globals.DataDirName, "test", "t1.ibd")
+			err = common.WriteString("damaged", dataFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = common.WriteString("extra", path.Join(sandboxDir, node, globals.DataDirName, "test", "t2.ibd"))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = RestoreSnapshot(sandboxDir, "before-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, node := range nodes {
+			dataDir := path.Join(sandboxDir, node, globals.DataDirName)
+			contents, err := common.SlurpAsString(path.Join(dataDir, "test", "t1.ibd"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			compare.OkEqualString("restored data", contents, "original "+node, t)
+			compare.OkEqualBool("extra file removed", common.FileExists(path.Join(dataDir, "test", "t2.ibd")), false, t)
+		}
+
+		err = RestoreSnapshot(sandboxDir, "no-such-snapshot")
+		compare.OkIsNotNil("unknown snapshot restore error", err, t)
+		err = DeleteSnapshot(sandboxDir, "before-test")
+		compare.OkIsNil("snapshot deletion error", err, t)
+		err = DeleteSnapshot(sandboxDir, "before-test")
+		compare.OkIsNotNil("second deletion error", err, t)
+		snapshots, err = ListSnapshots(sandboxDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compare.OkEqualInt("snapshots after deletion", len(snapshots), 0, t)
+	}
+}
+
+func TestSnapshotLabels(t *testing.T) {
+	useMockEnvironment(t)
+	sandboxDir := makeSnapshotSandbox(t, []string{""})
+	_, err := CreateSnapshot(sandboxDir, SnapshotOptions{Label: "before.test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, label := range []string{"", ".", "..", ".hidden", "../wrong", "a/b"} {
+		// An empty label in CreateSnapshot stands for a generated one
+		if label != "" {
+			_, err = CreateSnapshot(sandboxDir, SnapshotOptions{Label: label})
+			compare.OkIsNotNil("create with label '"+label+"' error", err, t)
+		}
+		err = RestoreSnapshot(sandboxDir, label)
+		compare.OkIsNotNil("restore with label '"+label+"' error", err, t)
+		err = DeleteSnapshot(sandboxDir, label)
+		compare.OkIsNotNil("delete with label '"+label+"' error", err, t)
+	}
+
+	// Nothing was removed from the sandbox
+	contents, err := common.SlurpAsString(path.Join(sandboxDir, globals.DataDirName, "test", "t1.ibd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare.OkEqualString("sandbox data", contents, "original ", t)
+	compare.OkEqualBool("start script", common.ExecExists(path.Join(sandboxDir, globals.ScriptStart)), true, t)
+	snapshots, err := ListSnapshots(sandboxDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare.OkEqualInt("snapshots", len(snapshots), 1, t)
+}
@@ -20,22 +20,29 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
 
 	"github.com/datacharmer/dbdeployer/common"
 	"github.com/datacharmer/dbdeployer/globals"
 	"github.com/datacharmer/dbdeployer/importing"
 )
 
-type sandboxConnection struct {
+const sandboxConnectionTimeout = 5 * time.Second
+
+// SandboxConnection contains the credentials to connect to a sandbox server
+type SandboxConnection struct {
 	Host     string `json:"master_host"`
 	Port     int    `json:"master_port"`
 	User     string `json:"master_user"`
 	Password string `json:"master_password"`
 }
 
-// getSandboxConnection finds the connection credentials in a given sandbox directory
-func getSandboxConnection(sandboxPath string, asSuperUser bool) (sandboxConnection, error) {
-	var sc sandboxConnection
+// GetSandboxConnection finds the connection credentials in a given sandbox directory.
+// The super user credentials are the ones of the database user; the others are the ones of the replication user
+func GetSandboxConnection(sandboxPath string, asSuperUser bool) (SandboxConnection, error) {
+	var sc SandboxConnection
 	if !common.DirExists(sandboxPath) {
 		return sc, fmt.Errorf(globals.ErrDirectoryNotFound, sandboxPath)
 	}
@@ -55,15 +62,25 @@ func getSandboxConnection(sandboxPath string, asSuperUser bool) (sandboxConnecti
 	return sc, err
 }
 
-// RunSandboxQuery runs a SQL query in a given sandbox directory
-func RunSandboxQuery[T comparable](sandboxPath, query string, asSuperUser bool) (interface{}, error) {
-
-	credentials, err := getSandboxConnection(sandboxPath, asSuperUser)
+// connectToSandbox opens a connection to the server in a given sandbox directory
+func connectToSandbox(sandboxPath string, asSuperUser bool) (*importing.DB, *mysql.Config, error) {
+	credentials, err := GetSandboxConnection(sandboxPath, asSuperUser)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
 	config := importing.ParamsToConfig(credentials.Host, credentials.User, credentials.Password, credentials.Port)
+	config.Timeout = sandboxConnectionTimeout
 	db, err := importing.Connect(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, config, nil
+}
+
+// RunSandboxQuery runs a SQL query in a given sandbox directory
+func RunSandboxQuery[T comparable](sandboxPath, query string, asSuperUser bool) (interface{}, error) {
+
+	db, config, err := connectToSandbox(sandboxPath, asSuperUser)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,466 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/datacharmer/dbdeployer/sandbox"
+)
+
+// Seconds that a new master can take to apply the transactions it received
+const promotionTimeout = 60
+
+// readOnlyState contains the read-only flags of a server
+type readOnlyState struct {
+	readOnly      bool
+	superReadOnly bool
+	// hasSuperReadOnly is false for versions without super_read_only
+	hasSuperReadOnly bool
+}
+
+// nodeQuery runs a query in a sandbox node as root, and returns the output without headers
+func nodeQuery(nodeDir, query string) (string, error) {
+	out, err := common.RunCmdCtrlWithArgs(path.Join(nodeDir, globals.ScriptUse), []string{"-u", "root", "-BN", "-e", query}, true)
+	if err != nil {
+		return "", fmt.Errorf("error running '%s' in %s: %s", query, nodeDir, err)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// nodeNumber returns the number of a node in a master-slave sandbox, as used by the "nN" scripts
+// and by the replication tree: the master directory is node 1, and "node1" is node 2
+func nodeNumber(nodeName string) (int, error) {
+	return sandbox.NodeScriptNumber(globals.MasterSlaveLabel, nodeName)
+}
+
+// nodeName is the opposite of nodeNumber
+func nodeName(number int) string {
+	if number == 1 {
+		return defaults.Defaults().MasterName
+	}
+	return fmt.Sprintf("%s%d", defaults.Defaults().NodePrefix, number-1)
+}
+
+// replicationRoles returns the current master and slaves of a master-slave sandbox.
+// After a switchover or a failover, the roles are recorded in the replication tree of the sandbox description
+func replicationRoles(sandboxDir string) (master string, slaves []string, sbDesc common.SandboxDescription, err error) {
+	sbDesc, err = common.ReadSandboxDescription(sandboxDir)
+	if err != nil {
+		return "", nil, sbDesc, err
+	}
+	if sbDesc.SBType != globals.MasterSlaveLabel {
+		return "", nil, sbDesc, fmt.Errorf("sandbox %s is of type '%s'. Only '%s' sandboxes can change master",
+			sandboxDir, sbDesc.SBType, globals.MasterSlaveLabel)
+	}
+	if sbDesc.ReplicationTree != nil {
+		master = nodeName(sbDesc.ReplicationTree.Node)
+		for _, slave := range sbDesc.ReplicationTree.Slaves {
+			slaves = append(slaves, nodeName(slave.Node))
+		}
+		return master, slaves, sbDesc, nil
+	}
+	nodes, err := sandboxDataNodes(sandboxDir)
+	if err != nil {
+		return "", nil, sbDesc, err
+	}
+	master = defaults.Defaults().MasterName
+	for _, node := range nodes {
+		if node != master {
+			slaves = append(slaves, node)
+		}
+	}
+	return master, slaves, sbDesc, nil
+}
+
+// getReadOnlyState reads the read-only flags of a node
+func getReadOnlyState(nodeDir string) (readOnlyState, error) {
+	var state readOnlyState
+	out, err := nodeQuery(nodeDir, "SELECT @@global.read_only")
+	if err != nil {
+		return state, err
+	}
+	state.readOnly = out == "1"
+	out, err = nodeQuery(nodeDir, "SELECT @@global.super_read_only")
+	if err == nil {
+		state.hasSuperReadOnly = true
+		state.superReadOnly = out == "1"
+	}
+	return state, nil
+}
+
+// setReadOnlyState sets the read-only flags of a node
+func setReadOnlyState(nodeDir string, state readOnlyState) error {
+	var queries []string
+	if state.hasSuperReadOnly && !state.superReadOnly {
+		queries = append(queries, "SET GLOBAL super_read_only=OFF")
+	}
+	queries = append(queries, fmt.Sprintf("SET GLOBAL read_only=%s", onOff(state.readOnly || state.superReadOnly)))
+	if state.hasSuperReadOnly && state.superReadOnly {
+		queries = append(queries, "SET GLOBAL super_read_only=ON")
+	}
+	_, err := nodeQuery(nodeDir, strings.Join(queries, ";"))
+	return err
+}
+
+func onOff(value bool) string {
+	if value {
+		return "ON"
+	}
+	return "OFF"
+}
+
+// gtidExecuted returns the transactions executed by a node.
+// It fails when the node doesn't use GTID, which is needed to move slaves to a new master
+func gtidExecuted(nodeDir string) (string, error) {
+	gtidMode, err := nodeQuery(nodeDir, "SELECT @@global.gtid_mode")
+	if err != nil || gtidMode != "ON" {
+		return "", fmt.Errorf("node %s doesn't use GTID. Changing master requires a sandbox deployed with --%s",
+			nodeDir, globals.GtidLabel)
+	}
+	return nodeQuery(nodeDir, `SELECT REPLACE(@@global.gtid_executed, '\n', '')`)
+}
+
+// waitForGtidSet waits until a node has executed the given transactions
+func waitForGtidSet(nodeDir, gtidSet string) error {
+	if gtidSet == "" {
+		return nil
+	}
+	out, err := nodeQuery(nodeDir, fmt.Sprintf("SELECT WAIT_FOR_EXECUTED_GTID_SET('%s', %d)", gtidSet, promotionTimeout))
+	if err != nil {
+		return err
+	}
+	if out != "0" {
+		return fmt.Errorf("node %s did not apply the transactions %s within %d seconds", nodeDir, gtidSet, promotionTimeout)
+	}
+	return nil
+}
+
+// changeMasterExtra returns the options that a slave needs, besides the ones for
+// host, port, credentials, and auto-position
+func changeMasterExtra(slaveDir string) string {
+	sbDesc, err := common.ReadSandboxDescription(slaveDir)
+	if err != nil {
+		return ""
+	}
+	isNativeAuth, err := common.HasCapability(sbDesc.Flavor, common.NativeAuth, sbDesc.Version)
+	if err == nil && isNativeAuth {
+		return fmt.Sprintf(", GET_%s_PUBLIC_KEY=1", sandbox.NodeReplicationSyntax(slaveDir).SourceOption)
+	}
+	return ""
+}
+
+// promoteNode removes the replication settings of a node, and makes it writable
+func promoteNode(nodeDir string) error {
+	syntax := sandbox.NodeReplicationSyntax(nodeDir)
+	_, err := nodeQuery(nodeDir, fmt.Sprintf("%s; %s ALL", syntax.StopReplica, syntax.ResetReplica))
+	if err != nil {
+		return err
+	}
+	state, err := getReadOnlyState(nodeDir)
+	if err != nil {
+		return err
+	}
+	state.readOnly = false
+	state.superReadOnly = false
+	return setReadOnlyState(nodeDir, state)
+}
+
+// attachSlave makes a node replicate from a master. Without binary log coordinates
+// (such as "MASTER_LOG_FILE='mysql-bin.000001', MASTER_LOG_POS=4"), it uses GTID auto-position
+func attachSlave(slaveDir string, master SandboxConnection, coordinates string) error {
+	syntax := sandbox.NodeReplicationSyntax(slaveDir)
+	position := fmt.Sprintf("%s_AUTO_POSITION=1", syntax.SourceOption)
+	if coordinates != "" {
+		position = coordinates
+	}
+	changeMaster := fmt.Sprintf("%s %s_HOST='%s', %s_PORT=%d, %s_USER='%s', %s_PASSWORD='%s', %s%s",
+		syntax.ChangeSource,
+		syntax.SourceOption, master.Host,
+		syntax.SourceOption, master.Port,
+		syntax.SourceOption, master.User,
+		syntax.SourceOption, master.Password,
+		position, changeMasterExtra(slaveDir))
+	_, err := nodeQuery(slaveDir, strings.Join([]string{syntax.StopReplica, changeMaster, syntax.StartReplica}, ";"))
+	return err
+}
+
+// applyReplicationRoles moves the slaves to the new master using GTID auto-position,
+// records the new roles in the sandbox description, and writes again the scripts that depend on them
+func applyReplicationRoles(sandboxDir string, sbDesc common.SandboxDescription, master string, slaves []string, slaveState readOnlyState) error {
+	connection, err := GetSandboxConnection(path.Join(sandboxDir, master), false)
+	if err != nil {
+		return err
+	}
+	for _, slave := range slaves {
+		slaveDir := path.Join(sandboxDir, slave)
+		err = attachSlave(slaveDir, connection, "")
+		if err != nil {
+			return err
+		}
+		err = setReadOnlyState(slaveDir, slaveState)
+		if err != nil {
+			return err
+		}
+	}
+	return writeReplicationRoles(sandboxDir, sbDesc, master, slaves)
+}
+
+// writeReplicationRoles records the roles of the nodes in the sandbox description,
+// and writes again the scripts that depend on them
+func writeReplicationRoles(sandboxDir string, sbDesc common.SandboxDescription, master string, slaves []string) error {
+	connection, err := GetSandboxConnection(path.Join(sandboxDir, master), false)
+	if err != nil {
+		return err
+	}
+	roles := sandbox.ReplicationRoles{
+		SandboxDir:        sandboxDir,
+		Master:            master,
+		MasterPort:        connection.Port,
+		MasterIp:          connection.Host,
+		RplUser:           connection.User,
+		RplPassword:       connection.Password,
+		ChangeMasterExtra: make(map[string]string),
+	}
+	masterNumber, err := nodeNumber(master)
+	if err != nil {
+		return err
+	}
+	tree := common.ReplicationTreeNode{Node: masterNumber}
+	for _, slave := range slaves {
+		slaveDir := path.Join(sandboxDir, slave)
+		slavePort, err := nodePort(slaveDir)
+		if err != nil {
+			return err
+		}
+		slaveNumber, err := nodeNumber(slave)
+		if err != nil {
+			return err
+		}
+		tree.Slaves = append(tree.Slaves, common.ReplicationTreeNode{Node: slaveNumber})
+		roles.Slaves = append(roles.Slaves, slave)
+		roles.SlavePorts = append(roles.SlavePorts, slavePort)
+		roles.ChangeMasterExtra[slave] = changeMasterExtra(slaveDir)
+	}
+	sbDesc.ReplicationTree = &tree
+	err = common.UpdateSandboxDescription(sandboxDir, sbDesc)
+	if err != nil {
+		return err
+	}
+	return sandbox.WriteReplicationRoleScripts(roles)
+}
+
+// Switchover makes a slave of a running master-slave sandbox the new master.
+// The current master is set read-only, the new master receives all its transactions,
+// and then every other node, including the old master, replicates from the new one.
+// If the switchover fails before the promotion of the new master, the old master becomes writable again.
+// If it fails later, the new master gets back its previous read-only state, and the old master stays read-only.
+func Switchover(sandboxDir, newMaster string) (err error) {
+	master, slaves, sbDesc, err := replicationRoles(sandboxDir)
+	if err != nil {
+		return err
+	}
+	if newMaster == master {
+		return fmt.Errorf("node '%s' is already the master", newMaster)
+	}
+	var otherSlaves []string
+	found := false
+	for _, slave := range slaves {
+		if slave == newMaster {
+			found = true
+		} else {
+			otherSlaves = append(otherSlaves, slave)
+		}
+	}
+	if !found {
+		return fmt.Errorf("node '%s' is not a slave of %s. Slaves: %v", newMaster, sandboxDir, slaves)
+	}
+	allNodes := append([]string{master}, slaves...)
+	running := runningNodes(sandboxDir, allNodes)
+	if len(running) != len(allNodes) {
+		return fmt.Errorf("switchover requires all nodes to be running. Running: %v", running)
+	}
+	masterDir := path.Join(sandboxDir, master)
+	newMasterDir := path.Join(sandboxDir, newMaster)
+	masterState, err := getReadOnlyState(masterDir)
+	if err != nil {
+		return err
+	}
+	slaveState, err := getReadOnlyState(newMasterDir)
+	if err != nil {
+		return err
+	}
+	// No more writes on the old master, so that the new one can catch up
+	frozenState := masterState
+	frozenState.readOnly = true
+	frozenState.superReadOnly = masterState.hasSuperReadOnly
+	err = setReadOnlyState(masterDir, frozenState)
+	if err != nil {
+		return err
+	}
+	success := false
+	promoting := false
+	defer func() {
+		if success {
+			return
+		}
+		if !promoting {
+			// Nothing has changed in the slaves: the old master can take writes again
+			_ = setReadOnlyState(masterDir, masterState)
+			return
+		}
+		// The new master may have lost its replication settings: writing to either
+		// node could lose transactions, until the replication is checked by hand
+		_ = setReadOnlyState(newMasterDir, slaveState)
+		err = fmt.Errorf("switchover to %s failed after its promotion: %s. "+
+			"The old master %s was left read-only. Check the replication in %s before writing to any node",
+			newMaster, err, master, sandboxDir)
+	}()
+	executed, err := gtidExecuted(masterDir)
+	if err != nil {
+		return err
+	}
+	err = waitForGtidSet(newMasterDir, executed)
+	if err != nil {
+		return err
+	}
+	promoting = true
+	err = promoteNode(newMasterDir)
+	if err != nil {
+		return err
+	}
+	err = applyReplicationRoles(sandboxDir, sbDesc, newMaster, append([]string{master}, otherSlaves...), slaveState)
+	if err != nil {
+		return err
+	}
+	success = true
+	return nil
+}
+
+// electNewMaster returns the slave that has executed all the transactions of the other ones
+func electNewMaster(sandboxDir string, candidates []string) (string, error) {
+	executed := make(map[string]string)
+	for _, candidate := range candidates {
+		gtidSet, err := gtidExecuted(path.Join(sandboxDir, candidate))
+		if err != nil {
+			return "", err
+		}
+		executed[candidate] = gtidSet
+	}
+	for _, candidate := range candidates {
+		isComplete := true
+		for _, other := range candidates {
+			if other == candidate {
+				continue
+			}
+			out, err := nodeQuery(path.Join(sandboxDir, candidate),
+				fmt.Sprintf("SELECT GTID_SUBSET('%s', @@global.gtid_executed)", executed[other]))
+			if err != nil {
+				return "", err
+			}
+			if out != "1" {
+				isComplete = false
+				break
+			}
+		}
+		if isComplete {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no slave has executed all the transactions of the others. Choose the new master explicitly")
+}
+
+// Failover replaces a failed master of a master-slave sandbox. The master is killed, if it is still running.
+// The slaves apply the transactions they have received, and then the new master is either the given one,
+// or the slave that has executed all the transactions of the others.
+// The old master is left out of replication. It returns the name of the new master.
+func Failover(sandboxDir, newMaster string) (string, error) {
+	master, slaves, sbDesc, err := replicationRoles(sandboxDir)
+	if err != nil {
+		return "", err
+	}
+	if newMaster == master {
+		return "", fmt.Errorf("node '%s' is the failed master", newMaster)
+	}
+	candidates := runningNodes(sandboxDir, slaves)
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no running slaves found in %s", sandboxDir)
+	}
+	// The new master is checked before killing the old one
+	if newMaster != "" {
+		found := false
+		for _, candidate := range candidates {
+			if candidate == newMaster {
+				found = true
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("node '%s' is not a running slave of %s. Running slaves: %v", newMaster, sandboxDir, candidates)
+		}
+	}
+	masterDir := path.Join(sandboxDir, master)
+	if len(runningNodes(sandboxDir, []string{master})) > 0 {
+		_, err = common.RunCmdCtrl(path.Join(masterDir, globals.ScriptSendKill), true)
+		if err != nil {
+			return "", fmt.Errorf("error killing master %s: %s", masterDir, err)
+		}
+	}
+	for _, candidate := range candidates {
+		candidateDir := path.Join(sandboxDir, candidate)
+		received, err := nodeQuery(candidateDir,
+			`SELECT REPLACE(GROUP_CONCAT(RECEIVED_TRANSACTION_SET), '\n', '') FROM performance_schema.replication_connection_status`)
+		if err != nil {
+			return "", err
+		}
+		if received != "NULL" {
+			err = waitForGtidSet(candidateDir, received)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+	if newMaster == "" {
+		newMaster, err = electNewMaster(sandboxDir, candidates)
+		if err != nil {
+			return "", err
+		}
+	}
+	var otherSlaves []string
+	for _, candidate := range candidates {
+		if candidate != newMaster {
+			otherSlaves = append(otherSlaves, candidate)
+		}
+	}
+	newMasterDir := path.Join(sandboxDir, newMaster)
+	slaveState, err := getReadOnlyState(newMasterDir)
+	if err != nil {
+		return "", err
+	}
+	err = promoteNode(newMasterDir)
+	if err != nil {
+		return "", err
+	}
+	err = applyReplicationRoles(sandboxDir, sbDesc, newMaster, otherSlaves, slaveState)
+	if err != nil {
+		return "", err
+	}
+	return newMaster, nil
+}
@@ -0,0 +1,173 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ops
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/compare"
+	"github.com/datacharmer/dbdeployer/globals"
+)
+
+func TestNodeNumber(t *testing.T) {
+	for number, name := range map[int]string{1: "master", 2: "node1", 3: "node2", 11: "node10"} {
+		compare.OkEqualString("node name", nodeName(number), name, t)
+		found, err := nodeNumber(name)
+		compare.OkIsNil("node number error", err, t)
+		compare.OkEqualInt("node number", found, number, t)
+	}
+	for _, name := range []string{"", "node", "nodex", "slave1"} {
+		_, err := nodeNumber(name)
+		compare.OkIsNotNil("invalid node name error for '"+name+"'", err, t)
+	}
+}
+
+// makeReplicationDirs creates the directories of a master-slave sandbox, without servers
+func makeReplicationDirs(t *testing.T, sbDesc common.SandboxDescription) string {
+	return makeFakeSandbox(t, t.TempDir(), fakeSandbox{
+		nodes:       []string{"master", "node1", "node2"},
+		scripts:     map[string]string{globals.ScriptStart: "#!/bin/sh\n"},
+		description: sbDesc,
+	})
+}
+
+func TestReplicationRoles(t *testing.T) {
+	sandboxDir := makeReplicationDirs(t, common.SandboxDescription{SBType: globals.MasterSlaveLabel})
+	master, slaves, _, err := replicationRoles(sandboxDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare.OkEqualString("initial master", master, "master", t)
+	compare.OkEqualStringSlices(t, slaves, []string{"node1", "node2"})
+
+	// After a change of master, the roles come from the replication tree
+	switchedDir := makeReplicationDirs(t, common.SandboxDescription{
+		SBType: globals.MasterSlaveLabel,
+		ReplicationTree: &common.ReplicationTreeNode{
+			Node:   3,
+			Slaves: []common.ReplicationTreeNode{{Node: 1}, {Node: 2}},
+		},
+	})
+	master, slaves, _, err = replicationRoles(switchedDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare.OkEqualString("master after switchover", master, "node2", t)
+	compare.OkEqualStringSlices(t, slaves, []string{"master", "node1"})
+
+	groupDir := makeReplicationDirs(t, common.SandboxDescription{SBType: "group-multi-primary"})
+	_, _, _, err = replicationRoles(groupDir)
+	compare.OkIsNotNil("group replication roles error", err, t)
+	err = Switchover(groupDir, "node1")
+	compare.OkIsNotNil("group switchover error", err, t)
+
+	err = Switchover(sandboxDir, "master")
+	compare.OkIsNotNil("switchover to current master error", err, t)
+	err = Switchover(sandboxDir, "node5")
+	compare.OkIsNotNil("switchover to unknown node error", err, t)
+	// The servers are not running
+	err = Switchover(sandboxDir, "node1")
+	compare.OkIsNotNil("switchover without servers error", err, t)
+	_, err = Failover(sandboxDir, "master")
+	compare.OkIsNotNil("failover to current master error", err, t)
+	_, err = Failover(sandboxDir, "")
+	compare.OkIsNotNil("failover without servers error", err, t)
+}
+
+// makeRunningReplication creates a master-slave sandbox whose nodes report to be running, and whose "use"
+// script records the queries in queries.log. The slaves are read-only. In the node named failingNode,
+// the queries matching the shell pattern failingQuery fail. The send_kill script leaves a file named "killed"
+func makeRunningReplication(t *testing.T, failingNode, failingQuery string) string {
+	useScript := fmt.Sprintf(`#!/bin/sh
+query="$5"
+printf '%%s\n' "$query" >> $(dirname $0)/queries.log
+case $0 in */%s/*) case "$query" in %s) exit 1;; esac;; esac
+case "$query" in
+	*gtid_mode*) echo ON;;
+	*gtid_executed*) echo "00000000-0000-0000-0000-000000000001:1-5";;
+	*read_only*) case $0 in */master/*) echo 0;; *) echo 1;; esac;;
+	SELECT*) echo 0;;
+esac
+exit 0
+`, failingNode, failingQuery)
+	return makeFakeSandbox(t, t.TempDir(), fakeSandbox{
+		nodes: []string{"master", "node1", "node2"},
+		scripts: map[string]string{
+			globals.ScriptStart:    "#!/bin/sh\n",
+			globals.ScriptStatus:   "#!/bin/sh\necho \"$(basename $(dirname $0)) on\"\n",
+			globals.ScriptSendKill: "#!/bin/sh\ntouch $(dirname $0)/killed\n",
+			globals.ScriptUse:      useScript,
+		},
+		description: common.SandboxDescription{SBType: globals.MasterSlaveLabel, Version: "8.0.36", Flavor: common.MySQLFlavor},
+	})
+}
+
+// nodeQueries returns the queries that a node of a sandbox made by makeRunningReplication has received
+func nodeQueries(t *testing.T, sandboxDir, node string) []string {
+	queries, err := common.SlurpAsLines(path.Join(sandboxDir, node, "queries.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return queries
+}
+
+const (
+	freezeQuery   = "SET GLOBAL read_only=ON;SET GLOBAL super_read_only=ON"
+	unfreezeQuery = "SET GLOBAL super_read_only=OFF;SET GLOBAL read_only=OFF"
+)
+
+func TestSwitchoverRollback(t *testing.T) {
+	// The new master doesn't catch up with the old one: the old master is writable again
+	sandboxDir := makeRunningReplication(t, "node1", "*WAIT_FOR_EXECUTED_GTID_SET*")
+	err := Switchover(sandboxDir, "node1")
+	compare.OkIsNotNil("switchover error before promotion", err, t)
+	queries := nodeQueries(t, sandboxDir, "master")
+	compare.OkEqualBool("old master set read-only", strings.Contains(strings.Join(queries, "\n"), freezeQuery), true, t)
+	compare.OkEqualString("last query in old master", queries[len(queries)-1], unfreezeQuery, t)
+
+	// The promotion of the new master fails: both nodes are left read-only
+	sandboxDir = makeRunningReplication(t, "node1", "STOP*")
+	err = Switchover(sandboxDir, "node1")
+	compare.OkIsNotNil("switchover error after promotion", err, t)
+	if err != nil {
+		compare.OkMatchesString("switchover error", err.Error(), "left read-only", t)
+	}
+	queries = nodeQueries(t, sandboxDir, "master")
+	compare.OkEqualBool("old master writable", strings.Contains(strings.Join(queries, "\n"), unfreezeQuery), false, t)
+	queries = nodeQueries(t, sandboxDir, "node1")
+	compare.OkEqualString("last query in new master", queries[len(queries)-1], freezeQuery, t)
+
+	// The old master stops replicating from the new one: the new master goes back to read-only
+	sandboxDir = makeRunningReplication(t, "master", "STOP*")
+	err = Switchover(sandboxDir, "node1")
+	compare.OkIsNotNil("switchover error after moving slaves", err, t)
+	queries = nodeQueries(t, sandboxDir, "master")
+	compare.OkEqualBool("old master writable", strings.Contains(strings.Join(queries, "\n"), unfreezeQuery), false, t)
+	queries = nodeQueries(t, sandboxDir, "node1")
+	compare.OkEqualString("last query in new master", queries[len(queries)-1], freezeQuery, t)
+}
+
+func TestFailoverToInvalidNode(t *testing.T) {
+	sandboxDir := makeRunningReplication(t, "", "")
+	_, err := Failover(sandboxDir, "node5")
+	compare.OkIsNotNil("failover to unknown node error", err, t)
+	// The master was not killed
+	compare.OkEqualBool("master killed", common.FileExists(path.Join(sandboxDir, "master", "killed")), false, t)
+}
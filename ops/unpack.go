@@ -40,6 +40,9 @@ type UnpackOptions struct {
 	DryRun        bool
 }
 
+// Top directory of the PostgreSQL binary tarballs
+const postgreSQLTarballDir = "pgsql"
+
 func UnpackTarball(options UnpackOptions) error {
 	Basedir := options.SandboxBinary
 	verbosity := options.Verbosity
@@ -47,14 +50,14 @@ func UnpackTarball(options UnpackOptions) error {
 		return fmt.Errorf(globals.ErrDirectoryNotFound, Basedir)
 	}
 	tarball := options.TarballName
-	reVersion := regexp.MustCompile(`(\d+\.\d+\.\d+)`)
-	verList := reVersion.FindAllStringSubmatch(tarball, -1)
-
+	// The detected version keeps vendor build, pre-release tag, and build variant
+	// (e.g. 8.0.35-27 for Percona Server), so that several builds of the same
+	// version can coexist in the sandbox binary directory
 	detectedVersion := ""
-	if verList != nil {
-		detectedVersion = verList[0][0]
+	serverVersion, err := common.ParseTarballVersion(tarball)
+	if err == nil {
+		detectedVersion = serverVersion.String()
 	}
-	// common.CondPrintf(">> %#v %s\n",verList, detected_version)
 
 	isShell := options.IsShell
 	target := options.TargetServer
@@ -76,12 +79,19 @@ func UnpackTarball(options UnpackOptions) error {
 	if Version == "" {
 		Version = detectedVersion
 	}
+	// PostgreSQL 10+ releases have a two-part version (16.2), which is deployed as 16.2.0
+	if Version == "" && flavor == common.PostgreSQLFlavor {
+		shortVersion := regexp.MustCompile(`(\d+\.\d+)`).FindString(common.BaseName(tarball))
+		if shortVersion != "" {
+			Version = shortVersion + ".0"
+		}
+	}
 	if Version == "" {
 		return fmt.Errorf("unpack: No version was detected from tarball name. " +
 			"Flag --unpack-version becomes mandatory")
 	}
 	// This call used to ensure that the port provided is in the right format
-	_, err := common.VersionToPort(Version)
+	_, err = common.VersionToPort(Version)
 	if err != nil {
 		return fmt.Errorf("version %s not in the required format", Version)
 	}
@@ -135,7 +145,11 @@ func UnpackTarball(options UnpackOptions) error {
 	default:
 		return fmt.Errorf("tarball extension must be either '%s' or '%s'", globals.TarGzExt, globals.TarXzExt)
 	}
-	err = unpack.VerifyTarFile(tarball)
+	var alternativeDirs []string
+	if flavor == common.PostgreSQLFlavor {
+		alternativeDirs = append(alternativeDirs, postgreSQLTarballDir)
+	}
+	err = unpack.VerifyTarFileWithDirs(tarball, alternativeDirs)
 	if err != nil {
 		return fmt.Errorf("validation for %s failed: %s", tarball, err)
 	}
@@ -161,6 +175,10 @@ func UnpackTarball(options UnpackOptions) error {
 		return err
 	}
 	finalName := path.Join(Basedir, bareName)
+	// PostgreSQL binary tarballs expand into a directory named "pgsql"
+	if !common.DirExists(finalName) && flavor == common.PostgreSQLFlavor && common.DirExists(path.Join(Basedir, postgreSQLTarballDir)) {
+		finalName = path.Join(Basedir, postgreSQLTarballDir)
+	}
 	// If the directory was not created, it probably means that the tarball was not well organised
 	// and either lacked the top directory or the top directory had a different name
 	if !common.DirExists(finalName) {
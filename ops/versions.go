@@ -34,6 +34,22 @@ func validateVersionOptions(options VersionOptions) error {
 	return nil
 }
 
+// ListVersions returns the versions available in options.SandboxBinary,
+// optionally limited to the ones of a given flavor
+func ListVersions(options VersionOptions) ([]common.VersionInfo, error) {
+	err := validateVersionOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	var versions []common.VersionInfo
+	for _, verInfo := range common.GetVersionInfoFromDir(options.SandboxBinary) {
+		if options.Flavor == verInfo.Flavor || options.Flavor == "" {
+			versions = append(versions, verInfo)
+		}
+	}
+	return versions, nil
+}
+
 func ShowVersions(options VersionOptions) error {
 	err := validateVersionOptions(options)
 	if err != nil {
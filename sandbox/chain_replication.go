@@ -0,0 +1,369 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2021 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/dustin/go-humanize/english"
+	"github.com/pkg/errors"
+)
+
+// ChainLink is a replication channel in a chained topology:
+// Node replicates from MasterNode, and it is Level steps away from the top master
+type ChainLink struct {
+	Node       int
+	MasterNode int
+	Level      int
+}
+
+// makeChainSpec returns the specification of a linear chain with the given number of nodes
+// (e.g. "1>2>3" for 3 nodes)
+func makeChainSpec(nodes int) string {
+	var list []string
+	for N := 1; N <= nodes; N++ {
+		list = append(list, fmt.Sprintf("%d", N))
+	}
+	return strings.Join(list, ">")
+}
+
+// chainSlaveShortcuts returns the name of the shortcut script of each slave node.
+// As in master-slave replication, slaves are numbered from 1 (s1, s2, ...) in the order of their node number
+func chainSlaveShortcuts(slaveAbbr string, slaveList []int) map[int]string {
+	sorted := append([]int{}, slaveList...)
+	sort.Ints(sorted)
+	shortcuts := make(map[int]string)
+	for i, slave := range sorted {
+		shortcuts[slave] = fmt.Sprintf("%s%d", slaveAbbr, i+1)
+	}
+	return shortcuts
+}
+
+// ParseChainSpec reads a replication tree specification, such as "1>2>3,2>4",
+// where each comma separated element is a chain of nodes, and "A>B" means that
+// node B replicates from node A.
+// It returns the top master and the list of links, sorted by level.
+func ParseChainSpec(spec string) (int, []ChainLink, error) {
+	masterOf := make(map[int]int)
+	var allNodes []int
+	seen := make(map[int]bool)
+	if strings.TrimSpace(spec) == "" {
+		return 0, nil, fmt.Errorf("empty chain specification")
+	}
+	for _, chain := range strings.Split(spec, ",") {
+		elements := strings.Split(strings.TrimSpace(chain), ">")
+		if len(elements) < 2 {
+			return 0, nil, fmt.Errorf("chain '%s' must contain at least two nodes separated by '>'", chain)
+		}
+		previous := 0
+		for _, element := range elements {
+			node, err := strconv.Atoi(strings.TrimSpace(element))
+			if err != nil {
+				return 0, nil, fmt.Errorf("invalid node '%s' in chain '%s'", element, chain)
+			}
+			if node < 1 {
+				return 0, nil, fmt.Errorf("node number must be greater than 0 (found '%d' in chain '%s')", node, chain)
+			}
+			if !seen[node] {
+				seen[node] = true
+				allNodes = append(allNodes, node)
+			}
+			if previous > 0 {
+				if previous == node {
+					return 0, nil, fmt.Errorf("node %d can't replicate from itself", node)
+				}
+				existing, ok := masterOf[node]
+				if ok && existing != previous {
+					return 0, nil, fmt.Errorf("node %d has two masters (%d and %d)", node, existing, previous)
+				}
+				masterOf[node] = previous
+			}
+			previous = node
+		}
+	}
+	sort.Ints(allNodes)
+	for i, node := range allNodes {
+		if node != i+1 {
+			return 0, nil, fmt.Errorf("nodes must be numbered from 1 to %d without gaps. Node %d is missing", len(allNodes), i+1)
+		}
+	}
+	var roots []int
+	for _, node := range allNodes {
+		if _, ok := masterOf[node]; !ok {
+			roots = append(roots, node)
+		}
+	}
+	if len(roots) != 1 {
+		return 0, nil, fmt.Errorf("a chain must have exactly one top master. Found %d (%v)", len(roots), roots)
+	}
+	var links []ChainLink
+	for _, node := range allNodes {
+		if node == roots[0] {
+			continue
+		}
+		level := 0
+		current := node
+		for current != roots[0] {
+			level++
+			if level > len(allNodes) {
+				return 0, nil, fmt.Errorf("loop detected in chain specification '%s'", spec)
+			}
+			current = masterOf[current]
+		}
+		links = append(links, ChainLink{Node: node, MasterNode: masterOf[node], Level: level})
+	}
+	sort.SliceStable(links, func(i, j int) bool {
+		if links[i].Level == links[j].Level {
+			return links[i].Node < links[j].Node
+		}
+		return links[i].Level < links[j].Level
+	})
+	return roots[0], links, nil
+}
+
+func chainToTree(node int, links []ChainLink) common.ReplicationTreeNode {
+	treeNode := common.ReplicationTreeNode{Node: node}
+	for _, link := range links {
+		if link.MasterNode == node {
+			treeNode.Slaves = append(treeNode.Slaves, chainToTree(link.Node, links))
+		}
+	}
+	return treeNode
+}
+
+// CreateChainReplication deploys a cascading replication, where some slaves are also
+// masters of other slaves (relay slaves).
+// The shape of the tree is defined by chainSpec (see ParseChainSpec). When chainSpec is empty,
+// the nodes are deployed as a linear chain (1>2>3...)
+func CreateChainReplication(sandboxDef SandboxDef, origin string, nodes int, masterIp, chainSpec string) error {
+	sandboxDef.SBType = globals.ChainLabel
+
+	var logger *defaults.Logger
+	if sandboxDef.Logger != nil {
+		logger = sandboxDef.Logger
+	} else {
+		var fileName string
+		var err error
+		logger, fileName, err = defaults.NewLogger(common.LogDirName(), globals.ChainLabel)
+		if err != nil {
+			return err
+		}
+		sandboxDef.LogFileName = common.ReplaceLiteralHome(fileName)
+	}
+
+	if chainSpec == "" {
+		chainSpec = makeChainSpec(nodes)
+	}
+	topMaster, links, err := ParseChainSpec(chainSpec)
+	if err != nil {
+		return err
+	}
+	if len(links)+1 != nodes {
+		return fmt.Errorf("chain specification '%s' defines %d nodes. Expected: %d", chainSpec, len(links)+1, nodes)
+	}
+	readOnlyOptions, err := checkReadOnlyFlags(sandboxDef)
+	if err != nil {
+		return err
+	}
+
+	syntax, err := common.GetReplicationSyntax(sandboxDef.Flavor, sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+	// Relay slaves must write the events received from their master to their own binary log
+	sandboxDef.MyCnfOptions = append(sandboxDef.MyCnfOptions, syntax.ReplicaUpdates)
+	masterAutoPosition := ""
+	isEnhancedGtid, err := common.HasCapability(sandboxDef.Flavor, common.EnhancedGTID, sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+	if isEnhancedGtid {
+		sandboxDef.GtidOptions = SingleTemplates[globals.TmplGtidOptions57].Contents
+		masterAutoPosition = fmt.Sprintf(", %s_AUTO_POSITION=1", syntax.SourceOption)
+	}
+	isCrashSafe, err := common.HasCapability(sandboxDef.Flavor, common.CrashSafe, sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+	if isCrashSafe {
+		sandboxDef.ReplCrashSafeOptions, err = replCrashSafeOptionsFor(sandboxDef.Flavor, sandboxDef.Version)
+		if err != nil {
+			return err
+		}
+	}
+	if sandboxDef.DirName == "" {
+		sandboxDef.DirName = defaults.Defaults().ChainPrefix + common.VersionToName(origin)
+	}
+	sandboxDir := sandboxDef.SandboxDir
+	sandboxDef.SandboxDir = common.DirName(sandboxDef.SandboxDir)
+
+	vList, err := common.VersionToList(sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+	rev := vList[0]
+	if sandboxDef.BasePort == 0 {
+		sandboxDef.BasePort = sandboxDef.Port + defaults.Defaults().ChainReplicationBasePort + (rev * 100)
+	}
+	masterAbbr := defaults.Defaults().MasterAbbr
+	slaveAbbr := defaults.Defaults().SlaveAbbr
+	masterLabel := defaults.Defaults().MasterName
+	slaveLabel := defaults.Defaults().SlavePrefix
+	nodeLabel := defaults.Defaults().NodePrefix
+
+	isMinimumNativeAuthPlugin, err := common.HasCapability(sandboxDef.Flavor, common.NativeAuth, sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+	if isMinimumNativeAuthPlugin && !sandboxDef.NativeAuthPlugin {
+		sandboxDef.ChangeMasterOptions = append(sandboxDef.ChangeMasterOptions, fmt.Sprintf("GET_%s_PUBLIC_KEY=1", syntax.SourceOption))
+	}
+
+	data, err := CreateMultipleSandbox(sandboxDef, origin, nodes)
+	if err != nil {
+		return err
+	}
+
+	rawSandboxDir := data["SandboxDir"]
+	if rawSandboxDir != nil {
+		sandboxDef.SandboxDir = rawSandboxDir.(string)
+	} else {
+		return fmt.Errorf("empty Sandbox directory received from multiple deployment")
+	}
+
+	// The description was written by the multiple deployment. We add the replication tree to it
+	sbDesc, err := common.ReadSandboxDescription(sandboxDef.SandboxDir)
+	if err != nil {
+		return err
+	}
+	tree := chainToTree(topMaster, links)
+	sbDesc.ReplicationTree = &tree
+	err = common.WriteSandboxDescription(sandboxDef.SandboxDir, sbDesc)
+	if err != nil {
+		return errors.Wrapf(err, "unable to write sandbox description")
+	}
+
+	setGlobal := "GLOBAL"
+	persistent, err := common.HasCapability(sandboxDef.Flavor, common.SetPersist, sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+	if persistent {
+		setGlobal = "PERSIST"
+	}
+
+	var masterList []int
+	var slaveList []int
+	var linkData []common.StringMap
+	isMaster := map[int]bool{topMaster: true}
+	masterList = append(masterList, topMaster)
+	for _, link := range links {
+		if !isMaster[link.MasterNode] {
+			isMaster[link.MasterNode] = true
+			masterList = append(masterList, link.MasterNode)
+		}
+		slaveList = append(slaveList, link.Node)
+		linkData = append(linkData, common.StringMap{
+			"Node":       link.Node,
+			"MasterNode": link.MasterNode,
+			"Level":      link.Level,
+		})
+	}
+
+	data["SetGlobal"] = setGlobal
+	data["SlavesReadOnly"] = readOnlyOptions
+	data["MasterIp"] = masterIp
+	data["MasterAbbr"] = masterAbbr
+	data["MasterLabel"] = masterLabel
+	data["TopMaster"] = topMaster
+	data["MasterList"] = common.IntSliceToSeparatedString(masterList, " ")
+	data["SlaveAbbr"] = slaveAbbr
+	data["SlaveLabel"] = slaveLabel
+	data["SlaveList"] = common.IntSliceToSeparatedString(slaveList, " ")
+	data["Links"] = linkData
+	data["ChainSpec"] = chainSpec
+	data["RplUser"] = sandboxDef.RplUser
+	data["RplPassword"] = sandboxDef.RplPassword
+	data["NodeLabel"] = nodeLabel
+	data["MasterAutoPosition"] = masterAutoPosition
+	data["ChangeMasterExtra"] = setChangeMasterProperties("", sandboxDef.ChangeMasterOptions, logger)
+	err = addReplicationSyntax(data, sandboxDef.Flavor, sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+
+	logger.Printf("Writing master and slave scripts in %s\n", sandboxDef.SandboxDir)
+	data["Node"] = topMaster
+	err = writeScript(logger, ReplicationTemplates, masterAbbr, globals.TmplSlave, sandboxDir, data, true)
+	if err != nil {
+		return err
+	}
+	shortcuts := chainSlaveShortcuts(slaveAbbr, slaveList)
+	for _, slave := range slaveList {
+		data["Node"] = slave
+		err = writeScript(logger, ReplicationTemplates, shortcuts[slave], globals.TmplSlave, sandboxDir, data, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	slavePlural := english.PluralWord(2, slaveLabel, "")
+	masterPlural := english.PluralWord(2, masterLabel, "")
+	initializeSlaves := "initialize_" + slavePlural
+	checkSlaves := "check_" + slavePlural
+	useAllMasters := "use_all_" + masterPlural
+	useAllSlaves := "use_all_" + slavePlural
+	execAllSlaves := "exec_all_" + slavePlural
+	execAllMasters := "exec_all_" + masterPlural
+
+	logger.Printf("Writing chain replication scripts in %s\n", sandboxDef.SandboxDir)
+	sbChain := ScriptBatch{
+		tc:         ReplicationTemplates,
+		logger:     logger,
+		data:       data,
+		sandboxDir: sandboxDir,
+		scripts: []ScriptDef{
+			{globals.ScriptTestReplication, globals.TmplMultiSourceTest, true},
+			{useAllSlaves, globals.TmplMultiSourceUseSlaves, true},
+			{useAllMasters, globals.TmplMultiSourceUseMasters, true},
+			{execAllMasters, globals.TmplMultiSourceExecMasters, true},
+			{execAllSlaves, globals.TmplMultiSourceExecSlaves, true},
+			{checkSlaves, globals.TmplChainCheckSlaves, true},
+			{initializeSlaves, globals.TmplChainInitSlaves, true},
+			{globals.ScriptWipeRestartAll, globals.TmplWipeAndRestartAll, true},
+		},
+	}
+	err = writeScripts(sbChain)
+	if err != nil {
+		return err
+	}
+	if !sandboxDef.SkipStart {
+		logger.Printf("Initializing chain replication\n")
+		common.CondPrintln(path.Join(common.ReplaceLiteralHome(sandboxDir), initializeSlaves))
+		_, err = common.RunCmd(path.Join(sandboxDir, initializeSlaves))
+		if err != nil {
+			return fmt.Errorf("error initializing chain replication: %s", err)
+		}
+	}
+	return nil
+}
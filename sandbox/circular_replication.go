@@ -0,0 +1,202 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2021 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/dustin/go-humanize/english"
+)
+
+// CreateCircularReplication deploys a ring of nodes, where each node replicates
+// from the previous one, and the first node replicates from the last one.
+// Every node gets a different auto_increment_offset, to avoid conflicts when
+// inserting into the same table from different nodes.
+func CreateCircularReplication(sandboxDef SandboxDef, origin string, nodes int, masterIp string) error {
+	sandboxDef.SBType = globals.CircularLabel
+
+	var logger *defaults.Logger
+	if sandboxDef.Logger != nil {
+		logger = sandboxDef.Logger
+	} else {
+		var fileName string
+		var err error
+		logger, fileName, err = defaults.NewLogger(common.LogDirName(), globals.CircularLabel)
+		if err != nil {
+			return err
+		}
+		sandboxDef.LogFileName = common.ReplaceLiteralHome(fileName)
+	}
+
+	if nodes < 2 {
+		return fmt.Errorf("can't run circular replication with less than 2 nodes")
+	}
+	readOnlyOptions, err := checkReadOnlyFlags(sandboxDef)
+	if err != nil {
+		return err
+	}
+	if readOnlyOptions != "" {
+		return fmt.Errorf("options --read-only and --super-read-only can't be used for circular topology\n" +
+			"as every node is also a master")
+	}
+
+	syntax, err := common.GetReplicationSyntax(sandboxDef.Flavor, sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+	// Each node must pass along the transactions received from its master
+	isEnhancedGtid, err := common.HasCapability(sandboxDef.Flavor, common.EnhancedGTID, sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+	if isEnhancedGtid {
+		sandboxDef.GtidOptions = SingleTemplates[globals.TmplGtidOptions57].Contents
+		sandboxDef.MyCnfOptions = append(sandboxDef.MyCnfOptions, syntax.ReplicaUpdates)
+	} else {
+		sandboxDef.GtidOptions = SingleTemplates[globals.TmplGtidOptions56].Contents
+	}
+	sandboxDef.ReplCrashSafeOptions, err = replCrashSafeOptionsFor(sandboxDef.Flavor, sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+	if sandboxDef.DirName == "" {
+		sandboxDef.DirName = defaults.Defaults().CircularPrefix + common.VersionToName(origin)
+	}
+	sandboxDir := sandboxDef.SandboxDir
+	sandboxDef.SandboxDir = common.DirName(sandboxDef.SandboxDir)
+
+	vList, err := common.VersionToList(sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+	rev := vList[0]
+	if sandboxDef.BasePort == 0 {
+		sandboxDef.BasePort = sandboxDef.Port + defaults.Defaults().CircularReplicationBasePort + (rev * 100)
+	}
+	masterAbbr := defaults.Defaults().MasterAbbr
+	slaveAbbr := defaults.Defaults().SlaveAbbr
+	masterLabel := defaults.Defaults().MasterName
+	slaveLabel := defaults.Defaults().SlavePrefix
+
+	isMinimumNativeAuthPlugin, err := common.HasCapability(sandboxDef.Flavor, common.NativeAuth, sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+	if isMinimumNativeAuthPlugin && !sandboxDef.NativeAuthPlugin {
+		sandboxDef.ChangeMasterOptions = append(sandboxDef.ChangeMasterOptions, fmt.Sprintf("GET_%s_PUBLIC_KEY=1", syntax.SourceOption))
+	}
+
+	data, err := CreateMultipleSandbox(sandboxDef, origin, nodes)
+	if err != nil {
+		return err
+	}
+
+	rawSandboxDir := data["SandboxDir"]
+	if rawSandboxDir != nil {
+		sandboxDef.SandboxDir = rawSandboxDir.(string)
+	} else {
+		return fmt.Errorf("empty Sandbox directory received from multiple deployment")
+	}
+
+	nodeList := makeNodesList(nodes)
+	nodeSlice, err := nodesListToIntSlice(nodeList, nodes)
+	if err != nil {
+		return err
+	}
+
+	setGlobal := "GLOBAL"
+	persistent, err := common.HasCapability(sandboxDef.Flavor, common.SetPersist, sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+	if persistent {
+		setGlobal = "PERSIST"
+	}
+
+	data["SetGlobal"] = setGlobal
+	data["MasterIp"] = masterIp
+	data["MasterAbbr"] = masterAbbr
+	data["MasterLabel"] = masterLabel
+	data["MasterList"] = normalizeNodeList(nodeList)
+	data["SlaveAbbr"] = slaveAbbr
+	data["SlaveLabel"] = slaveLabel
+	data["SlaveList"] = normalizeNodeList(nodeList)
+	data["NodeList"] = normalizeNodeList(nodeList)
+	data["NumNodes"] = nodes
+	data["RplUser"] = sandboxDef.RplUser
+	data["RplPassword"] = sandboxDef.RplPassword
+	data["NodeLabel"] = defaults.Defaults().NodePrefix
+	data["MasterAutoPosition"] = fmt.Sprintf(", %s_AUTO_POSITION=1", syntax.SourceOption)
+	data["ChangeMasterExtra"] = setChangeMasterProperties("", sandboxDef.ChangeMasterOptions, logger)
+	err = addReplicationSyntax(data, sandboxDef.Flavor, sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+	logger.Printf("Writing master and slave scripts in %s\n", sandboxDef.SandboxDir)
+	for _, node := range nodeSlice {
+		data["Node"] = node
+		err = writeScript(logger, ReplicationTemplates, fmt.Sprintf("s%d", node), globals.TmplSlave, sandboxDir, data, true)
+		if err != nil {
+			return err
+		}
+		err = writeScript(logger, ReplicationTemplates, fmt.Sprintf("m%d", node), globals.TmplSlave, sandboxDir, data, true)
+		if err != nil {
+			return err
+		}
+	}
+	logger.Printf("Writing circular replication scripts in %s\n", sandboxDef.SandboxDir)
+
+	slavePlural := english.PluralWord(2, slaveLabel, "")
+	masterPlural := english.PluralWord(2, masterLabel, "")
+	useAllMasters := "use_all_" + masterPlural
+	useAllSlaves := "use_all_" + slavePlural
+	execAllSlaves := "exec_all_" + slavePlural
+	execAllMasters := "exec_all_" + masterPlural
+
+	sbMulti := ScriptBatch{
+		tc:         ReplicationTemplates,
+		logger:     logger,
+		data:       data,
+		sandboxDir: sandboxDir,
+		scripts: []ScriptDef{
+			{globals.ScriptTestReplication, globals.TmplMultiSourceTest, true},
+			{useAllSlaves, globals.TmplMultiSourceUseSlaves, true},
+			{useAllMasters, globals.TmplMultiSourceUseMasters, true},
+			{execAllMasters, globals.TmplMultiSourceExecMasters, true},
+			{execAllSlaves, globals.TmplMultiSourceExecSlaves, true},
+			{globals.ScriptCheckRing, globals.TmplCheckRing, true},
+			{globals.ScriptInitializeRing, globals.TmplCircularReplication, true},
+			{globals.ScriptWipeRestartAll, globals.TmplWipeAndRestartAll, true},
+		},
+	}
+	err = writeScripts(sbMulti)
+	if err != nil {
+		return err
+	}
+	if !sandboxDef.SkipStart {
+		logger.Printf("Initializing circular replication \n")
+		common.CondPrintln(path.Join(common.ReplaceLiteralHome(sandboxDir), globals.ScriptInitializeRing))
+		_, err = common.RunCmd(path.Join(sandboxDir, globals.ScriptInitializeRing))
+		if err != nil {
+			return fmt.Errorf("error initializing circular replication: %s", err)
+		}
+	}
+	return nil
+}
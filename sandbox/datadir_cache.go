@@ -0,0 +1,369 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+)
+
+// The datadir cache keeps the output of init_db (mysqld --initialize or mysql_install_db)
+// for each combination of binaries and initialization options. New sandboxes get a copy
+// of the cached data directory instead of running the initialization again.
+// Users and grants are not cached: they depend on each sandbox options, and load_grants
+// applies them at the first start, as usual.
+
+const (
+	datadirCacheDirName   = "datadir-cache"
+	datadirCacheEntryFile = "cache.json"
+)
+
+// DatadirCacheEntry describes an initialized data directory in the cache
+type DatadirCacheEntry struct {
+	Key         string `json:"key"`
+	Flavor      string `json:"flavor"`
+	Version     string `json:"version"`
+	Basedir     string `json:"basedir"`
+	InitScript  string `json:"init_script"`
+	InitFlags   string `json:"init_flags"`
+	Fingerprint string `json:"fingerprint"`
+	Created     string `json:"created"`
+	Size        int64  `json:"size"`
+	Stale       bool   `json:"stale"`
+	Directory   string `json:"directory"`
+}
+
+// usesDatadirCache tells whether the data directory of a flavor can be cached
+func usesDatadirCache(flavor string) bool {
+	switch flavor {
+	case common.MySQLFlavor, common.PerconaServerFlavor, common.MariaDbFlavor:
+		return true
+	}
+	return false
+}
+
+// DatadirCacheDir returns the directory containing the cached data directories
+func DatadirCacheDir() string {
+	return path.Join(defaults.ConfigurationDir, datadirCacheDirName)
+}
+
+func hashStrings(items ...string) string {
+	hash := sha256.New()
+	for _, item := range items {
+		hash.Write([]byte(item))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// stringMapValue returns a template value as a string
+func stringMapValue(data common.StringMap, key string) string {
+	value, ok := data[key]
+	if !ok || value == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// datadirFingerprint identifies the current state of what produces the data directory:
+// the server executables and the init_db template.
+// When it changes, the cached data directory is no longer valid
+func datadirFingerprint(basedir, initScript string) string {
+	items := []string{SingleTemplates[globals.TmplInitDb].Contents}
+	for _, fileName := range []string{initScript, path.Join(basedir, "bin", globals.FnMysqld)} {
+		stat, err := os.Stat(fileName)
+		if err != nil {
+			items = append(items, fileName+":missing")
+			continue
+		}
+		items = append(items, fmt.Sprintf("%s:%d:%d", fileName, stat.Size(), stat.ModTime().UnixNano()))
+	}
+	return hashStrings(items...)
+}
+
+// newDatadirCacheEntry returns the cache entry for a sandbox, using the same
+// initialization data that is used for the init_db script
+func newDatadirCacheEntry(sandboxDef SandboxDef, data common.StringMap) DatadirCacheEntry {
+	initScript := stringMapValue(data, "InitScript")
+	initFlags := strings.Join(strings.Fields(strings.Replace(stringMapValue(data, "ExtraInitFlags"), "\\", "", -1)), " ")
+	entry := DatadirCacheEntry{
+		Flavor:     sandboxDef.Flavor,
+		Version:    sandboxDef.Version,
+		Basedir:    sandboxDef.Basedir,
+		InitScript: initScript,
+		InitFlags:  initFlags,
+	}
+	entry.Key = hashStrings(entry.Flavor, entry.Version, entry.Basedir, entry.InitScript,
+		entry.InitFlags, stringMapValue(data, "InitDefaults"), stringMapValue(data, "OsUser"))[:16]
+	entry.Fingerprint = datadirFingerprint(entry.Basedir, entry.InitScript)
+	entry.Directory = path.Join(DatadirCacheDir(), entry.Key)
+	return entry
+}
+
+func readDatadirCacheEntry(entryDir string) (DatadirCacheEntry, error) {
+	var entry DatadirCacheEntry
+	text, err := common.SlurpAsBytes(path.Join(entryDir, datadirCacheEntryFile))
+	if err != nil {
+		return entry, err
+	}
+	err = json.Unmarshal(text, &entry)
+	if err != nil {
+		return entry, errors.Wrapf(err, "error decoding cache entry in %s", entryDir)
+	}
+	entry.Directory = entryDir
+	entry.Stale = entry.Fingerprint != datadirFingerprint(entry.Basedir, entry.InitScript)
+	return entry, nil
+}
+
+// directorySize returns the total size of the files in a directory
+func directorySize(dirName string) int64 {
+	var size int64
+	_ = filepath.Walk(dirName, func(fileName string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// copyCachedDatadir copies a data directory using copy-on-write clones when the
+// file system supports them. Hard links are never used, as the server would modify
+// the cached files. If the clone fails, the files are copied one by one
+func copyCachedDatadir(source, destination string) error {
+	var cpArgs []string
+	switch runtime.GOOS {
+	case "linux":
+		cpArgs = []string{"-a", "--reflink=auto"}
+	case "darwin":
+		cpArgs = []string{"-c", "-R", "-p"}
+	}
+	cp, err := exec.LookPath("cp")
+	if cpArgs != nil && err == nil {
+		cpArgs = append(cpArgs, source+"/.", destination)
+		// #nosec G204
+		if exec.Command(cp, cpArgs...).Run() == nil {
+			return nil
+		}
+	}
+	return filepath.Walk(source, func(fileName string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		relativeName, err := filepath.Rel(source, fileName)
+		if err != nil {
+			return err
+		}
+		target := path.Join(destination, relativeName)
+		mode := info.Mode()
+		switch {
+		case mode.IsDir():
+			return os.MkdirAll(target, mode.Perm())
+		case mode&os.ModeSymlink != 0:
+			linkName, err := os.Readlink(fileName)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(linkName, target)
+		case mode.IsRegular():
+			return common.CopyFile(fileName, target)
+		}
+		return nil
+	})
+}
+
+// buildDatadirCacheEntry runs the initialization in a temporary directory inside the cache,
+// and then moves it to its final place. If another deployment has created the same entry
+// in the meantime, that one is kept
+func buildDatadirCacheEntry(entry DatadirCacheEntry, data common.StringMap, logger *defaults.Logger) error {
+	cacheDir := DatadirCacheDir()
+	err := os.MkdirAll(cacheDir, globals.PublicDirectoryAttr)
+	if err != nil {
+		return errors.Wrapf(err, globals.ErrCreatingDirectory, cacheDir, err)
+	}
+	buildDir, err := os.MkdirTemp(cacheDir, entry.Key+"-build-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(buildDir)
+	for _, dir := range []string{globals.DataDirName, "tmp"} {
+		err = os.Mkdir(path.Join(buildDir, dir), globals.PublicDirectoryAttr)
+		if err != nil {
+			return errors.Wrapf(err, globals.ErrCreatingDirectory, dir, err)
+		}
+	}
+	var buildData = make(common.StringMap)
+	for key, value := range data {
+		buildData[key] = value
+	}
+	buildData["SandboxDir"] = buildDir
+	buildData["FixUuidFile1"] = ""
+	buildData["FixUuidFile2"] = ""
+	err = writeScript(logger, SingleTemplates, globals.ScriptInitDb, globals.TmplInitDb, buildDir, buildData, true)
+	if err != nil {
+		return err
+	}
+	logger.Printf("Initializing cached data directory %s\n", entry.Key)
+	output, err := common.RunCmdCtrl(path.Join(buildDir, globals.ScriptInitDb), true)
+	if err != nil {
+		common.CondPrintf("%s output: %s\n", globals.ScriptInitDb, output)
+		return fmt.Errorf("%s failure while filling the datadir cache: %s", globals.ScriptInitDb, err)
+	}
+	// The server UUID must be different in every sandbox
+	_ = os.Remove(path.Join(buildDir, globals.DataDirName, globals.AutoCnfName))
+	for _, name := range []string{globals.ScriptInitDb, "tmp"} {
+		err = os.RemoveAll(path.Join(buildDir, name))
+		if err != nil {
+			return err
+		}
+	}
+	entry.Created = time.Now().Format(time.RFC3339)
+	entry.Size = directorySize(path.Join(buildDir, globals.DataDirName))
+	entry.Directory = ""
+	entry.Stale = false
+	text, err := json.MarshalIndent(entry, " ", "\t")
+	if err != nil {
+		return err
+	}
+	err = common.WriteString(string(text), path.Join(buildDir, datadirCacheEntryFile))
+	if err != nil {
+		return err
+	}
+	finalDir := path.Join(cacheDir, entry.Key)
+	err = os.Rename(buildDir, finalDir)
+	if err != nil && !common.DirExists(finalDir) {
+		return errors.Wrapf(err, "error moving %s to %s", buildDir, finalDir)
+	}
+	return nil
+}
+
+// initFromDatadirCache fills the data directory of a new sandbox with a copy of the cached one,
+// creating the cache entry if needed. Then it gives the sandbox its own server UUID.
+// The server ID is set in the options file, and the users are created by load_grants
+func initFromDatadirCache(sandboxDef SandboxDef, data common.StringMap, logger *defaults.Logger) error {
+	entry := newDatadirCacheEntry(sandboxDef, data)
+	if common.DirExists(entry.Directory) {
+		cached, err := readDatadirCacheEntry(entry.Directory)
+		if err != nil || cached.Stale {
+			logger.Printf("Removing stale cached data directory %s\n", entry.Key)
+			err = os.RemoveAll(entry.Directory)
+			if err != nil {
+				return errors.Wrapf(err, "error removing stale cache entry %s", entry.Directory)
+			}
+		}
+	}
+	if !common.DirExists(entry.Directory) {
+		err := buildDatadirCacheEntry(entry, data, logger)
+		if err != nil {
+			return err
+		}
+	}
+	dataDir := path.Join(sandboxDef.SandboxDir, globals.DataDirName)
+	logger.Printf("Copying cached data directory %s into %s\n", entry.Key, dataDir)
+	err := copyCachedDatadir(path.Join(entry.Directory, globals.DataDirName), dataDir)
+	if err != nil {
+		return errors.Wrapf(err, "error copying cached data directory %s", entry.Key)
+	}
+	if !sandboxDef.KeepUuid {
+		uuidDef, uuidFile, err := fixServerUuid(sandboxDef)
+		if err != nil {
+			return err
+		}
+		if uuidFile != "" {
+			err = common.WriteStrings([]string{"[auto]", uuidDef}, uuidFile, "\n")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ListDatadirCache returns the entries of the datadir cache, sorted by flavor and version
+func ListDatadirCache() ([]DatadirCacheEntry, error) {
+	var entries []DatadirCacheEntry
+	cacheDir := DatadirCacheDir()
+	if !common.DirExists(cacheDir) {
+		return entries, nil
+	}
+	files, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return entries, err
+	}
+	for _, f := range files {
+		if !f.IsDir() || strings.Contains(f.Name(), "-build-") {
+			continue
+		}
+		entry, err := readDatadirCacheEntry(path.Join(cacheDir, f.Name()))
+		if err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(a, b int) bool {
+		if entries[a].Flavor != entries[b].Flavor {
+			return entries[a].Flavor < entries[b].Flavor
+		}
+		return common.SortVersions([]string{entries[a].Version, entries[b].Version})[0] == entries[a].Version &&
+			entries[a].Version != entries[b].Version
+	})
+	return entries, nil
+}
+
+// PurgeDatadirCache removes the cache entries that match any of the given keys or versions,
+// or all of them when no filter is given. With staleOnly, only the entries that were
+// invalidated by a change of binaries or templates are removed.
+// It returns the removed entries
+func PurgeDatadirCache(filters []string, staleOnly bool) ([]DatadirCacheEntry, error) {
+	var removed []DatadirCacheEntry
+	entries, err := ListDatadirCache()
+	if err != nil {
+		return removed, err
+	}
+	for _, entry := range entries {
+		matches := len(filters) == 0
+		for _, filter := range filters {
+			if entry.Version == filter || strings.HasPrefix(entry.Key, filter) {
+				matches = true
+			}
+		}
+		if !matches || (staleOnly && !entry.Stale) {
+			continue
+		}
+		err = os.RemoveAll(entry.Directory)
+		if err != nil {
+			return removed, errors.Wrapf(err, "error removing cache entry %s", entry.Directory)
+		}
+		removed = append(removed, entry)
+	}
+	return removed, nil
+}
@@ -0,0 +1,584 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/concurrent"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/dustin/go-humanize/english"
+)
+
+const (
+	groupLocalAddressOption = "loose-group-replication-local-address"
+	groupSeedsOption        = "loose-group-replication-group-seeds"
+)
+
+// Options of the reference node that are not copied to a new node, because they identify the server.
+// The new node gets its own values when it is deployed
+var extraNodeSkippedOptions = map[string]bool{
+	"user":                  true,
+	"port":                  true,
+	"socket":                true,
+	"basedir":               true,
+	"datadir":               true,
+	"tmpdir":                true,
+	"pid-file":              true,
+	"bind-address":          true,
+	"log-error":             true,
+	"server-id":             true,
+	"report-host":           true,
+	"report-port":           true,
+	"mysqlx":                true,
+	"mysqlx-port":           true,
+	"mysqlx-socket":         true,
+	"admin-port":            true,
+	"admin-address":         true,
+	groupLocalAddressOption: true,
+	groupSeedsOption:        true,
+}
+
+// ExtraNode describes a node added to an existing sandbox
+type ExtraNode struct {
+	Name   string // directory of the node, such as "node4"
+	Number int    // number used by the "nN" scripts
+	Dir    string
+	Port   int
+}
+
+// nodeConnection contains the fields of connection.json and connection_super_user.json
+type nodeConnection struct {
+	Host     string `json:"master_host"`
+	Port     int    `json:"master_port"`
+	User     string `json:"master_user"`
+	Password string `json:"master_password"`
+}
+
+func readNodeConnection(nodeDir, fileName string) (nodeConnection, error) {
+	var connection nodeConnection
+	text, err := os.ReadFile(path.Join(nodeDir, fileName)) // #nosec G304
+	if err != nil {
+		return connection, err
+	}
+	err = json.Unmarshal(text, &connection)
+	return connection, err
+}
+
+// readServerOptions reads the [mysqld] section of a node configuration file.
+// It returns the options that a new node can use as they are, and the values
+// of the ones that identify the node
+func readServerOptions(cnfFile string) (options []string, identity map[string]string, err error) {
+	lines, err := common.SlurpAsLines(cnfFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	identity = make(map[string]string)
+	section := ""
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			section = strings.Trim(line, "[] ")
+			continue
+		}
+		if section != "mysqld" {
+			continue
+		}
+		key := line
+		value := ""
+		if equal := strings.Index(line, "="); equal >= 0 {
+			key = strings.TrimSpace(line[:equal])
+			value = strings.TrimSpace(line[equal+1:])
+		}
+		// The X plugin is loaded again by the deployment, when needed
+		if extraNodeSkippedOptions[key] || (key == "plugin_load_add" && strings.HasPrefix(value, "mysqlx=")) {
+			identity[key] = value
+			continue
+		}
+		options = append(options, line)
+	}
+	return options, identity, nil
+}
+
+// nextServerId returns a server ID higher than the given ones, following their progression:
+// the default server IDs of multiple sandboxes are multiples of 100
+func nextServerId(serverIds []int) int {
+	maxId := 0
+	step := 100
+	for _, serverId := range serverIds {
+		if serverId > maxId {
+			maxId = serverId
+		}
+		if serverId%100 != 0 {
+			step = 1
+		}
+	}
+	return maxId + step
+}
+
+// NodeScriptNumber returns the number of the "nN" script of a node.
+// In master-slave sandboxes, "n1" is the master, and the slaves follow.
+// In group and multiple sandboxes, "nN" is the node "nodeN"
+func NodeScriptNumber(sbType, nodeName string) (int, error) {
+	if sbType == globals.MasterSlaveLabel && nodeName == defaults.Defaults().MasterName {
+		return 1, nil
+	}
+	nodePrefix := defaults.Defaults().NodePrefix
+	number, err := strconv.Atoi(strings.TrimPrefix(nodeName, nodePrefix))
+	if err != nil || !strings.HasPrefix(nodeName, nodePrefix) || number < 1 {
+		return 0, fmt.Errorf("'%s' is not a node name", nodeName)
+	}
+	if sbType == globals.MasterSlaveLabel {
+		number++
+	}
+	return number, nil
+}
+
+// checkNodeListType makes sure that nodes can be added to or removed from a sandbox
+func checkNodeListType(sbDesc common.SandboxDescription) error {
+	switch sbDesc.SBType {
+	case globals.MasterSlaveLabel, globals.SbTypeMultiple, "group-multi-primary", "group-single-primary":
+	default:
+		return fmt.Errorf("nodes can't be added to or removed from sandboxes of type '%s'", sbDesc.SBType)
+	}
+	switch sbDesc.Flavor {
+	case common.NdbFlavor, common.PxcFlavor, common.TiDbFlavor:
+		return fmt.Errorf("nodes can't be added to or removed from sandboxes of flavor '%s'", sbDesc.Flavor)
+	}
+	return nil
+}
+
+// DeployExtraNode deploys a new node in a master-slave, group, or multiple sandbox, using the binaries
+// and the server options of an existing node. The new node gets the first free port after the ones of
+// the other nodes, and a server ID higher than theirs. The node is started, but it is neither provisioned
+// nor attached to the other nodes. The sandbox scripts, description, and catalog are left to UpdateNodeList
+func DeployExtraNode(sandboxDir string, nodes []string, reference string) (ExtraNode, error) {
+	var extraNode ExtraNode
+	sbDesc, err := common.ReadSandboxDescription(sandboxDir)
+	if err != nil {
+		return extraNode, err
+	}
+	err = checkNodeListType(sbDesc)
+	if err != nil {
+		return extraNode, err
+	}
+	isGroup := strings.HasPrefix(sbDesc.SBType, globals.GroupLabel)
+	referenceDir := path.Join(sandboxDir, reference)
+	referenceDesc, err := common.ReadSandboxDescription(referenceDir)
+	if err != nil {
+		return extraNode, err
+	}
+	options, identity, err := readServerOptions(path.Join(referenceDir, globals.ScriptMySandboxCnf))
+	if err != nil {
+		return extraNode, err
+	}
+	superConnection, err := readNodeConnection(referenceDir, globals.ScriptConnectionSuperJson)
+	if err != nil {
+		return extraNode, err
+	}
+	rplConnection, err := readNodeConnection(referenceDir, globals.ScriptConnectionJson)
+	if err != nil {
+		return extraNode, err
+	}
+
+	nodePrefix := defaults.Defaults().NodePrefix
+	maxNode := 0
+	maxPort := 0
+	maxGroupPort := 0
+	var serverIds []int
+	var groupSeeds []string
+	for _, node := range nodes {
+		nodeDir := path.Join(sandboxDir, node)
+		if strings.HasPrefix(node, nodePrefix) {
+			number, err := strconv.Atoi(strings.TrimPrefix(node, nodePrefix))
+			if err == nil && number > maxNode {
+				maxNode = number
+			}
+		}
+		nodeDesc, err := common.ReadSandboxDescription(nodeDir)
+		if err != nil {
+			return extraNode, err
+		}
+		if len(nodeDesc.Port) > 0 && nodeDesc.Port[0] > maxPort {
+			maxPort = nodeDesc.Port[0]
+		}
+		_, nodeIdentity, err := readServerOptions(path.Join(nodeDir, globals.ScriptMySandboxCnf))
+		if err != nil {
+			return extraNode, err
+		}
+		serverId, err := strconv.Atoi(nodeIdentity["server-id"])
+		if err == nil {
+			serverIds = append(serverIds, serverId)
+		}
+		if isGroup {
+			localAddress := nodeIdentity[groupLocalAddressOption]
+			groupPort, err := strconv.Atoi(localAddress[strings.LastIndex(localAddress, ":")+1:])
+			if err != nil {
+				return extraNode, fmt.Errorf("no group replication address found for node %s", nodeDir)
+			}
+			if groupPort > maxGroupPort {
+				maxGroupPort = groupPort
+			}
+			groupSeeds = append(groupSeeds, localAddress)
+		}
+	}
+	extraNode.Name = fmt.Sprintf("%s%d", nodePrefix, maxNode+1)
+	extraNode.Dir = path.Join(sandboxDir, extraNode.Name)
+	extraNode.Number, err = NodeScriptNumber(sbDesc.SBType, extraNode.Name)
+	if err != nil {
+		return extraNode, err
+	}
+
+	installedPorts, err := common.GetInstalledPorts(path.Dir(sandboxDir))
+	if err != nil {
+		return extraNode, err
+	}
+	installedPorts = append(installedPorts, defaults.Defaults().ReservedPorts...)
+	extraNode.Port, err = findFreePort(maxPort+1, installedPorts, 1)
+	if err != nil {
+		return extraNode, err
+	}
+	installedPorts = append(installedPorts, extraNode.Port)
+
+	sandboxDef := SandboxDef{
+		DirName:              extraNode.Name,
+		SBType:               referenceDesc.SBType,
+		Multi:                true,
+		NodeNum:              extraNode.Number,
+		Version:              referenceDesc.Version,
+		Flavor:               referenceDesc.Flavor,
+		Basedir:              referenceDesc.Basedir,
+		ClientBasedir:        referenceDesc.ClientBasedir,
+		BasedirName:          path.Base(referenceDesc.Basedir),
+		SandboxDir:           sandboxDir,
+		SbHost:               common.CoalesceString(referenceDesc.Host, globals.LocalHostIP),
+		ShellPath:            defaults.Defaults().ShellPath,
+		InstalledPorts:       installedPorts,
+		Port:                 extraNode.Port,
+		Prompt:               extraNode.Name,
+		DbUser:               superConnection.User,
+		DbPassword:           superConnection.Password,
+		RplUser:              rplConnection.User,
+		RplPassword:          rplConnection.Password,
+		RemoteAccess:         globals.RemoteAccessValue,
+		BindAddress:          common.CoalesceString(identity["bind-address"], globals.BindAddressValue),
+		DefaultRole:          globals.DefaultRoleValue,
+		CustomRoleName:       globals.CustomRoleNameValue,
+		CustomRolePrivileges: globals.CustomRolePrivilegesValue,
+		CustomRoleTarget:     globals.CustomRoleTargetValue,
+		CustomRoleExtra:      globals.CustomRoleExtraValue,
+		ServerId:             nextServerId(serverIds),
+		MyCnfOptions:         options,
+		LoadGrants:           true,
+		EnableMysqlX:         identity["mysqlx-port"] != "",
+		DisableMysqlX:        strings.EqualFold(identity["mysqlx"], "OFF"),
+		EnableAdminAddress:   identity["admin-port"] != "",
+	}
+	if isGroup {
+		groupPort, err := findFreePort(maxGroupPort+1, installedPorts, 1)
+		if err != nil {
+			return extraNode, err
+		}
+		localAddress := identity[groupLocalAddressOption]
+		groupHost := localAddress[:strings.LastIndex(localAddress, ":")]
+		localAddress = fmt.Sprintf("%s:%d", groupHost, groupPort)
+		groupSeeds = append(groupSeeds, localAddress)
+		sandboxDef.MorePorts = []int{groupPort}
+		sandboxDef.InstalledPorts = append(sandboxDef.InstalledPorts, groupPort)
+		sandboxDef.MyCnfOptions = append(sandboxDef.MyCnfOptions,
+			fmt.Sprintf("report-host=%s", groupHost),
+			fmt.Sprintf("%s=%s", groupLocalAddressOption, localAddress),
+			fmt.Sprintf("%s=%s", groupSeedsOption, strings.Join(groupSeeds, ",")))
+	}
+	if common.DirExists(extraNode.Dir) {
+		return extraNode, fmt.Errorf(globals.ErrNamedDirectoryAlreadyExists, "node", extraNode.Dir)
+	}
+	execList, err := CreateChildSandbox(sandboxDef)
+	if err != nil {
+		_ = os.RemoveAll(extraNode.Dir)
+		return extraNode, fmt.Errorf(globals.ErrCreatingSandbox, err)
+	}
+	concurrent.RunParallelTasksByPriority(execList)
+	return extraNode, nil
+}
+
+// UpdateNodeList records the nodes of a sandbox after some of them were added or removed.
+// The sandbox description and the catalog get the new nodes and ports, and the "nN" scripts
+// are written for each node. In group and multiple sandboxes, the scripts that run commands
+// in all nodes are written again. In master-slave sandboxes these scripts depend on the
+// replication roles, and are written by WriteReplicationRoleScripts.
+func UpdateNodeList(sandboxDir string, nodes []string) error {
+	sbDesc, err := common.ReadSandboxDescription(sandboxDir)
+	if err != nil {
+		return err
+	}
+	err = checkNodeListType(sbDesc)
+	if err != nil {
+		return err
+	}
+	isMasterSlave := sbDesc.SBType == globals.MasterSlaveLabel
+	numbers := make(map[string]int)
+	for _, node := range nodes {
+		numbers[node], err = NodeScriptNumber(sbDesc.SBType, node)
+		if err != nil {
+			return err
+		}
+	}
+	nodes = append([]string{}, nodes...)
+	sort.Slice(nodes, func(i, j int) bool { return numbers[nodes[i]] < numbers[nodes[j]] })
+	var ports []int
+	var nodeVersions []common.NodeVersion
+	withAdmin := false
+	for i, node := range nodes {
+		nodeDir := path.Join(sandboxDir, node)
+		nodeDesc, err := common.ReadSandboxDescription(nodeDir)
+		if err != nil {
+			return err
+		}
+		ports = append(ports, nodeDesc.Port...)
+		nodeVersions = append(nodeVersions, common.NodeVersion{
+			Node:    node,
+			Version: nodeDesc.Version,
+			Flavor:  nodeDesc.Flavor,
+			Basedir: nodeDesc.Basedir,
+		})
+		// The scripts of group and multiple sandboxes refer to nodes by number, from 1 to the number of nodes
+		if !isMasterSlave && numbers[node] != i+1 {
+			return fmt.Errorf("the nodes of %s must be numbered from 1 to %d. Found: %v", sandboxDir, len(nodes), nodes)
+		}
+		if common.ExecExists(path.Join(nodeDir, globals.ScriptUseAdmin)) {
+			withAdmin = true
+		}
+	}
+	// Node versions are only recorded for sandboxes that use different binaries for each node
+	if len(sbDesc.NodeVersions) == 0 {
+		nodeVersions = nil
+	}
+	sbDesc.Port = ports
+	sbDesc.Nodes = len(nodes)
+	if isMasterSlave {
+		sbDesc.Nodes = len(nodes) - 1
+	}
+	sbDesc.NodeVersions = nodeVersions
+	err = common.UpdateSandboxDescription(sandboxDir, sbDesc)
+	if err != nil {
+		return err
+	}
+	err = defaults.UpdateCatalogNodes(sandboxDir, nodes, ports, nodeVersions)
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Now()
+	maxNumber := 0
+	for _, node := range nodes {
+		number := numbers[node]
+		if number > maxNumber {
+			maxNumber = number
+		}
+		dataNode := common.StringMap{
+			"ShellPath":  defaults.Defaults().ShellPath,
+			"Copyright":  globals.ShellScriptCopyright,
+			"AppVersion": common.VersionDef,
+			"DateTime":   timestamp.Format(time.UnixDate),
+			"Node":       number,
+			"NodeLabel":  defaults.Defaults().NodePrefix,
+			"SandboxDir": sandboxDir,
+		}
+		scripts := []ScriptDef{{fmt.Sprintf("n%d", number), globals.TmplNode, true}}
+		if withAdmin {
+			scripts = append(scripts, ScriptDef{fmt.Sprintf("na%d", number), globals.TmplNodeAdmin, true})
+		}
+		templates := MultipleTemplates
+		if isMasterSlave {
+			dataNode["Node"] = node
+			dataNode["NodeLabel"] = ""
+			templates = ReplicationTemplates
+			scripts[0].templateName = globals.TmplSlave
+			if withAdmin {
+				scripts[1].templateName = globals.TmplSlaveAdmin
+			}
+		}
+		err = writeScripts(ScriptBatch{templates, nil, sandboxDir, dataNode, scripts})
+		if err != nil {
+			return err
+		}
+	}
+	for number := maxNumber + 1; common.FileExists(path.Join(sandboxDir, fmt.Sprintf("n%d", number))); number++ {
+		for _, script := range []string{fmt.Sprintf("n%d", number), fmt.Sprintf("na%d", number)} {
+			if common.FileExists(path.Join(sandboxDir, script)) {
+				err = os.Remove(path.Join(sandboxDir, script))
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if isMasterSlave {
+		return nil
+	}
+	return writeNodeListScripts(sandboxDir, sbDesc, len(nodes), withAdmin)
+}
+
+// writeNodeListScripts writes the scripts of a group or multiple sandbox that run commands in all nodes
+func writeNodeListScripts(sandboxDir string, sbDesc common.SandboxDescription, nodes int, withAdmin bool) error {
+	connection, err := readNodeConnection(path.Join(sandboxDir, defaults.Defaults().NodePrefix+"1"), globals.ScriptConnectionJson)
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now()
+	slaveLabel := defaults.Defaults().SlavePrefix
+	masterLabel := defaults.Defaults().MasterName
+	nodeLabel := defaults.Defaults().NodePrefix
+	masterList := makeNodesList(nodes)
+	slaveList := masterList
+	if sbDesc.SBType == "group-single-primary" {
+		masterList = "1"
+		slaveList = strings.TrimPrefix(makeNodesList(nodes), "1 ")
+	}
+	stopNodeList := ""
+	for i := nodes; i > 0; i-- {
+		stopNodeList += fmt.Sprintf(" %d", i)
+	}
+	var data = common.StringMap{
+		"ShellPath":         defaults.Defaults().ShellPath,
+		"Copyright":         globals.ShellScriptCopyright,
+		"AppVersion":        common.VersionDef,
+		"DateTime":          timestamp.Format(time.UnixDate),
+		"SandboxDir":        sandboxDir,
+		"MasterIp":          connection.Host,
+		"MasterList":        masterList,
+		"NodeLabel":         nodeLabel,
+		"SlaveList":         slaveList,
+		"RplUser":           connection.User,
+		"RplPassword":       connection.Password,
+		"SlaveLabel":        slaveLabel,
+		"SlaveAbbr":         defaults.Defaults().SlaveAbbr,
+		"ChangeMasterExtra": "",
+		"MasterLabel":       masterLabel,
+		"MasterAbbr":        defaults.Defaults().MasterAbbr,
+		"StopNodeList":      stopNodeList,
+		"Nodes":             []common.StringMap{},
+	}
+	for i := 1; i <= nodes; i++ {
+		nodePort, err := extraNodePort(path.Join(sandboxDir, fmt.Sprintf("%s%d", nodeLabel, i)))
+		if err != nil {
+			return err
+		}
+		data["Nodes"] = append(data["Nodes"].([]common.StringMap), common.StringMap{
+			"ShellPath":         defaults.Defaults().ShellPath,
+			"Copyright":         globals.ShellScriptCopyright,
+			"AppVersion":        common.VersionDef,
+			"DateTime":          timestamp.Format(time.UnixDate),
+			"Node":              i,
+			"NodePort":          nodePort,
+			"MasterIp":          connection.Host,
+			"NodeLabel":         nodeLabel,
+			"SlaveLabel":        slaveLabel,
+			"SlaveAbbr":         defaults.Defaults().SlaveAbbr,
+			"ChangeMasterExtra": "",
+			"MasterLabel":       masterLabel,
+			"MasterAbbr":        defaults.Defaults().MasterAbbr,
+			"SandboxDir":        sandboxDir,
+			"StopNodeList":      stopNodeList,
+			"RplUser":           connection.User,
+			"RplPassword":       connection.Password,
+		})
+	}
+	batches := []ScriptBatch{
+		{
+			tc:         MultipleTemplates,
+			sandboxDir: sandboxDir,
+			data:       data,
+			scripts: []ScriptDef{
+				{globals.ScriptStartAll, globals.TmplStartMulti, true},
+				{globals.ScriptRestartAll, globals.TmplRestartMulti, true},
+				{globals.ScriptStatusAll, globals.TmplStatusMulti, true},
+				{globals.ScriptTestSbAll, globals.TmplTestSbMulti, true},
+				{globals.ScriptStopAll, globals.TmplStopMulti, true},
+				{globals.ScriptClearAll, globals.TmplClearMulti, true},
+				{globals.ScriptSendKillAll, globals.TmplSendKillMulti, true},
+				{globals.ScriptUseAll, globals.TmplUseMulti, true},
+				{globals.ScriptExecAll, globals.TmplExecMulti, true},
+				{globals.ScriptMetadataAll, globals.TmplMetadataMulti, true},
+				{globals.ScriptReplicateFrom, globals.TmplReplicateFromMulti, true},
+				{globals.ScriptSysbench, globals.TmplSysbenchMulti, true},
+				{globals.ScriptSysbenchReady, globals.TmplSysbenchReadyMulti, true},
+			},
+		},
+	}
+	if withAdmin {
+		batches[0].scripts = append(batches[0].scripts, ScriptDef{globals.ScriptUseAllAdmin, globals.TmplUseMultiAdmin, true})
+	}
+	if strings.HasPrefix(sbDesc.SBType, globals.GroupLabel) {
+		slavePlural := english.PluralWord(2, slaveLabel, "")
+		masterPlural := english.PluralWord(2, masterLabel, "")
+		batches = append(batches,
+			ScriptBatch{
+				tc:         ReplicationTemplates,
+				sandboxDir: sandboxDir,
+				data:       data,
+				scripts: []ScriptDef{
+					{"use_all_" + slavePlural, globals.TmplMultiSourceUseSlaves, true},
+					{"use_all_" + masterPlural, globals.TmplMultiSourceUseMasters, true},
+					{"exec_all_" + masterPlural, globals.TmplMultiSourceExecMasters, true},
+					{"exec_all_" + slavePlural, globals.TmplMultiSourceExecSlaves, true},
+					{globals.ScriptTestReplication, globals.TmplMultiSourceTest, true},
+					{globals.ScriptWipeRestartAll, globals.TmplWipeAndRestartAll, true},
+				},
+			},
+			ScriptBatch{
+				tc:         GroupTemplates,
+				sandboxDir: sandboxDir,
+				data:       data,
+				scripts: []ScriptDef{
+					{globals.ScriptInitializeNodes, globals.TmplInitNodes, true},
+					{globals.ScriptCheckNodes, globals.TmplCheckNodes, true},
+				},
+			})
+	}
+	for _, sb := range batches {
+		err = writeScripts(sb)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extraNodePort returns the main port of a node
+func extraNodePort(nodeDir string) (int, error) {
+	nodeDesc, err := common.ReadSandboxDescription(nodeDir)
+	if err != nil {
+		return 0, err
+	}
+	if len(nodeDesc.Port) == 0 {
+		return 0, fmt.Errorf("no port found in the description of %s", nodeDir)
+	}
+	return nodeDesc.Port[0], nil
+}
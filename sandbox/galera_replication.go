@@ -0,0 +1,390 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2021 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/dustin/go-humanize/english"
+	"github.com/pkg/errors"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/concurrent"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+)
+
+// Directories, relative to the basedir, where MariaDB tarballs keep the Galera library
+var galeraProviderDirs = []string{"lib/galera-4", "lib/galera", "lib"}
+
+// galeraProvider returns the full path of the Galera library (wsrep provider) in a MariaDB basedir
+func galeraProvider(basedir string) (string, error) {
+	for _, dir := range galeraProviderDirs {
+		provider := path.Join(basedir, dir, globals.FnLibGaleraSmmSo)
+		if common.FileExists(provider) {
+			return provider, nil
+		}
+	}
+	return "", fmt.Errorf("galera library %s not found in %s (searched %v)",
+		globals.FnLibGaleraSmmSo, basedir, galeraProviderDirs)
+}
+
+func CreateGaleraReplication(sandboxDef SandboxDef, origin string, nodes int, masterIp string) error {
+	var execLists []concurrent.ExecutionList
+
+	err := common.CheckPrerequisites("Galera", globals.NeededGaleraExecutables)
+	if err != nil {
+		return err
+	}
+	var logger *defaults.Logger
+	if sandboxDef.Logger != nil {
+		logger = sandboxDef.Logger
+	} else {
+		var fileName string
+		var err error
+		logger, fileName, err = defaults.NewLogger(common.LogDirName(), "galera-replication")
+		if err != nil {
+			return err
+		}
+		sandboxDef.LogFileName = common.ReplaceLiteralHome(fileName)
+	}
+
+	readOnlyOptions, err := checkReadOnlyFlags(sandboxDef)
+	if err != nil {
+		return err
+	}
+	if readOnlyOptions != "" {
+		return fmt.Errorf("options --read-only and --super-read-only can't be used for Galera topology")
+	}
+	wsrepProvider, err := galeraProvider(sandboxDef.Basedir)
+	if err != nil {
+		return err
+	}
+
+	vList, err := common.VersionToList(sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+	rev := vList[2]
+	basePort := computeBaseport(sandboxDef.Port + defaults.Defaults().GaleraBasePort + (rev * 100))
+	if sandboxDef.BasePort > 0 {
+		basePort = sandboxDef.BasePort
+	}
+
+	if nodes < 3 {
+		return fmt.Errorf("can't run Galera replication with less than 3 nodes")
+	}
+	if common.DirExists(sandboxDef.SandboxDir) {
+		sandboxDef, err = checkDirectory(sandboxDef)
+		if err != nil {
+			return err
+		}
+	}
+	// As in PXC, each node uses a client port, a group communication port
+	// followed by the IST port, and a port to receive the SST
+	firstPort, err := findFreePort(basePort+1, sandboxDef.InstalledPorts, nodes)
+	if err != nil {
+		return errors.Wrapf(err, "error retrieving free port for replication")
+	}
+	groupPortDelta := defaults.Defaults().GroupPortDelta
+	rsyncPortDelta := groupPortDelta + nodes + 10
+	basePort = firstPort - 1
+	baseGroupPort := basePort + groupPortDelta
+	baseRsyncPort := basePort + rsyncPortDelta
+
+	firstPort, err = findFreePort(baseGroupPort+1, sandboxDef.InstalledPorts, nodes*2)
+	if err != nil {
+		return errors.Wrapf(err, "error retrieving Galera replication free port")
+	}
+	baseGroupPort = firstPort - 1
+	for checkPort := basePort + 1; checkPort < basePort+nodes+1; checkPort++ {
+		err = checkPortAvailability("CreateGaleraReplication", sandboxDef.SandboxDir, sandboxDef.InstalledPorts, checkPort)
+		if err != nil {
+			return err
+		}
+	}
+	for checkPort := baseGroupPort + 1; checkPort < baseGroupPort+(nodes*2)+1; checkPort++ {
+		err = checkPortAvailability("CreateGaleraReplication-group", sandboxDef.SandboxDir, sandboxDef.InstalledPorts, checkPort)
+		if err != nil {
+			return err
+		}
+	}
+	firstPort, err = findFreePort(baseRsyncPort+1, sandboxDef.InstalledPorts, nodes)
+	if err != nil {
+		return errors.Wrapf(err, "error retrieving Galera replication free port")
+	}
+	baseRsyncPort = firstPort - 1
+	for checkPort := baseRsyncPort + 1; checkPort < baseRsyncPort+nodes+1; checkPort++ {
+		err = checkPortAvailability("CreateGaleraReplication-rsync", sandboxDef.SandboxDir, sandboxDef.InstalledPorts, checkPort)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.Mkdir(sandboxDef.SandboxDir, globals.PublicDirectoryAttr)
+	if err != nil {
+		return err
+	}
+	common.AddToCleanupStack(common.RmdirAll, "RmdirAll", sandboxDef.SandboxDir)
+	logger.Printf("Creating directory %s\n", sandboxDef.SandboxDir)
+	timestamp := time.Now()
+	slaveLabel := defaults.Defaults().SlavePrefix
+	slaveAbbr := defaults.Defaults().SlaveAbbr
+	masterAbbr := defaults.Defaults().MasterAbbr
+	masterLabel := defaults.Defaults().MasterName
+	masterList := makeNodesList(nodes)
+	slaveList := masterList
+	changeMasterExtra := setChangeMasterProperties("", sandboxDef.ChangeMasterOptions, logger)
+
+	stopNodeList := ""
+	for i := nodes; i > 0; i-- {
+		stopNodeList += fmt.Sprintf(" %d", i)
+	}
+	nodeLabel := defaults.Defaults().NodePrefix
+	var data = common.StringMap{
+		"ShellPath":         sandboxDef.ShellPath,
+		"Copyright":         globals.ShellScriptCopyright,
+		"AppVersion":        common.VersionDef,
+		"DateTime":          timestamp.Format(time.UnixDate),
+		"SandboxDir":        sandboxDef.SandboxDir,
+		"MasterIp":          masterIp,
+		"MasterList":        masterList,
+		"NodeLabel":         nodeLabel,
+		"SlaveList":         slaveList,
+		"RplUser":           sandboxDef.RplUser,
+		"RplPassword":       sandboxDef.RplPassword,
+		"SlaveLabel":        slaveLabel,
+		"SlaveAbbr":         slaveAbbr,
+		"ChangeMasterExtra": changeMasterExtra,
+		"MasterLabel":       masterLabel,
+		"MasterAbbr":        masterAbbr,
+		"StopNodeList":      stopNodeList,
+		"Nodes":             []common.StringMap{},
+	}
+
+	sbDesc := common.SandboxDescription{
+		Basedir: sandboxDef.Basedir,
+		SBType:  globals.GaleraLabel,
+		Version: sandboxDef.Version,
+		Flavor:  sandboxDef.Flavor,
+		Port:    []int{},
+		Nodes:   nodes,
+		NodeNum: 0,
+		LogFile: sandboxDef.LogFileName,
+	}
+
+	sbItem := defaults.SandboxItem{
+		Origin:      sbDesc.Basedir,
+		SBType:      sbDesc.SBType,
+		Version:     sandboxDef.Version,
+		Flavor:      sandboxDef.Flavor,
+		Port:        []int{},
+		Nodes:       []string{},
+		Destination: sandboxDef.SandboxDir,
+		ExpiresAt:   sandboxDef.ExpiresAt,
+	}
+
+	if sandboxDef.LogFileName != "" {
+		sbItem.LogDirectory = common.DirName(sandboxDef.LogFileName)
+	}
+
+	baseReplicationOptions := sandboxDef.ReplOptions
+	clusterName := common.BaseName(sandboxDef.SandboxDir)
+	groupCommunication := "gcomm://"
+	for i := 1; i <= nodes; i++ {
+		groupCommunication += fmt.Sprintf("%s:%d", masterIp, baseGroupPort+(i*2))
+		if i < nodes {
+			groupCommunication += ","
+		}
+	}
+	logger.Printf("Creating connection string %s\n", groupCommunication)
+
+	for i := 1; i <= nodes; i++ {
+		groupPort := baseGroupPort + (i * 2)
+		rsyncPort := baseRsyncPort + i
+		sandboxDef.Port = basePort + i
+		data["Nodes"] = append(data["Nodes"].([]common.StringMap), common.StringMap{
+			"ShellPath":         sandboxDef.ShellPath,
+			"Copyright":         globals.ShellScriptCopyright,
+			"AppVersion":        common.VersionDef,
+			"DateTime":          timestamp.Format(time.UnixDate),
+			"Node":              i,
+			"NodePort":          sandboxDef.Port,
+			"MasterIp":          masterIp,
+			"NodeLabel":         nodeLabel,
+			"SlaveLabel":        slaveLabel,
+			"SlaveAbbr":         slaveAbbr,
+			"ChangeMasterExtra": changeMasterExtra,
+			"MasterLabel":       masterLabel,
+			"MasterAbbr":        masterAbbr,
+			"StopNodeList":      stopNodeList,
+			"SandboxDir":        sandboxDef.SandboxDir,
+			"RplUser":           sandboxDef.RplUser,
+			"RplPassword":       sandboxDef.RplPassword,
+		})
+
+		sandboxDef.DirName = fmt.Sprintf("%s%d", nodeLabel, i)
+		sandboxDef.MorePorts = []int{
+			groupPort,
+			groupPort + 1, // IST port
+			rsyncPort}
+		sandboxDef.ServerId = setServerId(sandboxDef, i)
+		sbItem.Nodes = append(sbItem.Nodes, sandboxDef.DirName)
+		for _, port := range []int{sandboxDef.Port, groupPort, groupPort + 1, rsyncPort} {
+			sbItem.Port = append(sbItem.Port, port)
+			sbDesc.Port = append(sbDesc.Port, port)
+		}
+
+		if !sandboxDef.RunConcurrently {
+			installationMessage := "Installing and starting %s %d\n"
+			if sandboxDef.SkipStart {
+				installationMessage = "Installing %s %d\n"
+			}
+			common.CondPrintf(installationMessage, nodeLabel, i)
+			logger.Printf(installationMessage, nodeLabel, i)
+		}
+
+		galeraReplicationData := common.StringMap{
+			"NodeIp":             masterIp,
+			"WsrepProvider":      wsrepProvider,
+			"ClusterName":        clusterName,
+			"GroupCommunication": groupCommunication,
+			"RsyncPort":          rsyncPort,
+			"GroupPort":          groupPort,
+			"SstMethod":          "rsync",
+		}
+		galeraFilledTemplate, err := common.SafeTemplateFill(globals.TmplGaleraReplication,
+			GaleraTemplates[globals.TmplGaleraReplication].Contents, galeraReplicationData)
+		if err != nil {
+			return fmt.Errorf("error filling Galera replication template %s", err)
+		}
+		sandboxDef.ReplOptions = baseReplicationOptions + fmt.Sprintf("\n%s\n", galeraFilledTemplate)
+
+		sandboxDef.Multi = true
+		// The first node creates the cluster. The others join it, and receive
+		// the data, including the grants, through SST
+		if i == 1 {
+			sandboxDef.StartArgs = []string{"--wsrep-new-cluster"}
+			sandboxDef.LoadGrants = true
+		} else {
+			sandboxDef.StartArgs = []string{}
+			sandboxDef.LoadGrants = false
+		}
+		sandboxDef.Prompt = fmt.Sprintf("%s%d", nodeLabel, i)
+		sandboxDef.SBType = "galera-node"
+		sandboxDef.NodeNum = i
+		logger.Printf("Create single sandbox for node %d\n", i)
+		execList, err := CreateChildSandbox(sandboxDef)
+		if err != nil {
+			return fmt.Errorf(globals.ErrCreatingSandbox, err)
+		}
+		execLists = append(execLists, execList...)
+		var dataNode = common.StringMap{
+			"ShellPath":         sandboxDef.ShellPath,
+			"Copyright":         globals.ShellScriptCopyright,
+			"AppVersion":        common.VersionDef,
+			"DateTime":          timestamp.Format(time.UnixDate),
+			"Node":              i,
+			"NodePort":          sandboxDef.Port,
+			"NodeLabel":         nodeLabel,
+			"MasterLabel":       masterLabel,
+			"MasterAbbr":        masterAbbr,
+			"ChangeMasterExtra": changeMasterExtra,
+			"SlaveLabel":        slaveLabel,
+			"SlaveAbbr":         slaveAbbr,
+			"SandboxDir":        sandboxDef.SandboxDir,
+		}
+		logger.Printf("Create node script for node %d\n", i)
+		err = writeScript(logger, MultipleTemplates, fmt.Sprintf("n%d", i), globals.TmplNode, sandboxDef.SandboxDir, dataNode, true)
+		if err != nil {
+			return err
+		}
+	}
+	logger.Printf("Writing sandbox description in %s\n", sandboxDef.SandboxDir)
+	err = common.WriteSandboxDescription(sandboxDef.SandboxDir, sbDesc)
+	if err != nil {
+		return errors.Wrapf(err, "unable to write sandbox description")
+	}
+	err = defaults.UpdateCatalog(sandboxDef.SandboxDir, sbItem)
+	if err != nil {
+		return errors.Wrapf(err, "unable to update catalog")
+	}
+
+	logger.Printf("Writing Galera replication scripts\n")
+	sbMultiple := ScriptBatch{
+		tc:         MultipleTemplates,
+		logger:     logger,
+		data:       data,
+		sandboxDir: sandboxDef.SandboxDir,
+		scripts: []ScriptDef{
+			{globals.ScriptRestartAll, globals.TmplRestartMulti, true},
+			{globals.ScriptStatusAll, globals.TmplStatusMulti, true},
+			{globals.ScriptTestSbAll, globals.TmplTestSbMulti, true},
+			{globals.ScriptStopAll, globals.TmplStopMulti, true},
+			{globals.ScriptClearAll, globals.TmplClearMulti, true},
+			{globals.ScriptSendKillAll, globals.TmplSendKillMulti, true},
+			{globals.ScriptUseAll, globals.TmplUseMulti, true},
+			{globals.ScriptMetadataAll, globals.TmplMetadataMulti, true},
+			{globals.ScriptReplicateFrom, globals.TmplReplicateFromMulti, true},
+			{globals.ScriptSysbench, globals.TmplSysbenchMulti, true},
+			{globals.ScriptSysbenchReady, globals.TmplSysbenchReadyMulti, true},
+		},
+	}
+
+	slavePlural := english.PluralWord(2, slaveLabel, "")
+	masterPlural := english.PluralWord(2, masterLabel, "")
+	useAllMasters := "use_all_" + masterPlural
+	useAllSlaves := "use_all_" + slavePlural
+
+	sbRepl := ScriptBatch{
+		tc:         ReplicationTemplates,
+		logger:     logger,
+		data:       data,
+		sandboxDir: sandboxDef.SandboxDir,
+		scripts: []ScriptDef{
+			{useAllSlaves, globals.TmplMultiSourceUseSlaves, true},
+			{useAllMasters, globals.TmplMultiSourceUseMasters, true},
+			{globals.ScriptTestReplication, globals.TmplMultiSourceTest, true},
+		},
+	}
+	// Starting with --wsrep-new-cluster and checking the wsrep status work the same as in PXC
+	sbGalera := ScriptBatch{
+		tc:         PxcTemplates,
+		logger:     logger,
+		data:       data,
+		sandboxDir: sandboxDef.SandboxDir,
+		scripts: []ScriptDef{
+			{globals.ScriptStartAll, globals.TmplPxcStart, true},
+			{globals.ScriptCheckNodes, globals.TmplPxcCheckNodes, true},
+		},
+	}
+
+	for _, sb := range []ScriptBatch{sbMultiple, sbRepl, sbGalera} {
+		err := writeScripts(sb)
+		if err != nil {
+			return err
+		}
+	}
+
+	logger.Printf("Running parallel tasks\n")
+	concurrent.RunParallelTasksByPriority(execLists)
+
+	common.CondPrintf("Replication directory installed in %s\n", common.ReplaceLiteralHome(sandboxDef.SandboxDir))
+	common.CondPrintf("run 'dbdeployer usage multiple' for basic instructions'\n")
+	return nil
+}
@@ -42,7 +42,7 @@ func getBaseMysqlxPort(basePort int, sdef SandboxDef, nodes int) (int, error) {
 		// FindFreePort returns the first free port, but base_port will be used
 		// with a counter. Thus the availability will be checked using
 		// "base_port + 1"
-		firstGroupPort, err := common.FindFreePort(baseMysqlxPort+1, sdef.InstalledPorts, nodes)
+		firstGroupPort, err := findFreePort(baseMysqlxPort+1, sdef.InstalledPorts, nodes)
 		if err != nil {
 			return -1, errors.Wrapf(err, "error finding a free port for MySQLX")
 		}
@@ -78,7 +78,7 @@ func getBaseAdminPort(basePort int, sdef SandboxDef, nodes int) (int, error) {
 		// FindFreePort returns the first free port, but base_port will be used
 		// with a counter. Thus the availability will be checked using
 		// "base_port + 1"
-		firstAdminPort, err := common.FindFreePort(baseAdminPort+1, sdef.InstalledPorts, nodes)
+		firstAdminPort, err := findFreePort(baseAdminPort+1, sdef.InstalledPorts, nodes)
 		if err != nil {
 			return -1, errors.Wrapf(err, "error finding a free admin port")
 		}
@@ -95,22 +95,40 @@ func getBaseAdminPort(basePort int, sdef SandboxDef, nodes int) (int, error) {
 }
 
 func CreateGroupReplication(sandboxDef SandboxDef, origin string, nodes int, masterIp string) error {
+	return createGroupReplication(sandboxDef, origin, nodes, masterIp, false)
+}
+
+// createGroupReplication deploys the nodes of a group. When withAdminAPI is set, the group
+// is an InnoDB Cluster, created by MySQL Shell instead of the initialize_nodes script
+func createGroupReplication(sandboxDef SandboxDef, origin string, nodes int, masterIp string, withAdminAPI bool) error {
 	var execLists []concurrent.ExecutionList
 	var err error
 
+	logName := "group-replication"
+	if withAdminAPI {
+		logName = globals.InnoDBClusterLabel
+	}
 	var logger *defaults.Logger
 	if sandboxDef.Logger != nil {
 		logger = sandboxDef.Logger
 	} else {
 		var fileName string
 		var err error
-		logger, fileName, err = defaults.NewLogger(common.LogDirName(), "group-replication")
+		logger, fileName, err = defaults.NewLogger(common.LogDirName(), logName)
 		if err != nil {
 			return err
 		}
 		sandboxDef.LogFileName = common.ReplaceLiteralHome(fileName)
 	}
 
+	mysqlShell := ""
+	if withAdminAPI {
+		mysqlShell, err = mysqlShellExecutable(sandboxDef.Basedir)
+		if err != nil {
+			return err
+		}
+	}
+
 	readOnlyOptions, err := checkReadOnlyFlags(sandboxDef)
 	if err != nil {
 		return err
@@ -129,6 +147,9 @@ func CreateGroupReplication(sandboxDef SandboxDef, origin string, nodes int, mas
 	if sandboxDef.SinglePrimary {
 		basePort = sandboxDef.Port + defaults.Defaults().GroupReplicationSpBasePort + (rev * 100)
 	}
+	if withAdminAPI {
+		basePort = computeBaseport(sandboxDef.Port + defaults.Defaults().InnoDBClusterBasePort + (rev * 100))
+	}
 	if sandboxDef.BasePort > 0 {
 		basePort = sandboxDef.BasePort
 	}
@@ -146,13 +167,13 @@ func CreateGroupReplication(sandboxDef SandboxDef, origin string, nodes int, mas
 	// FindFreePort returns the first free port, but base_port will be used
 	// with a counter. Thus the availability will be checked using
 	// "base_port + 1"
-	firstGroupPort, err := common.FindFreePort(basePort+1, sandboxDef.InstalledPorts, nodes)
+	firstGroupPort, err := findFreePort(basePort+1, sandboxDef.InstalledPorts, nodes)
 	if err != nil {
 		return errors.Wrapf(err, "error retrieving free port for replication")
 	}
 	basePort = firstGroupPort - 1
 	baseGroupPort := basePort + defaults.Defaults().GroupPortDelta
-	firstGroupPort, err = common.FindFreePort(baseGroupPort+1, sandboxDef.InstalledPorts, nodes)
+	firstGroupPort, err = findFreePort(baseGroupPort+1, sandboxDef.InstalledPorts, nodes)
 	if err != nil {
 		return errors.Wrapf(err, "error retrieving group replication free port")
 	}
@@ -190,7 +211,8 @@ func CreateGroupReplication(sandboxDef SandboxDef, origin string, nodes int, mas
 	masterLabel := defaults.Defaults().MasterName
 	masterList := makeNodesList(nodes)
 	slaveList := masterList
-	if sandboxDef.SinglePrimary {
+	// An InnoDB Cluster is created in single-primary mode, with the first node as primary
+	if sandboxDef.SinglePrimary || withAdminAPI {
 		masterList = "1"
 		slaveList = ""
 		for N := 2; N <= nodes; N++ {
@@ -238,6 +260,23 @@ func CreateGroupReplication(sandboxDef SandboxDef, origin string, nodes int, mas
 		"StopNodeList":      stopNodeList,
 		"Nodes":             []common.StringMap{},
 	}
+	syntax, err := common.GetReplicationSyntax(sandboxDef.Flavor, sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+	err = addReplicationSyntax(data, sandboxDef.Flavor, sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+	// transaction_write_set_extraction was deprecated in 8.0.26, and removed in 8.3
+	writeSetExtraction := "transaction_write_set_extraction=XXHASH64"
+	isReplicaTerminology, err := common.HasCapability(sandboxDef.Flavor, common.ReplicaTerminology, sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+	if isReplicaTerminology {
+		writeSetExtraction = ""
+	}
 	connectionString := ""
 	for i := 0; i < nodes; i++ {
 		groupPort := baseGroupPort + i + 1
@@ -254,6 +293,17 @@ func CreateGroupReplication(sandboxDef SandboxDef, origin string, nodes int, mas
 		sbType = "group-single-primary"
 		singlePrimaryMode = "on"
 	}
+	if withAdminAPI {
+		sbType = globals.InnoDBClusterLabel
+		singlePrimaryMode = "on"
+		data["MysqlShell"] = mysqlShell
+		data["ClusterName"] = clusterName(sandboxDef.SandboxDir)
+		data["ClusterAdmin"] = clusterAdminUser
+		data["ClusterPassword"] = sandboxDef.DbPassword
+		data["RemoteAccess"] = sandboxDef.RemoteAccess
+		data["PrimaryPort"] = basePort + 1
+		data["PrimaryGroupPort"] = baseGroupPort + 1
+	}
 	logger.Printf("Defining group type %s\n", sbType)
 
 	sbDesc := common.SandboxDescription{
@@ -275,6 +325,7 @@ func CreateGroupReplication(sandboxDef SandboxDef, origin string, nodes int, mas
 		Port:        []int{},
 		Nodes:       []string{},
 		Destination: sandboxDef.SandboxDir,
+		ExpiresAt:   sandboxDef.ExpiresAt,
 	}
 
 	if sandboxDef.LogFileName != "" {
@@ -300,6 +351,7 @@ func CreateGroupReplication(sandboxDef SandboxDef, origin string, nodes int, mas
 			"MasterAbbr":        masterAbbr,
 			"SandboxDir":        sandboxDef.SandboxDir,
 			"StopNodeList":      stopNodeList,
+			"GroupPort":         groupPort,
 			"RplUser":           sandboxDef.RplUser,
 			"RplPassword":       sandboxDef.RplPassword})
 
@@ -324,14 +376,21 @@ func CreateGroupReplication(sandboxDef SandboxDef, origin string, nodes int, mas
 
 		basePortText := fmt.Sprintf("%08d", basePort)
 		replicationData := common.StringMap{
-			"BasePort":       basePortText,
-			"GroupSeeds":     connectionString,
-			"LocalAddresses": fmt.Sprintf("%s:%d", masterIp, groupPort),
-			"PrimaryMode":    singlePrimaryMode,
+			"BasePort":           basePortText,
+			"GroupSeeds":         connectionString,
+			"LocalAddresses":     fmt.Sprintf("%s:%d", masterIp, groupPort),
+			"PrimaryMode":        singlePrimaryMode,
+			"ReplicaUpdates":     syntax.ReplicaUpdates,
+			"WriteSetExtraction": writeSetExtraction,
 		}
 
-		replOptionsText, err := common.SafeTemplateFill("group_replication",
-			GroupTemplates[globals.TmplGroupReplOptions].Contents, replicationData)
+		replOptionsTemplate := globals.TmplGroupReplOptions
+		if withAdminAPI {
+			// MySQL Shell sets the group replication options when the node joins the cluster
+			replOptionsTemplate = globals.TmplClusterOptions
+		}
+		replOptionsText, err := common.SafeTemplateFill(replOptionsTemplate,
+			GroupTemplates[replOptionsTemplate].Contents, replicationData)
 		if err != nil {
 			return err
 		}
@@ -341,7 +400,11 @@ func CreateGroupReplication(sandboxDef SandboxDef, origin string, nodes int, mas
 		sandboxDef.ReplOptions = reMasterIp.ReplaceAllString(sandboxDef.ReplOptions, masterIp)
 
 		sandboxDef.ReplOptions += fmt.Sprintf("\n%s\n", SingleTemplates[globals.TmplGtidOptions57].Contents)
-		sandboxDef.ReplOptions += fmt.Sprintf("\n%s\n", SingleTemplates[globals.TmplReplCrashSafeOptions].Contents)
+		replCrashSafeOptions, err := replCrashSafeOptionsFor(sandboxDef.Flavor, sandboxDef.Version)
+		if err != nil {
+			return err
+		}
+		sandboxDef.ReplOptions += fmt.Sprintf("\n%s\n", replCrashSafeOptions)
 
 		// 8.0.11
 		isMinimumMySQLXDefault, err := common.HasCapability(sandboxDef.Flavor, common.MySQLXDefault, sandboxDef.Version)
@@ -465,6 +528,15 @@ func CreateGroupReplication(sandboxDef SandboxDef, origin string, nodes int, mas
 			{globals.ScriptCheckNodes, globals.TmplCheckNodes, true},
 		},
 	}
+	initScript := globals.ScriptInitializeNodes
+	if withAdminAPI {
+		initScript = globals.ScriptInitializeCluster
+		sbGroup.scripts = []ScriptDef{
+			{globals.ScriptInitializeCluster, globals.TmplInitCluster, true},
+			{globals.ScriptCheckCluster, globals.TmplCheckCluster, true},
+			{globals.ScriptCheckNodes, globals.TmplCheckNodes, true},
+		}
+	}
 
 	for _, sb := range []ScriptBatch{sbMultiple, sbRepl, sbGroup} {
 		err := writeScripts(sb)
@@ -484,14 +556,18 @@ func CreateGroupReplication(sandboxDef SandboxDef, origin string, nodes int, mas
 	logger.Printf("Running parallel tasks\n")
 	concurrent.RunParallelTasksByPriority(execLists)
 	if !sandboxDef.SkipStart {
-		common.CondPrintln(path.Join(common.ReplaceLiteralHome(sandboxDef.SandboxDir), globals.ScriptInitializeNodes))
-		logger.Printf("Running group replication initialization script\n")
-		_, err := common.RunCmd(path.Join(sandboxDef.SandboxDir, globals.ScriptInitializeNodes))
+		common.CondPrintln(path.Join(common.ReplaceLiteralHome(sandboxDef.SandboxDir), initScript))
+		logger.Printf("Running group replication initialization script %s\n", initScript)
+		_, err := common.RunCmd(path.Join(sandboxDef.SandboxDir, initScript))
 		if err != nil {
 			return fmt.Errorf("error initializing group replication: %s", err)
 		}
 	}
-	common.CondPrintf("Group Replication directory installed in %s\n", common.ReplaceLiteralHome(sandboxDef.SandboxDir))
+	if withAdminAPI {
+		common.CondPrintf("InnoDB Cluster directory installed in %s\n", common.ReplaceLiteralHome(sandboxDef.SandboxDir))
+	} else {
+		common.CondPrintf("Group Replication directory installed in %s\n", common.ReplaceLiteralHome(sandboxDef.SandboxDir))
+	}
 	common.CondPrintf("run 'dbdeployer usage multiple' for basic instructions'\n")
 	return nil
 }
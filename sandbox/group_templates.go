@@ -36,6 +36,15 @@ var (
 	//go:embed templates/group/group_repl_options.gotxt
 	groupReplOptionsTemplate string
 
+	//go:embed templates/group/init_cluster.gotxt
+	initClusterTemplate string
+
+	//go:embed templates/group/check_cluster.gotxt
+	checkClusterTemplate string
+
+	//go:embed templates/group/cluster_options.gotxt
+	clusterOptionsTemplate string
+
 	GroupTemplates = TemplateCollection{
 		globals.TmplInitNodes: TemplateDesc{
 			Description: "Initialize group replication after deployment",
@@ -52,5 +61,20 @@ var (
 			Notes:       "",
 			Contents:    groupReplOptionsTemplate,
 		},
+		globals.TmplInitCluster: TemplateDesc{
+			Description: "Creates an InnoDB Cluster with MySQL Shell after deployment",
+			Notes:       "",
+			Contents:    initClusterTemplate,
+		},
+		globals.TmplCheckCluster: TemplateDesc{
+			Description: "Shows the status of an InnoDB Cluster",
+			Notes:       "",
+			Contents:    checkClusterTemplate,
+		},
+		globals.TmplClusterOptions: TemplateDesc{
+			Description: "replication options for InnoDB Cluster node",
+			Notes:       "",
+			Contents:    clusterOptionsTemplate,
+		},
 	}
 )
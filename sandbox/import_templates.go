@@ -21,7 +21,6 @@ package sandbox
 import (
 	_ "embed"
 	"fmt"
-	"os"
 	"regexp"
 
 	"github.com/datacharmer/dbdeployer/globals"
@@ -155,13 +154,11 @@ func init() {
 	re := regexp.MustCompile(`^` + importPrefix)
 	for name := range ImportTemplates {
 		if !re.MatchString(name) {
-			fmt.Printf("found template name '%s' that does not start with '%s'\n", name, importPrefix)
-			os.Exit(1)
+			panic(fmt.Sprintf("found template name '%s' that does not start with '%s'", name, importPrefix))
 		}
 		if len(ImportTemplates[name].Contents) == 0 {
 			// The template is empty
-			fmt.Printf("Template '%s' is empty\n", name)
-			os.Exit(1)
+			panic(fmt.Sprintf("Template '%s' is empty", name))
 		}
 	}
 }
@@ -0,0 +1,67 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"fmt"
+	"os/exec"
+	"path"
+	"regexp"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/globals"
+)
+
+// Account used by MySQL Shell to manage the cluster, and by MySQL Router to bootstrap
+const clusterAdminUser = "icadmin"
+
+var reClusterNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// mysqlShellExecutable returns the MySQL Shell that manages a cluster: the one merged into
+// the server binaries with "dbdeployer unpack --shell", or the one in $PATH
+func mysqlShellExecutable(basedir string) (string, error) {
+	mysqlsh := path.Join(basedir, "bin", globals.FnMysqlsh)
+	if common.ExecExists(mysqlsh) {
+		return mysqlsh, nil
+	}
+	mysqlsh, err := exec.LookPath(globals.FnMysqlsh)
+	if err != nil {
+		return "", fmt.Errorf("InnoDB Cluster requires MySQL Shell, which was not found in %s or in $PATH.\n"+
+			"Merge it into the server binaries with 'dbdeployer unpack --%s mysql-shell-x.x.x.tar.gz'",
+			path.Join(basedir, "bin"), globals.ShellLabel)
+	}
+	return mysqlsh, nil
+}
+
+// clusterName returns the name of the cluster deployed in a sandbox directory,
+// using only the characters that the AdminAPI accepts
+func clusterName(sandboxDir string) string {
+	return reClusterNameChars.ReplaceAllString(path.Base(sandboxDir), "_")
+}
+
+// CreateInnoDBCluster deploys a group of nodes and makes them an InnoDB Cluster
+// using the MySQL Shell AdminAPI (dba.createCluster and cluster.addInstance)
+func CreateInnoDBCluster(sandboxDef SandboxDef, origin string, nodes int, masterIp string) error {
+	isMinimumCluster, err := common.HasCapability(sandboxDef.Flavor, common.InnoDBCluster, sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+	if !isMinimumCluster {
+		return fmt.Errorf(globals.ErrFeatureRequiresCapability, "InnoDB Cluster", common.MySQLFlavor,
+			common.IntSliceToDottedString(globals.MinimumInnoDBClusterVersion))
+	}
+	return createGroupReplication(sandboxDef, origin, nodes, masterIp, true)
+}
@@ -74,6 +74,7 @@ func SetMockEnvironment(mockUpperDir string) error {
 	defaults.ConfigurationDir = path.Join(home, defaults.ConfigurationDirName)
 	defaults.ConfigurationFile = path.Join(home, defaults.ConfigurationDirName, defaults.ConfigurationFileName)
 	defaults.SandboxRegistry = path.Join(home, defaults.ConfigurationDirName, defaults.SandboxRegistryName)
+	defaults.PortLeasesFile = path.Join(home, defaults.ConfigurationDirName, defaults.PortLeasesName)
 	return nil
 }
 
@@ -142,15 +143,10 @@ func CreateCustomMockVersion(version string, fileSet []MockFileSet) error {
 }
 
 func MySQLMockSet(debug bool) []MockFileSet {
-	currentOs := runtime.GOOS
-	extension := ""
-	switch currentOs {
-	case "linux":
-		extension = "so"
-	case "darwin":
+	// Shared libraries use the ".so" extension everywhere, except on MacOS
+	extension := "so"
+	if runtime.GOOS == "darwin" {
 		extension = "dylib"
-	default:
-		common.Exitf(1, "unhandled operating system %s", currentOs)
 	}
 	var fileSet []MockFileSet
 	libmysqlclientFileName := fmt.Sprintf("libmysqlclient.%s", extension)
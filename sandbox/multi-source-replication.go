@@ -113,7 +113,11 @@ func CreateAllMastersReplication(sandboxDef SandboxDef, origin string, nodes int
 	}
 
 	sandboxDef.GtidOptions = SingleTemplates[globals.TmplGtidOptions57].Contents
-	sandboxDef.ReplCrashSafeOptions = SingleTemplates[globals.TmplReplCrashSafeOptions].Contents
+	replCrashSafeOptions, err := replCrashSafeOptionsFor(sandboxDef.Flavor, sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+	sandboxDef.ReplCrashSafeOptions = replCrashSafeOptions
 	if sandboxDef.DirName == "" {
 		sandboxDef.DirName += defaults.Defaults().AllMastersPrefix + common.VersionToName(origin)
 	}
@@ -161,7 +165,7 @@ func CreateAllMastersReplication(sandboxDef SandboxDef, origin string, nodes int
 
 	setGlobal := "GLOBAL"
 	// persistent, err := common.GreaterOrEqualVersion(sandboxDef.Version, globals.MinimumRolesVersion)
-	persistent, err := common.HasCapability(sandboxDef.Flavor, common.SetPersist, sandboxDef.Version)
+	persistent, err := allNodesHaveCapability(sandboxDef, common.SetPersist)
 	if err != nil {
 		return err
 	}
@@ -182,6 +186,10 @@ func CreateAllMastersReplication(sandboxDef SandboxDef, origin string, nodes int
 	data["RplPassword"] = sandboxDef.RplPassword
 	data["NodeLabel"] = defaults.Defaults().NodePrefix
 	data["ChangeMasterExtra"] = setChangeMasterProperties("", sandboxDef.ChangeMasterOptions, logger)
+	err = addNodesReplicationSyntax(data, sandboxDef)
+	if err != nil {
+		return err
+	}
 	logger.Printf("Writing master and slave scripts in %s\n", sandboxDef.SandboxDir)
 	for _, node := range slaveList {
 		data["Node"] = node
@@ -318,7 +326,10 @@ func CreateFanInReplication(sandboxDef SandboxDef, origin string, nodes int, mas
 		slaveList = globals.SlaveListValue
 	}
 	sandboxDef.GtidOptions = SingleTemplates[globals.TmplGtidOptions57].Contents
-	sandboxDef.ReplCrashSafeOptions = SingleTemplates[globals.TmplReplCrashSafeOptions].Contents
+	sandboxDef.ReplCrashSafeOptions, err = replCrashSafeOptionsFor(sandboxDef.Flavor, sandboxDef.Version)
+	if err != nil {
+		return err
+	}
 	if sandboxDef.DirName == "" {
 		sandboxDef.DirName = defaults.Defaults().FanInPrefix + common.VersionToName(origin)
 	}
@@ -382,7 +393,7 @@ func CreateFanInReplication(sandboxDef SandboxDef, origin string, nodes int, mas
 
 	setGlobal := "GLOBAL"
 	// persistent, err := common.GreaterOrEqualVersion(sandboxDef.Version, globals.MinimumRolesVersion)
-	persistent, err := common.HasCapability(sandboxDef.Flavor, common.SetPersist, sandboxDef.Version)
+	persistent, err := allNodesHaveCapability(sandboxDef, common.SetPersist)
 	if err != nil {
 		return err
 	}
@@ -406,6 +417,10 @@ func CreateFanInReplication(sandboxDef SandboxDef, origin string, nodes int, mas
 	data["RplPassword"] = sandboxDef.RplPassword
 	data["NodeLabel"] = defaults.Defaults().NodePrefix
 	data["ChangeMasterExtra"] = setChangeMasterProperties("", sandboxDef.ChangeMasterOptions, logger)
+	err = addNodesReplicationSyntax(data, sandboxDef)
+	if err != nil {
+		return err
+	}
 	data["MasterIp"] = masterIp
 	logger.Printf("Writing master and slave scripts in %s\n", sandboxDef.SandboxDir)
 	for _, slave := range slist {
@@ -83,7 +83,7 @@ func CreateMultipleSandbox(sandboxDef SandboxDef, origin string, nodes int) (com
 	// FindFreePort returns the first free port, but base_port will be used
 	// with a counter. Thus the availability will be checked using
 	// "base_port + 1"
-	firstPort, err := common.FindFreePort(basePort+1, sandboxDef.InstalledPorts, nodes)
+	firstPort, err := findFreePort(basePort+1, sandboxDef.InstalledPorts, nodes)
 	if err != nil {
 		return emptyStringMap, errors.Wrapf(err, "error getting free port for multiple deployment")
 	}
@@ -154,6 +154,7 @@ func CreateMultipleSandbox(sandboxDef SandboxDef, origin string, nodes int) (com
 		Port:        []int{},
 		Nodes:       []string{},
 		Destination: sandboxDef.SandboxDir,
+		ExpiresAt:   sandboxDef.ExpiresAt,
 	}
 
 	if sandboxDef.LogFileName != "" {
@@ -181,8 +182,15 @@ func CreateMultipleSandbox(sandboxDef SandboxDef, origin string, nodes int) (com
 		sbItem.Nodes = append(sbItem.Nodes, sandboxDef.DirName)
 		sbItem.Port = append(sbItem.Port, sandboxDef.Port)
 		sbDesc.Port = append(sbDesc.Port, sandboxDef.Port)
+		nodeDef, err := nodeSandboxDef(sandboxDef, i)
+		if err != nil {
+			return emptyStringMap, err
+		}
+		if len(sandboxDef.NodeVersions) > 0 {
+			sbDesc.NodeVersions = append(sbDesc.NodeVersions, nodeVersionDescription(nodeDef, sandboxDef.DirName))
+		}
 		// isMinimumMySQLXDefault, err := common.GreaterOrEqualVersion(sandboxDef.Version, globals.MinimumMysqlxDefaultVersion)
-		isMinimumMySQLXDefault, err := common.HasCapability(sandboxDef.Flavor, common.MySQLXDefault, sandboxDef.Version)
+		isMinimumMySQLXDefault, err := common.HasCapability(nodeDef.Flavor, common.MySQLXDefault, nodeDef.Version)
 		if err != nil {
 			return emptyStringMap, err
 		}
@@ -210,7 +218,11 @@ func CreateMultipleSandbox(sandboxDef SandboxDef, origin string, nodes int) (com
 			logger.Printf("installing and starting %s %d", nodeLabel, i)
 		}
 		logger.Printf("Creating single sandbox for node %d\n", i)
-		execList, err := CreateChildSandbox(sandboxDef)
+		nodeDef, err = nodeSandboxDef(sandboxDef, i)
+		if err != nil {
+			return emptyStringMap, err
+		}
+		execList, err := CreateChildSandbox(nodeDef)
 		if err != nil {
 			return emptyStringMap, fmt.Errorf(globals.ErrCreatingSandbox, err)
 		}
@@ -240,6 +252,7 @@ func CreateMultipleSandbox(sandboxDef SandboxDef, origin string, nodes int) (com
 			}
 		}
 	}
+	sbItem.NodeVersions = sbDesc.NodeVersions
 	logger.Printf("Write sandbox description\n")
 	err = common.WriteSandboxDescription(sandboxDef.SandboxDir, sbDesc)
 	if err != nil {
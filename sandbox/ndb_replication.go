@@ -68,7 +68,7 @@ func CreateNdbReplication(sandboxDef SandboxDef, origin string, nodes int, ndbNo
 	// FindFreePort returns the first free port, but base_port will be used
 	// with a counter. Thus the availability will be checked using
 	// "base_port + 1"
-	firstPort, err := common.FindFreePort(basePort+1, sandboxDef.InstalledPorts, nodes)
+	firstPort, err := findFreePort(basePort+1, sandboxDef.InstalledPorts, nodes)
 	if err != nil {
 		return errors.Wrapf(err, "error getting free port for ndb deployment")
 	}
@@ -90,7 +90,7 @@ func CreateNdbReplication(sandboxDef SandboxDef, origin string, nodes int, ndbNo
 
 	ndbClusterPort := defaults.Defaults().NdbClusterPort + (rev * 100)
 
-	ndbClusterPort, err = common.FindFreePort(ndbClusterPort, sandboxDef.InstalledPorts, 1)
+	ndbClusterPort, err = findFreePort(ndbClusterPort, sandboxDef.InstalledPorts, 1)
 	if err != nil {
 		return errors.Wrapf(err, "error retrieving free port for ndb cluster")
 	}
@@ -192,6 +192,7 @@ func CreateNdbReplication(sandboxDef SandboxDef, origin string, nodes int, ndbNo
 		Port:        []int{ndbClusterPort},
 		Nodes:       []string{},
 		Destination: sandboxDef.SandboxDir,
+		ExpiresAt:   sandboxDef.ExpiresAt,
 	}
 
 	if sandboxDef.LogFileName != "" {
@@ -0,0 +1,232 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/pkg/errors"
+)
+
+var reShortNodeVersion = regexp.MustCompile(`^\d+\.\d+$`)
+
+// nodeVersionsTopologies lists the topologies that can use different binaries for each node
+var nodeVersionsTopologies = []string{globals.MasterSlaveLabel, globals.FanInLabel, globals.AllMastersLabel}
+
+// ParseNodeVersions reads a list of node binaries, such as "1:5.7.44,2:8.0.36,3:ps8.0.35",
+// where each element is a node number and the name of a directory under sandboxBinary.
+// Short versions (8.0) are resolved to the latest available revision, and absolute paths are
+// used as they are. The flavor of each node is detected from its binaries.
+func ParseNodeVersions(spec, sandboxBinary string) (map[int]common.NodeVersion, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, fmt.Errorf("empty node versions specification")
+	}
+	nodeVersions := make(map[int]common.NodeVersion)
+	for _, element := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(element), ":", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("element '%s' must be in the format 'node:version'", element)
+		}
+		node, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid node '%s' in element '%s'", parts[0], element)
+		}
+		if node < 1 {
+			return nil, fmt.Errorf("node number must be greater than 0 (found '%d' in element '%s')", node, element)
+		}
+		if _, found := nodeVersions[node]; found {
+			return nil, fmt.Errorf("node %d is listed more than once", node)
+		}
+		basedirName := parts[1]
+		basedir := path.Join(sandboxBinary, basedirName)
+		if path.IsAbs(basedirName) {
+			basedir = common.RemoveTrailingSlash(basedirName)
+			basedirName = path.Base(basedir)
+		} else if reShortNodeVersion.MatchString(basedirName) {
+			fullVersion, err := common.LatestVersion(sandboxBinary, basedirName)
+			if err != nil {
+				return nil, err
+			}
+			if fullVersion == "" {
+				return nil, fmt.Errorf("no full version found for %s in %s", basedirName, sandboxBinary)
+			}
+			basedirName = fullVersion
+			basedir = path.Join(sandboxBinary, basedirName)
+		} else {
+			basedirName, err = common.ResolveVersionBuild(sandboxBinary, basedirName)
+			if err != nil {
+				return nil, errors.Wrapf(err, "node %d", node)
+			}
+			basedir = path.Join(sandboxBinary, basedirName)
+		}
+		if !common.DirExists(basedir) {
+			return nil, fmt.Errorf(globals.ErrBaseDirectoryNotFound, basedir)
+		}
+		if !common.IsVersion(basedirName) {
+			return nil, fmt.Errorf("no version detected for directory %s", basedir)
+		}
+		flavor, err := common.GetBinaryFlavor("", basedir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "node %d", node)
+		}
+		nodeVersions[node] = common.NodeVersion{
+			Version: basedirName,
+			Flavor:  flavor,
+			Basedir: basedir,
+		}
+	}
+	return nodeVersions, nil
+}
+
+// checkNodeVersions makes sure that the node binaries refer to existing nodes,
+// and that each node can run the given topology
+func checkNodeVersions(sandboxDef SandboxDef, topology string, nodes int) error {
+	if len(sandboxDef.NodeVersions) == 0 {
+		return nil
+	}
+	allowedTopology := false
+	for _, allowed := range nodeVersionsTopologies {
+		if topology == allowed {
+			allowedTopology = true
+		}
+	}
+	if !allowedTopology {
+		return fmt.Errorf("option '--%s' can only be used with topologies %v", globals.NodeVersionsLabel, nodeVersionsTopologies)
+	}
+	for node, nodeVersion := range sandboxDef.NodeVersions {
+		if node > nodes {
+			return fmt.Errorf("node %d in '--%s' is greater than the number of nodes (%d)", node, globals.NodeVersionsLabel, nodes)
+		}
+		if topology == globals.FanInLabel || topology == globals.AllMastersLabel {
+			isMinimumMultiSource, err := common.HasCapability(nodeVersion.Flavor, common.MultiSource, nodeVersion.Version)
+			if err != nil {
+				return err
+			}
+			if !isMinimumMultiSource {
+				return errors.Wrapf(fmt.Errorf(globals.ErrFeatureRequiresVersion, "multi-source replication",
+					common.IntSliceToDottedString(globals.MinimumMultiSourceReplVersion)), "node %d (%s)", node, nodeVersion.Version)
+			}
+		}
+	}
+	return nil
+}
+
+// nodeSandboxDef returns the definition of a node, using its own binaries when they were
+// requested with NodeVersions. The options that depend on the version are checked again
+func nodeSandboxDef(sandboxDef SandboxDef, node int) (SandboxDef, error) {
+	nodeVersion, found := sandboxDef.NodeVersions[node]
+	if !found {
+		return sandboxDef, nil
+	}
+	sandboxDef.Version = nodeVersion.Version
+	sandboxDef.Flavor = nodeVersion.Flavor
+	sandboxDef.Basedir = nodeVersion.Basedir
+	sandboxDef.BasedirName = path.Base(nodeVersion.Basedir)
+	nodeError := func(err error) error {
+		return errors.Wrapf(err, "node %d (%s)", node, nodeVersion.Version)
+	}
+	if sandboxDef.GtidOptions != "" {
+		templateName, err := gtidOptionsTemplate(sandboxDef.Flavor, sandboxDef.Version)
+		if err != nil {
+			return sandboxDef, nodeError(err)
+		}
+		sandboxDef.GtidOptions = SingleTemplates[templateName].Contents
+	}
+	if sandboxDef.ReplCrashSafeOptions != "" {
+		isMinimumCrashSafe, err := common.HasCapability(sandboxDef.Flavor, common.CrashSafe, sandboxDef.Version)
+		if err != nil {
+			return sandboxDef, nodeError(err)
+		}
+		if !isMinimumCrashSafe {
+			return sandboxDef, nodeError(fmt.Errorf(globals.ErrOptionRequiresVersion, globals.ReplCrashSafeLabel,
+				common.IntSliceToDottedString(globals.MinimumCrashSafeVersion)))
+		}
+		sandboxDef.ReplCrashSafeOptions, err = replCrashSafeOptionsFor(sandboxDef.Flavor, sandboxDef.Version)
+		if err != nil {
+			return sandboxDef, nodeError(err)
+		}
+	}
+	if sandboxDef.SemiSyncOptions != "" {
+		isMinimumSync, err := common.HasCapability(sandboxDef.Flavor, common.SemiSynch, sandboxDef.Version)
+		if err != nil {
+			return sandboxDef, nodeError(err)
+		}
+		if !isMinimumSync {
+			return sandboxDef, nodeError(fmt.Errorf(globals.ErrOptionRequiresVersion, globals.SemiSyncLabel,
+				common.IntSliceToDottedString(globals.MinimumSemiSyncVersion)))
+		}
+		// Semi-synchronous replication is only used in master/slave, where node 1 is the master
+		sandboxDef.SemiSyncOptions, err = semiSyncOptionsFor(sandboxDef.Flavor, sandboxDef.Version, node == 1)
+		if err != nil {
+			return sandboxDef, nodeError(err)
+		}
+	}
+	if sandboxDef.ReadOnlyOptions != "" {
+		readOnlyOptions, err := checkReadOnlyFlags(sandboxDef)
+		if err != nil {
+			return sandboxDef, nodeError(err)
+		}
+		sandboxDef.ReadOnlyOptions = readOnlyOptions
+	}
+	return sandboxDef, nil
+}
+
+// allNodesHaveCapability tells whether the main binaries, and the ones of every node, support a feature
+func allNodesHaveCapability(sandboxDef SandboxDef, feature string) (bool, error) {
+	hasCapability, err := common.HasCapability(sandboxDef.Flavor, feature, sandboxDef.Version)
+	if err != nil || !hasCapability {
+		return false, err
+	}
+	for _, nodeVersion := range sandboxDef.NodeVersions {
+		hasCapability, err = common.HasCapability(nodeVersion.Flavor, feature, nodeVersion.Version)
+		if err != nil || !hasCapability {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// addNodesReplicationSyntax adds to the template data the replication syntax of the main binaries.
+// When some nodes use binaries that don't understand the replica terminology, the old syntax is used instead
+func addNodesReplicationSyntax(data common.StringMap, sandboxDef SandboxDef) error {
+	flavor, version := sandboxDef.Flavor, sandboxDef.Version
+	for _, nodeVersion := range sandboxDef.NodeVersions {
+		isReplicaTerminology, err := common.HasCapability(nodeVersion.Flavor, common.ReplicaTerminology, nodeVersion.Version)
+		if err != nil {
+			return err
+		}
+		if !isReplicaTerminology {
+			flavor, version = nodeVersion.Flavor, nodeVersion.Version
+		}
+	}
+	return addReplicationSyntax(data, flavor, version)
+}
+
+// nodeVersionDescription returns the binaries used by a node, for the sandbox description and the catalog
+func nodeVersionDescription(nodeDef SandboxDef, nodeName string) common.NodeVersion {
+	return common.NodeVersion{
+		Node:    nodeName,
+		Version: nodeDef.Version,
+		Flavor:  nodeDef.Flavor,
+		Basedir: nodeDef.Basedir,
+	}
+}
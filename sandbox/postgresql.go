@@ -0,0 +1,474 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/dustin/go-humanize/english"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Seconds that pg_ctl waits for the server to start
+	postgreSQLStartupTimeout = 60
+	// Configuration file created by initdb, to which the sandbox options are appended
+	postgreSQLConfigName = "postgresql.conf"
+	// Temporary file holding the superuser password during initdb
+	postgreSQLPasswordFile = "pwfile"
+)
+
+// postgreSQLExecutables lists the binaries that a PostgreSQL sandbox needs
+var postgreSQLExecutables = []string{
+	globals.FnPostgres,
+	globals.FnInitDb,
+	globals.FnPgCtl,
+	globals.FnPsql,
+}
+
+// initPostgreSQLDataDir creates the data directory of a PostgreSQL server.
+// When primaryPort is 0, the directory is created with initdb.
+// Otherwise, it is cloned with pg_basebackup from the primary listening on that port,
+// and the resulting server will start as a streaming standby.
+func initPostgreSQLDataDir(sandboxDef SandboxDef, dataDir string, primaryPort int, logger *defaults.Logger) error {
+	binDir := path.Join(sandboxDef.Basedir, "bin")
+	if primaryPort == 0 {
+		passwordFile := path.Join(sandboxDef.SandboxDir, postgreSQLPasswordFile)
+		err := common.WriteString(sandboxDef.DbPassword, passwordFile)
+		if err != nil {
+			return errors.Wrapf(err, "error writing password file")
+		}
+		defer os.Remove(passwordFile) // #nosec G104
+		args := []string{
+			"-D", dataDir,
+			"-U", sandboxDef.DbUser,
+			"--pwfile=" + passwordFile,
+			"--auth-local=trust",
+			"--auth-host=md5",
+			"--encoding=UTF8",
+			"--no-locale",
+		}
+		logger.Printf("Running %s %v\n", globals.FnInitDb, args)
+		out, err := common.RunCmdCtrlWithArgs(path.Join(binDir, globals.FnInitDb), args, true)
+		if err != nil {
+			return fmt.Errorf("error running %s: %s\n%s", globals.FnInitDb, err, out)
+		}
+		return nil
+	}
+	args := []string{
+		"-d", fmt.Sprintf("host=%s port=%d user=%s password=%s",
+			sandboxDef.SbHost, primaryPort, sandboxDef.RplUser, sandboxDef.RplPassword),
+		"-D", dataDir,
+		"-R",
+		"-X", "stream",
+	}
+	logger.Printf("Running %s from port %d\n", globals.FnPgBasebackup, primaryPort)
+	out, err := common.RunCmdCtrlWithArgs(path.Join(binDir, globals.FnPgBasebackup), args, true)
+	if err != nil {
+		return fmt.Errorf("error running %s: %s\n%s", globals.FnPgBasebackup, err, out)
+	}
+	return nil
+}
+
+// createPostgreSQLSandbox deploys a PostgreSQL server.
+// It is called by createSingleSandbox for standalone sandboxes,
+// and by CreatePostgreSQLReplication for the nodes of a replication sandbox,
+// where primaryPort is the port of the primary for the standby nodes.
+func createPostgreSQLSandbox(sandboxDef SandboxDef, primaryPort int) error {
+	var err error
+	if sandboxDef.SBType == "" {
+		sandboxDef.SBType = globals.SbTypeSingle
+	}
+	logger := sandboxDef.Logger
+	if logger == nil {
+		var fileName string
+		logger, fileName, err = defaults.NewLogger(common.LogDirName(), sandboxDef.SBType)
+		if err != nil {
+			return sbError("logger", "%s", err)
+		}
+		sandboxDef.LogFileName = common.ReplaceLiteralHome(fileName)
+	}
+	logger.Printf("PostgreSQL Sandbox Definition: %s\n", sandboxDefToJson(sandboxDef))
+	if !common.DirExists(sandboxDef.Basedir) {
+		return fmt.Errorf(globals.ErrBaseDirectoryNotFound, sandboxDef.Basedir)
+	}
+	executables := postgreSQLExecutables
+	if primaryPort > 0 {
+		executables = append(executables, globals.FnPgBasebackup)
+	}
+	for _, executable := range executables {
+		fullPath := path.Join(sandboxDef.Basedir, "bin", executable)
+		if !common.ExecExists(fullPath) {
+			return fmt.Errorf(globals.ErrExecutableNotFound, fullPath)
+		}
+	}
+	if sandboxDef.Port <= 1024 {
+		return fmt.Errorf("port for sandbox must be > 1024 (given:%d)", sandboxDef.Port)
+	}
+	versionList, err := common.VersionToList(sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+	if sandboxDef.Prompt == "" || sandboxDef.Prompt == globals.PromptValue {
+		sandboxDef.Prompt = "pg"
+	}
+	if sandboxDef.DirName == "" {
+		if sandboxDef.Version != sandboxDef.BasedirName && sandboxDef.BasedirName != "" {
+			sandboxDef.DirName = defaults.Defaults().SandboxPrefix + sandboxDef.BasedirName
+		} else {
+			sandboxDef.DirName = defaults.Defaults().SandboxPrefix + common.VersionToName(sandboxDef.Version)
+		}
+	}
+	if sandboxDef.DirName == globals.ForbiddenDirName {
+		return fmt.Errorf("the name %s cannot be used for a sandbox", sandboxDef.DirName)
+	}
+	sandboxDir := path.Join(sandboxDef.SandboxDir, sandboxDef.DirName)
+	sandboxDef.SandboxDir = sandboxDir
+	if sandboxDef.NodeNum == 0 && !sandboxDef.Force {
+		sandboxDef.Port, err = findFreePort(sandboxDef.Port, sandboxDef.InstalledPorts, 1)
+		if err != nil {
+			return errors.Wrapf(err, "error detecting free port for single sandbox")
+		}
+		logger.Printf("Port defined as %d using FindFreePort \n", sandboxDef.Port)
+	}
+	if common.DirExists(sandboxDir) {
+		sandboxDef, err = checkDirectory(sandboxDef)
+		if err != nil {
+			return sbError("check directory", "%s", err)
+		}
+	}
+	err = os.Mkdir(sandboxDir, globals.PublicDirectoryAttr)
+	if err != nil {
+		return err
+	}
+	common.AddToCleanupStack(common.RmdirAll, "RmdirAll", sandboxDir)
+	logger.Printf("Created directory %s\n", sandboxDir)
+
+	dataDir := path.Join(sandboxDir, globals.DataDirName)
+	err = initPostgreSQLDataDir(sandboxDef, dataDir, primaryPort, logger)
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Now()
+	data := common.StringMap{
+		"ShellPath":      sandboxDef.ShellPath,
+		"Copyright":      globals.ShellScriptCopyright,
+		"AppVersion":     common.VersionDef,
+		"DateTime":       timestamp.Format(time.UnixDate),
+		"SandboxDir":     sandboxDir,
+		"Basedir":        sandboxDef.Basedir,
+		"Port":           sandboxDef.Port,
+		"SbHost":         sandboxDef.SbHost,
+		"BindAddress":    sandboxDef.BindAddress,
+		"SocketDir":      common.GlobalTempDir(),
+		"DbUser":         sandboxDef.DbUser,
+		"DbPassword":     sandboxDef.DbPassword,
+		"Prompt":         sandboxDef.Prompt,
+		"MajorVersion":   versionList[0],
+		"StartupTimeout": postgreSQLStartupTimeout,
+		"Replication":    sandboxDef.SBType != globals.SbTypeSingle,
+		"TemplateName":   globals.TmplPostgreSQLOptions,
+	}
+	options, err := common.SafeTemplateFill(globals.TmplPostgreSQLOptions,
+		PostgreSQLTemplates[globals.TmplPostgreSQLOptions].Contents, data)
+	if err != nil {
+		return err
+	}
+	err = common.AppendStrings([]string{options}, path.Join(dataDir, postgreSQLConfigName), "\n")
+	if err != nil {
+		return errors.Wrapf(err, "error updating %s", postgreSQLConfigName)
+	}
+
+	logger.Printf("Writing PostgreSQL sandbox scripts\n")
+	err = writeScripts(ScriptBatch{
+		tc:         PostgreSQLTemplates,
+		logger:     logger,
+		sandboxDir: sandboxDir,
+		data:       data,
+		scripts: []ScriptDef{
+			{globals.ScriptStart, globals.TmplPostgreSQLStart, true},
+			{globals.ScriptStop, globals.TmplPostgreSQLStop, true},
+			{globals.ScriptRestart, globals.TmplPostgreSQLRestart, true},
+			{globals.ScriptStatus, globals.TmplPostgreSQLStatus, true},
+			{globals.ScriptSendKill, globals.TmplPostgreSQLSendKill, true},
+			{globals.ScriptUse, globals.TmplPostgreSQLUse, true},
+			{globals.ScriptTestSb, globals.TmplPostgreSQLTestSb, true},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	sbDesc := common.SandboxDescription{
+		Basedir: sandboxDef.Basedir,
+		SBType:  sandboxDef.SBType,
+		Version: sandboxDef.Version,
+		Flavor:  common.PostgreSQLFlavor,
+		Host:    sandboxDef.SbHost,
+		Port:    []int{sandboxDef.Port},
+		NodeNum: sandboxDef.NodeNum,
+		LogFile: sandboxDef.LogFileName,
+	}
+	err = common.WriteSandboxDescription(sandboxDir, sbDesc)
+	if err != nil {
+		return errors.Wrapf(err, "unable to write sandbox description")
+	}
+	if sandboxDef.NodeNum == 0 {
+		sbItem := defaults.SandboxItem{
+			Origin:      sandboxDef.Basedir,
+			SBType:      sandboxDef.SBType,
+			Version:     sandboxDef.Version,
+			Flavor:      common.PostgreSQLFlavor,
+			Port:        []int{sandboxDef.Port},
+			Destination: sandboxDir,
+			ExpiresAt:   sandboxDef.ExpiresAt,
+		}
+		if sandboxDef.LogFileName != "" {
+			sbItem.LogDirectory = common.DirName(sandboxDef.LogFileName)
+		}
+		err = defaults.UpdateCatalog(sandboxDir, sbItem)
+		if err != nil {
+			return errors.Wrapf(err, "error updating catalog")
+		}
+	}
+	if !sandboxDef.SkipStart {
+		_, err = common.RunCmd(path.Join(sandboxDir, globals.ScriptStart))
+		if err != nil {
+			return fmt.Errorf("error starting %s: %s", sandboxDir, err)
+		}
+	}
+	if sandboxDef.NodeNum == 0 {
+		common.CondPrintf("Database installed in %s\n", common.ReplaceLiteralHome(sandboxDir))
+	}
+	return nil
+}
+
+// CreatePostgreSQLReplication deploys a PostgreSQL primary and nodes-1 standbys using streaming replication.
+// The sandbox layout and the scripts follow the ones of a MySQL master-slave replication
+func CreatePostgreSQLReplication(sandboxDef SandboxDef, origin string, nodes int) error {
+	if nodes < 2 {
+		return fmt.Errorf("can't run replication with less than 2 nodes")
+	}
+	if sandboxDef.SkipStart {
+		return fmt.Errorf("PostgreSQL replication requires a running primary: option --%s is not supported",
+			globals.SkipStartLabel)
+	}
+	if len(sandboxDef.NodeVersions) > 0 {
+		return fmt.Errorf("option --%s is not supported with flavor %s",
+			globals.NodeVersionsLabel, common.PostgreSQLFlavor)
+	}
+	var logger *defaults.Logger
+	if sandboxDef.Logger != nil {
+		logger = sandboxDef.Logger
+	} else {
+		var fileName string
+		var err error
+		logger, fileName, err = defaults.NewLogger(common.LogDirName(), "postgresql-replication")
+		if err != nil {
+			return err
+		}
+		sandboxDef.LogFileName = common.ReplaceLiteralHome(fileName)
+		sandboxDef.Logger = logger
+	}
+	vList, err := common.VersionToList(sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+	basePort := computeBaseport(sandboxDef.Port + defaults.Defaults().MasterSlaveBasePort + (vList[2] * 100))
+	if sandboxDef.BasePort > 0 {
+		basePort = sandboxDef.BasePort
+	}
+	// The nodes use base_port + 1 ... base_port + nodes
+	firstPort, err := findFreePort(basePort+1, sandboxDef.InstalledPorts, nodes)
+	if err != nil {
+		return errors.Wrapf(err, "error detecting free port for replication")
+	}
+	basePort = firstPort - 1
+
+	err = os.Mkdir(sandboxDef.SandboxDir, globals.PublicDirectoryAttr)
+	if err != nil {
+		return err
+	}
+	logger.Printf("Created directory %s\n", sandboxDef.SandboxDir)
+	logger.Printf("PostgreSQL Replication Sandbox Definition: %s\n", sandboxDefToJson(sandboxDef))
+	common.AddToCleanupStack(common.RmdirAll, "RmdirAll", sandboxDef.SandboxDir)
+
+	slaves := nodes - 1
+	masterAbbr := defaults.Defaults().MasterAbbr
+	masterLabel := defaults.Defaults().MasterName
+	slaveLabel := defaults.Defaults().SlavePrefix
+	slaveAbbr := defaults.Defaults().SlaveAbbr
+	nodeLabel := defaults.Defaults().NodePrefix
+	masterPort := basePort + 1
+	timestamp := time.Now()
+	var data = common.StringMap{
+		"ShellPath":   sandboxDef.ShellPath,
+		"Copyright":   globals.ShellScriptCopyright,
+		"AppVersion":  common.VersionDef,
+		"DateTime":    timestamp.Format(time.UnixDate),
+		"SandboxDir":  sandboxDef.SandboxDir,
+		"MasterLabel": masterLabel,
+		"MasterPort":  masterPort,
+		"SlaveLabel":  slaveLabel,
+		"MasterAbbr":  masterAbbr,
+		"SlaveAbbr":   slaveAbbr,
+		"Slaves":      []common.StringMap{},
+	}
+
+	sandboxDef.SBType = "replication-node"
+	sandboxDef.Multi = true
+	sandboxDef.Logger = logger
+	sandboxDef.Flavor = common.PostgreSQLFlavor
+
+	masterDef := sandboxDef
+	masterDef.Port = masterPort
+	masterDef.DirName = masterLabel
+	masterDef.Prompt = masterLabel
+	masterDef.NodeNum = 1
+	common.CondPrintf("Installing and starting %s\n", masterLabel)
+	logger.Printf("Creating PostgreSQL sandbox for primary\n")
+	err = createPostgreSQLSandbox(masterDef, 0)
+	if err != nil {
+		return fmt.Errorf(globals.ErrCreatingSandbox, err)
+	}
+	// The role used by the standbys to stream from the primary
+	createRole := fmt.Sprintf("CREATE ROLE %s WITH REPLICATION LOGIN PASSWORD '%s'",
+		sandboxDef.RplUser, sandboxDef.RplPassword)
+	out, err := common.RunCmdCtrlWithArgs(path.Join(sandboxDef.SandboxDir, masterLabel, globals.ScriptUse),
+		[]string{"-c", createRole}, true)
+	if err != nil {
+		return fmt.Errorf("error creating replication user: %s\n%s", err, out)
+	}
+
+	sbDesc := common.SandboxDescription{
+		Basedir: sandboxDef.Basedir,
+		SBType:  globals.MasterSlaveLabel,
+		Version: sandboxDef.Version,
+		Flavor:  common.PostgreSQLFlavor,
+		Port:    []int{masterPort},
+		Nodes:   slaves,
+		NodeNum: 0,
+		LogFile: sandboxDef.LogFileName,
+	}
+	sbItem := defaults.SandboxItem{
+		Origin:      sandboxDef.Basedir,
+		SBType:      globals.MasterSlaveLabel,
+		Version:     sandboxDef.Version,
+		Flavor:      common.PostgreSQLFlavor,
+		Port:        []int{masterPort},
+		Nodes:       []string{masterLabel},
+		Destination: sandboxDef.SandboxDir,
+		ExpiresAt:   sandboxDef.ExpiresAt,
+	}
+	if sandboxDef.LogFileName != "" {
+		sbItem.LogDirectory = common.DirName(sandboxDef.LogFileName)
+	}
+
+	for i := 1; i <= slaves; i++ {
+		slaveDef := sandboxDef
+		slaveDef.Port = basePort + i + 1
+		slaveDef.DirName = fmt.Sprintf("%s%d", nodeLabel, i)
+		slaveDef.Prompt = fmt.Sprintf("%s%d", slaveLabel, i)
+		slaveDef.NodeNum = i + 1
+		nodeData := common.StringMap{
+			"ShellPath":  sandboxDef.ShellPath,
+			"Copyright":  globals.ShellScriptCopyright,
+			"AppVersion": common.VersionDef,
+			"DateTime":   timestamp.Format(time.UnixDate),
+			"Node":       i,
+			"NodeLabel":  nodeLabel,
+			"NodePort":   slaveDef.Port,
+			"SlaveLabel": slaveLabel,
+			"MasterAbbr": masterAbbr,
+			"SlaveAbbr":  slaveAbbr,
+			"SandboxDir": sandboxDef.SandboxDir,
+			"MasterPort": masterPort,
+		}
+		data["Slaves"] = append(data["Slaves"].([]common.StringMap), nodeData)
+		sbItem.Nodes = append(sbItem.Nodes, slaveDef.DirName)
+		sbItem.Port = append(sbItem.Port, slaveDef.Port)
+		sbDesc.Port = append(sbDesc.Port, slaveDef.Port)
+
+		common.CondPrintf("Installing and starting %s%d\n", slaveLabel, i)
+		logger.Printf("Creating PostgreSQL sandbox for standby %d\n", i)
+		err = createPostgreSQLSandbox(slaveDef, masterPort)
+		if err != nil {
+			return fmt.Errorf(globals.ErrCreatingSandbox, err)
+		}
+		err = writeScripts(ScriptBatch{ReplicationTemplates, logger, sandboxDef.SandboxDir, nodeData,
+			[]ScriptDef{
+				{fmt.Sprintf("%s%d", slaveAbbr, i), globals.TmplSlave, true},
+				{fmt.Sprintf("n%d", i+1), globals.TmplSlave, true},
+			}})
+		if err != nil {
+			return err
+		}
+	}
+	err = common.WriteSandboxDescription(sandboxDef.SandboxDir, sbDesc)
+	if err != nil {
+		return errors.Wrapf(err, "unable to write sandbox description")
+	}
+	err = defaults.UpdateCatalog(sandboxDef.SandboxDir, sbItem)
+	if err != nil {
+		return errors.Wrapf(err, "unable to update catalog")
+	}
+
+	slavePlural := english.PluralWord(2, slaveLabel, "")
+	err = writeScripts(ScriptBatch{
+		tc:         ReplicationTemplates,
+		logger:     logger,
+		sandboxDir: sandboxDef.SandboxDir,
+		data:       data,
+		scripts: []ScriptDef{
+			{globals.ScriptStartAll, globals.TmplStartAll, true},
+			{globals.ScriptRestartAll, globals.TmplRestartAll, true},
+			{globals.ScriptStopAll, globals.TmplStopAll, true},
+			{globals.ScriptSendKillAll, globals.TmplSendKillAll, true},
+			{globals.ScriptUseAll, globals.TmplUseAll, true},
+			{globals.ScriptExecAll, globals.TmplExecAll, true},
+			{globals.ScriptTestSbAll, globals.TmplTestSbAll, true},
+			{masterAbbr, globals.TmplMaster, true},
+			{"n1", globals.TmplMaster, true},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	err = writeScripts(ScriptBatch{
+		tc:         PostgreSQLTemplates,
+		logger:     logger,
+		sandboxDir: sandboxDef.SandboxDir,
+		data:       data,
+		scripts: []ScriptDef{
+			{globals.ScriptStatusAll, globals.TmplPostgreSQLStatusAll, true},
+			{"check_" + slavePlural, globals.TmplPostgreSQLCheckSlaves, true},
+			{"test_replication", globals.TmplPostgreSQLTestReplication, true},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	common.CondPrintf("Replication directory installed in %s\n", common.ReplaceLiteralHome(sandboxDef.SandboxDir))
+	common.CondPrintf("run 'dbdeployer usage multiple' for basic instructions'\n")
+	return nil
+}
@@ -0,0 +1,105 @@
+//go:build go1.16
+// +build go1.16
+
+package sandbox
+
+import (
+	_ "embed"
+
+	"github.com/datacharmer/dbdeployer/globals"
+)
+
+// Templates for PostgreSQL
+
+var (
+	//go:embed templates/postgresql/postgresql_options.gotxt
+	postgreSQLOptionsTemplate string
+
+	//go:embed templates/postgresql/postgresql_start.gotxt
+	postgreSQLStartTemplate string
+
+	//go:embed templates/postgresql/postgresql_stop.gotxt
+	postgreSQLStopTemplate string
+
+	//go:embed templates/postgresql/postgresql_restart.gotxt
+	postgreSQLRestartTemplate string
+
+	//go:embed templates/postgresql/postgresql_status.gotxt
+	postgreSQLStatusTemplate string
+
+	//go:embed templates/postgresql/postgresql_send_kill.gotxt
+	postgreSQLSendKillTemplate string
+
+	//go:embed templates/postgresql/postgresql_use.gotxt
+	postgreSQLUseTemplate string
+
+	//go:embed templates/postgresql/postgresql_test_sb.gotxt
+	postgreSQLTestSbTemplate string
+
+	//go:embed templates/postgresql/postgresql_status_all.gotxt
+	postgreSQLStatusAllTemplate string
+
+	//go:embed templates/postgresql/postgresql_check_slaves.gotxt
+	postgreSQLCheckSlavesTemplate string
+
+	//go:embed templates/postgresql/postgresql_test_replication.gotxt
+	postgreSQLTestReplicationTemplate string
+
+	PostgreSQLTemplates = TemplateCollection{
+		globals.TmplPostgreSQLOptions: TemplateDesc{
+			Description: "Options appended to postgresql.conf",
+			Notes:       "Replication options are only added to the nodes of a replication sandbox",
+			Contents:    postgreSQLOptionsTemplate,
+		},
+		globals.TmplPostgreSQLStart: TemplateDesc{
+			Description: "Starts a PostgreSQL sandbox",
+			Notes:       "",
+			Contents:    postgreSQLStartTemplate,
+		},
+		globals.TmplPostgreSQLStop: TemplateDesc{
+			Description: "Stops a PostgreSQL sandbox",
+			Notes:       "",
+			Contents:    postgreSQLStopTemplate,
+		},
+		globals.TmplPostgreSQLRestart: TemplateDesc{
+			Description: "Restarts a PostgreSQL sandbox",
+			Notes:       "",
+			Contents:    postgreSQLRestartTemplate,
+		},
+		globals.TmplPostgreSQLStatus: TemplateDesc{
+			Description: "Shows the status of a PostgreSQL sandbox",
+			Notes:       "",
+			Contents:    postgreSQLStatusTemplate,
+		},
+		globals.TmplPostgreSQLSendKill: TemplateDesc{
+			Description: "Kills a PostgreSQL sandbox",
+			Notes:       "",
+			Contents:    postgreSQLSendKillTemplate,
+		},
+		globals.TmplPostgreSQLUse: TemplateDesc{
+			Description: "Invokes psql with the sandbox connection parameters",
+			Notes:       "A leading '-e' is converted to '-c', for compatibility with 'dbdeployer global use'",
+			Contents:    postgreSQLUseTemplate,
+		},
+		globals.TmplPostgreSQLTestSb: TemplateDesc{
+			Description: "Tests a PostgreSQL sandbox",
+			Notes:       "",
+			Contents:    postgreSQLTestSbTemplate,
+		},
+		globals.TmplPostgreSQLStatusAll: TemplateDesc{
+			Description: "Shows the status of all nodes in a PostgreSQL replication sandbox",
+			Notes:       "",
+			Contents:    postgreSQLStatusAllTemplate,
+		},
+		globals.TmplPostgreSQLCheckSlaves: TemplateDesc{
+			Description: "Checks the streaming replication status of all nodes",
+			Notes:       "",
+			Contents:    postgreSQLCheckSlavesTemplate,
+		},
+		globals.TmplPostgreSQLTestReplication: TemplateDesc{
+			Description: "Tests streaming replication from the primary to the standbys",
+			Notes:       "",
+			Contents:    postgreSQLTestReplicationTemplate,
+		},
+	}
+)
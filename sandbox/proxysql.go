@@ -0,0 +1,324 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Ports used by ProxySQL, starting at its base port: admin and MySQL protocol
+	proxySQLPorts = 2
+	// Seconds that the start script waits for ProxySQL to write its PID file
+	proxySQLStartupTimeout = 30
+	proxySQLConfigName     = "proxysql.cnf"
+	proxySQLAdminUser      = "admin"
+	proxySQLAdminPassword  = "admin"
+
+	// Hostgroups used in the ProxySQL configuration
+	proxySQLWriterHostgroup       = 0
+	proxySQLReaderHostgroup       = 1
+	proxySQLBackupWriterHostgroup = 2
+	proxySQLOfflineHostgroup      = 3
+)
+
+// ProxySQLDef describes a ProxySQL sandbox, attached to an existing sandbox
+type ProxySQLDef struct {
+	ProxySQL       string // Full path of the proxysql executable
+	SandboxDir     string // Directory where the ProxySQL sandbox is created
+	DirName        string // Name of the ProxySQL sandbox. Default: proxysql prefix + backend sandbox name
+	BackendDir     string // Full path of the sandbox that ProxySQL connects to
+	BasePort       int    // Admin port. The MySQL port is the next one. Default: proxysql-base-port
+	InstalledPorts []int  // Ports used by other sandboxes
+	ShellPath      string // Shell used by the scripts
+	SkipStart      bool   // Does not start ProxySQL after the deployment
+	ExpiresAt      string // When the sandbox can be removed by "dbdeployer gc" (RFC3339)
+}
+
+// ProxySQLServer is a backend server in the ProxySQL configuration
+type ProxySQLServer struct {
+	Node      string
+	Host      string
+	Port      int
+	Hostgroup int
+}
+
+// ProxySQLVersion returns the version of a proxysql executable
+func ProxySQLVersion(proxySQL string) (string, error) {
+	out, err := common.RunCmdCtrlWithArgs(proxySQL, []string{"--version"}, true)
+	if err != nil {
+		return "", fmt.Errorf("error getting the version of %s: %s", proxySQL, err)
+	}
+	version := regexp.MustCompile(`\d+\.\d+\.\d+`).FindString(out)
+	if version == "" {
+		return "", fmt.Errorf("no version found in the output of '%s --version'", proxySQL)
+	}
+	return version, nil
+}
+
+// backendNodes returns the directories of the nodes of a sandbox that can be used by ProxySQL.
+// A single sandbox is returned as a node with an empty name
+func backendNodes(backendDir string) ([]string, error) {
+	if common.FileExists(path.Join(backendDir, globals.ScriptConnectionSuperJson)) {
+		return []string{""}, nil
+	}
+	entries, err := os.ReadDir(backendDir)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []string
+	for _, entry := range entries {
+		if entry.IsDir() && common.FileExists(path.Join(backendDir, entry.Name(), globals.ScriptConnectionSuperJson)) {
+			nodes = append(nodes, entry.Name())
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no database servers found in %s", backendDir)
+	}
+	sort.Strings(nodes)
+	return nodes, nil
+}
+
+// ProxySQLServers returns the backend servers of a sandbox, with their hostgroups.
+// In master-slave sandboxes, the master goes to the writer hostgroup and the slaves to the reader one,
+// following the replication tree after a switchover.
+// In the other topologies, all the nodes start in the writer hostgroup,
+// and group replication members are then moved by the ProxySQL monitor
+func ProxySQLServers(backendDir string, sbDesc common.SandboxDescription) ([]ProxySQLServer, error) {
+	nodes, err := backendNodes(backendDir)
+	if err != nil {
+		return nil, err
+	}
+	masterNumber := 1
+	if sbDesc.ReplicationTree != nil {
+		masterNumber = sbDesc.ReplicationTree.Node
+	}
+	var servers []ProxySQLServer
+	for _, node := range nodes {
+		connection, err := readNodeConnection(path.Join(backendDir, node), globals.ScriptConnectionSuperJson)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading the connection data of %s", path.Join(backendDir, node))
+		}
+		hostgroup := proxySQLWriterHostgroup
+		if sbDesc.SBType == globals.MasterSlaveLabel {
+			number, err := NodeScriptNumber(sbDesc.SBType, node)
+			if err != nil {
+				return nil, err
+			}
+			if number != masterNumber {
+				hostgroup = proxySQLReaderHostgroup
+			}
+		}
+		servers = append(servers, ProxySQLServer{
+			Node:      node,
+			Host:      connection.Host,
+			Port:      connection.Port,
+			Hostgroup: hostgroup,
+		})
+	}
+	return servers, nil
+}
+
+// proxySQLServerList formats the backend servers as entries of the mysql_servers section
+func proxySQLServerList(servers []ProxySQLServer) string {
+	var entries []string
+	for _, server := range servers {
+		entries = append(entries, fmt.Sprintf(`    { address="%s", port=%d, hostgroup=%d, max_connections=200 }`,
+			server.Host, server.Port, server.Hostgroup))
+	}
+	return strings.Join(entries, ",\n")
+}
+
+// CreateProxySQLSandbox writes the configuration and the scripts of a ProxySQL sandbox
+// that uses the servers of an existing sandbox as backends
+func CreateProxySQLSandbox(proxyDef ProxySQLDef) error {
+	if !common.ExecExists(proxyDef.ProxySQL) {
+		return fmt.Errorf(globals.ErrExecutableNotFound, proxyDef.ProxySQL)
+	}
+	version, err := ProxySQLVersion(proxyDef.ProxySQL)
+	if err != nil {
+		return err
+	}
+	backendDesc, err := common.ReadSandboxDescription(proxyDef.BackendDir)
+	if err != nil {
+		return errors.Wrapf(err, "error reading the description of sandbox %s", proxyDef.BackendDir)
+	}
+	switch backendDesc.SBType {
+	case globals.SbTypeProxySQL, globals.SbTypeRouter:
+		return fmt.Errorf("sandbox %s is a '%s' sandbox. ProxySQL requires a database sandbox",
+			proxyDef.BackendDir, backendDesc.SBType)
+	}
+	servers, err := ProxySQLServers(proxyDef.BackendDir, backendDesc)
+	if err != nil {
+		return err
+	}
+	firstNode := path.Join(proxyDef.BackendDir, servers[0].Node)
+	superUser, err := readNodeConnection(firstNode, globals.ScriptConnectionSuperJson)
+	if err != nil {
+		return errors.Wrapf(err, "error reading the connection data of %s", firstNode)
+	}
+
+	if proxyDef.DirName == "" {
+		proxyDef.DirName = defaults.Defaults().ProxySQLPrefix + path.Base(proxyDef.BackendDir)
+	}
+	sandboxDir := path.Join(proxyDef.SandboxDir, proxyDef.DirName)
+	if common.DirExists(sandboxDir) {
+		return fmt.Errorf(globals.ErrNamedDirectoryAlreadyExists, "proxysql", sandboxDir)
+	}
+	basePort := proxyDef.BasePort
+	if basePort == 0 {
+		basePort = defaults.Defaults().ProxySQLBasePort
+	}
+	basePort, err = findFreePort(basePort, proxyDef.InstalledPorts, proxySQLPorts)
+	if err != nil {
+		return errors.Wrapf(err, "error finding free ports for ProxySQL")
+	}
+	adminPort := basePort
+	mysqlPort := basePort + 1
+
+	dataDir := path.Join(sandboxDir, globals.DataDirName)
+	err = os.MkdirAll(dataDir, globals.PublicDirectoryAttr)
+	if err != nil {
+		return errors.Wrapf(err, "error creating ProxySQL data directory %s", dataDir)
+	}
+	common.AddToCleanupStack(common.RmdirAll, "RmdirAll", sandboxDir)
+
+	clientBasedir := backendDesc.ClientBasedir
+	if clientBasedir == "" {
+		clientBasedir = backendDesc.Basedir
+	}
+	isGroup := strings.HasPrefix(backendDesc.SBType, globals.GroupLabel) ||
+		backendDesc.SBType == globals.InnoDBClusterLabel
+	isMultiPrimary := backendDesc.SBType == globals.GroupLabel
+	maxWriters := 1
+	if isMultiPrimary {
+		maxWriters = len(servers)
+	}
+	timestamp := time.Now()
+	data := common.StringMap{
+		"ShellPath":             proxyDef.ShellPath,
+		"Copyright":             globals.ShellScriptCopyright,
+		"AppVersion":            common.VersionDef,
+		"DateTime":              timestamp.Format(time.UnixDate),
+		"SandboxDir":            sandboxDir,
+		"DataDir":               dataDir,
+		"ProxySQL":              proxyDef.ProxySQL,
+		"ConfigFile":            path.Join(sandboxDir, proxySQLConfigName),
+		"ClientBasedir":         clientBasedir,
+		"Host":                  superUser.Host,
+		"AdminPort":             adminPort,
+		"MysqlPort":             mysqlPort,
+		"AdminUser":             proxySQLAdminUser,
+		"AdminPassword":         proxySQLAdminPassword,
+		"DbUser":                superUser.User,
+		"DbPassword":            superUser.Password,
+		"ServerVersion":         backendDesc.Version,
+		"Servers":               proxySQLServerList(servers),
+		"IsMasterSlave":         backendDesc.SBType == globals.MasterSlaveLabel,
+		"IsGroup":               isGroup,
+		"MaxWriters":            maxWriters,
+		"ReadWriteSplit":        !isMultiPrimary && (isGroup || backendDesc.SBType == globals.MasterSlaveLabel),
+		"WriterHostgroup":       proxySQLWriterHostgroup,
+		"ReaderHostgroup":       proxySQLReaderHostgroup,
+		"BackupWriterHostgroup": proxySQLBackupWriterHostgroup,
+		"OfflineHostgroup":      proxySQLOfflineHostgroup,
+		"StartupTimeout":        proxySQLStartupTimeout,
+	}
+	err = writeScripts(ScriptBatch{
+		tc:         ProxySQLTemplates,
+		data:       data,
+		sandboxDir: sandboxDir,
+		scripts: []ScriptDef{
+			{proxySQLConfigName, globals.TmplProxySQLConfig, false},
+			{globals.ScriptStart, globals.TmplProxySQLStart, true},
+			{globals.ScriptStop, globals.TmplProxySQLStop, true},
+			{globals.ScriptSendKill, globals.TmplProxySQLSendKill, true},
+			{globals.ScriptStatus, globals.TmplProxySQLStatus, true},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for _, use := range []struct {
+		script   string
+		role     string
+		port     int
+		user     string
+		password string
+	}{
+		{globals.ScriptUseProxy, "ProxySQL", mysqlPort, superUser.User, superUser.Password},
+		{globals.ScriptUseAdmin, "ProxySQL Admin", adminPort, proxySQLAdminUser, proxySQLAdminPassword},
+	} {
+		data["Port"] = use.port
+		data["PortRole"] = use.role
+		data["User"] = use.user
+		data["Password"] = use.password
+		err = writeScript(nil, ProxySQLTemplates, use.script, globals.TmplProxySQLUse, sandboxDir, data, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	ports := []int{adminPort, mysqlPort}
+	sbDesc := common.SandboxDescription{
+		Basedir:       path.Dir(proxyDef.ProxySQL),
+		ClientBasedir: clientBasedir,
+		SBType:        globals.SbTypeProxySQL,
+		Version:       version,
+		Flavor:        common.ProxySQLFlavor,
+		Host:          superUser.Host,
+		Port:          ports,
+		Backend:       proxyDef.BackendDir,
+	}
+	err = common.WriteSandboxDescription(sandboxDir, sbDesc)
+	if err != nil {
+		return errors.Wrapf(err, "unable to write sandbox description")
+	}
+	err = defaults.UpdateCatalog(sandboxDir, defaults.SandboxItem{
+		Origin:      proxyDef.ProxySQL,
+		SBType:      globals.SbTypeProxySQL,
+		Version:     version,
+		Flavor:      common.ProxySQLFlavor,
+		Host:        superUser.Host,
+		Port:        ports,
+		Destination: sandboxDir,
+		Backend:     proxyDef.BackendDir,
+		ExpiresAt:   proxyDef.ExpiresAt,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "unable to update catalog")
+	}
+	if !proxyDef.SkipStart {
+		_, err = common.RunCmd(path.Join(sandboxDir, globals.ScriptStart))
+		if err != nil {
+			return fmt.Errorf("error starting ProxySQL: %s", err)
+		}
+	}
+	common.CondPrintf("ProxySQL installed in %s\n", common.ReplaceLiteralHome(sandboxDir))
+	common.CondPrintf("MySQL port: %d - Admin port: %d\n", mysqlPort, adminPort)
+	return nil
+}
@@ -0,0 +1,65 @@
+//go:build go1.16
+// +build go1.16
+
+package sandbox
+
+import (
+	_ "embed"
+
+	"github.com/datacharmer/dbdeployer/globals"
+)
+
+// Templates for ProxySQL
+
+var (
+	//go:embed templates/proxysql/proxysql_config.gotxt
+	proxySQLConfigTemplate string
+
+	//go:embed templates/proxysql/proxysql_start.gotxt
+	proxySQLStartTemplate string
+
+	//go:embed templates/proxysql/proxysql_stop.gotxt
+	proxySQLStopTemplate string
+
+	//go:embed templates/proxysql/proxysql_send_kill.gotxt
+	proxySQLSendKillTemplate string
+
+	//go:embed templates/proxysql/proxysql_status.gotxt
+	proxySQLStatusTemplate string
+
+	//go:embed templates/proxysql/proxysql_use.gotxt
+	proxySQLUseTemplate string
+
+	ProxySQLTemplates = TemplateCollection{
+		globals.TmplProxySQLConfig: TemplateDesc{
+			Description: "Configuration file for ProxySQL",
+			Notes:       "Servers and hostgroups come from the sandbox that ProxySQL is attached to",
+			Contents:    proxySQLConfigTemplate,
+		},
+		globals.TmplProxySQLStart: TemplateDesc{
+			Description: "Starts a ProxySQL sandbox",
+			Notes:       "",
+			Contents:    proxySQLStartTemplate,
+		},
+		globals.TmplProxySQLStop: TemplateDesc{
+			Description: "Stops a ProxySQL sandbox",
+			Notes:       "",
+			Contents:    proxySQLStopTemplate,
+		},
+		globals.TmplProxySQLSendKill: TemplateDesc{
+			Description: "Kills a ProxySQL sandbox",
+			Notes:       "",
+			Contents:    proxySQLSendKillTemplate,
+		},
+		globals.TmplProxySQLStatus: TemplateDesc{
+			Description: "Shows the status of a ProxySQL sandbox",
+			Notes:       "",
+			Contents:    proxySQLStatusTemplate,
+		},
+		globals.TmplProxySQLUse: TemplateDesc{
+			Description: "Connects to a ProxySQL port",
+			Notes:       "Used for both the MySQL port (use_proxy) and the admin port (use_admin)",
+			Contents:    proxySQLUseTemplate,
+		},
+	}
+)
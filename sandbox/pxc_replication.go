@@ -79,7 +79,7 @@ func CreatePxcReplication(sandboxDef SandboxDef, origin string, nodes int, maste
 	// FindFreePort returns the first free port, but base_port will be used
 	// with a counter. Thus the availability will be checked using
 	// "base_port + 1"
-	firstGroupPort, err := common.FindFreePort(basePort+1, sandboxDef.InstalledPorts, nodes)
+	firstGroupPort, err := findFreePort(basePort+1, sandboxDef.InstalledPorts, nodes)
 	if err != nil {
 		return errors.Wrapf(err, "error retrieving free port for replication")
 	}
@@ -89,7 +89,7 @@ func CreatePxcReplication(sandboxDef SandboxDef, origin string, nodes int, maste
 	baseGroupPort := basePort + pxcPortDelta
 	baseRsyncPort := basePort + pxcRsyncPortDelta
 
-	firstGroupPort, err = common.FindFreePort(baseGroupPort+1, sandboxDef.InstalledPorts, nodes*2)
+	firstGroupPort, err = findFreePort(baseGroupPort+1, sandboxDef.InstalledPorts, nodes*2)
 	if err != nil {
 		return errors.Wrapf(err, "error retrieving PXC replication free port")
 	}
@@ -116,7 +116,7 @@ func CreatePxcReplication(sandboxDef SandboxDef, origin string, nodes int, maste
 		return err
 	}
 
-	firstGroupPort, err = common.FindFreePort(baseRsyncPort+1, sandboxDef.InstalledPorts, nodes)
+	firstGroupPort, err = findFreePort(baseRsyncPort+1, sandboxDef.InstalledPorts, nodes)
 	if err != nil {
 		return errors.Wrapf(err, "error retrieving PXC replication free port")
 	}
@@ -214,6 +214,7 @@ func CreatePxcReplication(sandboxDef SandboxDef, origin string, nodes int, maste
 		Port:        []int{},
 		Nodes:       []string{},
 		Destination: sandboxDef.SandboxDir,
+		ExpiresAt:   sandboxDef.ExpiresAt,
 	}
 
 	if sandboxDef.LogFileName != "" {
@@ -322,7 +323,11 @@ func CreatePxcReplication(sandboxDef SandboxDef, origin string, nodes int, maste
 		sandboxDef.ReplOptions = baseReplicationOptions + fmt.Sprintf("\n%s\n", pxcFilledTemplate)
 
 		sandboxDef.ReplOptions += fmt.Sprintf("\n%s\n", SingleTemplates[globals.TmplGtidOptions57].Contents)
-		sandboxDef.ReplOptions += fmt.Sprintf("\n%s\n", SingleTemplates[globals.TmplReplCrashSafeOptions].Contents)
+		replCrashSafeOptions, err := replCrashSafeOptionsFor(sandboxDef.Flavor, sandboxDef.Version)
+		if err != nil {
+			return err
+		}
+		sandboxDef.ReplOptions += fmt.Sprintf("\n%s\n", replCrashSafeOptions)
 		// 8.0.11
 		isMinimumMySQLXDefault, err := common.HasCapability(sandboxDef.Flavor, common.MySQLXDefault, sandboxDef.Version)
 		if err != nil {
@@ -129,6 +129,18 @@ var (
 	//go:embed templates/replication/repl_sysbench_ready.gotxt
 	sysbenchReadyReplTemplate string
 
+	//go:embed templates/replication/circular_replication.gotxt
+	circularReplicationTemplate string
+
+	//go:embed templates/replication/check_ring.gotxt
+	checkRingTemplate string
+
+	//go:embed templates/replication/chain_init_slaves.gotxt
+	chainInitSlavesTemplate string
+
+	//go:embed templates/replication/chain_check_slaves.gotxt
+	chainCheckSlavesTemplate string
+
 	ReplicationTemplates = TemplateCollection{
 		globals.TmplInitSlaves: TemplateDesc{
 			Description: "Initialize slaves after deployment",
@@ -300,5 +312,25 @@ var (
 			Notes:       "",
 			Contents:    sysbenchReadyReplTemplate,
 		},
+		globals.TmplCircularReplication: TemplateDesc{
+			Description: "Initializes nodes for circular replication",
+			Notes:       "circular",
+			Contents:    circularReplicationTemplate,
+		},
+		globals.TmplCheckRing: TemplateDesc{
+			Description: "checks replication status for circular replication",
+			Notes:       "circular",
+			Contents:    checkRingTemplate,
+		},
+		globals.TmplChainInitSlaves: TemplateDesc{
+			Description: "Initializes nodes for chain replication",
+			Notes:       "chain",
+			Contents:    chainInitSlavesTemplate,
+		},
+		globals.TmplChainCheckSlaves: TemplateDesc{
+			Description: "checks replication status for chain replication",
+			Notes:       "chain",
+			Contents:    chainCheckSlavesTemplate,
+		},
 	}
 )
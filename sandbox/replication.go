@@ -42,8 +42,10 @@ type ReplicationData struct {
 	MasterIp   string
 	Nodes      int
 	NdbNodes   int
+	TiKVNodes  int
 	MasterList string
 	SlaveList  string
+	ChainSpec  string
 }
 
 func setChangeMasterProperties(currentProperties string, moreProperties []string, logger *defaults.Logger) string {
@@ -54,6 +56,66 @@ func setChangeMasterProperties(currentProperties string, moreProperties []string
 	return currentProperties
 }
 
+// addReplicationSyntax adds to the template data the replication statements
+// that the given flavor and version understand (see common.ReplicationSyntax)
+func addReplicationSyntax(data common.StringMap, flavor, version string) error {
+	syntax, err := common.GetReplicationSyntax(flavor, version)
+	if err != nil {
+		return errors.Wrapf(err, globals.ErrWhileComparingVersions)
+	}
+	for key, value := range syntax.ToMap() {
+		data[key] = value
+	}
+	return nil
+}
+
+// NodeReplicationSyntax returns the replication syntax of the binaries used by a sandbox directory.
+// The old syntax is returned when the sandbox description can't be read
+func NodeReplicationSyntax(sandboxDir string) common.ReplicationSyntax {
+	sbDesc, err := common.ReadSandboxDescription(sandboxDir)
+	if err != nil {
+		return common.LegacyReplicationSyntax
+	}
+	syntax, err := common.GetReplicationSyntax(sbDesc.Flavor, sbDesc.Version)
+	if err != nil {
+		return common.LegacyReplicationSyntax
+	}
+	return syntax
+}
+
+// changeSourceOptions returns the auto-position clause and the extra options for CHANGE MASTER TO
+// (CHANGE REPLICATION SOURCE TO in recent versions), as understood by a slave with the given binaries
+func changeSourceOptions(sandboxDef SandboxDef, flavor, version string, logger *defaults.Logger) (string, string, error) {
+	syntax, err := common.GetReplicationSyntax(flavor, version)
+	if err != nil {
+		return "", "", errors.Wrapf(err, globals.ErrWhileComparingVersions)
+	}
+	autoPosition := ""
+	if sandboxDef.GtidOptions != "" {
+		isMariaDbGtid, err := common.HasCapability(flavor, common.MariaDbGTID, version)
+		if err != nil {
+			return "", "", err
+		}
+		if isMariaDbGtid {
+			autoPosition += ", MASTER_USE_GTID=slave_pos"
+			logger.Printf("Adding MASTER_USE_GTID to slaves setup\n")
+		} else {
+			autoPosition += fmt.Sprintf(", %s_AUTO_POSITION=1", syntax.SourceOption)
+			logger.Printf("Adding %s_AUTO_POSITION to slaves setup\n", syntax.SourceOption)
+		}
+	}
+	changeMasterOptions := sandboxDef.ChangeMasterOptions
+	// 8.0.11
+	isMinimumNativeAuthPlugin, err := common.HasCapability(flavor, common.NativeAuth, version)
+	if err != nil {
+		return "", "", err
+	}
+	if isMinimumNativeAuthPlugin && !sandboxDef.NativeAuthPlugin {
+		changeMasterOptions = append(changeMasterOptions, fmt.Sprintf("GET_%s_PUBLIC_KEY=1", syntax.SourceOption))
+	}
+	return autoPosition, setChangeMasterProperties("", changeMasterOptions, logger), nil
+}
+
 func checkReadOnlyFlags(sandboxDef SandboxDef) (string, error) {
 	readOnlyOption := ""
 	if sandboxDef.SlavesSuperReadOnly && sandboxDef.SlavesReadOnly {
@@ -133,7 +195,7 @@ func CreateMasterSlaveReplication(sandboxDef SandboxDef, origin string, nodes in
 	// FindFreePort returns the first free port, but base_port will be used
 	// with a counter. Thus the availability will be checked using
 	// "base_port + 1"
-	firstPort, err := common.FindFreePort(basePort+1, sandboxDef.InstalledPorts, nodes)
+	firstPort, err := findFreePort(basePort+1, sandboxDef.InstalledPorts, nodes)
 	if err != nil {
 		return errors.Wrapf(err, "error detecting free port for replication")
 	}
@@ -174,23 +236,10 @@ func CreateMasterSlaveReplication(sandboxDef SandboxDef, origin string, nodes in
 	sandboxDef.ServerId = setServerId(sandboxDef, 1)
 	sandboxDef.LoadGrants = false
 	masterPort := sandboxDef.Port
-	changeMasterExtra := ""
-	masterAutoPosition := ""
-	if sandboxDef.GtidOptions != "" {
-		masterAutoPosition += ", MASTER_AUTO_POSITION=1"
-		logger.Printf("Adding MASTER_AUTO_POSITION to slaves setup\n")
-	}
-	// 8.0.11
-	// isMinimumNativeAuthPlugin, err := common.GreaterOrEqualVersion(sandboxDef.Version, globals.MinimumNativeAuthPluginVersion)
-	isMinimumNativeAuthPlugin, err := common.HasCapability(sandboxDef.Flavor, common.NativeAuth, sandboxDef.Version)
+	masterAutoPosition, changeMasterExtra, err := changeSourceOptions(sandboxDef, sandboxDef.Flavor, sandboxDef.Version, logger)
 	if err != nil {
 		return err
 	}
-	if isMinimumNativeAuthPlugin {
-		if !sandboxDef.NativeAuthPlugin {
-			sandboxDef.ChangeMasterOptions = append(sandboxDef.ChangeMasterOptions, "GET_MASTER_PUBLIC_KEY=1")
-		}
-	}
 	slaves := nodes - 1
 	masterAbbr := defaults.Defaults().MasterAbbr
 	masterLabel := defaults.Defaults().MasterName
@@ -198,7 +247,6 @@ func CreateMasterSlaveReplication(sandboxDef SandboxDef, origin string, nodes in
 	slaveAbbr := defaults.Defaults().SlaveAbbr
 	timestamp := time.Now()
 
-	changeMasterExtra = setChangeMasterProperties(changeMasterExtra, sandboxDef.ChangeMasterOptions, logger)
 	var data = common.StringMap{
 		"ShellPath":          sandboxDef.ShellPath,
 		"Copyright":          globals.ShellScriptCopyright,
@@ -233,8 +281,23 @@ func CreateMasterSlaveReplication(sandboxDef SandboxDef, origin string, nodes in
 	sandboxDef.NodeNum = 1
 	sandboxDef.SBType = "replication-node"
 	sandboxDef.ReadOnlyOptions = ""
+	if sandboxDef.SemiSyncOptions != "" {
+		sandboxDef.SemiSyncOptions, err = semiSyncOptionsFor(sandboxDef.Flavor, sandboxDef.Version, true)
+		if err != nil {
+			return err
+		}
+	}
 	logger.Printf("Creating single sandbox for master\n")
-	execList, err := CreateChildSandbox(sandboxDef)
+	masterDef, err := nodeSandboxDef(sandboxDef, 1)
+	if err != nil {
+		return err
+	}
+	// The scripts that run on the master use its own replication statements
+	err = addReplicationSyntax(data, masterDef.Flavor, masterDef.Version)
+	if err != nil {
+		return err
+	}
+	execList, err := CreateChildSandbox(masterDef)
 	if err != nil {
 		return fmt.Errorf(globals.ErrCreatingSandbox, err)
 	}
@@ -259,6 +322,10 @@ func CreateMasterSlaveReplication(sandboxDef SandboxDef, origin string, nodes in
 		Port:        []int{sandboxDef.Port},
 		Nodes:       []string{defaults.Defaults().MasterName},
 		Destination: sandboxDef.SandboxDir,
+		ExpiresAt:   sandboxDef.ExpiresAt,
+	}
+	if len(sandboxDef.NodeVersions) > 0 {
+		sbDesc.NodeVersions = append(sbDesc.NodeVersions, nodeVersionDescription(masterDef, masterLabel))
 	}
 
 	if sandboxDef.LogFileName != "" {
@@ -267,7 +334,7 @@ func CreateMasterSlaveReplication(sandboxDef SandboxDef, origin string, nodes in
 
 	// 8.0.11
 	// isMinimumMySQLXDefault, err := common.GreaterOrEqualVersion(sandboxDef.Version, globals.MinimumMysqlxDefaultVersion)
-	isMinimumMySQLXDefault, err := common.HasCapability(sandboxDef.Flavor, common.MySQLXDefault, sandboxDef.Version)
+	isMinimumMySQLXDefault, err := common.HasCapability(masterDef.Flavor, common.MySQLXDefault, masterDef.Version)
 	if err != nil {
 		return err
 	}
@@ -291,7 +358,16 @@ func CreateMasterSlaveReplication(sandboxDef SandboxDef, origin string, nodes in
 	nodeLabel := defaults.Defaults().NodePrefix
 	for i := 1; i <= slaves; i++ {
 		sandboxDef.Port = basePort + i + 1
-		data["Slaves"] = append(data["Slaves"].([]common.StringMap), common.StringMap{
+		nodeVersion, nodeFlavor := sandboxDef.Version, sandboxDef.Flavor
+		if nodeBinaries, found := sandboxDef.NodeVersions[i+1]; found {
+			nodeVersion, nodeFlavor = nodeBinaries.Version, nodeBinaries.Flavor
+		}
+		// Each slave gets the replication statements that its own binaries understand
+		slaveAutoPosition, slaveChangeMasterExtra, err := changeSourceOptions(sandboxDef, nodeFlavor, nodeVersion, logger)
+		if err != nil {
+			return err
+		}
+		slaveData := common.StringMap{
 			"ShellPath":          sandboxDef.ShellPath,
 			"Copyright":          globals.ShellScriptCopyright,
 			"AppVersion":         common.VersionDef,
@@ -305,10 +381,15 @@ func CreateMasterSlaveReplication(sandboxDef SandboxDef, origin string, nodes in
 			"SandboxDir":         sandboxDef.SandboxDir,
 			"MasterPort":         masterPort,
 			"MasterIp":           masterIp,
-			"ChangeMasterExtra":  changeMasterExtra,
-			"MasterAutoPosition": masterAutoPosition,
+			"ChangeMasterExtra":  slaveChangeMasterExtra,
+			"MasterAutoPosition": slaveAutoPosition,
 			"RplUser":            sandboxDef.RplUser,
-			"RplPassword":        sandboxDef.RplPassword})
+			"RplPassword":        sandboxDef.RplPassword}
+		err = addReplicationSyntax(slaveData, nodeFlavor, nodeVersion)
+		if err != nil {
+			return err
+		}
+		data["Slaves"] = append(data["Slaves"].([]common.StringMap), slaveData)
 		sandboxDef.LoadGrants = false
 		sandboxDef.Prompt = fmt.Sprintf("%s%d", slaveLabel, i)
 		sandboxDef.DirName = fmt.Sprintf("%s%d", nodeLabel, i)
@@ -320,7 +401,7 @@ func CreateMasterSlaveReplication(sandboxDef SandboxDef, origin string, nodes in
 		sbDesc.Port = append(sbDesc.Port, sandboxDef.Port)
 		// 8.0.11
 		// isMinimumMySQLXDefault, err := common.GreaterOrEqualVersion(sandboxDef.Version, globals.MinimumMysqlxDefaultVersion)
-		isMinimumMySQLXDefault, err := common.HasCapability(sandboxDef.Flavor, common.MySQLXDefault, sandboxDef.Version)
+		isMinimumMySQLXDefault, err := common.HasCapability(nodeFlavor, common.MySQLXDefault, nodeVersion)
 		if err != nil {
 			return err
 		}
@@ -347,10 +428,20 @@ func CreateMasterSlaveReplication(sandboxDef SandboxDef, origin string, nodes in
 			logger.Printf(installationMessage, slaveLabel, i)
 		}
 		if sandboxDef.SemiSyncOptions != "" {
-			sandboxDef.SemiSyncOptions = SingleTemplates[globals.TmplSemisyncSlaveOptions].Contents
+			sandboxDef.SemiSyncOptions, err = semiSyncOptionsFor(sandboxDef.Flavor, sandboxDef.Version, false)
+			if err != nil {
+				return err
+			}
 		}
 		logger.Printf("Creating single sandbox for slave %d\n", i)
-		execListNode, err := CreateChildSandbox(sandboxDef)
+		slaveDef, err := nodeSandboxDef(sandboxDef, i+1)
+		if err != nil {
+			return err
+		}
+		if len(sandboxDef.NodeVersions) > 0 {
+			sbDesc.NodeVersions = append(sbDesc.NodeVersions, nodeVersionDescription(slaveDef, sandboxDef.DirName))
+		}
+		execListNode, err := CreateChildSandbox(slaveDef)
 		if err != nil {
 			return fmt.Errorf(globals.ErrCreatingSandbox, err)
 		}
@@ -365,8 +456,8 @@ func CreateMasterSlaveReplication(sandboxDef SandboxDef, origin string, nodes in
 			"NodePort":           sandboxDef.Port,
 			"SlaveLabel":         slaveLabel,
 			"MasterAbbr":         masterAbbr,
-			"ChangeMasterExtra":  changeMasterExtra,
-			"MasterAutoPosition": masterAutoPosition,
+			"ChangeMasterExtra":  slaveChangeMasterExtra,
+			"MasterAutoPosition": slaveAutoPosition,
 			"SlaveAbbr":          slaveAbbr,
 			"SandboxDir":         sandboxDef.SandboxDir,
 		}
@@ -392,6 +483,7 @@ func CreateMasterSlaveReplication(sandboxDef SandboxDef, origin string, nodes in
 			}
 		}
 	}
+	sbItem.NodeVersions = sbDesc.NodeVersions
 	err = common.WriteSandboxDescription(sandboxDef.SandboxDir, sbDesc)
 	if err != nil {
 		return errors.Wrapf(err, "unable to write sandbox description")
@@ -482,6 +574,9 @@ func CreateReplicationSandbox(sdef SandboxDef, origin string, replData Replicati
 		return fmt.Errorf(globals.ErrBaseDirectoryNotFound, Basedir)
 	}
 
+	if sdef.Flavor == common.PostgreSQLFlavor && replData.Topology != globals.MasterSlaveLabel {
+		return fmt.Errorf("flavor %s only supports topology '%s'", common.PostgreSQLFlavor, globals.MasterSlaveLabel)
+	}
 	sandboxDir := sdef.SandboxDir
 	switch replData.Topology {
 	case globals.MasterSlaveLabel:
@@ -501,6 +596,8 @@ func CreateReplicationSandbox(sdef SandboxDef, origin string, replData Replicati
 		if !isMinimumGroupRepl {
 			return fmt.Errorf(globals.ErrFeatureRequiresVersion, "group replication", common.IntSliceToDottedString(globals.MinimumGroupReplVersion))
 		}
+	case globals.InnoDBClusterLabel:
+		sdef.SandboxDir = path.Join(sdef.SandboxDir, defaults.Defaults().InnoDBClusterPrefix+common.VersionToName(origin))
 	case globals.FanInLabel:
 		// 5.7.9
 		// isMinimumMultiSource, err := common.GreaterOrEqualVersion(sdef.Version, globals.MinimumMultiSourceReplVersion)
@@ -524,6 +621,22 @@ func CreateReplicationSandbox(sdef SandboxDef, origin string, replData Replicati
 			return fmt.Errorf(globals.ErrFeatureRequiresVersion, "multi-source replication", common.IntSliceToDottedString(globals.MinimumMultiSourceReplVersion))
 		}
 		sdef.SandboxDir = path.Join(sdef.SandboxDir, defaults.Defaults().AllMastersPrefix+common.VersionToName(origin))
+	case globals.CircularLabel:
+		isCircular, err := common.HasCapability(sdef.Flavor, common.CircularReplication, sdef.Version)
+		if err != nil {
+			return err
+		}
+		// Circular replication is always deployed with GTID
+		isMinimumGtid, err := common.HasCapability(sdef.Flavor, common.GTID, sdef.Version)
+		if err != nil {
+			return err
+		}
+		if !isCircular || !isMinimumGtid {
+			return fmt.Errorf(globals.ErrFeatureRequiresVersion, "circular replication", common.IntSliceToDottedString(globals.MinimumGtidVersion))
+		}
+		sdef.SandboxDir = path.Join(sdef.SandboxDir, defaults.Defaults().CircularPrefix+common.VersionToName(origin))
+	case globals.ChainLabel:
+		sdef.SandboxDir = path.Join(sdef.SandboxDir, defaults.Defaults().ChainPrefix+common.VersionToName(origin))
 	case globals.PxcLabel:
 		isMinimumPxc, err := common.HasCapability(sdef.Flavor, common.XtradbCluster, sdef.Version)
 		if err != nil {
@@ -533,6 +646,16 @@ func CreateReplicationSandbox(sdef SandboxDef, origin string, replData Replicati
 			return fmt.Errorf(globals.ErrFeatureRequiresCapability, "Xtradb Cluster", common.PxcFlavor, common.IntSliceToDottedString(globals.MinimumXtradbClusterVersion))
 		}
 		sdef.SandboxDir = path.Join(sdef.SandboxDir, defaults.Defaults().PxcPrefix+common.VersionToName(origin))
+	case globals.GaleraLabel:
+		isMinimumGalera, err := common.HasCapability(sdef.Flavor, common.MariaDbGalera, sdef.Version)
+		if err != nil {
+			return err
+		}
+		if !isMinimumGalera {
+			return fmt.Errorf(globals.ErrFeatureRequiresCapability, "Galera cluster", common.MariaDbFlavor,
+				common.IntSliceToDottedString(globals.MinimumMariaDbGaleraVersion))
+		}
+		sdef.SandboxDir = path.Join(sdef.SandboxDir, defaults.Defaults().GaleraPrefix+common.VersionToName(origin))
 	case globals.NdbLabel:
 		isMinimumNdb, err := common.HasCapability(sdef.Flavor, common.NdbCluster, sdef.Version)
 		if err != nil {
@@ -543,6 +666,16 @@ func CreateReplicationSandbox(sdef SandboxDef, origin string, replData Replicati
 				common.IntSliceToDottedString(globals.MinimumNdbClusterVersion))
 		}
 		sdef.SandboxDir = path.Join(sdef.SandboxDir, defaults.Defaults().NdbPrefix+common.VersionToName(origin))
+	case globals.TiDBClusterLabel:
+		isMinimumTidbCluster, err := common.HasCapability(sdef.Flavor, common.TiDBCluster, sdef.Version)
+		if err != nil {
+			return err
+		}
+		if !isMinimumTidbCluster {
+			return fmt.Errorf(globals.ErrFeatureRequiresCapability, "TiDB cluster", common.TiDbFlavor,
+				common.IntSliceToDottedString(globals.MinimumTiDBClusterVersion))
+		}
+		sdef.SandboxDir = path.Join(sdef.SandboxDir, defaults.Defaults().TidbClusterPrefix+common.VersionToName(origin))
 	default:
 		return fmt.Errorf("unrecognized topology. Accepted: '%v'", globals.AllowedTopologies)
 	}
@@ -561,20 +694,41 @@ func CreateReplicationSandbox(sdef SandboxDef, origin string, replData Replicati
 	if sdef.HistoryDir == "REPL_DIR" {
 		sdef.HistoryDir = sdef.SandboxDir
 	}
-	var err error
+	err := checkNodeVersions(sdef, replData.Topology, replData.Nodes)
+	if err != nil {
+		return err
+	}
 	switch replData.Topology {
 	case globals.MasterSlaveLabel:
-		err = CreateMasterSlaveReplication(sdef, origin, replData.Nodes, replData.MasterIp)
+		if sdef.Flavor == common.PostgreSQLFlavor {
+			err = CreatePostgreSQLReplication(sdef, origin, replData.Nodes)
+		} else {
+			err = CreateMasterSlaveReplication(sdef, origin, replData.Nodes, replData.MasterIp)
+		}
 	case globals.GroupLabel:
 		err = CreateGroupReplication(sdef, origin, replData.Nodes, replData.MasterIp)
+	case globals.InnoDBClusterLabel:
+		err = CreateInnoDBCluster(sdef, origin, replData.Nodes, replData.MasterIp)
 	case globals.FanInLabel:
 		err = CreateFanInReplication(sdef, origin, replData.Nodes, replData.MasterIp, replData.MasterList, replData.SlaveList)
 	case globals.AllMastersLabel:
 		err = CreateAllMastersReplication(sdef, origin, replData.Nodes, replData.MasterIp)
+	case globals.CircularLabel:
+		err = CreateCircularReplication(sdef, origin, replData.Nodes, replData.MasterIp)
+	case globals.ChainLabel:
+		err = CreateChainReplication(sdef, origin, replData.Nodes, replData.MasterIp, replData.ChainSpec)
 	case globals.PxcLabel:
 		err = CreatePxcReplication(sdef, origin, replData.Nodes, replData.MasterIp)
+	case globals.GaleraLabel:
+		err = CreateGaleraReplication(sdef, origin, replData.Nodes, replData.MasterIp)
 	case globals.NdbLabel:
 		err = CreateNdbReplication(sdef, origin, replData.Nodes, replData.NdbNodes, replData.MasterIp)
+	case globals.TiDBClusterLabel:
+		tikvNodes := replData.TiKVNodes
+		if tikvNodes == 0 {
+			tikvNodes = globals.TiKVNodesValue
+		}
+		err = CreateTidbCluster(sdef, origin, replData.Nodes, tikvNodes, replData.MasterIp)
 	}
 	return err
 }
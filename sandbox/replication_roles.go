@@ -0,0 +1,170 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/dustin/go-humanize/english"
+)
+
+// ReplicationRoles describes which nodes of a master-slave sandbox are the master and the slaves.
+// Nodes are identified by the name of their directory, which doesn't change when the roles do.
+type ReplicationRoles struct {
+	SandboxDir  string
+	Master      string
+	MasterPort  int
+	Slaves      []string
+	SlavePorts  []int
+	MasterIp    string
+	RplUser     string
+	RplPassword string
+	// Options to add to CHANGE MASTER TO, by slave directory (such as ", GET_SOURCE_PUBLIC_KEY=1")
+	ChangeMasterExtra map[string]string
+}
+
+// WriteReplicationRoleScripts writes again the scripts of a master-slave sandbox that depend
+// on which nodes are the master and the slaves: the master and slave shortcuts (m, s1, ...),
+// the scripts that run commands in all nodes, and the ones that check and initialize replication.
+// Slave shortcuts that are left over from a larger set of slaves are removed.
+func WriteReplicationRoleScripts(roles ReplicationRoles) error {
+	if len(roles.Slaves) != len(roles.SlavePorts) {
+		return fmt.Errorf("%d slaves given with %d ports", len(roles.Slaves), len(roles.SlavePorts))
+	}
+	masterAbbr := defaults.Defaults().MasterAbbr
+	slaveAbbr := defaults.Defaults().SlaveAbbr
+	masterLabel := defaults.Defaults().MasterName
+	slaveLabel := defaults.Defaults().SlavePrefix
+	timestamp := time.Now()
+	// Node directories are used as they are: the node label is empty,
+	// and the node name is the full directory name
+	var data = common.StringMap{
+		"ShellPath":   defaults.Defaults().ShellPath,
+		"Copyright":   globals.ShellScriptCopyright,
+		"AppVersion":  common.VersionDef,
+		"DateTime":    timestamp.Format(time.UnixDate),
+		"SandboxDir":  roles.SandboxDir,
+		"MasterLabel": roles.Master,
+		"MasterPort":  roles.MasterPort,
+		"SlaveLabel":  slaveLabel,
+		"MasterAbbr":  masterAbbr,
+		"MasterIp":    roles.MasterIp,
+		"RplUser":     roles.RplUser,
+		"RplPassword": roles.RplPassword,
+		"SlaveAbbr":   slaveAbbr,
+		"Slaves":      []common.StringMap{},
+	}
+	// Each node uses the replication statements of its own binaries
+	for key, value := range NodeReplicationSyntax(path.Join(roles.SandboxDir, roles.Master)).ToMap() {
+		data[key] = value
+	}
+	for i, slave := range roles.Slaves {
+		syntax := NodeReplicationSyntax(path.Join(roles.SandboxDir, slave))
+		slaveData := common.StringMap{
+			"Node":               slave,
+			"NodeLabel":          "",
+			"NodePort":           roles.SlavePorts[i],
+			"SlaveLabel":         "",
+			"SandboxDir":         roles.SandboxDir,
+			"MasterPort":         roles.MasterPort,
+			"MasterIp":           roles.MasterIp,
+			"ChangeMasterExtra":  roles.ChangeMasterExtra[slave],
+			"MasterAutoPosition": fmt.Sprintf(", %s_AUTO_POSITION=1", syntax.SourceOption),
+			"RplUser":            roles.RplUser,
+			"RplPassword":        roles.RplPassword,
+		}
+		for key, value := range syntax.ToMap() {
+			slaveData[key] = value
+		}
+		data["Slaves"] = append(data["Slaves"].([]common.StringMap), slaveData)
+	}
+	withAdmin := common.ExecExists(path.Join(roles.SandboxDir, masterAbbr+"a"))
+
+	slavePlural := english.PluralWord(2, slaveLabel, "")
+	masterPlural := english.PluralWord(2, masterLabel, "")
+	sb := ScriptBatch{
+		tc:         ReplicationTemplates,
+		sandboxDir: roles.SandboxDir,
+		data:       data,
+		scripts: []ScriptDef{
+			{masterAbbr, globals.TmplMaster, true},
+			{globals.ScriptStartAll, globals.TmplStartAll, true},
+			{globals.ScriptRestartAll, globals.TmplRestartAll, true},
+			{globals.ScriptStatusAll, globals.TmplStatusAll, true},
+			{globals.ScriptTestSbAll, globals.TmplTestSbAll, true},
+			{globals.ScriptStopAll, globals.TmplStopAll, true},
+			{globals.ScriptClearAll, globals.TmplClearAll, true},
+			{globals.ScriptSendKillAll, globals.TmplSendKillAll, true},
+			{globals.ScriptMetadataAll, globals.TmplMetadataAll, true},
+			{globals.ScriptWipeRestartAll, globals.TmplWipeAndRestartAll, true},
+			{globals.ScriptUseAll, globals.TmplUseAll, true},
+			{globals.ScriptExecAll, globals.TmplExecAll, true},
+			{"use_all_" + slavePlural, globals.TmplUseAllSlaves, true},
+			{"use_all_" + masterPlural, globals.TmplUseAllMasters, true},
+			{"exec_all_" + slavePlural, globals.TmplExecAllSlaves, true},
+			{"exec_all_" + masterPlural, globals.TmplExecAllMasters, true},
+			{"initialize_" + slavePlural, globals.TmplInitSlaves, true},
+			{"check_" + slavePlural, globals.TmplCheckSlaves, true},
+		},
+	}
+	if withAdmin {
+		sb.scripts = append(sb.scripts, ScriptDef{masterAbbr + "a", globals.TmplMasterAdmin, true})
+	}
+	err := writeScripts(sb)
+	if err != nil {
+		return err
+	}
+	for i, slave := range roles.Slaves {
+		dataSlave := common.StringMap{
+			"ShellPath":  defaults.Defaults().ShellPath,
+			"Copyright":  globals.ShellScriptCopyright,
+			"AppVersion": common.VersionDef,
+			"DateTime":   timestamp.Format(time.UnixDate),
+			"Node":       slave,
+			"NodeLabel":  "",
+			"SandboxDir": roles.SandboxDir,
+		}
+		scripts := []ScriptDef{{fmt.Sprintf("%s%d", slaveAbbr, i+1), globals.TmplSlave, true}}
+		if withAdmin {
+			scripts = append(scripts, ScriptDef{fmt.Sprintf("%sa%d", slaveAbbr, i+1), globals.TmplSlaveAdmin, true})
+		}
+		err = writeScripts(ScriptBatch{ReplicationTemplates, nil, roles.SandboxDir, dataSlave, scripts})
+		if err != nil {
+			return err
+		}
+	}
+	for i := len(roles.Slaves) + 1; ; i++ {
+		slaveScript := path.Join(roles.SandboxDir, fmt.Sprintf("%s%d", slaveAbbr, i))
+		if !common.FileExists(slaveScript) {
+			break
+		}
+		for _, script := range []string{slaveScript, path.Join(roles.SandboxDir, fmt.Sprintf("%sa%d", slaveAbbr, i))} {
+			if common.FileExists(script) {
+				err = os.Remove(script)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Ports used by a router, starting at its base port:
+	// classic read-write, classic read-only, X read-write, X read-only,
+	// read-write splitting (MySQL Router 8.2+), and HTTP server
+	routerPorts = 6
+	// Seconds that the start script waits for the router to write its PID file
+	routerStartupTimeout = 30
+	// Configuration file written by mysqlrouter --bootstrap
+	routerConfigName = "mysqlrouter.conf"
+)
+
+// RouterDef describes a MySQL Router sandbox, attached to an InnoDB Cluster sandbox
+type RouterDef struct {
+	Basedir        string // Directory containing the router binaries
+	Version        string // Version of the router
+	SandboxDir     string // Directory where the router sandbox is created
+	DirName        string // Name of the router sandbox. Default: router prefix + cluster sandbox name
+	ClusterDir     string // Full path of the InnoDB Cluster sandbox
+	BasePort       int    // First of the router ports. Default: router-base-port
+	InstalledPorts []int  // Ports used by other sandboxes
+	ShellPath      string // Shell used by the scripts
+	SkipStart      bool   // Does not start the router after the bootstrap
+	ExpiresAt      string // When the sandbox can be removed by "dbdeployer gc" (RFC3339)
+}
+
+// RouterPorts returns the ports of a router sandbox, starting at basePort
+func RouterPorts(basePort int) []int {
+	var ports []int
+	for i := 0; i < routerPorts; i++ {
+		ports = append(ports, basePort+i)
+	}
+	return ports
+}
+
+// setRouterHttpPort changes the port of the HTTP server in a router configuration file,
+// as all the routers bootstrapped with default options would use the same one
+func setRouterHttpPort(configFile string, port int) error {
+	lines, err := common.SlurpAsLines(configFile)
+	if err != nil {
+		return err
+	}
+	section := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			section = strings.Trim(trimmed, "[] ")
+			continue
+		}
+		if section == "http_server" && strings.HasPrefix(strings.ReplaceAll(trimmed, " ", ""), "port=") {
+			lines[i] = fmt.Sprintf("port=%d", port)
+		}
+	}
+	return common.WriteStrings(lines, configFile, "\n")
+}
+
+// CreateRouterSandbox bootstraps MySQL Router against a running InnoDB Cluster sandbox,
+// and writes the scripts to start, stop, and use it
+func CreateRouterSandbox(routerDef RouterDef) error {
+	mysqlRouter := path.Join(routerDef.Basedir, "bin", globals.FnMysqlRouter)
+	if !common.ExecExists(mysqlRouter) {
+		return fmt.Errorf(globals.ErrExecutableNotFound, mysqlRouter)
+	}
+	clusterDesc, err := common.ReadSandboxDescription(routerDef.ClusterDir)
+	if err != nil {
+		return errors.Wrapf(err, "error reading the description of cluster %s", routerDef.ClusterDir)
+	}
+	if clusterDesc.SBType != globals.InnoDBClusterLabel {
+		return fmt.Errorf("sandbox %s is a '%s' sandbox. MySQL Router requires an '%s' sandbox",
+			routerDef.ClusterDir, clusterDesc.SBType, globals.InnoDBClusterLabel)
+	}
+	firstNode := path.Join(routerDef.ClusterDir, defaults.Defaults().NodePrefix+"1")
+	superUser, err := readNodeConnection(firstNode, globals.ScriptConnectionSuperJson)
+	if err != nil {
+		return errors.Wrapf(err, "error reading the connection data of %s", firstNode)
+	}
+
+	if routerDef.DirName == "" {
+		routerDef.DirName = defaults.Defaults().RouterPrefix + path.Base(routerDef.ClusterDir)
+	}
+	sandboxDir := path.Join(routerDef.SandboxDir, routerDef.DirName)
+	if common.DirExists(sandboxDir) {
+		return fmt.Errorf(globals.ErrNamedDirectoryAlreadyExists, "router", sandboxDir)
+	}
+	basePort := routerDef.BasePort
+	if basePort == 0 {
+		basePort = defaults.Defaults().RouterBasePort
+	}
+	basePort, err = findFreePort(basePort, routerDef.InstalledPorts, routerPorts)
+	if err != nil {
+		return errors.Wrapf(err, "error finding free ports for the router")
+	}
+	ports := RouterPorts(basePort)
+
+	args := []string{
+		"--bootstrap", fmt.Sprintf("%s:%s@%s:%d", clusterAdminUser, superUser.Password, superUser.Host, superUser.Port),
+		"--directory", sandboxDir,
+		"--conf-base-port", fmt.Sprintf("%d", basePort),
+		"--conf-bind-address", superUser.Host,
+		"--report-host", superUser.Host,
+		"--name", routerDef.DirName,
+	}
+	// The router refuses to bootstrap as root, unless the user is explicit
+	if os.Geteuid() == 0 {
+		args = append(args, "--user", "root")
+	}
+	common.CondPrintf("Bootstrapping %s from %s\n", routerDef.DirName, common.ReplaceLiteralHome(routerDef.ClusterDir))
+	_, err = common.RunCmdCtrlWithArgs(mysqlRouter, args, true)
+	if err != nil {
+		if common.DirExists(sandboxDir) {
+			_ = os.RemoveAll(sandboxDir)
+		}
+		return fmt.Errorf("error bootstrapping the router from %s: %s", routerDef.ClusterDir, err)
+	}
+	common.AddToCleanupStack(common.RmdirAll, "RmdirAll", sandboxDir)
+	configFile := path.Join(sandboxDir, routerConfigName)
+	if common.FileExists(configFile) {
+		err = setRouterHttpPort(configFile, ports[routerPorts-1])
+		if err != nil {
+			return errors.Wrapf(err, "error setting the HTTP port of the router")
+		}
+	}
+
+	timestamp := time.Now()
+	data := common.StringMap{
+		"ShellPath":      routerDef.ShellPath,
+		"Copyright":      globals.ShellScriptCopyright,
+		"AppVersion":     common.VersionDef,
+		"DateTime":       timestamp.Format(time.UnixDate),
+		"SandboxDir":     sandboxDir,
+		"ClientBasedir":  clusterDesc.Basedir,
+		"DbUser":         superUser.User,
+		"DbPassword":     superUser.Password,
+		"RwPort":         ports[0],
+		"RoPort":         ports[1],
+		"StartupTimeout": routerStartupTimeout,
+	}
+	err = writeScripts(ScriptBatch{
+		tc:         RouterTemplates,
+		data:       data,
+		sandboxDir: sandboxDir,
+		scripts: []ScriptDef{
+			{globals.ScriptStart, globals.TmplRouterStart, true},
+			{globals.ScriptStop, globals.TmplRouterStop, true},
+			{globals.ScriptSendKill, globals.TmplRouterSendKill, true},
+			{globals.ScriptStatus, globals.TmplRouterStatus, true},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for _, use := range []struct {
+		script string
+		role   string
+		port   int
+	}{
+		{globals.ScriptUseRw, "RW", ports[0]},
+		{globals.ScriptUseRo, "RO", ports[1]},
+	} {
+		data["Port"] = use.port
+		data["PortRole"] = use.role
+		err = writeScript(nil, RouterTemplates, use.script, globals.TmplRouterUse, sandboxDir, data, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	sbDesc := common.SandboxDescription{
+		Basedir: routerDef.Basedir,
+		SBType:  globals.SbTypeRouter,
+		Version: routerDef.Version,
+		Flavor:  common.MySQLRouterFlavor,
+		Port:    ports,
+	}
+	err = common.WriteSandboxDescription(sandboxDir, sbDesc)
+	if err != nil {
+		return errors.Wrapf(err, "unable to write sandbox description")
+	}
+	err = defaults.UpdateCatalog(sandboxDir, defaults.SandboxItem{
+		Origin:      routerDef.Basedir,
+		SBType:      globals.SbTypeRouter,
+		Version:     routerDef.Version,
+		Flavor:      common.MySQLRouterFlavor,
+		Port:        ports,
+		Destination: sandboxDir,
+		ExpiresAt:   routerDef.ExpiresAt,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "unable to update catalog")
+	}
+	if !routerDef.SkipStart {
+		_, err = common.RunCmd(path.Join(sandboxDir, globals.ScriptStart))
+		if err != nil {
+			return fmt.Errorf("error starting the router: %s", err)
+		}
+	}
+	common.CondPrintf("Router installed in %s\n", common.ReplaceLiteralHome(sandboxDir))
+	common.CondPrintf("Read-write port: %d - Read-only port: %d\n", ports[0], ports[1])
+	return nil
+}
@@ -0,0 +1,72 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.16
+// +build go1.16
+
+package sandbox
+
+import (
+	_ "embed"
+
+	"github.com/datacharmer/dbdeployer/globals"
+)
+
+// Templates for MySQL Router
+
+var (
+	//go:embed templates/router/router_start.gotxt
+	routerStartTemplate string
+
+	//go:embed templates/router/router_stop.gotxt
+	routerStopTemplate string
+
+	//go:embed templates/router/router_send_kill.gotxt
+	routerSendKillTemplate string
+
+	//go:embed templates/router/router_status.gotxt
+	routerStatusTemplate string
+
+	//go:embed templates/router/router_use.gotxt
+	routerUseTemplate string
+
+	RouterTemplates = TemplateCollection{
+		globals.TmplRouterStart: TemplateDesc{
+			Description: "Starts a MySQL Router sandbox",
+			Notes:       "Uses the start.sh script written by mysqlrouter --bootstrap",
+			Contents:    routerStartTemplate,
+		},
+		globals.TmplRouterStop: TemplateDesc{
+			Description: "Stops a MySQL Router sandbox",
+			Notes:       "Uses the stop.sh script written by mysqlrouter --bootstrap",
+			Contents:    routerStopTemplate,
+		},
+		globals.TmplRouterSendKill: TemplateDesc{
+			Description: "Kills a MySQL Router sandbox",
+			Notes:       "",
+			Contents:    routerSendKillTemplate,
+		},
+		globals.TmplRouterStatus: TemplateDesc{
+			Description: "Shows the status of a MySQL Router sandbox",
+			Notes:       "",
+			Contents:    routerStatusTemplate,
+		},
+		globals.TmplRouterUse: TemplateDesc{
+			Description: "Connects to the cluster through a router port",
+			Notes:       "Used for both the read-write and the read-only port",
+			Contents:    routerUseTemplate,
+		},
+	}
+)
@@ -91,6 +91,7 @@ type SandboxDef struct {
 	HistoryDir           string           // Where to store the MySQL client history
 	LogFileName          string           // Where to log operations for this sandbox
 	Flavor               string           // The flavor of the binaries (MySQL, Percona, NDB, etc)
+	TidbPdAddress        string           // PD address for a TiDB server in a cluster. Empty for the embedded store
 	PortAsServerId       bool             // Whether we use the port number as server ID
 	FlavorInPrompt       bool             // Add flavor to prompt
 	SocketInDatadir      bool             // Whether we want the socket in the data directory
@@ -108,6 +109,10 @@ type SandboxDef struct {
 	Force                bool             // Overwrite an existing sandbox with same target
 	ExposeDdTables       bool             // Show hidden data dictionary tables (MySQL 8.0.0+)
 	RunConcurrently      bool             // Run multiple sandbox creation concurrently
+	UseDatadirCache      bool             // Copy the data directory from the cache of initialized ones
+	ExpiresAt            string           // When the sandbox can be removed by "dbdeployer gc" (RFC3339)
+	// Binaries for specific nodes of a replication sandbox, by node number. Other nodes use Basedir
+	NodeVersions map[int]common.NodeVersion
 }
 
 type ScriptDef struct {
@@ -173,15 +178,116 @@ func stringMapToJson(data common.StringMap) string {
 	return string(b)
 }
 
-func isLocked(sbDir string) bool {
+// IsLocked returns true if the sandbox in sbDir is protected against deletion
+func IsLocked(sbDir string) bool {
 	return common.FileExists(path.Join(sbDir, globals.ScriptNoClear)) || common.FileExists(path.Join(sbDir, globals.ScriptNoClearAll))
 }
 
+// gtidOptionsTemplate returns the name of the template with the GTID options
+// for the given flavor and version. MariaDB uses its own GTID implementation
+func gtidOptionsTemplate(flavor, version string) (string, error) {
+	isMariaDbGtid, err := common.HasCapability(flavor, common.MariaDbGTID, version)
+	if err != nil {
+		return "", errors.Wrapf(err, globals.ErrWhileComparingVersions)
+	}
+	if isMariaDbGtid {
+		return globals.TmplGtidOptionsMariaDb, nil
+	}
+	isMinimumGtid, err := common.HasCapability(flavor, common.GTID, version)
+	if err != nil {
+		return "", errors.Wrapf(err, globals.ErrWhileComparingVersions)
+	}
+	if !isMinimumGtid {
+		return "", fmt.Errorf(globals.ErrOptionRequiresVersion, globals.GtidLabel,
+			common.IntSliceToDottedString(globals.MinimumGtidVersion))
+	}
+	isEnhancedGtid, err := common.HasCapability(flavor, common.EnhancedGTID, version)
+	if err != nil {
+		return "", errors.Wrapf(err, globals.ErrWhileComparingVersions)
+	}
+	if isEnhancedGtid {
+		return globals.TmplGtidOptions57, nil
+	}
+	return globals.TmplGtidOptions56, nil
+}
+
+// replCrashSafeOptionsFor returns the crash-safe replication options for the given flavor and version.
+// Versions with the replica terminology don't accept the repository options anymore
+func replCrashSafeOptionsFor(flavor, version string) (string, error) {
+	isReplicaTerminology, err := common.HasCapability(flavor, common.ReplicaTerminology, version)
+	if err != nil {
+		return "", errors.Wrapf(err, globals.ErrWhileComparingVersions)
+	}
+	if isReplicaTerminology {
+		return SingleTemplates[globals.TmplReplCrashSafeReplica].Contents, nil
+	}
+	return SingleTemplates[globals.TmplReplCrashSafeOptions].Contents, nil
+}
+
+// semiSyncOptionsFor returns the semi-synchronous replication options for a source (isSource=true)
+// or a replica, using the plugin names that are available for the given flavor and version
+func semiSyncOptionsFor(flavor, version string, isSource bool) (string, error) {
+	isReplicaTerminology, err := common.HasCapability(flavor, common.ReplicaTerminology, version)
+	if err != nil {
+		return "", errors.Wrapf(err, globals.ErrWhileComparingVersions)
+	}
+	templateName := globals.TmplSemisyncSlaveOptions
+	switch {
+	case isSource && isReplicaTerminology:
+		templateName = globals.TmplSemisyncSourceOptions
+	case isSource:
+		templateName = globals.TmplSemisyncMasterOptions
+	case isReplicaTerminology:
+		templateName = globals.TmplSemisyncReplicaOptions
+	}
+	return SingleTemplates[templateName].Contents, nil
+}
+
+// SetReplicationOptions adds to a sandbox definition the options for binary log (master),
+// GTID, and crash-safe replication, checking that the version supports them
+func SetReplicationOptions(sandboxDef SandboxDef, master, gtid, replCrashSafe bool) (SandboxDef, error) {
+	if master {
+		sandboxDef.ReplOptions = SingleTemplates[globals.TmplReplicationOptions].Contents
+		sandboxDef.PortAsServerId = sandboxDef.ServerId == 0
+	}
+	if gtid {
+		templateName, err := gtidOptionsTemplate(sandboxDef.Flavor, sandboxDef.Version)
+		if err != nil {
+			return sandboxDef, err
+		}
+		sandboxDef.GtidOptions = SingleTemplates[templateName].Contents
+		// MariaDB doesn't have the crash-safe options of MySQL
+		if templateName != globals.TmplGtidOptionsMariaDb {
+			sandboxDef.ReplCrashSafeOptions, err = replCrashSafeOptionsFor(sandboxDef.Flavor, sandboxDef.Version)
+			if err != nil {
+				return sandboxDef, err
+			}
+		}
+		sandboxDef.ReplOptions = SingleTemplates[globals.TmplReplicationOptions].Contents
+		sandboxDef.PortAsServerId = sandboxDef.ServerId == 0
+	}
+	if replCrashSafe && sandboxDef.ReplCrashSafeOptions == "" {
+		isMinimumCrashSafe, err := common.HasCapability(sandboxDef.Flavor, common.CrashSafe, sandboxDef.Version)
+		if err != nil {
+			return sandboxDef, errors.Wrapf(err, globals.ErrWhileComparingVersions)
+		}
+		if !isMinimumCrashSafe {
+			return sandboxDef, fmt.Errorf(globals.ErrOptionRequiresVersion, globals.ReplCrashSafeLabel,
+				common.IntSliceToDottedString(globals.MinimumCrashSafeVersion))
+		}
+		sandboxDef.ReplCrashSafeOptions, err = replCrashSafeOptionsFor(sandboxDef.Flavor, sandboxDef.Version)
+		if err != nil {
+			return sandboxDef, err
+		}
+	}
+	return sandboxDef, nil
+}
+
 func checkDirectory(sandboxDef SandboxDef) (SandboxDef, error) {
 	sandboxDir := sandboxDef.SandboxDir
 	if common.DirExists(sandboxDir) {
 		if sandboxDef.Force {
-			if isLocked(sandboxDir) {
+			if IsLocked(sandboxDir) {
 				return sandboxDef, fmt.Errorf("sandbox in %s is locked. Cannot be overwritten\nYou can unlock it with 'dbdeployer admin unlock %s'", sandboxDir, common.DirName(sandboxDir))
 			}
 			common.CondPrintf("Overwriting directory %s\n", sandboxDir)
@@ -278,6 +384,49 @@ func fixServerUuid(sandboxDef SandboxDef) (uuidDef string, uuidFile string, err
 	return uuidDef, uuidFile, nil
 }
 
+// WriteServerUuid writes the auto.cnf of an existing sandbox node, using the server UUID that
+// a deployment with the port and node number of its description would get.
+// It is used when the data directory comes from another sandbox
+func WriteServerUuid(nodeDir string, sbDesc common.SandboxDescription) error {
+	if len(sbDesc.Port) == 0 {
+		return fmt.Errorf("no port found in the description of %s", nodeDir)
+	}
+	flavor := sbDesc.Flavor
+	if flavor == "" {
+		flavor = common.MySQLFlavor
+	}
+	uuidDef, uuidFile, err := fixServerUuid(SandboxDef{
+		Flavor:     flavor,
+		Version:    sbDesc.Version,
+		Port:       sbDesc.Port[0],
+		NodeNum:    sbDesc.NodeNum,
+		SandboxDir: nodeDir,
+	})
+	if err != nil || uuidFile == "" {
+		return err
+	}
+	return common.WriteString(fmt.Sprintf("[auto]\n%s\n", uuidDef), uuidFile)
+}
+
+// findFreePort finds free ports like common.FindFreePort, also skipping the ports leased by
+// concurrent deployments. The ports found are leased until the sandbox enters the catalog
+func findFreePort(basePort int, installedPorts []int, howMany int) (int, error) {
+	firstPort := 0
+	_, err := defaults.LeasePorts(func(usedPorts []int) ([]int, error) {
+		var err error
+		firstPort, err = common.FindFreePort(basePort, append(usedPorts, installedPorts...), howMany)
+		if err != nil {
+			return nil, err
+		}
+		var ports []int
+		for port := firstPort; port < firstPort+howMany; port++ {
+			ports = append(ports, port)
+		}
+		return ports, nil
+	})
+	return firstPort, err
+}
+
 func sliceToText(stringSlice []string) string {
 	var text string = ""
 	for _, v := range stringSlice {
@@ -295,7 +444,7 @@ func setMysqlxProperties(sandboxDef SandboxDef, socketDir string) (SandboxDef, e
 	mysqlxPort := sandboxDef.MysqlXPort
 	if mysqlxPort == 0 {
 		var err error
-		mysqlxPort, err = common.FindFreePort(sandboxDef.Port+defaults.Defaults().MysqlXPortDelta, sandboxDef.InstalledPorts, 1)
+		mysqlxPort, err = findFreePort(sandboxDef.Port+defaults.Defaults().MysqlXPortDelta, sandboxDef.InstalledPorts, 1)
 		if err != nil {
 			return SandboxDef{}, errors.Wrapf(err, "error detecting free port for MySQLX")
 		}
@@ -325,7 +474,7 @@ func setAdminPortProperties(sandboxDef SandboxDef) (SandboxDef, error) {
 	adminPort := sandboxDef.AdminPort
 	if adminPort == 0 {
 		var err error
-		adminPort, err = common.FindFreePort(sandboxDef.Port+defaults.Defaults().AdminPortDelta, sandboxDef.InstalledPorts, 1)
+		adminPort, err = findFreePort(sandboxDef.Port+defaults.Defaults().AdminPortDelta, sandboxDef.InstalledPorts, 1)
 		if err != nil {
 			return SandboxDef{}, errors.Wrapf(err, "error detecting free admin port")
 		}
@@ -359,6 +508,9 @@ func createSingleSandbox(sandboxDef SandboxDef) (execList []concurrent.Execution
 	if sandboxDef.Flavor == "" {
 		sandboxDef.Flavor = common.MySQLFlavor
 	}
+	if sandboxDef.Flavor == common.PostgreSQLFlavor {
+		return emptyExecutionList, createPostgreSQLSandbox(sandboxDef, 0)
+	}
 
 	if sandboxDef.Flavor == common.TiDbFlavor {
 		// Ensures that we can run a client.
@@ -460,7 +612,7 @@ func createSingleSandbox(sandboxDef SandboxDef) (execList []concurrent.Execution
 		socketDir = dataDir
 	}
 	if sandboxDef.NodeNum == 0 && !sandboxDef.Force && !sandboxDef.Imported {
-		sandboxDef.Port, err = common.FindFreePort(sandboxDef.Port, sandboxDef.InstalledPorts, 1)
+		sandboxDef.Port, err = findFreePort(sandboxDef.Port, sandboxDef.InstalledPorts, 1)
 		if err != nil {
 			return emptyExecutionList, errors.Wrapf(err, "error detecting free port for single sandbox")
 		}
@@ -748,6 +900,29 @@ func createSingleSandbox(sandboxDef SandboxDef) (execList []concurrent.Execution
 	} else {
 		data["ServerId"] = ""
 	}
+	// With MariaDB GTID, each node writes in its own domain, so that a transaction
+	// executed on a slave doesn't break gtid_strict_mode when the master sends its own
+	if sandboxDef.GtidOptions != "" && sandboxDef.NodeNum > 0 {
+		isMariaDbGtid, err := common.HasCapability(sandboxDef.Flavor, common.MariaDbGTID, sandboxDef.Version)
+		if err != nil {
+			return emptyExecutionList, err
+		}
+		if isMariaDbGtid {
+			data["GtidOptions"] = sandboxDef.GtidOptions + fmt.Sprintf("gtid_domain_id=%d\n", sandboxDef.NodeNum)
+		}
+	}
+	// Scripts such as replicate_from and clear use the replication statements of this version
+	err = addReplicationSyntax(data, sandboxDef.Flavor, sandboxDef.Version)
+	if err != nil {
+		return emptyExecutionList, err
+	}
+	// A TiDB server in a cluster uses TiKV through PD, instead of the embedded store
+	data["TidbStore"] = "mocktikv"
+	data["TidbStorePath"] = dataDir
+	if sandboxDef.TidbPdAddress != "" {
+		data["TidbStore"] = "tikv"
+		data["TidbStorePath"] = sandboxDef.TidbPdAddress
+	}
 	if common.DirExists(sandboxDir) {
 		sandboxDef, err = checkDirectory(sandboxDef)
 		if err != nil {
@@ -799,6 +974,23 @@ func createSingleSandbox(sandboxDef SandboxDef) (execList []concurrent.Execution
 	if usesMysqlInstallDb && !sandboxDef.Imported {
 		script = path.Join(sandboxDef.Basedir, "scripts", globals.FnMysqlInstallDb)
 	}
+	mysqldSafe := path.Join("bin", globals.FnMysqldSafe)
+	// MariaDB 10.5+ names its executables mariadbd, mariadbd-safe, and mariadb-install-db.
+	// The MySQL names are symbolic links, which recent tarballs may not include
+	usesMariaDbBinaries, err := common.HasCapability(sandboxDef.Flavor, common.MariaDbBinaries, sandboxDef.Version)
+	if err != nil {
+		return emptyExecutionList, err
+	}
+	if usesMariaDbBinaries {
+		mariaDbInstallDb := path.Join(sandboxDef.Basedir, "scripts", globals.FnMariadbInstallDb)
+		if usesMysqlInstallDb && !sandboxDef.Imported && common.ExecExists(mariaDbInstallDb) {
+			script = mariaDbInstallDb
+		}
+		if common.ExecExists(path.Join(sandboxDef.Basedir, "bin", globals.FnMariadbdSafe)) {
+			mysqldSafe = path.Join("bin", globals.FnMariadbdSafe)
+		}
+	}
+	data["MysqldSafe"] = mysqldSafe
 	if script != "" && !common.ExecExists(script) && !sandboxDef.Imported {
 		common.CondPrintf("SCRIPT\n")
 		return emptyExecutionList, fmt.Errorf(globals.ErrScriptNotFound, script)
@@ -836,7 +1028,32 @@ func createSingleSandbox(sandboxDef SandboxDef) (execList []concurrent.Execution
 	if err != nil {
 		return emptyExecutionList, err
 	}
-	if sandboxDef.RunConcurrently {
+	usedDatadirCache := false
+	if sandboxDef.UseDatadirCache && script != "" && !sandboxDef.Imported && usesDatadirCache(sandboxDef.Flavor) {
+		err = initFromDatadirCache(sandboxDef, data, logger)
+		if err == nil {
+			usedDatadirCache = true
+			if !sandboxDef.Multi && globals.UsingDbDeployer {
+				common.CondPrintf("Database installed in %s (from datadir cache)\n", common.ReplaceLiteralHome(sandboxDir))
+				common.CondPrintf("run 'dbdeployer usage single' for basic instructions'\n")
+			}
+		} else {
+			// The regular initialization takes over, starting from an empty data directory
+			_, _ = fmt.Fprintf(os.Stderr, "# datadir cache non-blocking failure: %s\n", err)
+			logger.Printf("Datadir cache failure: %s\n", err)
+			err = os.RemoveAll(dataDir)
+			if err != nil {
+				return emptyExecutionList, err
+			}
+			err = os.Mkdir(dataDir, globals.PublicDirectoryAttr)
+			if err != nil {
+				return emptyExecutionList, sbError("data dir creation", "%s", err)
+			}
+		}
+	}
+	if usedDatadirCache {
+		logger.Printf("Skipping init_db script: data directory copied from cache\n")
+	} else if sandboxDef.RunConcurrently {
 		var eCommand = concurrent.ExecCommand{
 			Cmd:  path.Join(sandboxDir, globals.ScriptInitDb),
 			Args: []string{},
@@ -872,6 +1089,7 @@ func createSingleSandbox(sandboxDef SandboxDef) (execList []concurrent.Execution
 		Port:        []int{sandboxDef.Port},
 		Nodes:       []string{},
 		Destination: sandboxDir,
+		ExpiresAt:   sandboxDef.ExpiresAt,
 	}
 
 	if sandboxDef.LogFileName != "" {
@@ -148,6 +148,645 @@ func testCreateMockSandbox(t *testing.T) {
 	compare.OkIsNil("removal", err, t)
 }
 
+func testCreateMockInnoDBCluster(t *testing.T) {
+	// Without MySQL Shell in the binaries directory or in $PATH, the cluster can't be created
+	_, err := mysqlShellExecutable("/no/such/dir")
+	if err == nil {
+		t.Skipf("MySQL Shell found in $PATH")
+	}
+	compare.OkMatchesString("missing shell", err.Error(), "requires MySQL Shell", t)
+	err = SetMockEnvironment(DefaultMockDir)
+	if err != nil {
+		t.Fatal("mock dir creation failed")
+	}
+	err = CreateMockVersion("8.0.36")
+	compare.OkIsNil("version creation", err, t)
+	var sandboxDef = SandboxDef{
+		Version:        "8.0.36",
+		Flavor:         common.MySQLFlavor,
+		Basedir:        path.Join(mockSandboxBinary, "8.0.36"),
+		SandboxDir:     mockSandboxHome,
+		InstalledPorts: defaults.Defaults().ReservedPorts,
+		Port:           8036,
+		DbUser:         globals.DbUserValue,
+		RplUser:        globals.RplUserValue,
+		DbPassword:     globals.DbPasswordValue,
+		RplPassword:    globals.RplPasswordValue,
+		RemoteAccess:   globals.RemoteAccessValue,
+		BindAddress:    globals.BindAddressValue,
+		SkipStart:      true,
+	}
+	replData := ReplicationData{Topology: globals.InnoDBClusterLabel, Nodes: 3, MasterIp: globals.MasterIpValue}
+	err = CreateReplicationSandbox(sandboxDef, "8.0.36", replData)
+	compare.OkIsNotNil("cluster without MySQL Shell", err, t)
+
+	mysqlsh := path.Join(sandboxDef.Basedir, "bin", globals.FnMysqlsh)
+	err = common.WriteString("#!/bin/sh\nexit 0\n", mysqlsh)
+	compare.OkIsNil("mock shell", err, t)
+	err = os.Chmod(mysqlsh, globals.ExecutableFileAttr)
+	compare.OkIsNil("mock shell permissions", err, t)
+	err = CreateReplicationSandbox(sandboxDef, "8.0.36", replData)
+	compare.OkIsNil("cluster creation", err, t)
+	clusterDir := path.Join(mockSandboxHome, defaults.Defaults().InnoDBClusterPrefix+"8_0_36")
+	sbDesc, err := common.ReadSandboxDescription(clusterDir)
+	compare.OkIsNil("cluster description", err, t)
+	compare.OkEqualString("cluster type", sbDesc.SBType, globals.InnoDBClusterLabel, t)
+	for _, script := range []string{globals.ScriptInitializeCluster, globals.ScriptCheckCluster, globals.ScriptCheckNodes, "n1", "n3"} {
+		okExecutableExists(t, clusterDir, script)
+	}
+	compare.OkEqualBool("no manual group initialization",
+		common.FileExists(path.Join(clusterDir, globals.ScriptInitializeNodes)), false, t)
+	initCluster, err := common.SlurpAsString(path.Join(clusterDir, globals.ScriptInitializeCluster))
+	compare.OkIsNil("reading init script", err, t)
+	compare.OkMatchesString("create cluster", initCluster, `dba.createCluster\('ic_msb_8_0_36'`, t)
+	compare.OkMatchesString("add instance", initCluster, `cluster.addInstance\('\$cluster_admin@127.0.0.1:\d+'`, t)
+	cnf, err := common.SlurpAsString(path.Join(clusterDir, "node1", globals.ScriptMySandboxCnf))
+	compare.OkIsNil("reading node configuration", err, t)
+	compare.OkEqualBool("group options left to the shell", strings.Contains(cnf, "group_replication_group_name"), false, t)
+
+	// A router bootstrapped by a mock mysqlrouter, which only creates the directory and its configuration
+	routerBasedir := path.Join(mockSandboxBinary, "router8.0.36")
+	err = os.MkdirAll(path.Join(routerBasedir, "bin"), globals.PublicDirectoryAttr)
+	compare.OkIsNil("router basedir", err, t)
+	routerDef := RouterDef{
+		Basedir:        routerBasedir,
+		Version:        "8.0.36",
+		SandboxDir:     mockSandboxHome,
+		ClusterDir:     clusterDir,
+		InstalledPorts: defaults.Defaults().ReservedPorts,
+		SkipStart:      true,
+	}
+	err = CreateRouterSandbox(routerDef)
+	compare.OkIsNotNil("router without binaries", err, t)
+	mysqlRouter := path.Join(routerBasedir, "bin", globals.FnMysqlRouter)
+	mockRouter := `#!/bin/sh
+while [ -n "$1" ]
+do
+    [ "$1" = "--directory" ] && dir=$2
+    shift
+done
+mkdir -p $dir
+printf "[routing]\nbind_port=6446\n\n[http_server]\nport=8443\n" > $dir/mysqlrouter.conf
+`
+	err = common.WriteString(mockRouter, mysqlRouter)
+	compare.OkIsNil("mock router", err, t)
+	err = os.Chmod(mysqlRouter, globals.ExecutableFileAttr)
+	compare.OkIsNil("mock router permissions", err, t)
+	routerDef.ClusterDir = path.Join(clusterDir, "node1")
+	err = CreateRouterSandbox(routerDef)
+	compare.OkIsNotNil("router for a sandbox that is not a cluster", err, t)
+	routerDef.ClusterDir = clusterDir
+	err = CreateRouterSandbox(routerDef)
+	compare.OkIsNil("router creation", err, t)
+	routerDir := path.Join(mockSandboxHome, defaults.Defaults().RouterPrefix+path.Base(clusterDir))
+	for _, script := range []string{globals.ScriptStart, globals.ScriptStop, globals.ScriptSendKill,
+		globals.ScriptStatus, globals.ScriptUseRw, globals.ScriptUseRo} {
+		okExecutableExists(t, routerDir, script)
+	}
+	ports := RouterPorts(defaults.Defaults().RouterBasePort)
+	okPortExists(t, routerDir, ports[0])
+	okPortExists(t, routerDir, ports[1])
+	routerConf, err := common.SlurpAsString(path.Join(routerDir, routerConfigName))
+	compare.OkIsNil("router configuration", err, t)
+	compare.OkMatchesString("http port", routerConf, fmt.Sprintf("(?m)^port=%d$", ports[len(ports)-1]), t)
+	compare.OkMatchesString("routing port untouched", routerConf, "bind_port=6446", t)
+	err = CreateRouterSandbox(routerDef)
+	compare.OkIsNotNil("router directory already exists", err, t)
+
+	err = RemoveMockEnvironment(DefaultMockDir)
+	compare.OkIsNil("removal", err, t)
+}
+
+func testCreateMockProxySQL(t *testing.T) {
+	err := SetMockEnvironment(DefaultMockDir)
+	if err != nil {
+		t.Fatal("mock dir creation failed")
+	}
+	err = CreateMockVersion("8.0.36")
+	compare.OkIsNil("version creation", err, t)
+	var sandboxDef = SandboxDef{
+		Version:        "8.0.36",
+		Flavor:         common.MySQLFlavor,
+		Basedir:        path.Join(mockSandboxBinary, "8.0.36"),
+		SandboxDir:     mockSandboxHome,
+		InstalledPorts: defaults.Defaults().ReservedPorts,
+		Port:           8036,
+		DbUser:         globals.DbUserValue,
+		RplUser:        globals.RplUserValue,
+		DbPassword:     globals.DbPasswordValue,
+		RplPassword:    globals.RplPasswordValue,
+		RemoteAccess:   globals.RemoteAccessValue,
+		BindAddress:    globals.BindAddressValue,
+		SkipStart:      true,
+	}
+	replData := ReplicationData{Topology: globals.MasterSlaveLabel, Nodes: 3, MasterIp: globals.MasterIpValue}
+	err = CreateReplicationSandbox(sandboxDef, "8.0.36", replData)
+	compare.OkIsNil("replication creation", err, t)
+	backendDir := path.Join(mockSandboxHome, defaults.Defaults().MasterSlavePrefix+"8_0_36")
+
+	// After a switchover, node1 is the master
+	sbDesc, err := common.ReadSandboxDescription(backendDir)
+	compare.OkIsNil("backend description", err, t)
+	sbDesc.ReplicationTree = &common.ReplicationTreeNode{Node: 2,
+		Slaves: []common.ReplicationTreeNode{{Node: 1}, {Node: 3}}}
+	servers, err := ProxySQLServers(backendDir, sbDesc)
+	compare.OkIsNil("backend servers", err, t)
+	compare.OkEqualInt("number of servers", len(servers), 3, t)
+	for _, server := range servers {
+		expected := proxySQLReaderHostgroup
+		if server.Node == "node1" {
+			expected = proxySQLWriterHostgroup
+		}
+		compare.OkEqualInt(fmt.Sprintf("hostgroup of %s", server.Node), server.Hostgroup, expected, t)
+	}
+	singleServers, err := ProxySQLServers(path.Join(backendDir, "master"), common.SandboxDescription{SBType: globals.SbTypeSingle})
+	compare.OkIsNil("single backend servers", err, t)
+	compare.OkEqualInt("single backend", len(singleServers), 1, t)
+
+	proxySQL := path.Join(mockSandboxBinary, globals.FnProxySQL)
+	proxyDef := ProxySQLDef{
+		ProxySQL:       proxySQL,
+		SandboxDir:     mockSandboxHome,
+		BackendDir:     backendDir,
+		InstalledPorts: defaults.Defaults().ReservedPorts,
+		SkipStart:      true,
+	}
+	err = CreateProxySQLSandbox(proxyDef)
+	compare.OkIsNotNil("proxysql without executable", err, t)
+	err = common.WriteString("#!/bin/sh\necho 'ProxySQL version 2.5.5-10-g195bd70, codename Truls'\n", proxySQL)
+	compare.OkIsNil("mock proxysql", err, t)
+	err = os.Chmod(proxySQL, globals.ExecutableFileAttr)
+	compare.OkIsNil("mock proxysql permissions", err, t)
+	err = CreateProxySQLSandbox(proxyDef)
+	compare.OkIsNil("proxysql creation", err, t)
+
+	proxyDir := path.Join(mockSandboxHome, defaults.Defaults().ProxySQLPrefix+path.Base(backendDir))
+	for _, script := range []string{globals.ScriptStart, globals.ScriptStop, globals.ScriptSendKill,
+		globals.ScriptStatus, globals.ScriptUseProxy, globals.ScriptUseAdmin} {
+		okExecutableExists(t, proxyDir, script)
+	}
+	okDirExists(t, path.Join(proxyDir, globals.DataDirName))
+	okPortExists(t, proxyDir, defaults.Defaults().ProxySQLBasePort)
+	okPortExists(t, proxyDir, defaults.Defaults().ProxySQLBasePort+1)
+	proxyDesc, err := common.ReadSandboxDescription(proxyDir)
+	compare.OkIsNil("proxysql description", err, t)
+	compare.OkEqualString("proxysql type", proxyDesc.SBType, globals.SbTypeProxySQL, t)
+	compare.OkEqualString("proxysql version", proxyDesc.Version, "2.5.5", t)
+	compare.OkEqualString("proxysql backend", proxyDesc.Backend, backendDir, t)
+	config, err := common.SlurpAsString(path.Join(proxyDir, proxySQLConfigName))
+	compare.OkIsNil("proxysql configuration", err, t)
+	compare.OkMatchesString("writer", config, `address="127.0.0.1", port=\d+, hostgroup=0`, t)
+	compare.OkMatchesString("readers", config, `address="127.0.0.1", port=\d+, hostgroup=1`, t)
+	compare.OkMatchesString("replication hostgroups", config, "mysql_replication_hostgroups", t)
+	compare.OkMatchesString("query rules", config, `match_digest="\^SELECT"`, t)
+	compare.OkEqualBool("no group hostgroups", strings.Contains(config, "mysql_group_replication_hostgroups"), false, t)
+
+	err = CreateProxySQLSandbox(proxyDef)
+	compare.OkIsNotNil("proxysql directory already exists", err, t)
+	proxyDef.BackendDir = proxyDir
+	proxyDef.DirName = "proxy_of_proxy"
+	err = CreateProxySQLSandbox(proxyDef)
+	compare.OkIsNotNil("proxysql attached to a proxysql sandbox", err, t)
+
+	err = RemoveMockEnvironment(DefaultMockDir)
+	compare.OkIsNil("removal", err, t)
+}
+
+// createMockPostgreSQLVersion creates a directory with stub PostgreSQL binaries.
+// initdb and pg_basebackup create the data directory given with -D,
+// and pg_ctl reports the server as not running
+func createMockPostgreSQLVersion(version string) error {
+	binDir := path.Join(mockSandboxBinary, version, "bin")
+	err := os.MkdirAll(binDir, globals.PublicDirectoryAttr)
+	if err != nil {
+		return err
+	}
+	createDataDir := `#!/bin/bash
+while [ -n "$1" ]
+do
+    if [ "$1" = "-D" ] ; then datadir=$2 ; fi
+    shift
+done
+mkdir -p $datadir
+echo "# mock" > $datadir/postgresql.conf
+`
+	stubs := map[string]string{
+		globals.FnPostgres:     "#!/bin/bash\necho 'postgres (PostgreSQL) " + version + "'\n",
+		globals.FnInitDb:       createDataDir,
+		globals.FnPgBasebackup: createDataDir,
+		globals.FnPgCtl:        "#!/bin/bash\n[ \"$3\" != \"status\" ]\n",
+		globals.FnPsql:         "#!/bin/bash\nexit 0\n",
+	}
+	for name, contents := range stubs {
+		fileName := path.Join(binDir, name)
+		err = common.WriteString(contents, fileName)
+		if err != nil {
+			return err
+		}
+		err = os.Chmod(fileName, globals.ExecutableFileAttr)
+		if err != nil {
+			return err
+		}
+	}
+	return common.WriteString(common.PostgreSQLFlavor, path.Join(mockSandboxBinary, version, globals.FlavorFileName))
+}
+
+func testCreateMockPostgreSQL(t *testing.T) {
+	err := SetMockEnvironment(DefaultMockDir)
+	if err != nil {
+		t.Fatal("mock dir creation failed")
+	}
+	version := "16.2.0"
+	err = createMockPostgreSQLVersion(version)
+	compare.OkIsNil("postgresql version creation", err, t)
+	var sandboxDef = SandboxDef{
+		Version:        version,
+		Flavor:         common.PostgreSQLFlavor,
+		Basedir:        path.Join(mockSandboxBinary, version),
+		SandboxDir:     mockSandboxHome,
+		InstalledPorts: defaults.Defaults().ReservedPorts,
+		Port:           16200,
+		DbUser:         globals.DbUserValue,
+		RplUser:        globals.RplUserValue,
+		DbPassword:     globals.DbPasswordValue,
+		RplPassword:    globals.RplPasswordValue,
+		SbHost:         globals.BindAddressValue,
+		BindAddress:    globals.BindAddressValue,
+		ShellPath:      globals.ShellPathValue,
+	}
+	err = CreateStandaloneSandbox(sandboxDef)
+	compare.OkIsNil("postgresql single creation", err, t)
+	singleDir := path.Join(mockSandboxHome, defaults.Defaults().SandboxPrefix+"16_2_0")
+	for _, script := range []string{globals.ScriptStart, globals.ScriptStop, globals.ScriptRestart,
+		globals.ScriptStatus, globals.ScriptSendKill, globals.ScriptUse, globals.ScriptTestSb} {
+		okExecutableExists(t, singleDir, script)
+	}
+	okPortExists(t, singleDir, 16200)
+	config, err := common.SlurpAsString(path.Join(singleDir, globals.DataDirName, postgreSQLConfigName))
+	compare.OkIsNil("postgresql configuration", err, t)
+	compare.OkMatchesString("port", config, `port = 16200`, t)
+	compare.OkEqualBool("no replication options", strings.Contains(config, "wal_level"), false, t)
+	sbDesc, err := common.ReadSandboxDescription(singleDir)
+	compare.OkIsNil("postgresql description", err, t)
+	compare.OkEqualString("postgresql flavor", sbDesc.Flavor, common.PostgreSQLFlavor, t)
+
+	replData := ReplicationData{Topology: globals.GroupLabel, Nodes: 3, MasterIp: globals.MasterIpValue}
+	err = CreateReplicationSandbox(sandboxDef, version, replData)
+	compare.OkIsNotNil("postgresql group replication", err, t)
+
+	replData.Topology = globals.MasterSlaveLabel
+	err = CreateReplicationSandbox(sandboxDef, version, replData)
+	compare.OkIsNil("postgresql replication creation", err, t)
+	replDir := path.Join(mockSandboxHome, defaults.Defaults().MasterSlavePrefix+"16_2_0")
+	for _, script := range []string{globals.ScriptStartAll, globals.ScriptStopAll, globals.ScriptStatusAll,
+		globals.ScriptUseAll, globals.ScriptTestSbAll, "check_slaves", "test_replication", "m", "s1", "s2", "n3"} {
+		okExecutableExists(t, replDir, script)
+	}
+	for _, node := range []string{"master", "node1", "node2"} {
+		okDirExists(t, path.Join(replDir, node, globals.DataDirName))
+		config, err = common.SlurpAsString(path.Join(replDir, node, globals.DataDirName, postgreSQLConfigName))
+		compare.OkIsNil(node+" configuration", err, t)
+		compare.OkMatchesString(node+" replication options", config, `wal_level = replica`, t)
+	}
+	replDesc, err := common.ReadSandboxDescription(replDir)
+	compare.OkIsNil("postgresql replication description", err, t)
+	compare.OkEqualInt("postgresql replication ports", len(replDesc.Port), 3, t)
+	compare.OkEqualInt("postgresql standbys", replDesc.Nodes, 2, t)
+
+	err = RemoveMockEnvironment(DefaultMockDir)
+	compare.OkIsNil("removal", err, t)
+}
+
+func testCreateMockNodeVersions(t *testing.T) {
+	err := SetMockEnvironment(DefaultMockDir)
+	if err != nil {
+		t.Fatal("mock dir creation failed")
+	}
+	for _, version := range []string{"5.7.22", "8.0.10", "8.0.11"} {
+		err = CreateMockVersion(version)
+		compare.OkIsNil("version creation", err, t)
+	}
+	for spec, errRegex := range map[string]string{
+		"":             "empty",
+		"2=8.0.11":     "format",
+		"x:8.0.11":     "invalid node",
+		"0:8.0.11":     "greater than 0",
+		"2:8.0.11,2:8": "more than once",
+		"2:9.9.9":      "not found",
+		"2:9.9":        "no full version",
+	} {
+		_, err = ParseNodeVersions(spec, mockSandboxBinary)
+		compare.OkIsNotNil(spec, err, t)
+		if err != nil {
+			compare.OkMatchesString(spec, err.Error(), errRegex, t)
+		}
+	}
+	nodeVersions, err := ParseNodeVersions("2:8.0, 3:"+path.Join(mockSandboxBinary, "8.0.10"), mockSandboxBinary)
+	compare.OkIsNil("parsing node versions", err, t)
+	compare.OkEqualInt("node versions", len(nodeVersions), 2, t)
+	compare.OkEqualString("short version resolved", nodeVersions[2].Version, "8.0.11", t)
+	compare.OkEqualString("absolute path", nodeVersions[3].Basedir, path.Join(mockSandboxBinary, "8.0.10"), t)
+	compare.OkEqualString("flavor", nodeVersions[3].Flavor, common.MySQLFlavor, t)
+
+	var sandboxDef = SandboxDef{
+		Version:        "5.7.22",
+		Flavor:         common.MySQLFlavor,
+		Basedir:        path.Join(mockSandboxBinary, "5.7.22"),
+		SandboxDir:     mockSandboxHome,
+		DirName:        "rsandbox_mixed",
+		InstalledPorts: defaults.Defaults().ReservedPorts,
+		Port:           5722,
+		DbUser:         globals.DbUserValue,
+		RplUser:        globals.RplUserValue,
+		DbPassword:     globals.DbPasswordValue,
+		RplPassword:    globals.RplPasswordValue,
+		RemoteAccess:   globals.RemoteAccessValue,
+		BindAddress:    globals.BindAddressValue,
+		NodeVersions:   nodeVersions,
+	}
+	replData := ReplicationData{Topology: globals.GroupLabel, Nodes: 3, MasterIp: globals.MasterIpValue}
+	err = CreateReplicationSandbox(sandboxDef, "5.7.22", replData)
+	compare.OkIsNotNil("node versions with group topology", err, t)
+	replData = ReplicationData{Topology: globals.MasterSlaveLabel, Nodes: 2, MasterIp: globals.MasterIpValue}
+	err = CreateReplicationSandbox(sandboxDef, "5.7.22", replData)
+	compare.OkIsNotNil("node version beyond the number of nodes", err, t)
+
+	replData.Nodes = 3
+	err = CreateReplicationSandbox(sandboxDef, "5.7.22", replData)
+	compare.OkIsNil("replication with node versions", err, t)
+	sandboxDir := path.Join(mockSandboxHome, sandboxDef.DirName)
+	// The 8.0 slaves ask for the public key of the master, although the 5.7 main version doesn't need it
+	initSlaves, err := common.SlurpAsLines(path.Join(sandboxDir, globals.ScriptInitializeSlaves))
+	compare.OkIsNil("reading initialize_slaves", err, t)
+	for node, wantPublicKey := range map[string]bool{"node1": true, "node2": true} {
+		found := false
+		for _, line := range initSlaves {
+			if strings.Contains(line, "/"+node+"/use -u root") && strings.Contains(strings.ToUpper(line), "_HOST=") {
+				found = true
+				compare.OkEqualBool(fmt.Sprintf("public key option for %s", node),
+					strings.Contains(line, "_PUBLIC_KEY=1"), wantPublicKey, t)
+			}
+		}
+		compare.OkEqualBool(fmt.Sprintf("replication setup for %s", node), found, true, t)
+	}
+	sbDesc, err := common.ReadSandboxDescription(sandboxDir)
+	compare.OkIsNil("sandbox description", err, t)
+	expected := []common.NodeVersion{
+		{Node: defaults.Defaults().MasterName, Version: "5.7.22", Flavor: common.MySQLFlavor, Basedir: sandboxDef.Basedir},
+		{Node: defaults.Defaults().NodePrefix + "1", Version: "8.0.11", Flavor: common.MySQLFlavor, Basedir: nodeVersions[2].Basedir},
+		{Node: defaults.Defaults().NodePrefix + "2", Version: "8.0.10", Flavor: common.MySQLFlavor, Basedir: nodeVersions[3].Basedir},
+	}
+	catalog, err := defaults.ReadCatalog()
+	compare.OkIsNil("catalog", err, t)
+	compare.OkEqualInt("node versions in description", len(sbDesc.NodeVersions), len(expected), t)
+	compare.OkEqualInt("node versions in catalog", len(catalog[sandboxDir].NodeVersions), len(expected), t)
+	for i, nodeVersion := range expected {
+		if i < len(sbDesc.NodeVersions) {
+			compare.OkEqualInterface("node version in description", sbDesc.NodeVersions[i], nodeVersion, t)
+		}
+		if i < len(catalog[sandboxDir].NodeVersions) {
+			compare.OkEqualInterface("node version in catalog", catalog[sandboxDir].NodeVersions[i], nodeVersion, t)
+		}
+	}
+
+	err = RemoveMockEnvironment(DefaultMockDir)
+	compare.OkIsNil("removal", err, t)
+}
+
+func testCreateMockReplicaTerminology(t *testing.T) {
+	err := SetMockEnvironment(DefaultMockDir)
+	if err != nil {
+		t.Fatal("mock dir creation failed")
+	}
+	for _, version := range []string{"8.0.20", "8.4.0"} {
+		err = CreateMockVersion(version)
+		compare.OkIsNil("version creation", err, t)
+	}
+	var sandboxDef = SandboxDef{
+		Version:         "8.4.0",
+		Flavor:          common.MySQLFlavor,
+		Basedir:         path.Join(mockSandboxBinary, "8.4.0"),
+		SandboxDir:      mockSandboxHome,
+		InstalledPorts:  defaults.Defaults().ReservedPorts,
+		Port:            8400,
+		DbUser:          globals.DbUserValue,
+		RplUser:         globals.RplUserValue,
+		DbPassword:      globals.DbPasswordValue,
+		RplPassword:     globals.RplPasswordValue,
+		RemoteAccess:    globals.RemoteAccessValue,
+		BindAddress:     globals.BindAddressValue,
+		SemiSyncOptions: SingleTemplates[globals.TmplSemisyncMasterOptions].Contents,
+		SkipStart:       true,
+	}
+	sandboxDef, err = SetReplicationOptions(sandboxDef, false, true, false)
+	compare.OkIsNil("GTID options", err, t)
+	err = CreateReplicationSandbox(sandboxDef, "8.4.0",
+		ReplicationData{Topology: globals.MasterSlaveLabel, Nodes: 3, MasterIp: globals.MasterIpValue})
+	compare.OkIsNil("replication 8.4", err, t)
+	replicationDir := path.Join(mockSandboxHome, defaults.Defaults().MasterSlavePrefix+"8_4_0")
+	initSlaves, err := common.SlurpAsString(path.Join(replicationDir, "initialize_slaves"))
+	compare.OkIsNil("initialize_slaves", err, t)
+	for _, expected := range []string{"CHANGE REPLICATION SOURCE TO", "SOURCE_AUTO_POSITION=1", "START REPLICA"} {
+		compare.OkMatchesString("initialize_slaves 8.4", initSlaves, expected, t)
+	}
+	compare.OkEqualBool("no legacy syntax", strings.Contains(initSlaves, "CHANGE MASTER TO"), false, t)
+	checkSlaves, err := common.SlurpAsString(path.Join(replicationDir, "check_slaves"))
+	compare.OkIsNil("check_slaves", err, t)
+	compare.OkMatchesString("source status", checkSlaves, "SHOW BINARY LOG STATUS", t)
+	compare.OkMatchesString("replica status", checkSlaves, "SHOW REPLICA STATUS", t)
+
+	masterConfig, err := common.SlurpAsString(path.Join(replicationDir, defaults.Defaults().MasterName, globals.ScriptMySandboxCnf))
+	compare.OkIsNil("master configuration", err, t)
+	compare.OkMatchesString("semisync source", masterConfig, "rpl_semi_sync_source", t)
+	compare.OkEqualBool("no master-info repository", strings.Contains(masterConfig, "master-info-repository"), false, t)
+	replicaConfig, err := common.SlurpAsString(path.Join(replicationDir, "node1", globals.ScriptMySandboxCnf))
+	compare.OkIsNil("replica configuration", err, t)
+	compare.OkMatchesString("semisync replica", replicaConfig, "rpl_semi_sync_replica", t)
+
+	// A mixed deployment where one node does not support the new syntax
+	nodeVersions, err := ParseNodeVersions("3:8.0.20", mockSandboxBinary)
+	compare.OkIsNil("parsing node versions", err, t)
+	sandboxDef.DirName = "rsandbox_mixed_84"
+	sandboxDef.Port = 8500
+	sandboxDef.NodeVersions = nodeVersions
+	err = CreateReplicationSandbox(sandboxDef, "8.4.0",
+		ReplicationData{Topology: globals.MasterSlaveLabel, Nodes: 3, MasterIp: globals.MasterIpValue})
+	compare.OkIsNil("mixed replication", err, t)
+	mixedDir := path.Join(mockSandboxHome, sandboxDef.DirName)
+	initSlaves, err = common.SlurpAsString(path.Join(mixedDir, "initialize_slaves"))
+	compare.OkIsNil("mixed initialize_slaves", err, t)
+	compare.OkMatchesString("new syntax for 8.4 replica", initSlaves, "CHANGE REPLICATION SOURCE TO", t)
+	compare.OkMatchesString("legacy syntax for 8.0.20 replica", initSlaves, "CHANGE MASTER TO", t)
+
+	err = RemoveMockEnvironment(DefaultMockDir)
+	compare.OkIsNil("removal", err, t)
+}
+
+func testCreateMockDatadirCache(t *testing.T) {
+	err := SetMockEnvironment(DefaultMockDir)
+	if err != nil {
+		t.Fatal("mock dir creation failed")
+	}
+	version := "8.0.36"
+	err = CreateMockVersion(version)
+	compare.OkIsNil("version creation", err, t)
+	basedir := path.Join(mockSandboxBinary, version)
+	counter := path.Join(mockSandboxHome, "init_count")
+	// A mysqld that counts its initializations and leaves a mark in the data directory
+	writeMysqld := func(comment string) {
+		mysqld := path.Join(basedir, "bin", globals.FnMysqld)
+		err := common.WriteStrings([]string{
+			"#!" + globals.ShellPathValue,
+			"# " + comment,
+			"for arg in \"$@\"",
+			"do",
+			"  case $arg in",
+			"    --datadir=*) datadir=${arg#--datadir=} ;;",
+			"  esac",
+			"done",
+			"echo init >> " + counter,
+			"mkdir -p $datadir/mysql",
+			"echo initialized > $datadir/mysql/marker",
+			"echo old-uuid > $datadir/auto.cnf",
+		}, mysqld, "\n")
+		compare.OkIsNil("mysqld creation", err, t)
+		err = os.Chmod(mysqld, globals.ExecutableFileAttr)
+		compare.OkIsNil("mysqld permissions", err, t)
+	}
+	countInits := func() int {
+		lines, _ := common.SlurpAsLines(counter)
+		return len(lines)
+	}
+	writeMysqld("first")
+	var sandboxDef = SandboxDef{
+		Version:         version,
+		Flavor:          common.MySQLFlavor,
+		Basedir:         basedir,
+		SandboxDir:      mockSandboxHome,
+		InstalledPorts:  defaults.Defaults().ReservedPorts,
+		DbUser:          globals.DbUserValue,
+		RplUser:         globals.RplUserValue,
+		DbPassword:      globals.DbPasswordValue,
+		RplPassword:     globals.RplPasswordValue,
+		RemoteAccess:    globals.RemoteAccessValue,
+		BindAddress:     globals.BindAddressValue,
+		UseDatadirCache: true,
+		SkipStart:       true,
+	}
+	var sandboxDirs []string
+	for i, port := range []int{8036, 8037, 8038} {
+		sandboxDef.Port = port
+		sandboxDef.DirName = fmt.Sprintf("cached_%d", i)
+		if i == 2 {
+			// A change of binaries makes the cached data directory stale
+			writeMysqld("second build")
+		}
+		err = CreateStandaloneSandbox(sandboxDef)
+		compare.OkIsNil("sandbox with datadir cache", err, t)
+		sandboxDir := path.Join(mockSandboxHome, sandboxDef.DirName)
+		sandboxDirs = append(sandboxDirs, sandboxDir)
+		compare.OkEqualBool("initialized datadir", common.FileExists(path.Join(sandboxDir, globals.DataDirName, "mysql", "marker")), true, t)
+		autoCnf, err := common.SlurpAsString(path.Join(sandboxDir, globals.DataDirName, globals.AutoCnfName))
+		compare.OkIsNil("auto.cnf", err, t)
+		compare.OkMatchesString("own server UUID", autoCnf, "server-uuid=", t)
+		if i == 0 {
+			compare.OkEqualInt("initializations after first deployment", countInits(), 1, t)
+		}
+	}
+	compare.OkEqualInt("initialization reused", countInits(), 2, t)
+	firstUuid, _ := common.SlurpAsString(path.Join(sandboxDirs[0], globals.DataDirName, globals.AutoCnfName))
+	secondUuid, _ := common.SlurpAsString(path.Join(sandboxDirs[1], globals.DataDirName, globals.AutoCnfName))
+	compare.OkEqualBool("different UUIDs", firstUuid == secondUuid, false, t)
+
+	entries, err := ListDatadirCache()
+	compare.OkIsNil("cache list", err, t)
+	compare.OkEqualInt("cache entries", len(entries), 1, t)
+	if len(entries) == 1 {
+		compare.OkEqualString("cached version", entries[0].Version, version, t)
+		compare.OkEqualBool("valid entry", entries[0].Stale, false, t)
+		compare.OkEqualBool("cached datadir", common.FileExists(path.Join(entries[0].Directory, globals.DataDirName, "mysql", "marker")), true, t)
+		_, err = os.Stat(path.Join(entries[0].Directory, globals.DataDirName, globals.AutoCnfName))
+		compare.OkEqualBool("no cached auto.cnf", os.IsNotExist(err), true, t)
+	}
+	removed, err := PurgeDatadirCache([]string{"5.7.44"}, false)
+	compare.OkIsNil("purge unrelated version", err, t)
+	compare.OkEqualInt("nothing purged", len(removed), 0, t)
+	removed, err = PurgeDatadirCache([]string{version}, false)
+	compare.OkIsNil("purge", err, t)
+	compare.OkEqualInt("entries purged", len(removed), 1, t)
+	entries, err = ListDatadirCache()
+	compare.OkIsNil("cache list after purge", err, t)
+	compare.OkEqualInt("empty cache", len(entries), 0, t)
+
+	err = RemoveMockEnvironment(DefaultMockDir)
+	compare.OkIsNil("removal", err, t)
+}
+
+func testMockPortLeases(t *testing.T) {
+	err := SetMockEnvironment(DefaultMockDir)
+	if err != nil {
+		t.Fatal("mock dir creation failed")
+	}
+	firstPort, err := findFreePort(9000, []int{}, 2)
+	compare.OkIsNil("first lease", err, t)
+	// A concurrent deployment can't get the leased ports
+	secondPort, err := findFreePort(firstPort, []int{}, 1)
+	compare.OkIsNil("second lease", err, t)
+	compare.OkEqualBool("leased ports skipped", secondPort > firstPort+1, true, t)
+	leases, err := defaults.ActivePortLeases()
+	compare.OkIsNil("active leases", err, t)
+	compare.OkEqualInt("leases", len(leases), 1, t)
+	if len(leases) == 1 {
+		compare.OkEqualIntSlices(t, leases[0].Ports, []int{firstPort, firstPort + 1, secondPort})
+		compare.OkEqualInt("lease owner", leases[0].Pid, os.Getpid(), t)
+	}
+	err = defaults.ReleasePorts([]int{firstPort, firstPort + 1, secondPort})
+	compare.OkIsNil("release", err, t)
+	leases, err = defaults.ActivePortLeases()
+	compare.OkIsNil("leases after release", err, t)
+	compare.OkEqualInt("no leases", len(leases), 0, t)
+
+	// A deployment releases its ports when the sandbox is recorded in the catalog
+	version := "8.0.36"
+	err = CreateMockVersion(version)
+	compare.OkIsNil("version creation", err, t)
+	var sandboxDef = SandboxDef{
+		Version:        version,
+		Flavor:         common.MySQLFlavor,
+		Basedir:        path.Join(mockSandboxBinary, version),
+		SandboxDir:     mockSandboxHome,
+		DirName:        "msb_leases",
+		InstalledPorts: defaults.Defaults().ReservedPorts,
+		Port:           9100,
+		DbUser:         globals.DbUserValue,
+		RplUser:        globals.RplUserValue,
+		DbPassword:     globals.DbPasswordValue,
+		RplPassword:    globals.RplPasswordValue,
+		RemoteAccess:   globals.RemoteAccessValue,
+		BindAddress:    globals.BindAddressValue,
+		SBType:         globals.SbTypeSingle,
+		SkipStart:      true,
+	}
+	err = CreateStandaloneSandbox(sandboxDef)
+	compare.OkIsNil("sandbox creation", err, t)
+	leases, err = defaults.ActivePortLeases()
+	compare.OkIsNil("leases after deployment", err, t)
+	compare.OkEqualInt("no leases after deployment", len(leases), 0, t)
+	catalog, err := defaults.ReadCatalog()
+	compare.OkIsNil("catalog", err, t)
+	deployedPorts := catalog[path.Join(mockSandboxHome, "msb_leases")].Port
+	compare.OkEqualBool("ports in catalog", len(deployedPorts) > 0, true, t)
+	if len(deployedPorts) > 0 {
+		// The ports in the catalog are skipped, even if they are not in the installed ports
+		nextPort, err := findFreePort(deployedPorts[0], []int{}, 1)
+		compare.OkIsNil("port after deployment", err, t)
+		compare.OkEqualBool("catalog port skipped", nextPort != deployedPorts[0], true, t)
+	}
+
+	err = RemoveMockEnvironment(DefaultMockDir)
+	compare.OkIsNil("removal", err, t)
+}
+
 func testDetectFlavor(t *testing.T) {
 
 	err := SetMockEnvironment(DefaultMockDir)
@@ -261,6 +900,166 @@ func testDetectFlavor(t *testing.T) {
 
 }
 
+func testCreateMockMariaDb(t *testing.T) {
+	err := SetMockEnvironment(DefaultMockDir)
+	if err != nil {
+		t.Fatal("mock dir creation failed")
+	}
+	mariaDbVersion := "10.6.16"
+	fileSet := []MockFileSet{
+		{"bin", []ScriptDef{
+			{globals.FnMysqld, noOpMockTemplateName, true},
+			{globals.FnMariadbd, noOpMockTemplateName, true},
+			{globals.FnMysql, noOpMockTemplateName, true},
+			{globals.FnMysqldSafe, globals.TmplMysqldSafeMock, true},
+			{globals.FnMariadbdSafe, globals.TmplMysqldSafeMock, true},
+		}},
+		{"lib", []ScriptDef{
+			{globals.FnLibMariadbClientSo, noOpMockTemplateName, false},
+		}},
+		{"scripts", []ScriptDef{
+			{globals.FnMysqlInstallDb, noOpMockTemplateName, true},
+			{globals.FnMariadbInstallDb, noOpMockTemplateName, true},
+		}},
+	}
+	err = CreateCustomMockVersion(mariaDbVersion, fileSet)
+	compare.OkIsNil("MariaDB version creation", err, t)
+	var sandboxDef = SandboxDef{
+		Version:        mariaDbVersion,
+		Flavor:         common.MariaDbFlavor,
+		Basedir:        path.Join(mockSandboxBinary, mariaDbVersion),
+		SandboxDir:     mockSandboxHome,
+		InstalledPorts: defaults.Defaults().ReservedPorts,
+		Port:           10616,
+		DbUser:         globals.DbUserValue,
+		RplUser:        globals.RplUserValue,
+		DbPassword:     globals.DbPasswordValue,
+		RplPassword:    globals.RplPasswordValue,
+		RemoteAccess:   globals.RemoteAccessValue,
+		BindAddress:    globals.BindAddressValue,
+		SkipStart:      true,
+	}
+	sandboxDef, err = SetReplicationOptions(sandboxDef, false, true, false)
+	compare.OkIsNil("MariaDB GTID options", err, t)
+	compare.OkMatchesString("MariaDB GTID", sandboxDef.GtidOptions, "gtid_strict_mode", t)
+	compare.OkEqualString("MariaDB crash-safe options", sandboxDef.ReplCrashSafeOptions, "", t)
+
+	err = CreateReplicationSandbox(sandboxDef, mariaDbVersion,
+		ReplicationData{Topology: globals.MasterSlaveLabel, Nodes: 3, MasterIp: globals.MasterIpValue})
+	compare.OkIsNil("MariaDB replication", err, t)
+	replicationDir := path.Join(mockSandboxHome, defaults.Defaults().MasterSlavePrefix+"10_6_16")
+	initSlaves, err := common.SlurpAsString(path.Join(replicationDir, "initialize_slaves"))
+	compare.OkIsNil("initialize_slaves", err, t)
+	compare.OkMatchesString("MariaDB GTID position", initSlaves, "MASTER_USE_GTID=slave_pos", t)
+	for i, node := range []string{defaults.Defaults().MasterName, "node1", "node2"} {
+		config, err := common.SlurpAsString(path.Join(replicationDir, node, globals.ScriptMySandboxCnf))
+		compare.OkIsNil(node+" configuration", err, t)
+		compare.OkMatchesString(node+" GTID domain", config, fmt.Sprintf("gtid_domain_id=%d", i+1), t)
+		startScript, err := common.SlurpAsString(path.Join(replicationDir, node, globals.ScriptStart))
+		compare.OkIsNil(node+" start script", err, t)
+		compare.OkMatchesString(node+" server executable", startScript, `MYSQLD_SAFE="bin/`+globals.FnMariadbdSafe+`"`, t)
+		initScript, err := common.SlurpAsString(path.Join(replicationDir, node, globals.ScriptInitDb))
+		compare.OkIsNil(node+" init script", err, t)
+		compare.OkMatchesString(node+" install script", initScript, globals.FnMariadbInstallDb, t)
+	}
+
+	// Galera needs the wsrep provider library from the tarball
+	_, err = galeraProvider(sandboxDef.Basedir)
+	compare.OkIsNotNil("missing Galera library", err, t)
+	galeraDir := path.Join(sandboxDef.Basedir, "lib", "galera")
+	err = os.Mkdir(galeraDir, globals.PublicDirectoryAttr)
+	compare.OkIsNil("Galera library directory", err, t)
+	err = os.WriteFile(path.Join(galeraDir, globals.FnLibGaleraSmmSo), []byte{}, globals.ExecutableFileAttr)
+	compare.OkIsNil("Galera library", err, t)
+	provider, err := galeraProvider(sandboxDef.Basedir)
+	compare.OkIsNil("Galera library found", err, t)
+	compare.OkEqualString("Galera library path", provider, path.Join(galeraDir, globals.FnLibGaleraSmmSo), t)
+
+	sandboxDef.Version = "10.0.38"
+	err = CreateReplicationSandbox(sandboxDef, "10.0.38",
+		ReplicationData{Topology: globals.GaleraLabel, Nodes: 3, MasterIp: globals.MasterIpValue})
+	compare.OkIsNotNil("Galera with MariaDB 10.0", err, t)
+
+	err = RemoveMockEnvironment(DefaultMockDir)
+	compare.OkIsNil("removal", err, t)
+}
+
+func testCreateTidbClusterMockSandbox(t *testing.T) {
+	err := SetMockEnvironment(DefaultMockDir)
+	if err != nil {
+		t.Fatal("mock dir creation failed")
+	}
+	err = CreateMockVersion("5.7.25")
+	compare.OkIsNil("MySQL support version creation", err, t)
+	tidbVersion := "3.0.30"
+	fileSet := MockFileSet{
+		"bin",
+		[]ScriptDef{
+			{globals.FnTiDbServer, globals.TmplTidbMock, true},
+			{globals.FnPdServer, globals.TmplTidbMock, true},
+			{globals.FnTiKVServer, globals.TmplTidbMock, true},
+		},
+	}
+	err = CreateCustomMockVersion(tidbVersion, []MockFileSet{fileSet})
+	compare.OkIsNil("TiDB version creation", err, t)
+	var sandboxDef = SandboxDef{
+		Version:        tidbVersion,
+		Flavor:         common.TiDbFlavor,
+		Basedir:        path.Join(mockSandboxBinary, tidbVersion),
+		SandboxDir:     mockSandboxHome,
+		InstalledPorts: defaults.Defaults().ReservedPorts,
+		Port:           3030,
+		DbUser:         globals.DbUserValue,
+		RplUser:        globals.RplUserValue,
+		DbPassword:     globals.DbPasswordValue,
+		RplPassword:    globals.RplPasswordValue,
+		RemoteAccess:   globals.RemoteAccessValue,
+		BindAddress:    globals.BindAddressValue,
+		ClientBasedir:  path.Join(mockSandboxBinary, "5.7.25"),
+		SkipStart:      true,
+	}
+	replData := ReplicationData{Topology: globals.TiDBClusterLabel, Nodes: 2, TiKVNodes: 3, MasterIp: globals.MasterIpValue}
+	err = CreateReplicationSandbox(sandboxDef, tidbVersion, replData)
+	compare.OkIsNil("TiDB cluster creation", err, t)
+
+	clusterDir := path.Join(mockSandboxHome, defaults.Defaults().TidbClusterPrefix+"3_0_30")
+	for _, script := range []string{globals.ScriptStartAll, globals.ScriptStopAll, globals.ScriptRestartAll,
+		globals.ScriptStatusAll, globals.ScriptSendKillAll, globals.ScriptUseAll, globals.ScriptCheckCluster, "n1", "n2"} {
+		okExecutableExists(t, clusterDir, script)
+	}
+	for _, component := range []string{tidbClusterPdDir, "tikv1", "tikv2", "tikv3"} {
+		for _, script := range []string{globals.ScriptStart, globals.ScriptStop, globals.ScriptSendKill, globals.ScriptStatus} {
+			okExecutableExists(t, path.Join(clusterDir, component), script)
+		}
+	}
+	sbDesc, err := common.ReadSandboxDescription(clusterDir)
+	compare.OkIsNil("TiDB cluster description", err, t)
+	compare.OkEqualString("TiDB cluster type", sbDesc.SBType, globals.TiDBClusterLabel, t)
+	// 2 TiDB servers, PD client and peer ports, 3 TiKV servers with their status ports
+	compare.OkEqualInt("TiDB cluster ports", len(sbDesc.Port), 10, t)
+	pdPort := sbDesc.Port[2]
+	for _, node := range []string{"node1", "node2"} {
+		okDirExists(t, path.Join(clusterDir, node))
+		// The TiDB configuration is written by init_db, which runs from the execution list
+		config, err := common.SlurpAsString(path.Join(clusterDir, node, "tidb.toml"))
+		compare.OkIsNil(node+" configuration", err, t)
+		compare.OkMatchesString(node+" store", config, `store = "tikv"`, t)
+		compare.OkMatchesString(node+" PD address", config, fmt.Sprintf(`path = "127.0.0.1:%d"`, pdPort), t)
+	}
+	tikvStart, err := common.SlurpAsString(path.Join(clusterDir, "tikv1", globals.ScriptStart))
+	compare.OkIsNil("TiKV start script", err, t)
+	compare.OkMatchesString("TiKV PD address", tikvStart, fmt.Sprintf(`--pd=127.0.0.1:%d`, pdPort), t)
+
+	sandboxDef.Flavor = common.MySQLFlavor
+	sandboxDef.Version = "5.7.25"
+	sandboxDef.Basedir = path.Join(mockSandboxBinary, "5.7.25")
+	err = CreateReplicationSandbox(sandboxDef, "5.7.25", replData)
+	compare.OkIsNotNil("TiDB cluster with MySQL binaries", err, t)
+
+	err = RemoveMockEnvironment(DefaultMockDir)
+	compare.OkIsNil("removal", err, t)
+}
+
 func testCreateTidbMockSandbox(t *testing.T) {
 	err := SetMockEnvironment(DefaultMockDir)
 	if err != nil {
@@ -374,7 +1173,8 @@ func expectFailure(sandboxDef SandboxDef, label, deployment, regex string, args
 			Nodes:      nodes,
 			MasterIp:   masterIp,
 			MasterList: "",
-			SlaveList:  ""})
+			SlaveList:  "",
+			ChainSpec:  args["chainSpec"]})
 		compare.OkIsNotNil(label, err, t)
 		if err != nil {
 			compare.OkMatchesString(label, err.Error(), regex, t)
@@ -478,6 +1278,30 @@ func testFailSandboxConditions(t *testing.T) {
 		replMap,
 		t)
 
+	sandboxDef.SlavesReadOnly = false
+	replMap["topology"] = globals.CircularLabel
+	expectFailure(sandboxDef, "invalid circular",
+		"replication",
+		`circular replication.*requires MySQL version '5.6.9'`,
+		replMap,
+		t)
+
+	replMap["topology"] = globals.ChainLabel
+	replMap["chainSpec"] = "1>2,3>4"
+	expectFailure(sandboxDef, "invalid chain spec",
+		"replication",
+		"exactly one top master",
+		replMap,
+		t)
+	replMap["chainSpec"] = "1>2>3"
+	expectFailure(sandboxDef, "chain spec with wrong number of nodes",
+		"replication",
+		"defines 3 nodes. Expected: 2",
+		replMap,
+		t)
+	delete(replMap, "chainSpec")
+	delete(replMap, "topology")
+
 	sandboxDef.MyCnfFile = ""
 	mysqlVersion = "5.7.0"
 	pathVersion = "5_7_0"
@@ -655,6 +1479,157 @@ func testCreateReplicationSandbox(t *testing.T) {
 	}
 }
 
+func TestParseChainSpec(t *testing.T) {
+	type chainTest struct {
+		spec      string
+		topMaster int
+		links     []ChainLink
+		errRegex  string
+	}
+	var tests = []chainTest{
+		{"1>2>3", 1, []ChainLink{{2, 1, 1}, {3, 2, 2}}, ""},
+		{"1>2>3,2>4", 1, []ChainLink{{2, 1, 1}, {3, 2, 2}, {4, 2, 2}}, ""},
+		{"2>1, 2>3>4", 2, []ChainLink{{1, 2, 1}, {3, 2, 1}, {4, 3, 2}}, ""},
+		{"", 0, nil, "empty chain"},
+		{"1", 0, nil, "at least two nodes"},
+		{"1>x", 0, nil, "invalid node"},
+		{"0>1", 0, nil, "greater than 0"},
+		{"1>1", 0, nil, "replicate from itself"},
+		{"1>2,3>2", 0, nil, "two masters"},
+		{"1>2>4", 0, nil, "Node 3 is missing"},
+		{"1>2,3>4", 0, nil, "exactly one top master"},
+		{"1>2>3>1", 0, nil, "exactly one top master"},
+	}
+	for _, test := range tests {
+		topMaster, links, err := ParseChainSpec(test.spec)
+		if test.errRegex != "" {
+			compare.OkIsNotNil(test.spec, err, t)
+			if err != nil {
+				compare.OkMatchesString(test.spec, err.Error(), test.errRegex, t)
+			}
+			continue
+		}
+		compare.OkIsNil(test.spec, err, t)
+		compare.OkEqualInt(fmt.Sprintf("top master for %s", test.spec), topMaster, test.topMaster, t)
+		compare.OkEqualInt(fmt.Sprintf("links for %s", test.spec), len(links), len(test.links), t)
+		for i, link := range links {
+			if i < len(test.links) {
+				compare.OkEqualInterface(fmt.Sprintf("link %d for %s", i, test.spec), link, test.links[i], t)
+			}
+		}
+	}
+}
+
+func TestChainSlaveShortcuts(t *testing.T) {
+	var tests = []struct {
+		slaves    []int
+		shortcuts map[int]string
+	}{
+		{[]int{2, 3, 4}, map[int]string{2: "s1", 3: "s2", 4: "s3"}},
+		// With node 2 as top master, node 1 is the first slave
+		{[]int{3, 1, 4}, map[int]string{1: "s1", 3: "s2", 4: "s3"}},
+	}
+	for _, test := range tests {
+		shortcuts := chainSlaveShortcuts("s", test.slaves)
+		compare.OkEqualInt(fmt.Sprintf("shortcuts for %v", test.slaves), len(shortcuts), len(test.shortcuts), t)
+		for node, name := range test.shortcuts {
+			compare.OkEqualString(fmt.Sprintf("shortcut for node %d", node), shortcuts[node], name, t)
+		}
+	}
+}
+
+func TestWriteReplicationRoleScripts(t *testing.T) {
+	sandboxDir := t.TempDir()
+	// A leftover from a sandbox with three slaves
+	staleSlave := path.Join(sandboxDir, defaults.Defaults().SlaveAbbr+"3")
+	err := common.WriteString("#!/bin/sh\n", staleSlave)
+	compare.OkIsNil("stale slave script", err, t)
+	err = WriteReplicationRoleScripts(ReplicationRoles{
+		SandboxDir:  sandboxDir,
+		Master:      "node2",
+		MasterPort:  19003,
+		Slaves:      []string{"master", "node1"},
+		SlavePorts:  []int{19001, 19002},
+		MasterIp:    "127.0.0.1",
+		RplUser:     "rsandbox",
+		RplPassword: "rsandbox",
+	})
+	compare.OkIsNil("writing role scripts", err, t)
+	expected := map[string]string{
+		defaults.Defaults().MasterAbbr:      path.Join(sandboxDir, "node2", "use"),
+		defaults.Defaults().SlaveAbbr + "1": path.Join(sandboxDir, "master", "use"),
+		defaults.Defaults().SlaveAbbr + "2": path.Join(sandboxDir, "node1", "use"),
+	}
+	for script, usedScript := range expected {
+		contents, err := common.SlurpAsString(path.Join(sandboxDir, script))
+		compare.OkIsNil("reading "+script, err, t)
+		compare.OkMatchesString(script, contents, usedScript, t)
+	}
+	compare.OkEqualBool("stale slave script removed", common.FileExists(staleSlave), false, t)
+	err = WriteReplicationRoleScripts(ReplicationRoles{SandboxDir: sandboxDir, Slaves: []string{"master"}})
+	compare.OkIsNotNil("slaves without ports", err, t)
+}
+
+func TestExtraNodeHelpers(t *testing.T) {
+	cnfFile := path.Join(t.TempDir(), globals.ScriptMySandboxCnf)
+	cnf := `[client]
+port = 5000
+
+[mysqld]
+user = msandbox
+port = 19001
+server-id = 100
+# a comment
+log-bin = mysql-bin
+plugin_load_add = mysqlx=mysqlx.so
+skip-name-resolve
+`
+	err := common.WriteString(cnf, cnfFile)
+	compare.OkIsNil("writing configuration", err, t)
+	options, identity, err := readServerOptions(cnfFile)
+	compare.OkIsNil("reading options", err, t)
+	compare.OkEqualString("options", strings.Join(options, ","), "log-bin = mysql-bin,skip-name-resolve", t)
+	compare.OkEqualString("port", identity["port"], "19001", t)
+	compare.OkEqualString("server-id", identity["server-id"], "100", t)
+	compare.OkEqualString("mysqlx", identity["plugin_load_add"], "mysqlx=mysqlx.so", t)
+
+	compare.OkEqualInt("multiple server IDs", nextServerId([]int{100, 200, 300}), 400, t)
+	compare.OkEqualInt("replication server IDs", nextServerId([]int{101, 100, 102}), 103, t)
+
+	for _, data := range []struct {
+		sbType string
+		node   string
+		number int
+	}{
+		{globals.MasterSlaveLabel, "master", 1},
+		{globals.MasterSlaveLabel, "node1", 2},
+		{globals.MasterSlaveLabel, "node10", 11},
+		{globals.SbTypeMultiple, "node1", 1},
+		{"group-multi-primary", "node3", 3},
+	} {
+		number, err := NodeScriptNumber(data.sbType, data.node)
+		compare.OkIsNil(data.node, err, t)
+		compare.OkEqualInt(data.sbType+" "+data.node, number, data.number, t)
+	}
+	for _, node := range []string{"", "master", "node0", "nodex", "slave1"} {
+		_, err = NodeScriptNumber(globals.SbTypeMultiple, node)
+		compare.OkIsNotNil(node, err, t)
+	}
+
+	for sbType, expected := range map[string]bool{
+		globals.MasterSlaveLabel: true,
+		globals.SbTypeMultiple:   true,
+		"group-single-primary":   true,
+		"fan-in":                 false,
+		"single":                 false,
+	} {
+		err = checkNodeListType(common.SandboxDescription{SBType: sbType, Flavor: common.MySQLFlavor})
+		compare.OkEqualBool(sbType, err == nil, expected, t)
+	}
+	err = checkNodeListType(common.SandboxDescription{SBType: globals.MasterSlaveLabel, Flavor: common.PxcFlavor})
+	compare.OkIsNotNil("pxc flavor", err, t)
+}
+
 func TestCreateSandbox(t *testing.T) {
 	if common.FileExists(defaults.SandboxRegistry) {
 		catalog, err := defaults.ReadCatalog()
@@ -677,7 +1652,17 @@ func TestCreateSandbox(t *testing.T) {
 	t.Run("single", testCreateStandaloneSandbox)
 	t.Run("replication", testCreateReplicationSandbox)
 	t.Run("mock", testCreateMockSandbox)
+	t.Run("mocknodeversions", testCreateMockNodeVersions)
+	t.Run("mockreplicaterminology", testCreateMockReplicaTerminology)
+	t.Run("mockdatadircache", testCreateMockDatadirCache)
+	t.Run("mockportleases", testMockPortLeases)
+	t.Run("mockcluster", testCreateMockInnoDBCluster)
+	t.Run("mockproxysql", testCreateMockProxySQL)
+	t.Run("mockpostgresql", testCreateMockPostgreSQL)
+	// Runs before the TiDB tests, which replace the main templates
+	t.Run("mockmariadb", testCreateMockMariaDb)
 	t.Run("mocktidb", testCreateTidbMockSandbox)
+	t.Run("mocktidbcluster", testCreateTidbClusterMockSandbox)
 	t.Run("expectedFailures", testFailSandboxConditions)
 	t.Run("flavors", testDetectFlavor)
 }
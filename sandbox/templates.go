@@ -21,7 +21,6 @@ package sandbox
 import (
 	_ "embed"
 	"fmt"
-	"os"
 
 	"github.com/datacharmer/dbdeployer/common"
 	"github.com/datacharmer/dbdeployer/defaults"
@@ -125,15 +124,27 @@ var (
 	//go:embed templates/single/semisync_slave_options.gotxt
 	semisyncSlaveOptions string
 
+	//go:embed templates/single/semisync_source_options.gotxt
+	semisyncSourceOptions string
+
+	//go:embed templates/single/semisync_replica_options.gotxt
+	semisyncReplicaOptions string
+
 	//go:embed templates/single/repl_crash_safe_options.gotxt
 	replCrashSafeOptions string
 
+	//go:embed templates/single/repl_crash_safe_options_replica.gotxt
+	replCrashSafeOptionsReplica string
+
 	//go:embed templates/single/gtid_options_56.gotxt
 	gtidOptions56 string
 
 	//go:embed templates/single/gtid_options_57.gotxt
 	gtidOptions57 string
 
+	//go:embed templates/single/gtid_options_mariadb.gotxt
+	gtidOptionsMariaDb string
+
 	//go:embed templates/single/expose_dd_tables.gotxt
 	exposeDdTables string
 
@@ -203,6 +214,16 @@ var (
 			Notes:       "",
 			Contents:    semisyncSlaveOptions,
 		},
+		globals.TmplSemisyncSourceOptions: TemplateDesc{
+			Description: "source semi-synch options for my.cnf 8.0.26+",
+			Notes:       "",
+			Contents:    semisyncSourceOptions,
+		},
+		globals.TmplSemisyncReplicaOptions: TemplateDesc{
+			Description: "replica semi-synch options for my.cnf 8.0.26+",
+			Notes:       "",
+			Contents:    semisyncReplicaOptions,
+		},
 		globals.TmplGtidOptions56: TemplateDesc{
 			Description: "GTID options for my.cnf 5.6.x",
 			Notes:       "",
@@ -213,11 +234,21 @@ var (
 			Notes:       "",
 			Contents:    gtidOptions57,
 		},
+		globals.TmplGtidOptionsMariaDb: TemplateDesc{
+			Description: "GTID options for my.cnf MariaDB 10.0+",
+			Notes:       "",
+			Contents:    gtidOptionsMariaDb,
+		},
 		globals.TmplReplCrashSafeOptions: TemplateDesc{
 			Description: "Replication crash safe options",
 			Notes:       "",
 			Contents:    replCrashSafeOptions,
 		},
+		globals.TmplReplCrashSafeReplica: TemplateDesc{
+			Description: "Replication crash safe options 8.0.26+",
+			Notes:       "",
+			Contents:    replCrashSafeOptionsReplica,
+		},
 		globals.TmplExposeDdTables: TemplateDesc{
 			Description: "Commands needed to enable data dictionary table usage",
 			Notes:       "",
@@ -428,15 +459,20 @@ var (
 	}
 
 	AllTemplates = AllTemplateCollection{
-		"mock":        MockTemplates,
-		"single":      SingleTemplates,
-		"tidb":        TidbTemplates,
-		"import":      ImportTemplates,
-		"multiple":    MultipleTemplates,
-		"replication": ReplicationTemplates,
-		"group":       GroupTemplates,
-		"pxc":         PxcTemplates,
-		"ndb":         NdbTemplates,
+		"mock":         MockTemplates,
+		"single":       SingleTemplates,
+		"tidb":         TidbTemplates,
+		"import":       ImportTemplates,
+		"multiple":     MultipleTemplates,
+		"replication":  ReplicationTemplates,
+		"group":        GroupTemplates,
+		"pxc":          PxcTemplates,
+		"galera":       GaleraTemplates,
+		"ndb":          NdbTemplates,
+		"router":       RouterTemplates,
+		"proxysql":     ProxySQLTemplates,
+		"postgresql":   PostgreSQLTemplates,
+		"tidb-cluster": TidbClusterTemplates,
 	}
 )
 
@@ -467,14 +503,12 @@ func init() {
 			_, found := seen[name]
 			if found {
 				// name already exists:
-				fmt.Printf("Duplicate template %s found in %s\n", name, collName)
-				os.Exit(1)
+				panic(fmt.Sprintf("Duplicate template %s found in %s", name, collName))
 			}
 			seen[name] = true
 			if len(coll[name].Contents) == 0 {
 				// The template is empty
-				fmt.Printf("Template '%s' is empty\n", name)
-				os.Exit(1)
+				panic(fmt.Sprintf("Template '%s' is empty", name))
 			}
 		}
 	}
@@ -0,0 +1,342 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/datacharmer/dbdeployer/common"
+	"github.com/datacharmer/dbdeployer/concurrent"
+	"github.com/datacharmer/dbdeployer/defaults"
+	"github.com/datacharmer/dbdeployer/globals"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Directory of the PD server inside a TiDB cluster sandbox
+	tidbClusterPdDir = "pd1"
+	// Prefix of the TiKV server directories inside a TiDB cluster sandbox
+	tidbClusterTiKVPrefix = "tikv"
+	// Seconds that PD and TiKV start scripts wait for the component to be ready
+	tidbClusterStartupTimeout = 60
+	// Priorities of the start commands in the execution list.
+	// The TiDB servers start with priority 2, after their init_db (priority 0)
+	tidbClusterPdPriority   = 0
+	tidbClusterTiKVPriority = 1
+)
+
+// tidbClusterPorts computes the ports of a TiDB cluster, where the TiDB servers use
+// basePort+1 to basePort+nodes, followed by the PD client and peer ports,
+// and by the server and status ports of each TiKV server
+func tidbClusterPorts(basePort, nodes, tikvNodes int) (tidbPorts []int, pdPort, pdPeerPort int, tikvPorts, tikvStatusPorts []int) {
+	for i := 1; i <= nodes; i++ {
+		tidbPorts = append(tidbPorts, basePort+i)
+	}
+	pdPort = basePort + nodes + 1
+	pdPeerPort = basePort + nodes + 2
+	for j := 1; j <= tikvNodes; j++ {
+		tikvPorts = append(tikvPorts, pdPeerPort+(j*2)-1)
+		tikvStatusPorts = append(tikvStatusPorts, pdPeerPort+(j*2))
+	}
+	return
+}
+
+// writeTidbComponentScripts writes the scripts of a PD or TiKV server in its own directory
+func writeTidbComponentScripts(logger *defaults.Logger, componentDir, startTemplate string, data common.StringMap) error {
+	err := os.Mkdir(componentDir, globals.PublicDirectoryAttr)
+	if err != nil {
+		return err
+	}
+	data["SandboxDir"] = componentDir
+	data["Component"] = path.Base(componentDir)
+	return writeScripts(ScriptBatch{
+		tc:         TidbClusterTemplates,
+		logger:     logger,
+		sandboxDir: componentDir,
+		data:       data,
+		scripts: []ScriptDef{
+			{globals.ScriptStart, startTemplate, true},
+			{globals.ScriptStop, globals.TmplTidbClusterStop, true},
+			{globals.ScriptSendKill, globals.TmplTidbClusterSendKill, true},
+			{globals.ScriptStatus, globals.TmplTidbClusterStatus, true},
+		},
+	})
+}
+
+// CreateTidbCluster deploys a TiDB cluster with one PD server, tikvNodes TiKV servers, and nodes TiDB servers.
+// The components are started in order through the priorities of the execution list:
+// PD, then TiKV, then TiDB
+func CreateTidbCluster(sandboxDef SandboxDef, origin string, nodes int, tikvNodes int, masterIp string) error {
+	var execLists []concurrent.ExecutionList
+
+	var logger *defaults.Logger
+	if sandboxDef.Logger != nil {
+		logger = sandboxDef.Logger
+	} else {
+		var fileName string
+		var err error
+		logger, fileName, err = defaults.NewLogger(common.LogDirName(), "tidb-cluster")
+		if err != nil {
+			return err
+		}
+		sandboxDef.LogFileName = common.ReplaceLiteralHome(fileName)
+		sandboxDef.Logger = logger
+	}
+	if nodes < 1 {
+		return fmt.Errorf("can't run a TiDB cluster without TiDB servers")
+	}
+	if tikvNodes < 1 {
+		return fmt.Errorf("can't run a TiDB cluster with less than 1 TiKV server")
+	}
+	for _, executable := range []string{globals.FnPdServer, globals.FnTiKVServer, globals.FnTiDbServer} {
+		fullPath := path.Join(sandboxDef.Basedir, "bin", executable)
+		if !common.ExecExists(fullPath) {
+			return fmt.Errorf(globals.ErrExecutableNotFound, fullPath)
+		}
+	}
+	// The start scripts check the components through the HTTP API of PD
+	if !sandboxDef.SkipStart && common.Which("curl") == "" {
+		return fmt.Errorf(globals.ErrExecutableNotFound, "curl")
+	}
+
+	vList, err := common.VersionToList(sandboxDef.Version)
+	if err != nil {
+		return err
+	}
+	basePort := computeBaseport(sandboxDef.Port + defaults.Defaults().TidbClusterBasePort + (vList[2] * 100))
+	if sandboxDef.BasePort > 0 {
+		basePort = sandboxDef.BasePort
+	}
+	totalPorts := nodes + 2 + tikvNodes*2
+	firstPort, err := findFreePort(basePort+1, sandboxDef.InstalledPorts, totalPorts)
+	if err != nil {
+		return errors.Wrapf(err, "error detecting free ports for TiDB cluster")
+	}
+	basePort = firstPort - 1
+	tidbPorts, pdPort, pdPeerPort, tikvPorts, tikvStatusPorts := tidbClusterPorts(basePort, nodes, tikvNodes)
+
+	err = os.Mkdir(sandboxDef.SandboxDir, globals.PublicDirectoryAttr)
+	if err != nil {
+		return err
+	}
+	common.AddToCleanupStack(common.RmdirAll, "RmdirAll", sandboxDef.SandboxDir)
+	logger.Printf("Created directory %s\n", sandboxDef.SandboxDir)
+	logger.Printf("TiDB cluster Sandbox Definition: %s\n", sandboxDefToJson(sandboxDef))
+
+	timestamp := time.Now()
+	componentData := func() common.StringMap {
+		return common.StringMap{
+			"ShellPath":      sandboxDef.ShellPath,
+			"Copyright":      globals.ShellScriptCopyright,
+			"AppVersion":     common.VersionDef,
+			"DateTime":       timestamp.Format(time.UnixDate),
+			"Basedir":        sandboxDef.Basedir,
+			"Host":           masterIp,
+			"PdPort":         pdPort,
+			"StartupTimeout": tidbClusterStartupTimeout,
+		}
+	}
+
+	pdData := componentData()
+	pdData["Name"] = tidbClusterPdDir
+	pdData["Port"] = pdPort
+	pdData["PeerPort"] = pdPeerPort
+	pdDir := path.Join(sandboxDef.SandboxDir, tidbClusterPdDir)
+	logger.Printf("Creating PD server in %s\n", pdDir)
+	err = writeTidbComponentScripts(logger, pdDir, globals.TmplTidbClusterPdStart, pdData)
+	if err != nil {
+		return err
+	}
+	if !sandboxDef.SkipStart {
+		execLists = append(execLists, concurrent.ExecutionList{Logger: logger, Priority: tidbClusterPdPriority,
+			Command: concurrent.ExecCommand{Cmd: path.Join(pdDir, globals.ScriptStart), Args: []string{}}})
+	}
+
+	var tikvList []common.StringMap
+	for j := 1; j <= tikvNodes; j++ {
+		tikvName := fmt.Sprintf("%s%d", tidbClusterTiKVPrefix, j)
+		tikvData := componentData()
+		tikvData["Port"] = tikvPorts[j-1]
+		tikvData["StatusPort"] = tikvStatusPorts[j-1]
+		tikvDir := path.Join(sandboxDef.SandboxDir, tikvName)
+		logger.Printf("Creating TiKV server %d in %s\n", j, tikvDir)
+		err = writeTidbComponentScripts(logger, tikvDir, globals.TmplTidbClusterTiKVStart, tikvData)
+		if err != nil {
+			return err
+		}
+		tikvList = append(tikvList, common.StringMap{"Dir": tikvName, "Port": tikvPorts[j-1]})
+		if !sandboxDef.SkipStart {
+			execLists = append(execLists, concurrent.ExecutionList{Logger: logger, Priority: tidbClusterTiKVPriority,
+				Command: concurrent.ExecCommand{Cmd: path.Join(tikvDir, globals.ScriptStart), Args: []string{}}})
+		}
+	}
+
+	nodeLabel := defaults.Defaults().NodePrefix
+	var data = common.StringMap{
+		"ShellPath":    sandboxDef.ShellPath,
+		"Copyright":    globals.ShellScriptCopyright,
+		"AppVersion":   common.VersionDef,
+		"DateTime":     timestamp.Format(time.UnixDate),
+		"SandboxDir":   sandboxDef.SandboxDir,
+		"Host":         masterIp,
+		"PdDir":        tidbClusterPdDir,
+		"PdPort":       pdPort,
+		"NumTiKVNodes": tikvNodes,
+		"TiKVNodes":    tikvList,
+		"Nodes":        []common.StringMap{},
+	}
+
+	allPorts := append([]int{}, tidbPorts...)
+	allPorts = append(allPorts, pdPort, pdPeerPort)
+	for j := range tikvPorts {
+		allPorts = append(allPorts, tikvPorts[j], tikvStatusPorts[j])
+	}
+	sbDesc := common.SandboxDescription{
+		Basedir:       sandboxDef.Basedir,
+		ClientBasedir: sandboxDef.ClientBasedir,
+		SBType:        globals.TiDBClusterLabel,
+		Version:       sandboxDef.Version,
+		Flavor:        common.TiDbFlavor,
+		Host:          masterIp,
+		Port:          allPorts,
+		Nodes:         nodes,
+		NodeNum:       0,
+		LogFile:       sandboxDef.LogFileName,
+	}
+	sbItem := defaults.SandboxItem{
+		Origin:      sandboxDef.Basedir,
+		SBType:      globals.TiDBClusterLabel,
+		Version:     sandboxDef.Version,
+		Flavor:      common.TiDbFlavor,
+		Host:        masterIp,
+		Port:        allPorts,
+		Nodes:       []string{},
+		Destination: sandboxDef.SandboxDir,
+		ExpiresAt:   sandboxDef.ExpiresAt,
+	}
+	if sandboxDef.LogFileName != "" {
+		sbItem.LogDirectory = common.DirName(sandboxDef.LogFileName)
+	}
+
+	for i := 1; i <= nodes; i++ {
+		nodeDef := sandboxDef
+		nodeDef.Flavor = common.TiDbFlavor
+		nodeDef.Port = tidbPorts[i-1]
+		nodeDef.SbHost = masterIp
+		nodeDef.DirName = fmt.Sprintf("%s%d", nodeLabel, i)
+		nodeDef.Prompt = fmt.Sprintf("%s%d", nodeLabel, i)
+		nodeDef.SBType = "tidb-node"
+		nodeDef.NodeNum = i
+		nodeDef.Multi = true
+		nodeDef.LoadGrants = true
+		nodeDef.MorePorts = []int{}
+		// The TiDB servers must start after PD and TiKV: their commands go to the execution list
+		nodeDef.RunConcurrently = true
+		nodeDef.TidbPdAddress = fmt.Sprintf("%s:%d", masterIp, pdPort)
+		data["Nodes"] = append(data["Nodes"].([]common.StringMap), common.StringMap{
+			"Node":       i,
+			"NodePort":   nodeDef.Port,
+			"NodeLabel":  nodeLabel,
+			"SandboxDir": sandboxDef.SandboxDir,
+		})
+		sbItem.Nodes = append(sbItem.Nodes, nodeDef.DirName)
+
+		installationMessage := "Installing and starting %s %d\n"
+		if sandboxDef.SkipStart {
+			installationMessage = "Installing %s %d\n"
+		}
+		common.CondPrintf(installationMessage, nodeLabel, i)
+		logger.Printf(installationMessage, nodeLabel, i)
+		execList, err := CreateChildSandbox(nodeDef)
+		if err != nil {
+			return fmt.Errorf(globals.ErrCreatingSandbox, err)
+		}
+		execLists = append(execLists, execList...)
+		err = writeScript(logger, MultipleTemplates, fmt.Sprintf("n%d", i), globals.TmplNode,
+			sandboxDef.SandboxDir, common.StringMap{
+				"ShellPath":  sandboxDef.ShellPath,
+				"Copyright":  globals.ShellScriptCopyright,
+				"AppVersion": common.VersionDef,
+				"DateTime":   timestamp.Format(time.UnixDate),
+				"Node":       i,
+				"NodeLabel":  nodeLabel,
+				"SandboxDir": sandboxDef.SandboxDir,
+			}, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	logger.Printf("Writing sandbox description in %s\n", sandboxDef.SandboxDir)
+	err = common.WriteSandboxDescription(sandboxDef.SandboxDir, sbDesc)
+	if err != nil {
+		return errors.Wrapf(err, "unable to write sandbox description")
+	}
+	err = defaults.UpdateCatalog(sandboxDef.SandboxDir, sbItem)
+	if err != nil {
+		return errors.Wrapf(err, "unable to update catalog")
+	}
+
+	logger.Printf("Writing TiDB cluster scripts\n")
+	for _, sb := range []ScriptBatch{
+		{
+			tc:         TidbClusterTemplates,
+			logger:     logger,
+			data:       data,
+			sandboxDir: sandboxDef.SandboxDir,
+			scripts: []ScriptDef{
+				{globals.ScriptStartAll, globals.TmplTidbClusterStartAll, true},
+				{globals.ScriptStopAll, globals.TmplTidbClusterStopAll, true},
+				{globals.ScriptSendKillAll, globals.TmplTidbClusterSendKillAll, true},
+				{globals.ScriptStatusAll, globals.TmplTidbClusterStatusAll, true},
+				{globals.ScriptCheckCluster, globals.TmplTidbClusterCheckCluster, true},
+			},
+		},
+		{
+			tc:         MultipleTemplates,
+			logger:     logger,
+			data:       data,
+			sandboxDir: sandboxDef.SandboxDir,
+			scripts: []ScriptDef{
+				{globals.ScriptRestartAll, globals.TmplRestartMulti, true},
+				{globals.ScriptUseAll, globals.TmplUseMulti, true},
+				{globals.ScriptExecAll, globals.TmplExecMulti, true},
+				{globals.ScriptTestSbAll, globals.TmplTestSbMulti, true},
+			},
+		},
+	} {
+		err = writeScripts(sb)
+		if err != nil {
+			return err
+		}
+	}
+
+	logger.Printf("Running parallel tasks\n")
+	concurrent.RunParallelTasksByPriority(execLists)
+	if !sandboxDef.SkipStart {
+		logger.Printf("Checking the cluster through PD\n")
+		out, err := common.RunCmd(path.Join(sandboxDef.SandboxDir, globals.ScriptCheckCluster))
+		if err != nil {
+			return fmt.Errorf("error checking TiDB cluster: %s\n%s", err, out)
+		}
+	}
+	common.CondPrintf("TiDB cluster directory installed in %s\n", common.ReplaceLiteralHome(sandboxDef.SandboxDir))
+	common.CondPrintf("PD: %s:%d - TiKV servers: %d - TiDB servers: %d\n", masterIp, pdPort, tikvNodes, nodes)
+	return nil
+}
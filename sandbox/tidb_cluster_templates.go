@@ -0,0 +1,98 @@
+//go:build go1.16
+// +build go1.16
+
+package sandbox
+
+import (
+	_ "embed"
+
+	"github.com/datacharmer/dbdeployer/globals"
+)
+
+// Templates for the PD and TiKV components of a TiDB cluster.
+// The TiDB servers use the templates of a single TiDB sandbox
+
+var (
+	//go:embed templates/tidb_cluster/pd_start.gotxt
+	tidbClusterPdStartTemplate string
+
+	//go:embed templates/tidb_cluster/tikv_start.gotxt
+	tidbClusterTiKVStartTemplate string
+
+	//go:embed templates/tidb_cluster/component_stop.gotxt
+	tidbClusterStopTemplate string
+
+	//go:embed templates/tidb_cluster/component_send_kill.gotxt
+	tidbClusterSendKillTemplate string
+
+	//go:embed templates/tidb_cluster/component_status.gotxt
+	tidbClusterStatusTemplate string
+
+	//go:embed templates/tidb_cluster/start_all.gotxt
+	tidbClusterStartAllTemplate string
+
+	//go:embed templates/tidb_cluster/stop_all.gotxt
+	tidbClusterStopAllTemplate string
+
+	//go:embed templates/tidb_cluster/send_kill_all.gotxt
+	tidbClusterSendKillAllTemplate string
+
+	//go:embed templates/tidb_cluster/status_all.gotxt
+	tidbClusterStatusAllTemplate string
+
+	//go:embed templates/tidb_cluster/check_cluster.gotxt
+	tidbClusterCheckClusterTemplate string
+
+	TidbClusterTemplates = TemplateCollection{
+		globals.TmplTidbClusterPdStart: TemplateDesc{
+			Description: "Starts the PD server of a TiDB cluster",
+			Notes:       "Waits until the PD health API reports the server as healthy",
+			Contents:    tidbClusterPdStartTemplate,
+		},
+		globals.TmplTidbClusterTiKVStart: TemplateDesc{
+			Description: "Starts a TiKV server of a TiDB cluster",
+			Notes:       "Waits until PD lists the store as 'Up'",
+			Contents:    tidbClusterTiKVStartTemplate,
+		},
+		globals.TmplTidbClusterStop: TemplateDesc{
+			Description: "Stops a PD or TiKV server",
+			Notes:       "",
+			Contents:    tidbClusterStopTemplate,
+		},
+		globals.TmplTidbClusterSendKill: TemplateDesc{
+			Description: "Kills a PD or TiKV server",
+			Notes:       "",
+			Contents:    tidbClusterSendKillTemplate,
+		},
+		globals.TmplTidbClusterStatus: TemplateDesc{
+			Description: "Shows the status of a PD or TiKV server",
+			Notes:       "",
+			Contents:    tidbClusterStatusTemplate,
+		},
+		globals.TmplTidbClusterStartAll: TemplateDesc{
+			Description: "Starts all the components of a TiDB cluster",
+			Notes:       "PD first, then TiKV, then TiDB",
+			Contents:    tidbClusterStartAllTemplate,
+		},
+		globals.TmplTidbClusterStopAll: TemplateDesc{
+			Description: "Stops all the components of a TiDB cluster",
+			Notes:       "TiDB first, then TiKV, then PD",
+			Contents:    tidbClusterStopAllTemplate,
+		},
+		globals.TmplTidbClusterSendKillAll: TemplateDesc{
+			Description: "Kills all the components of a TiDB cluster",
+			Notes:       "",
+			Contents:    tidbClusterSendKillAllTemplate,
+		},
+		globals.TmplTidbClusterStatusAll: TemplateDesc{
+			Description: "Shows the status of all the components of a TiDB cluster",
+			Notes:       "",
+			Contents:    tidbClusterStatusAllTemplate,
+		},
+		globals.TmplTidbClusterCheckCluster: TemplateDesc{
+			Description: "Checks a TiDB cluster through the HTTP API of PD",
+			Notes:       "Reports the PD health and the number of TiKV stores that are up",
+			Contents:    tidbClusterCheckClusterTemplate,
+		},
+	}
+)
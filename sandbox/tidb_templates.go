@@ -21,7 +21,6 @@ package sandbox
 import (
 	_ "embed"
 	"fmt"
-	"os"
 	"regexp"
 
 	"github.com/datacharmer/dbdeployer/globals"
@@ -98,8 +97,7 @@ func init() {
 	re := regexp.MustCompile(`^` + tidbPrefix)
 	for name := range TidbTemplates {
 		if !re.MatchString(name) {
-			fmt.Printf("found template name '%s' that does not start with '%s'\n", name, tidbPrefix)
-			os.Exit(1)
+			panic(fmt.Sprintf("found template name '%s' that does not start with '%s'", name, tidbPrefix))
 		}
 	}
 }
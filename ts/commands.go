@@ -153,7 +153,7 @@ func customCommands() map[string]func(ts *testscript.TestScript, neg bool, args
 
 		// check_sandbox_manifest checks that all the files that should be in a sandbox are present
 		// invoke as "check_sandbox_manifest $sb_dir sandbox_type"
-		// sandbox_type is one of {single|replication|multiple|multi_source|group}
+		// sandbox_type is one of {single|replication|multiple|multi_source|group|circular|chain}
 		"check_sandbox_manifest": checkSandboxManifest,
 	}
 }
@@ -388,4 +388,27 @@ var manifests = map[string]manifest{
 		"regular":   {"sbdescription.json"},
 		"nodes":     []string{"node1", "node2", "node3"},
 	},
+	"circular": {
+		"executable": []string{
+			"check_ring", "exec_all_slaves", "metadata_all", "start_all", "sysbench_ready", "use_all_masters",
+			"clear_all", "initialize_ring", "n1", "status_all", "test_replication", "use_all_slaves",
+			"exec_all", "n2", "replicate_from", "stop_all", "test_sb_all", "wipe_and_restart_all",
+			"exec_all_masters", "n3", "restart_all", "send_kill_all", "sysbench", "use_all",
+		},
+		"directory": {"node1", "node2", "node3"},
+		"regular":   {"sbdescription.json"},
+		"nodes":     []string{"node1", "node2", "node3"},
+	},
+	"chain": {
+		"executable": []string{
+			"check_slaves", "exec_all_slaves", "metadata_all", "start_all", "sysbench_ready", "use_all_masters",
+			"clear_all", "initialize_slaves", "n1", "status_all", "test_replication", "use_all_slaves",
+			"exec_all", "n2", "replicate_from", "stop_all", "test_sb_all", "wipe_and_restart_all",
+			"exec_all_masters", "n3", "n4", "restart_all", "send_kill_all", "sysbench", "use_all",
+			"m", "s1", "s2", "s3",
+		},
+		"directory": {"node1", "node2", "node3", "node4"},
+		"regular":   {"sbdescription.json"},
+		"nodes":     []string{"node1", "node2", "node3", "node4"},
+	},
 }
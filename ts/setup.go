@@ -268,6 +268,8 @@ func buildTests(templateDir, dataDir, label string, data map[string]string) erro
 		"semisync":                  common.SemiSynch,
 		"fan-in":                    common.MultiSource,
 		"all-masters":               common.MultiSource,
+		"circular":                  common.GTID,
+		"chain":                     "",
 	}
 	for _, needed := range []string{"DbVersion", "DbFlavor", "DbPathVer", "Home", "TmpDir"} {
 		neededTxt, ok := data[needed]
@@ -0,0 +1,103 @@
+// DBDeployer - The MySQL Sandbox
+// Copyright © 2006-2022 Giuseppe Maxia
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unpack
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/datacharmer/dbdeployer/common"
+)
+
+// PackTarGz archives a directory into a compressed tarball.
+// The entries in the tarball start with the base name of the directory,
+// so that UnpackTar will re-create it inside the destination.
+// Only directories, regular files, and symbolic links are archived.
+func PackTarGz(sourceDir, tarball string) (err error) {
+	if !common.DirExists(sourceDir) {
+		return fmt.Errorf("directory %s not found", sourceDir)
+	}
+	file, err := os.Create(tarball) // #nosec G304
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := file.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	compressor := gzip.NewWriter(file)
+	writer := tar.NewWriter(compressor)
+
+	parentDir := path.Dir(filepath.Clean(sourceDir))
+	err = filepath.Walk(sourceDir, func(fileName string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		mode := info.Mode()
+		if !mode.IsDir() && !mode.IsRegular() && mode&os.ModeSymlink == 0 {
+			// sockets, pipes, and devices are not archived
+			return nil
+		}
+		linkName := ""
+		if mode&os.ModeSymlink != 0 {
+			linkName, err = os.Readlink(fileName)
+			if err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, linkName)
+		if err != nil {
+			return err
+		}
+		relativeName, err := filepath.Rel(parentDir, fileName)
+		if err != nil {
+			return err
+		}
+		header.Name = relativeName
+		if mode.IsDir() {
+			header.Name += "/"
+		}
+		err = writer.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		if !mode.IsRegular() {
+			return nil
+		}
+		source, err := os.Open(fileName) // #nosec G304
+		if err != nil {
+			return err
+		}
+		defer source.Close() // #nosec G307
+		_, err = io.Copy(writer, source)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+	return compressor.Close()
+}
@@ -338,6 +338,12 @@ func sanitizedName(filename string) string {
 }
 
 func VerifyTarFile(fileName string) error {
+	return VerifyTarFileWithDirs(fileName, nil)
+}
+
+// VerifyTarFileWithDirs is like VerifyTarFile, but it also accepts
+// inner directories with one of the names in alternativeDirs
+func VerifyTarFileWithDirs(fileName string, alternativeDirs []string) error {
 	if !validSuffix(fileName) {
 		return fmt.Errorf("unrecognized archive suffix %s", fileName)
 	}
@@ -391,6 +397,11 @@ func VerifyTarFile(fileName string) error {
 	reSlash := regexp.MustCompile(`/.*`)
 	fileDir = reSlash.ReplaceAllString(fileDir, "")
 
+	for _, dir := range alternativeDirs {
+		if fileDir == dir {
+			return nil
+		}
+	}
 	if fileDir != expectedDirName {
 		return fmt.Errorf("inner directory name different from tarball name\n"+
 			"Expected: %s - Found: %s", expectedDirName, fileDir)